@@ -0,0 +1,291 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrCorrupt  = errors.New("database is corrupt")
+	ErrName     = errors.New("backup name is illegal")
+	ErrNotFound = errors.New("backup not found")
+	ErrBusy     = errors.New("database is busy")
+	ErrDriver   = errors.New("database driver is not sqlite3")
+)
+
+const (
+	prefix = "backup-"
+	ext    = ".db"
+	// 文件名中的时间
+	layout = "20060102-150405"
+)
+
+// 每步复制的页数,步之间释放锁让其他连接读写
+const pages = 100
+
+// 一个备份文件
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Created string `json:"created"`
+}
+
+// 按时间生成备份文件名
+func Name(t time.Time) string {
+	return prefix + t.Format(layout) + ext
+}
+
+// 备份文件路径,name只能是Name生成的文件名
+func Path(dir, name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+		return "", ErrName
+	}
+
+	if _, err := time.Parse(layout, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)); err != nil {
+		return "", ErrName
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// 在线备份dsn的数据库到path,不影响其他连接读写
+// 先写临时文件,检查完整后再改名
+func Backup(dsn, path string, timeout time.Duration) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	if err := copyFile(tmp, dsn, timeout); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := CheckFile(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// 从path的备份恢复到dsn的数据库,其他连接之后读到恢复的数据
+func Restore(dsn, path string, timeout time.Duration) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	if err := CheckFile(path); err != nil {
+		return err
+	}
+
+	return copyFile(dsn, path, timeout)
+}
+
+// 用sqlite备份接口从src复制到dst
+func copyFile(dst, src string, timeout time.Duration) error {
+	dstDB, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+
+	srcDB, err := sql.Open("sqlite3", src)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	ctx := context.Background()
+
+	dstConn, err := dstDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			dc, ok := d.(*sqlite3.SQLiteConn)
+			if !ok {
+				return ErrDriver
+			}
+
+			sc, ok := s.(*sqlite3.SQLiteConn)
+			if !ok {
+				return ErrDriver
+			}
+
+			return step(dc, sc, timeout)
+		})
+	})
+}
+
+func step(dst, src *sqlite3.SQLiteConn, timeout time.Duration) error {
+	b, err := dst.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := b.Step(pages)
+		if err != nil {
+			b.Finish()
+			return err
+		}
+
+		if done {
+			break
+		}
+
+		// 其他连接占用时重试,超时返回
+		if time.Now().After(deadline) {
+			b.Finish()
+			return ErrBusy
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return b.Finish()
+}
+
+// 完整性检查,损坏时返回ErrCorrupt和问题列表
+func Check(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		// 文件头损坏时打开就会失败
+		return []string{err.Error()}, ErrCorrupt
+	}
+	defer rows.Close()
+
+	list := make([]string, 0)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+
+		if v != "ok" {
+			list = append(list, v)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return []string{err.Error()}, ErrCorrupt
+	}
+
+	if len(list) > 0 {
+		return list, ErrCorrupt
+	}
+
+	return nil, nil
+}
+
+// 检查数据库文件
+func CheckFile(dsn string) error {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	list, err := Check(db)
+	if err != nil {
+		if err == ErrCorrupt {
+			return fmt.Errorf("%v: %s", ErrCorrupt, strings.Join(list, "; "))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// 目录中的备份,新的在前
+func List(dir string) ([]*File, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*File{}, nil
+		}
+
+		return nil, err
+	}
+
+	list := make([]*File, 0, len(infos))
+	for _, v := range infos {
+		if v.IsDir() {
+			continue
+		}
+
+		if _, err := Path(dir, v.Name()); err != nil {
+			continue
+		}
+
+		list = append(list, &File{
+			Name:    v.Name(),
+			Size:    v.Size(),
+			Created: v.ModTime().Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	// 文件名按时间生成
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name > list[j].Name
+	})
+
+	return list, nil
+}
+
+// 只保留最新的keep个备份,返回删除的文件名
+// keep不大于0时不删除,exclude中的备份不删除
+func Rotate(dir string, keep int, exclude ...string) ([]string, error) {
+	if keep <= 0 {
+		return []string{}, nil
+	}
+
+	list, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool, len(exclude))
+	for _, v := range exclude {
+		skip[v] = true
+	}
+
+	removed := make([]string, 0)
+	for i := keep; i < len(list); i++ {
+		if skip[list[i].Name] {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, list[i].Name)); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, list[i].Name)
+	}
+
+	return removed, nil
+}
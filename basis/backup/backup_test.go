@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openDB(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func count(t *testing.T, db *sql.DB) int {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM stock`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestPath(t *testing.T) {
+	name := Name(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	if name != "backup-20200102-030405.db" {
+		t.Fatal("name err: ", name)
+	}
+
+	if p, err := Path("dir", name); err != nil || p != filepath.Join("dir", name) {
+		t.Fatal("path err: ", p, err)
+	}
+
+	for _, v := range []string{"../backup-20200102-030405.db", "data.db", "backup-x.db", "backup-20200102-030405.db.tmp"} {
+		if _, err := Path("dir", v); err != ErrName {
+			t.Fatal("path illegal err: ", v, err)
+		}
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "data.db")
+
+	db := openDB(t, dsn)
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE stock (id INTEGER PRIMARY KEY, qty INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, err := db.Exec(`INSERT INTO stock (qty) VALUES (?)`, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 备份时连接保持打开
+	path := filepath.Join(dir, Name(time.Now()))
+	if err := Backup(dsn, path, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM stock WHERE id > 10`); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, db); n != 10 {
+		t.Fatal("delete err: ", n)
+	}
+
+	if err := Restore(dsn, path, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已打开的连接读到恢复的数据
+	if n := count(t, db); n != 100 {
+		t.Fatal("restore err: ", n)
+	}
+
+	if err := Restore(dsn, filepath.Join(dir, Name(time.Now().Add(time.Hour))), time.Second); err != ErrNotFound {
+		t.Fatal("restore not found err: ", err)
+	}
+}
+
+func TestCheckCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "corrupt.db")
+
+	if err := ioutil.WriteFile(path, []byte("this is not a sqlite database file, just some bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openDB(t, path)
+	defer db.Close()
+
+	list, err := Check(db)
+	if err != ErrCorrupt || len(list) == 0 {
+		t.Fatal("check corrupt err: ", list, err)
+	}
+
+	if err := CheckFile(path); err == nil {
+		t.Fatal("check file corrupt err")
+	}
+
+	// 损坏的备份不能恢复
+	name := filepath.Join(dir, Name(time.Now()))
+	if err := os.Rename(path, name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(filepath.Join(dir, "data.db"), name, time.Second); err == nil {
+		t.Fatal("restore corrupt err")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, Name(now.Add(time.Duration(i)*time.Hour))), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 不是备份的文件不处理
+	if err := ioutil.WriteFile(filepath.Join(dir, "data.db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Rotate(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 2 || removed[0] != Name(now.Add(time.Hour)) || removed[1] != Name(now) {
+		t.Fatal("rotate err: ", removed)
+	}
+
+	list, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 3 || list[0].Name != Name(now.Add(4*time.Hour)) {
+		t.Fatal("list err: ", len(list))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "data.db")); err != nil {
+		t.Fatal("rotate other file err: ", err)
+	}
+}
+
+// 备份数已到keep时恢复最旧的备份,恢复前的备份不能把它轮换掉
+func TestRestoreOldest(t *testing.T) {
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "data.db")
+
+	db := openDB(t, dsn)
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE stock (id INTEGER PRIMARY KEY, qty INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	const keep = 3
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < keep; i++ {
+		if _, err := db.Exec(`INSERT INTO stock (qty) VALUES (?)`, i); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Backup(dsn, filepath.Join(dir, Name(now.Add(time.Duration(i)*time.Hour))), time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldest := Name(now)
+
+	// 恢复前备份当前数据库并轮换
+	if err := Backup(dsn, filepath.Join(dir, Name(now.Add(keep*time.Hour))), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Rotate(dir, keep, oldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 0 {
+		t.Fatal("rotate err: ", removed)
+	}
+
+	if err := Restore(dsn, filepath.Join(dir, oldest), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, db); n != 1 {
+		t.Fatal("restore err: ", n)
+	}
+
+	// 下次轮换时正常删除
+	removed, err = Rotate(dir, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 1 || removed[0] != oldest {
+		t.Fatal("rotate err: ", removed)
+	}
+}
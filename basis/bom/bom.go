@@ -0,0 +1,142 @@
+package bom
+
+import (
+	"math"
+)
+
+// 物料清单的一行
+type Line struct {
+	// 清单行ID
+	ItemId int `json:"itemId"`
+	// 清单上的物料
+	MaterialId int `json:"materialId"`
+	// 需求数量
+	Qty int `json:"qty"`
+	// 按顺序尝试的物料,为空时只用清单上的物料
+	Materials []*Material `json:"materials"`
+}
+
+// 可领取的物料
+type Material struct {
+	MaterialId int `json:"materialId"`
+	// 替代1个清单物料需要的数量,0按1
+	Ratio float64 `json:"ratio"`
+}
+
+// 格子库存
+type Stock struct {
+	GridId     int `json:"gridId"`
+	MaterialId int `json:"materialId"`
+	Qty        int `json:"qty"`
+}
+
+// 从一个格子领取
+type Pick struct {
+	ItemId     int `json:"itemId"`
+	MaterialId int `json:"materialId"`
+	GridId     int `json:"gridId"`
+	// 领取物料的数量
+	Qty int `json:"qty"`
+	// 折合清单物料的数量
+	LineQty int `json:"lineQty"`
+	// 替代比例
+	Ratio float64 `json:"ratio"`
+	// 是否为替代物料
+	Substitute bool `json:"substitute"`
+}
+
+// 库存不足的数量
+type Shortfall struct {
+	ItemId     int `json:"itemId"`
+	MaterialId int `json:"materialId"`
+	Qty        int `json:"qty"`
+}
+
+// 按行分配格子,每个物料的格子按stocks的顺序取
+// 同一格子被多行使用时扣减后再分配,不修改stocks
+func Plan(lines []*Line, stocks []*Stock) ([]*Pick, []*Shortfall) {
+	remain := make([]int, len(stocks))
+	for i, v := range stocks {
+		remain[i] = v.Qty
+	}
+
+	picks := []*Pick{}
+	shortfalls := []*Shortfall{}
+
+	for _, line := range lines {
+		need := line.Qty
+		if need <= 0 {
+			continue
+		}
+
+		materials := line.Materials
+		if len(materials) == 0 {
+			materials = []*Material{{MaterialId: line.MaterialId}}
+		}
+
+		for _, m := range materials {
+			for i, v := range stocks {
+				if need == 0 {
+					break
+				}
+
+				if v.MaterialId != m.MaterialId || remain[i] <= 0 {
+					continue
+				}
+
+				// 按比例折算,格子剩余不够替代1个时跳过
+				lineQty := Equivalent(remain[i], m.Ratio)
+				if lineQty > need {
+					lineQty = need
+				}
+
+				if lineQty <= 0 {
+					continue
+				}
+
+				qty := Convert(lineQty, m.Ratio)
+
+				remain[i] -= qty
+				need -= lineQty
+
+				picks = append(picks, &Pick{
+					ItemId:     line.ItemId,
+					MaterialId: m.MaterialId,
+					GridId:     v.GridId,
+					Qty:        qty,
+					LineQty:    lineQty,
+					Ratio:      m.Ratio,
+					Substitute: m.MaterialId != line.MaterialId,
+				})
+			}
+		}
+
+		if need > 0 {
+			shortfalls = append(shortfalls, &Shortfall{
+				ItemId:     line.ItemId,
+				MaterialId: line.MaterialId,
+				Qty:        need,
+			})
+		}
+	}
+
+	return picks, shortfalls
+}
+
+// 替代qty个物料需要的数量,向上取整
+func Convert(qty int, ratio float64) int {
+	if ratio <= 0 {
+		return qty
+	}
+
+	return int(math.Ceil(float64(qty)*ratio - 1e-9))
+}
+
+// qty个替代物料可替代的数量,向下取整
+func Equivalent(qty int, ratio float64) int {
+	if ratio <= 0 {
+		return qty
+	}
+
+	return int(math.Floor(float64(qty)/ratio + 1e-9))
+}
@@ -0,0 +1,108 @@
+package bom
+
+import (
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	stocks := []*Stock{
+		{GridId: 1, MaterialId: 10, Qty: 3},
+		{GridId: 2, MaterialId: 10, Qty: 2},
+		{GridId: 3, MaterialId: 20, Qty: 5},
+	}
+
+	// 跨格子领取
+	picks, shortfalls := Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 4},
+	}, stocks)
+	if len(shortfalls) != 0 || len(picks) != 2 {
+		t.Fatalf("plan err: %d %d", len(picks), len(shortfalls))
+	}
+
+	if picks[0].GridId != 1 || picks[0].Qty != 3 || picks[1].GridId != 2 || picks[1].Qty != 1 {
+		t.Fatalf("picks err: %#v %#v", picks[0], picks[1])
+	}
+
+	// 不修改库存
+	if stocks[0].Qty != 3 {
+		t.Fatal("stocks modified")
+	}
+
+	// 库存不足
+	picks, shortfalls = Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 7},
+	}, stocks)
+	if len(picks) != 2 || len(shortfalls) != 1 || shortfalls[0].Qty != 2 || shortfalls[0].MaterialId != 10 {
+		t.Fatalf("shortfall err: %d %#v", len(picks), shortfalls)
+	}
+
+	// 不足部分用替代物料
+	picks, shortfalls = Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 7, Materials: []*Material{{MaterialId: 10}, {MaterialId: 20}}},
+	}, stocks)
+	if len(shortfalls) != 0 || len(picks) != 3 {
+		t.Fatalf("substitute err: %d %d", len(picks), len(shortfalls))
+	}
+
+	if !picks[2].Substitute || picks[2].MaterialId != 20 || picks[2].Qty != 2 || picks[0].Substitute {
+		t.Fatalf("substitute pick err: %#v", picks[2])
+	}
+
+	// 同一物料多行共用库存
+	picks, shortfalls = Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 4},
+		{ItemId: 2, MaterialId: 10, Qty: 4},
+	}, stocks)
+	if len(shortfalls) != 1 || shortfalls[0].ItemId != 2 || shortfalls[0].Qty != 3 {
+		t.Fatalf("shared err: %#v", shortfalls)
+	}
+
+	if picks[len(picks)-1].GridId != 2 || picks[len(picks)-1].Qty != 1 {
+		t.Fatalf("shared pick err: %#v", picks[len(picks)-1])
+	}
+
+	// 只用指定的替代物料
+	picks, shortfalls = Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 2, Materials: []*Material{{MaterialId: 20}}},
+	}, stocks)
+	if len(shortfalls) != 0 || len(picks) != 1 || picks[0].GridId != 3 || !picks[0].Substitute {
+		t.Fatalf("prefer err: %#v", picks)
+	}
+}
+
+func TestPlanRatio(t *testing.T) {
+	stocks := []*Stock{
+		{GridId: 1, MaterialId: 10, Qty: 1},
+		{GridId: 2, MaterialId: 20, Qty: 5},
+	}
+
+	// 2个替代物料替代1个
+	picks, shortfalls := Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 4, Materials: []*Material{{MaterialId: 10}, {MaterialId: 20, Ratio: 2}}},
+	}, stocks)
+	if len(picks) != 2 || len(shortfalls) != 1 || shortfalls[0].Qty != 1 {
+		t.Fatalf("ratio err: %d %#v", len(picks), shortfalls)
+	}
+
+	if picks[1].Qty != 4 || picks[1].LineQty != 2 {
+		t.Fatalf("ratio pick err: %#v", picks[1])
+	}
+
+	// 1个替代物料替代2个
+	picks, shortfalls = Plan([]*Line{
+		{ItemId: 1, MaterialId: 10, Qty: 3, Materials: []*Material{{MaterialId: 20, Ratio: 0.5}}},
+	}, stocks)
+	if len(shortfalls) != 0 || picks[0].Qty != 2 || picks[0].LineQty != 3 {
+		t.Fatalf("half err: %#v %#v", picks[0], shortfalls)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	if Convert(3, 0) != 3 || Convert(3, 1.5) != 5 || Convert(10, 0.1) != 1 {
+		t.Fatal("convert err")
+	}
+
+	if Equivalent(5, 2) != 2 || Equivalent(1, 0.1) != 10 || Equivalent(5, 0) != 5 {
+		t.Fatal("equivalent err")
+	}
+}
@@ -0,0 +1,233 @@
+package bus
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// 订阅所有事件
+const ALL = "*"
+
+type Event interface {
+	Topic() string
+}
+
+type Handler func(Event) error
+
+// 订阅者
+type subscriber struct {
+	id      int
+	topic   string
+	handler Handler
+	// 异步队列,nil为同步
+	queue chan Event
+}
+
+// 事件统计
+type Stats struct {
+	Published int64 `json:"published"`
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	// 异步队列满丢弃
+	Dropped int64 `json:"dropped"`
+}
+
+type Bus struct {
+	lock  sync.RWMutex
+	seq   int
+	subs  map[string][]*subscriber
+	stats map[string]*Stats
+	wg    sync.WaitGroup
+	// 异步处理出错回调
+	onError func(Event, error)
+}
+
+func New() *Bus {
+	return &Bus{
+		subs:  make(map[string][]*subscriber),
+		stats: make(map[string]*Stats),
+	}
+}
+
+// 设置异步处理出错回调
+func (b *Bus) OnError(fn func(Event, error)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.onError = fn
+}
+
+// 同步订阅,在Publish中按订阅顺序调用
+func (b *Bus) Subscribe(topic string, handler Handler) int {
+	return b.subscribe(topic, handler, nil)
+}
+
+// 异步订阅,每个订阅者一个协程按顺序处理
+func (b *Bus) SubscribeAsync(topic string, handler Handler, size int) int {
+	if size <= 0 {
+		size = 1
+	}
+
+	queue := make(chan Event, size)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		for e := range queue {
+			if err := b.call(handler, e); err != nil {
+				b.lock.RLock()
+				fn := b.onError
+				b.lock.RUnlock()
+
+				if fn != nil {
+					fn(e, err)
+				}
+			}
+		}
+	}()
+
+	return b.subscribe(topic, handler, queue)
+}
+
+func (b *Bus) subscribe(topic string, handler Handler, queue chan Event) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.seq++
+	b.subs[topic] = append(b.subs[topic], &subscriber{
+		id:      b.seq,
+		topic:   topic,
+		handler: handler,
+		queue:   queue,
+	})
+
+	return b.seq
+}
+
+// 取消订阅
+func (b *Bus) Unsubscribe(id int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for topic, subs := range b.subs {
+		for i, sub := range subs {
+			if sub.id != id {
+				continue
+			}
+
+			if sub.queue != nil {
+				close(sub.queue)
+			}
+
+			b.subs[topic] = append(subs[:i:i], subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// 发布事件,返回第一个同步处理错误
+func (b *Bus) Publish(e Event) error {
+	topic := e.Topic()
+
+	b.lock.Lock()
+	stats := b.stat(topic)
+	subs := make([]*subscriber, 0, len(b.subs[topic])+len(b.subs[ALL]))
+	subs = append(subs, b.subs[topic]...)
+	subs = append(subs, b.subs[ALL]...)
+
+	// 持锁入队,避免与Unsubscribe关闭队列冲突
+	for _, sub := range subs {
+		if sub.queue == nil {
+			continue
+		}
+
+		select {
+		case sub.queue <- e:
+		default:
+			atomic.AddInt64(&stats.Dropped, 1)
+		}
+	}
+	b.lock.Unlock()
+
+	atomic.AddInt64(&stats.Published, 1)
+
+	var first error
+	for _, sub := range subs {
+		if sub.queue != nil {
+			continue
+		}
+
+		if err := b.call(sub.handler, e); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// 调用处理,panic视为失败
+func (b *Bus) call(handler Handler, e Event) (err error) {
+	b.lock.Lock()
+	stats := b.stat(e.Topic())
+	b.lock.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("bus handler panic: %v", r)
+		}
+
+		if err != nil {
+			atomic.AddInt64(&stats.Failed, 1)
+		} else {
+			atomic.AddInt64(&stats.Delivered, 1)
+		}
+	}()
+
+	return handler(e)
+}
+
+func (b *Bus) stat(topic string) *Stats {
+	s, ok := b.stats[topic]
+	if !ok {
+		s = &Stats{}
+		b.stats[topic] = s
+	}
+
+	return s
+}
+
+// 各事件统计
+func (b *Bus) Stats() map[string]Stats {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	res := make(map[string]Stats, len(b.stats))
+	for topic, s := range b.stats {
+		res[topic] = Stats{
+			Published: atomic.LoadInt64(&s.Published),
+			Delivered: atomic.LoadInt64(&s.Delivered),
+			Failed:    atomic.LoadInt64(&s.Failed),
+			Dropped:   atomic.LoadInt64(&s.Dropped),
+		}
+	}
+
+	return res
+}
+
+// 关闭异步订阅,等待队列处理完
+func (b *Bus) Close() {
+	b.lock.Lock()
+	for topic, subs := range b.subs {
+		for _, sub := range subs {
+			if sub.queue != nil {
+				close(sub.queue)
+			}
+		}
+		delete(b.subs, topic)
+	}
+	b.lock.Unlock()
+
+	b.wg.Wait()
+}
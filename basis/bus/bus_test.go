@@ -0,0 +1,142 @@
+package bus
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type testEvent struct {
+	topic string
+	n     int
+}
+
+func (e *testEvent) Topic() string {
+	return e.topic
+}
+
+func TestSync(t *testing.T) {
+	b := New()
+
+	var got []int
+	b.Subscribe("a", func(e Event) error {
+		got = append(got, e.(*testEvent).n)
+		return nil
+	})
+
+	var all int
+	b.Subscribe(ALL, func(e Event) error {
+		all++
+		return nil
+	})
+
+	errFail := errors.New("fail")
+	id := b.Subscribe("b", func(e Event) error {
+		return errFail
+	})
+
+	b.Publish(&testEvent{"a", 1})
+	b.Publish(&testEvent{"a", 2})
+
+	if err := b.Publish(&testEvent{"b", 3}); err != errFail {
+		t.Fatal("publish err: ", err)
+	}
+
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatal("got err: ", got)
+	}
+
+	if all != 3 {
+		t.Fatal("all err: ", all)
+	}
+
+	b.Unsubscribe(id)
+	if err := b.Publish(&testEvent{"b", 4}); err != nil {
+		t.Fatal("unsubscribe err: ", err)
+	}
+
+	stats := b.Stats()
+	if stats["a"].Published != 2 || stats["a"].Delivered != 4 {
+		t.Fatal("stats err: ", stats["a"])
+	}
+
+	if stats["b"].Failed != 1 {
+		t.Fatal("stats err: ", stats["b"])
+	}
+}
+
+func TestPanic(t *testing.T) {
+	b := New()
+
+	b.Subscribe("a", func(e Event) error {
+		panic("boom")
+	})
+
+	if err := b.Publish(&testEvent{"a", 1}); err == nil {
+		t.Fatal("panic err")
+	}
+}
+
+func TestAsync(t *testing.T) {
+	b := New()
+
+	var lock sync.Mutex
+	var got []int
+	b.SubscribeAsync("a", func(e Event) error {
+		lock.Lock()
+		got = append(got, e.(*testEvent).n)
+		lock.Unlock()
+		return nil
+	}, 10)
+
+	var failed int
+	b.OnError(func(e Event, err error) {
+		failed++
+	})
+	b.SubscribeAsync("b", func(e Event) error {
+		return errors.New("fail")
+	}, 10)
+
+	for i := 1; i <= 5; i++ {
+		b.Publish(&testEvent{"a", i})
+	}
+	b.Publish(&testEvent{"b", 0})
+
+	b.Close()
+
+	if len(got) != 5 {
+		t.Fatal("got err: ", got)
+	}
+
+	for i, n := range got {
+		if n != i+1 {
+			t.Fatal("order err: ", got)
+		}
+	}
+
+	if failed != 1 {
+		t.Fatal("failed err: ", failed)
+	}
+}
+
+func TestDropped(t *testing.T) {
+	b := New()
+
+	block := make(chan struct{})
+	b.SubscribeAsync("a", func(e Event) error {
+		<-block
+		return nil
+	}, 1)
+
+	// 第1个被处理阻塞,第2个入队,第3个起丢弃
+	for i := 0; i < 5; i++ {
+		b.Publish(&testEvent{"a", i})
+	}
+
+	if b.Stats()["a"].Dropped == 0 {
+		t.Fatal("dropped err")
+	}
+
+	close(block)
+	b.Close()
+}
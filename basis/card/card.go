@@ -0,0 +1,105 @@
+package card
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/tarm/goserial"
+)
+
+// 读卡器类型
+const (
+	// 0x1b协议RFID读卡器
+	RF = "rf"
+	// 键盘模拟(HID行输入)
+	WEDGE = "wedge"
+	// 串口Wiegand转换器
+	WIEGAND = "wiegand"
+)
+
+var (
+	ErrPortLost   = errors.New("card port lost")
+	ErrPortClosed = errors.New("card port closed")
+)
+
+// 刷卡事件
+type Event struct {
+	// 读卡器类型
+	Reader string `json:"reader"`
+	// 卡号,大写十六进制
+	Card string `json:"card"`
+	// 刷卡时间
+	Time time.Time `json:"time"`
+}
+
+// 读卡器
+type Reader interface {
+	// 读卡器类型
+	Name() string
+	// 打开设备
+	Open() error
+	// 阻塞读取卡号,返回错误时由Driver重连
+	ReadCard() (string, error)
+	// 关闭设备
+	Close() error
+}
+
+// 设备端口
+type Port interface {
+	// 打开端口
+	Open() (io.ReadWriteCloser, error)
+	// 端口是否存在,读超时时用于判断设备是否断开
+	Exists() bool
+}
+
+// 串口
+type serialPort struct {
+	cfg *serial.Config
+}
+
+func NewSerialPort(cfg *serial.Config) Port {
+	return &serialPort{
+		cfg: cfg,
+	}
+}
+
+func (p *serialPort) Open() (io.ReadWriteCloser, error) {
+	rw, err := serial.OpenPort(p.cfg)
+	if err != nil {
+		return nil, errors.As(err, p.cfg.Name)
+	}
+
+	return rw, nil
+}
+
+func (p *serialPort) Exists() bool {
+	_, err := os.Stat(p.cfg.Name)
+	return err == nil
+}
+
+// 设备文件,如/dev/hidraw0
+type filePort struct {
+	name string
+}
+
+func NewFilePort(name string) Port {
+	return &filePort{
+		name: name,
+	}
+}
+
+func (p *filePort) Open() (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(p.name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, errors.As(err, p.name)
+	}
+
+	return f, nil
+}
+
+func (p *filePort) Exists() bool {
+	_, err := os.Stat(p.name)
+	return err == nil
+}
@@ -0,0 +1,181 @@
+package card
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// 内存端口
+type testPort struct {
+	data   []byte
+	opened int
+}
+
+type testRw struct {
+	*bytes.Reader
+	written bytes.Buffer
+}
+
+func (rw *testRw) Write(p []byte) (int, error) {
+	return rw.written.Write(p)
+}
+
+func (rw *testRw) Close() error {
+	return nil
+}
+
+func (p *testPort) Open() (io.ReadWriteCloser, error) {
+	p.opened++
+	return &testRw{Reader: bytes.NewReader(p.data)}, nil
+}
+
+func (p *testPort) Exists() bool {
+	return false
+}
+
+func TestRfParser(t *testing.T) {
+	data := []byte{
+		// 无效数据
+		0x00, 0x12,
+		// 卡号 A1B2C3D4
+		HDR, 0x01, 0x00, 0x00, 0x00, 0x04, 0xa1, 0xb2, 0xc3, 0xd4, 0xa1 ^ 0xb2 ^ 0xc3 ^ 0xd4,
+		// 校验错误
+		HDR, 0x01, 0x00, 0x00, 0x00, 0x02, 0x01, 0x02, 0x00,
+		// 卡号 0102
+		HDR, 0x01, 0x00, 0x00, 0x00, 0x02, 0x01, 0x02, 0x03,
+	}
+
+	p := newRfParser()
+
+	cards := make([]string, 0)
+	for _, q := range data {
+		if card, ok := p.Feed(q); ok {
+			cards = append(cards, card)
+		}
+	}
+
+	if len(cards) != 2 || cards[0] != "A1B2C3D4" || cards[1] != "0102" {
+		t.Fatal("cards err: ", cards)
+	}
+}
+
+func TestRfReader(t *testing.T) {
+	port := &testPort{
+		data: []byte{
+			HDR, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0f, 0x0f,
+			HDR, 0x01, 0x00, 0x00, 0x00, 0x01, 0xf0, 0xf0,
+		},
+	}
+
+	r := NewRfReader(port, time.Hour)
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"0F", "F0"} {
+		card, err := r.ReadCard()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if card != want {
+			t.Fatal("card err: ", want, card)
+		}
+	}
+
+	// 端口不存在时读到EOF为断开
+	if _, err := r.ReadCard(); !ErrPortLost.Equal(err) {
+		t.Fatal("err: ", err)
+	}
+
+	written := r.(*rfReader).rw.(*testRw).written.Bytes()
+	if !bytes.Equal(written, NewPollCommand().Bytes()) {
+		t.Fatalf("poll err: %X", written)
+	}
+}
+
+func TestWedgeReader(t *testing.T) {
+	port := &testPort{
+		data: []byte("00a1b2\r\n\n  1234 \n#$%\nlast"),
+	}
+
+	r := NewWedgeReader(port)
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"00A1B2", "1234"} {
+		card, err := r.ReadCard()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if card != want {
+			t.Fatal("card err: ", want, card)
+		}
+	}
+
+	// 不完整的行不上报
+	if _, err := r.ReadCard(); !ErrPortLost.Equal(err) {
+		t.Fatal("err: ", err)
+	}
+}
+
+var wiegandData = []struct {
+	In  string
+	Out string
+	Ok  bool
+}{
+	// 26位: 设施码 0x01, 卡号 0x0203
+	{"10000000100000010000000110", "010203", true},
+	// 校验错误
+	{"00000000100000010000000110", "", false},
+	// 34位: 0x12345678
+	{"1000100100011010001010110011110001", "12345678", true},
+	// 非位串按键盘模拟处理
+	{"abc123", "ABC123", true},
+}
+
+func TestDecodeWiegand(t *testing.T) {
+	for _, v := range wiegandData {
+		card, err := decodeWiegand(v.In)
+		if v.Ok != (err == nil) {
+			t.Fatal("err: ", v.In, err)
+		}
+
+		if card != v.Out {
+			t.Fatal("out err: ", v.In, v.Out, card)
+		}
+	}
+}
+
+func TestDriver(t *testing.T) {
+	port := &testPort{
+		data: []byte("1111\n1111\n2222\n"),
+	}
+
+	d := NewDriver(NewWedgeReader(port), 10*time.Millisecond)
+	d.Start()
+	defer d.Stop()
+
+	cards := make([]string, 0)
+	for len(cards) < 3 {
+		select {
+		case e := <-d.Events():
+			cards = append(cards, e.Card)
+		case <-time.After(time.Second):
+			t.Fatal("timeout: ", cards)
+		}
+	}
+
+	// 重复刷卡去重,断开后重连继续上报
+	if cards[0] != "1111" || cards[1] != "2222" || cards[2] != "1111" {
+		t.Fatal("cards err: ", cards)
+	}
+
+	if port.opened < 2 {
+		t.Fatal("reconnect err: ", port.opened)
+	}
+}
@@ -0,0 +1,142 @@
+package card
+
+import (
+	"sync"
+	"time"
+
+	l "github.com/beego/ms304w-client/basis/log"
+)
+
+var log = l.New("card")
+
+const (
+	// 重连最大间隔
+	maxRetry = 30 * time.Second
+	// 同一张卡重复上报的间隔
+	defaultDebounce = 2 * time.Second
+)
+
+// 读卡驱动,负责打开设备、断线重连和事件分发
+type Driver struct {
+	reader   Reader
+	retry    time.Duration
+	debounce time.Duration
+
+	events chan *Event
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func NewDriver(reader Reader, retry time.Duration) *Driver {
+	if retry <= 0 {
+		retry = time.Second
+	}
+
+	return &Driver{
+		reader:   reader,
+		retry:    retry,
+		debounce: defaultDebounce,
+		events:   make(chan *Event, 16),
+		stop:     make(chan struct{}),
+	}
+}
+
+// 刷卡事件
+func (d *Driver) Events() <-chan *Event {
+	return d.events
+}
+
+func (d *Driver) Start() {
+	go d.run()
+}
+
+func (d *Driver) Stop() {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *Driver) stopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 等待重连,返回false表示已停止
+func (d *Driver) wait(delay time.Duration) bool {
+	select {
+	case <-d.stop:
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+func (d *Driver) run() {
+	defer close(d.events)
+
+	delay := d.retry
+	for !d.stopped() {
+		if err := d.reader.Open(); err != nil {
+			log.Warn(d.reader.Name(), err)
+
+			if !d.wait(delay) {
+				return
+			}
+
+			// 退避重连
+			if delay *= 2; delay > maxRetry {
+				delay = maxRetry
+			}
+
+			continue
+		}
+
+		log.Info(d.reader.Name(), "opened")
+		delay = d.retry
+
+		d.read()
+
+		if err := d.reader.Close(); err != nil {
+			log.Warn(d.reader.Name(), err)
+		}
+
+		if !d.wait(delay) {
+			return
+		}
+	}
+}
+
+// 读卡直到出错或停止
+func (d *Driver) read() {
+	var last string
+	var lastTime time.Time
+
+	for !d.stopped() {
+		card, err := d.reader.ReadCard()
+		if err != nil {
+			log.Warn(d.reader.Name(), err)
+			return
+		}
+
+		now := time.Now()
+
+		// 卡片停留时读卡器会重复上报
+		if card == last && now.Sub(lastTime) < d.debounce {
+			lastTime = now
+			continue
+		}
+
+		last = card
+		lastTime = now
+
+		select {
+		case d.events <- &Event{Reader: d.reader.Name(), Card: card, Time: now}:
+		case <-d.stop:
+			return
+		}
+	}
+}
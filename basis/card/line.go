@@ -0,0 +1,97 @@
+package card
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+// 按行读取的设备,行内容由decode转换为卡号
+type lineReader struct {
+	name   string
+	port   Port
+	decode func(line string) (string, error)
+
+	rw   io.ReadWriteCloser
+	buf  []byte
+	line []byte
+}
+
+func newLineReader(name string, port Port, decode func(string) (string, error)) *lineReader {
+	return &lineReader{
+		name:   name,
+		port:   port,
+		decode: decode,
+		buf:    make([]byte, 64),
+	}
+}
+
+func (r *lineReader) Name() string {
+	return r.name
+}
+
+func (r *lineReader) Open() error {
+	rw, err := r.port.Open()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	r.rw = rw
+	r.line = r.line[:0]
+
+	return nil
+}
+
+func (r *lineReader) ReadCard() (string, error) {
+	if r.rw == nil {
+		return "", errors.As(ErrPortClosed)
+	}
+
+	for {
+		// 已有完整行
+		if i := bytes.IndexAny(r.line, "\r\n"); i >= 0 {
+			line := string(bytes.TrimSpace(r.line[:i]))
+			r.line = append(r.line[:0], r.line[i+1:]...)
+
+			if len(line) == 0 {
+				continue
+			}
+
+			card, err := r.decode(line)
+			if err != nil {
+				// 无效数据丢弃
+				continue
+			}
+
+			return card, nil
+		}
+
+		n, err := r.rw.Read(r.buf)
+		r.line = append(r.line, r.buf[:n]...)
+
+		if err != nil {
+			// 读超时返回EOF
+			if err == io.EOF && r.port.Exists() {
+				continue
+			}
+
+			return "", errors.As(ErrPortLost, err)
+		}
+	}
+}
+
+func (r *lineReader) Close() error {
+	if r.rw == nil {
+		return nil
+	}
+
+	err := r.rw.Close()
+	r.rw = nil
+
+	if err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package card
+
+import (
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+const (
+	// 命令头
+	HDR byte = 0x1b
+	// 寻卡命令码
+	CMD_POLL byte = 0x01
+)
+
+// 写命令
+// var dataArray = []byte{27, 1, 0, 0, 0, 0, 0}
+type Command struct {
+	Hdr   byte // 1命令头 0x1b
+	Cmd   byte // 2命令码
+	Seq   byte // 3命令序号，指定天线板序号 0..
+	State byte // 4命令状态
+	Opt1  byte // 5命令操作码，保留
+	Opt2  byte // 6命令操作码，保留
+	Opt3  byte // 7命令操作码，保留
+}
+
+func NewPollCommand() *Command {
+	return &Command{
+		Hdr: HDR,
+		Cmd: CMD_POLL,
+	}
+}
+
+func (w *Command) Bytes() []byte {
+	return []byte{w.Hdr, w.Cmd, w.Seq, w.State, w.Opt1, w.Opt2, w.Opt3}
+}
+
+// 读数据帧,一次处理一个字节
+type rfParser struct {
+	Hdr   byte   // 命令头 0x1b
+	Cmd   byte   // 命令码
+	Seq   byte   // 命令序号，指定天线板序号 0..
+	State byte   // 命令状态
+	Opt   byte   // 命令操作码，保留
+	Len   byte   // 命令数据长度，不超过255
+	Data  []byte // 命令数据内容
+	Sign  byte   // 校验码,数据内容异或
+	// 当前位置
+	Flag int
+}
+
+func newRfParser() *rfParser {
+	return &rfParser{
+		Data: make([]byte, 0),
+	}
+}
+
+func (p *rfParser) reset() {
+	*p = rfParser{
+		Data: make([]byte, 0),
+	}
+}
+
+// 处理一个字节,帧完整且校验通过时返回卡号
+func (p *rfParser) Feed(q byte) (string, bool) {
+	switch p.Flag {
+	case 0: // 命令头
+		if q == HDR {
+			p.Hdr = q
+			p.Flag++
+		}
+	case 1: // 命令码
+		p.Cmd = q
+		p.Flag++
+	case 2: // 命令序号
+		p.Seq = q
+		p.Flag++
+	case 3: // 命令状态
+		p.State = q
+		p.Flag++
+	case 4: // 命令操作码
+		p.Opt = q
+		p.Flag++
+	case 5: // 命令数据长度
+		p.Len = q
+		if p.Len == 0 {
+			// 没有数据内容
+			p.Flag += 2
+		} else {
+			p.Flag++
+		}
+	case 6: // 数据内容
+		p.Data = append(p.Data, q)
+		p.Sign ^= q
+
+		if int(p.Len) == len(p.Data) {
+			p.Flag++
+		}
+	case 7: // 校验码
+		var card string
+		if p.Sign == q && len(p.Data) > 0 {
+			card = strings.ToUpper(hex.EncodeToString(p.Data))
+		}
+
+		p.reset()
+
+		return card, len(card) > 0
+	default:
+		p.reset()
+	}
+
+	return "", false
+}
+
+// 0x1b协议读卡器,定时发送寻卡命令
+type rfReader struct {
+	port     Port
+	interval time.Duration
+
+	rw     io.ReadWriteCloser
+	parser *rfParser
+	polled time.Time
+	buf    []byte
+	// 未处理的字节
+	pending []byte
+}
+
+func NewRfReader(port Port, interval time.Duration) Reader {
+	return &rfReader{
+		port:     port,
+		interval: interval,
+		buf:      make([]byte, 64),
+	}
+}
+
+func (r *rfReader) Name() string {
+	return RF
+}
+
+func (r *rfReader) Open() error {
+	rw, err := r.port.Open()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	r.rw = rw
+	r.parser = newRfParser()
+	r.polled = time.Time{}
+	r.pending = nil
+
+	return nil
+}
+
+func (r *rfReader) ReadCard() (string, error) {
+	if r.rw == nil {
+		return "", errors.As(ErrPortClosed)
+	}
+
+	for {
+		// 上次读到的剩余字节
+		for len(r.pending) > 0 {
+			q := r.pending[0]
+			r.pending = r.pending[1:]
+
+			if card, ok := r.parser.Feed(q); ok {
+				return card, nil
+			}
+		}
+
+		// 寻卡
+		if time.Since(r.polled) >= r.interval {
+			if _, err := r.rw.Write(NewPollCommand().Bytes()); err != nil {
+				return "", errors.As(ErrPortLost, err)
+			}
+
+			r.polled = time.Now()
+		}
+
+		n, err := r.rw.Read(r.buf)
+		r.pending = append(r.pending, r.buf[:n]...)
+
+		if err != nil {
+			// 串口读超时返回EOF
+			if err == io.EOF && r.port.Exists() {
+				continue
+			}
+
+			return "", errors.As(ErrPortLost, err)
+		}
+	}
+}
+
+func (r *rfReader) Close() error {
+	if r.rw == nil {
+		return nil
+	}
+
+	err := r.rw.Close()
+	r.rw = nil
+
+	if err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package card
+
+import (
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var ErrCardInvalid = errors.New("card invalid")
+
+// 键盘模拟读卡器,每次刷卡输出一行卡号
+func NewWedgeReader(port Port) Reader {
+	return newLineReader(WEDGE, port, decodeWedge)
+}
+
+// 只保留字母数字,统一大写
+func decodeWedge(line string) (string, error) {
+	card := strings.ToUpper(strings.TrimSpace(line))
+	if len(card) == 0 {
+		return "", errors.As(ErrCardInvalid, line)
+	}
+
+	for _, r := range card {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'Z') {
+			return "", errors.As(ErrCardInvalid, line)
+		}
+	}
+
+	return card, nil
+}
@@ -0,0 +1,45 @@
+package card
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var ErrWiegandParity = errors.New("wiegand parity error")
+
+// 串口Wiegand转换器,每帧一行
+// 26/34位原始位串(如 "10101...")校验奇偶后转为十六进制卡号,
+// 其他内容按键盘模拟处理
+func NewWiegandReader(port Port) Reader {
+	return newLineReader(WIEGAND, port, decodeWiegand)
+}
+
+func decodeWiegand(line string) (string, error) {
+	line = strings.TrimSpace(line)
+
+	bits := len(line)
+	if (bits != 26 && bits != 34) || strings.Trim(line, "01") != "" {
+		return decodeWedge(line)
+	}
+
+	half := bits / 2
+
+	// 前半部分偶校验,后半部分奇校验
+	if ones(line[:half])%2 != 0 || ones(line[half:])%2 != 1 {
+		return "", errors.As(ErrWiegandParity, line)
+	}
+
+	var data uint64
+	for _, b := range line[1 : bits-1] {
+		data = data<<1 | uint64(b-'0')
+	}
+
+	// 26位为3字节,34位为4字节
+	return fmt.Sprintf("%0*X", (bits-2)/4, data), nil
+}
+
+func ones(s string) int {
+	return strings.Count(s, "1")
+}
@@ -25,3 +25,15 @@ func Int(key string) int {
 
 	return i
 }
+
+func DefaultString(key, def string) string {
+	return beego.AppConfig.DefaultString(key, def)
+}
+
+func DefaultBool(key string, def bool) bool {
+	return beego.AppConfig.DefaultBool(key, def)
+}
+
+func DefaultInt(key string, def int) int {
+	return beego.AppConfig.DefaultInt(key, def)
+}
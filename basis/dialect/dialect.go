@@ -0,0 +1,171 @@
+package dialect
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// 支持的数据库驱动
+const (
+	SQLITE   = "sqlite3"
+	MYSQL    = "mysql"
+	POSTGRES = "postgres"
+)
+
+var (
+	ErrDriver     = errors.New("db driver is not supported")
+	ErrDropColumn = errors.New("sqlite 3.35 or later is required to drop column")
+)
+
+// 检查驱动是否支持
+func Check(driver string) error {
+	switch driver {
+	case SQLITE, MYSQL, POSTGRES:
+		return nil
+	}
+
+	return ErrDriver
+}
+
+// 补充连接参数
+// mysql开启ANSI_QUOTES,和其他数据库一样用双引号引用order等表名
+func Dsn(driver, dsn string) string {
+	if driver != MYSQL || strings.Contains(dsn, "sql_mode=") {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	return dsn + sep + "sql_mode=" + url.QueryEscape("CONCAT(@@sql_mode, ',ANSI_QUOTES')")
+}
+
+// 默认最大连接数,sqlite写操作只能一个连接
+func MaxOpenConns(driver string) int {
+	if driver == SQLITE {
+		return 1
+	}
+
+	return 50
+}
+
+// 引用表名或列名
+func Quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// 创建索引
+// mysql不支持IF NOT EXISTS,需要先用IndexExistsSql查询
+func CreateIndex(driver, name, table string, columns ...string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, v := range columns {
+		quoted = append(quoted, Quote(v))
+	}
+
+	exists := "IF NOT EXISTS "
+	if driver == MYSQL {
+		exists = ""
+	}
+
+	return "CREATE INDEX " + exists + Quote(name) + " ON " + Quote(table) + " (" + strings.Join(quoted, ", ") + ")"
+}
+
+// 删除索引
+// mysql不支持IF EXISTS,需要先用IndexExistsSql查询
+func DropIndex(driver, name, table string) string {
+	if driver == MYSQL {
+		return "DROP INDEX " + Quote(name) + " ON " + Quote(table)
+	}
+
+	return "DROP INDEX IF EXISTS " + Quote(name)
+}
+
+// mysql查询索引是否存在,参数为表名和索引名
+const IndexExistsSql = `
+SELECT
+    COUNT(*)
+FROM
+    information_schema.statistics
+WHERE
+    table_schema = DATABASE()
+AND
+    table_name = ?
+AND
+    index_name = ?
+`
+
+// 自增主键列的类型
+func AutoPk(driver string) string {
+	switch driver {
+	case MYSQL:
+		return "INTEGER AUTO_INCREMENT NOT NULL PRIMARY KEY"
+	case POSTGRES:
+		return "SERIAL NOT NULL PRIMARY KEY"
+	}
+
+	return "INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT"
+}
+
+// 删除表
+func DropTable(table string) string {
+	return "DROP TABLE IF EXISTS " + Quote(table)
+}
+
+// 添加列,def为类型和约束
+// 都不支持IF NOT EXISTS,需要先用ColumnExistsSql查询
+func AddColumn(table, column, def string) string {
+	return "ALTER TABLE " + Quote(table) + " ADD COLUMN " + Quote(column) + " " + def
+}
+
+// 删除列,sqlite需要3.35以上,先用SqliteVersionSql查询版本
+func DropColumn(table, column string) string {
+	return "ALTER TABLE " + Quote(table) + " DROP COLUMN " + Quote(column)
+}
+
+// sqlite支持删除列的最低版本,主版本*1000+次版本
+const SQLITE_DROP_COLUMN = 3035
+
+// 检查是否支持删除列,version为SqliteVersionSql查询的版本
+func CheckDropColumn(driver string, version int) error {
+	if driver == SQLITE && version < SQLITE_DROP_COLUMN {
+		return ErrDropColumn
+	}
+
+	return nil
+}
+
+// sqlite版本,主版本*1000+次版本
+const SqliteVersionSql = `
+SELECT
+    CAST(SUBSTR(t1.v, 1, INSTR(t1.v, '.') - 1) AS INTEGER) * 1000 +
+    CAST(SUBSTR(t1.v, INSTR(t1.v, '.') + 1) AS INTEGER)
+FROM
+    (SELECT sqlite_version() AS v) AS t1
+`
+
+// 查询列是否存在,参数为表名和列名
+func ColumnExistsSql(driver string) string {
+	switch driver {
+	case MYSQL:
+		return columnExistsSql + "table_schema = DATABASE()"
+	case POSTGRES:
+		return columnExistsSql + "table_schema = current_schema()"
+	}
+
+	return `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+}
+
+const columnExistsSql = `
+SELECT
+    COUNT(*)
+FROM
+    information_schema.columns
+WHERE
+    table_name = ?
+AND
+    column_name = ?
+AND
+    `
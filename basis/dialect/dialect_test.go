@@ -0,0 +1,233 @@
+package dialect
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCheck(t *testing.T) {
+	for _, v := range []string{SQLITE, MYSQL, POSTGRES} {
+		if err := Check(v); err != nil {
+			t.Fatal("check err: ", v, err)
+		}
+	}
+
+	if err := Check("oracle"); err != ErrDriver {
+		t.Fatal("check oracle err: ", err)
+	}
+}
+
+var dsnData = []struct {
+	Driver string
+	In     string
+	Out    string
+}{
+	{SQLITE, "data.db", "data.db"},
+	{POSTGRES, "postgres://u:p@localhost/db", "postgres://u:p@localhost/db"},
+	{MYSQL, "u:p@tcp(localhost)/db", "u:p@tcp(localhost)/db?sql_mode=CONCAT%28%40%40sql_mode%2C+%27%2CANSI_QUOTES%27%29"},
+	{MYSQL, "u:p@tcp(localhost)/db?charset=utf8mb4", "u:p@tcp(localhost)/db?charset=utf8mb4&sql_mode=CONCAT%28%40%40sql_mode%2C+%27%2CANSI_QUOTES%27%29"},
+	// 已指定sql_mode时不修改
+	{MYSQL, "u:p@tcp(localhost)/db?sql_mode=ANSI", "u:p@tcp(localhost)/db?sql_mode=ANSI"},
+}
+
+func TestDsn(t *testing.T) {
+	for _, v := range dsnData {
+		if out := Dsn(v.Driver, v.In); out != v.Out {
+			t.Fatal("dsn err: ", v.Driver, v.In, out)
+		}
+	}
+}
+
+func TestIndexSql(t *testing.T) {
+	if s := CreateIndex(SQLITE, "idx_order_account", "order", "account_id", "created"); s != `CREATE INDEX IF NOT EXISTS "idx_order_account" ON "order" ("account_id", "created")` {
+		t.Fatal("create sqlite err: ", s)
+	}
+
+	if s := CreateIndex(MYSQL, "idx_order_account", "order", "account_id"); s != `CREATE INDEX "idx_order_account" ON "order" ("account_id")` {
+		t.Fatal("create mysql err: ", s)
+	}
+
+	if s := DropIndex(POSTGRES, "idx_order_account", "order"); s != `DROP INDEX IF EXISTS "idx_order_account"` {
+		t.Fatal("drop postgres err: ", s)
+	}
+
+	if s := DropIndex(MYSQL, "idx_order_account", "order"); s != `DROP INDEX "idx_order_account" ON "order"` {
+		t.Fatal("drop mysql err: ", s)
+	}
+}
+
+func TestColumnSql(t *testing.T) {
+	if s := AddColumn("order", "qty", "INTEGER NOT NULL DEFAULT 0"); s != `ALTER TABLE "order" ADD COLUMN "qty" INTEGER NOT NULL DEFAULT 0` {
+		t.Fatal("add column err: ", s)
+	}
+
+	if s := DropColumn("order", "qty"); s != `ALTER TABLE "order" DROP COLUMN "qty"` {
+		t.Fatal("drop column err: ", s)
+	}
+
+	if s := DropTable("order"); s != `DROP TABLE IF EXISTS "order"` {
+		t.Fatal("drop table err: ", s)
+	}
+
+	if err := CheckDropColumn(SQLITE, 3034); err != ErrDropColumn {
+		t.Fatal("check sqlite 3.34 err: ", err)
+	}
+
+	if err := CheckDropColumn(SQLITE, SQLITE_DROP_COLUMN); err != nil {
+		t.Fatal("check sqlite 3.35 err: ", err)
+	}
+
+	if err := CheckDropColumn(MYSQL, 0); err != nil {
+		t.Fatal("check mysql err: ", err)
+	}
+}
+
+// 每种数据库执行一遍,sqlite使用临时文件
+// postgres和mysql需要本地实例,设置TEST_POSTGRES_DSN和TEST_MYSQL_DSN后执行
+func TestMatrix(t *testing.T) {
+	dsns := map[string]string{
+		SQLITE:   filepath.Join(t.TempDir(), "test.db"),
+		POSTGRES: os.Getenv("TEST_POSTGRES_DSN"),
+		MYSQL:    os.Getenv("TEST_MYSQL_DSN"),
+	}
+
+	for driver, dsn := range dsns {
+		driver, dsn := driver, dsn
+
+		t.Run(driver, func(t *testing.T) {
+			if dsn == "" {
+				t.Skip("dsn is empty")
+			}
+
+			db, err := sql.Open(driver, Dsn(driver, dsn))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			testMatrix(t, driver, db)
+		})
+	}
+}
+
+func testMatrix(t *testing.T, driver string, db *sql.DB) {
+	exec := func(s string) {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(s, err)
+		}
+	}
+
+	// 保留字表名
+	exec(`DROP TABLE IF EXISTS "order"`)
+	exec(`CREATE TABLE "order" (id INTEGER NOT NULL PRIMARY KEY, account_id INTEGER NOT NULL DEFAULT 0, created VARCHAR(32) NOT NULL DEFAULT '')`)
+	exec(`INSERT INTO "order" (id, account_id, created) VALUES (1, 7, '2020-01-01 00:00:00'), (2, 7, '2020-01-02 00:00:00')`)
+
+	indexExists := func() bool {
+		if driver != MYSQL {
+			return false
+		}
+
+		var count int
+		if err := db.QueryRow(IndexExistsSql, "order", "idx_order_account").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count > 0
+	}
+
+	// 重复执行
+	for i := 0; i < 2; i++ {
+		if !indexExists() {
+			exec(CreateIndex(driver, "idx_order_account", "order", "account_id", "created"))
+		}
+	}
+
+	// 按天分组
+	var day string
+	var qty int
+	if err := db.QueryRow(`SELECT SUBSTR(t1.created, 1, 10) AS day, COUNT(*) AS qty FROM "order" AS t1 GROUP BY SUBSTR(t1.created, 1, 10) ORDER BY day DESC LIMIT 1`).Scan(&day, &qty); err != nil {
+		t.Fatal(err)
+	}
+
+	if day != "2020-01-02" || qty != 1 {
+		t.Fatal("group err: ", day, qty)
+	}
+
+	// 自增主键和增删列
+	exec(DropTable("order_log"))
+	exec(`CREATE TABLE "order_log" ("id" ` + AutoPk(driver) + `, "note" VARCHAR(255) NOT NULL DEFAULT '')`)
+	exec(`INSERT INTO "order_log" ("note") VALUES ('a'), ('b')`)
+
+	columnExists := func() bool {
+		var count int
+		if err := db.QueryRow(ColumnExistsSql(driver), "order_log", "qty").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count > 0
+	}
+
+	if columnExists() {
+		t.Fatal("column exists before add")
+	}
+
+	exec(AddColumn("order_log", "qty", "INTEGER NOT NULL DEFAULT 0"))
+	if !columnExists() {
+		t.Fatal("column not exists after add")
+	}
+
+	if ids := queryIds(t, db, `SELECT "id" FROM "order_log" WHERE "qty" = 0 ORDER BY "id"`); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatal("auto pk err: ", ids)
+	}
+
+	// sqlite低于3.35不能删除列
+	var version int
+	if driver == SQLITE {
+		if err := db.QueryRow(SqliteVersionSql).Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if CheckDropColumn(driver, version) == nil {
+		exec(DropColumn("order_log", "qty"))
+		if columnExists() {
+			t.Fatal("column exists after drop")
+		}
+	}
+
+	exec(DropTable("order_log"))
+	exec(DropTable("order_log"))
+
+	if driver != MYSQL || indexExists() {
+		exec(DropIndex(driver, "idx_order_account", "order"))
+	}
+
+	exec(`DROP TABLE "order"`)
+}
+
+func queryIds(t *testing.T, db *sql.DB, s string, args ...interface{}) []int {
+	rows, err := db.Query(s, args...)
+	if err != nil {
+		t.Fatal(s, err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ids
+}
@@ -155,7 +155,11 @@ func caller() string {
 
 	fields := strings.Split(file, "/")
 
-	filename := strings.Join(fields[len(fields)-2:], "/")
+	// 包初始化时文件为<autogenerated>
+	filename := file
+	if len(fields) >= 2 {
+		filename = strings.Join(fields[len(fields)-2:], "/")
+	}
 
 	at = me.Name() + "(file:" + filename + ",line:" + fmt.Sprintf("%d", line) + ")"
 	return at
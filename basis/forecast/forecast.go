@@ -0,0 +1,107 @@
+package forecast
+
+import (
+	"math"
+)
+
+// 用量统计
+type Usage struct {
+	// 统计天数,没有领料的天按0计
+	Days int `json:"days"`
+	// 总用量
+	Total int `json:"total"`
+	// 日均用量
+	Avg float64 `json:"avg"`
+	// 单日最大用量
+	Peak int `json:"peak"`
+	// 有领料的天数
+	ActiveDays int `json:"activeDays"`
+}
+
+// 按天统计,daily为有领料的日用量,days为统计窗口天数
+func Compute(daily []int, days int) *Usage {
+	u := &Usage{
+		Days: days,
+	}
+
+	for _, v := range daily {
+		if v <= 0 {
+			continue
+		}
+
+		u.Total += v
+		u.ActiveDays++
+		if v > u.Peak {
+			u.Peak = v
+		}
+	}
+
+	// 窗口小于有领料的天数时以实际天数为准
+	if u.Days < u.ActiveDays {
+		u.Days = u.ActiveDays
+	}
+
+	if u.Days > 0 {
+		u.Avg = float64(u.Total) / float64(u.Days)
+	}
+
+	return u
+}
+
+// 建议值
+type Suggestion struct {
+	// 交货期(天)
+	LeadTime int `json:"leadTime"`
+	// 交货期内需求
+	LeadTimeDemand float64 `json:"leadTimeDemand"`
+	// 安全库存
+	SafeQty int `json:"safeQty"`
+	// 订货点
+	ReorderQty int `json:"reorderQty"`
+}
+
+// 最大最小法:
+// 交货期需求 = 日均 * 交货期
+// 安全库存 = (单日最大 - 日均) * 交货期
+// 订货点 = 交货期需求 + 安全库存
+// maxQty大于0时不超过格子容量
+func Suggest(u *Usage, leadTime, maxQty int) *Suggestion {
+	s := &Suggestion{
+		LeadTime: leadTime,
+	}
+
+	if u == nil || leadTime <= 0 {
+		return s
+	}
+
+	s.LeadTimeDemand = round(u.Avg * float64(leadTime))
+
+	safe := (float64(u.Peak) - u.Avg) * float64(leadTime)
+	if safe < 0 {
+		safe = 0
+	}
+
+	s.SafeQty = ceil(safe)
+	s.ReorderQty = ceil(s.LeadTimeDemand + safe)
+
+	if maxQty > 0 {
+		if s.ReorderQty > maxQty {
+			s.ReorderQty = maxQty
+		}
+		if s.SafeQty > s.ReorderQty {
+			s.SafeQty = s.ReorderQty
+		}
+	}
+
+	return s
+}
+
+// 保留两位小数
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// 向上取整,忽略浮点误差
+func ceil(v float64) int {
+	return int(math.Ceil(v - 1e-9))
+}
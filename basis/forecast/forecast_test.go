@@ -0,0 +1,48 @@
+package forecast
+
+import (
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	u := Compute([]int{2, 0, 6, 4}, 10)
+	if u.Days != 10 || u.Total != 12 || u.Peak != 6 || u.ActiveDays != 3 {
+		t.Fatalf("compute err: %#v", u)
+	}
+
+	if u.Avg != 1.2 {
+		t.Fatal("avg err: ", u.Avg)
+	}
+
+	// 窗口小于实际天数
+	u = Compute([]int{1, 1, 1}, 2)
+	if u.Days != 3 || u.Avg != 1 {
+		t.Fatalf("days err: %#v", u)
+	}
+
+	u = Compute(nil, 0)
+	if u.Avg != 0 || u.Peak != 0 {
+		t.Fatalf("empty err: %#v", u)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	u := &Usage{Days: 10, Total: 12, Avg: 1.2, Peak: 6}
+
+	s := Suggest(u, 5, 0)
+	if s.LeadTimeDemand != 6 || s.SafeQty != 24 || s.ReorderQty != 30 {
+		t.Fatalf("suggest err: %#v", s)
+	}
+
+	// 不超过格子容量
+	s = Suggest(u, 5, 20)
+	if s.ReorderQty != 20 || s.SafeQty != 20 {
+		t.Fatalf("max err: %#v", s)
+	}
+
+	// 没有交货期
+	s = Suggest(u, 0, 0)
+	if s.SafeQty != 0 || s.ReorderQty != 0 {
+		t.Fatalf("lead time err: %#v", s)
+	}
+}
@@ -0,0 +1,132 @@
+package fusion
+
+import (
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+// 传感器类型
+const (
+	WEIGHT     = "weight"
+	ULTRASONIC = "ultrasonic"
+	IMAGE      = "image"
+	RFID       = "rfid"
+)
+
+var ErrNoReading = errors.New("fusion no reading")
+
+// 单个通道读数
+type Reading struct {
+	// 传感器类型
+	Kind string `json:"kind"`
+	// 通道
+	Channel int `json:"channel"`
+	// 原始值
+	Value int `json:"value"`
+	// 换算数量
+	Qty int `json:"qty"`
+}
+
+// 融合规则
+type Rule struct {
+	// 主传感器
+	Primary string `json:"primary"`
+	// 校验传感器,为空不校验
+	Check string `json:"check"`
+	// 允许相差数量
+	Tolerance int `json:"tolerance"`
+}
+
+// 融合结果
+type Result struct {
+	Qty int `json:"qty"`
+	// 确定数量的传感器
+	Source []string `json:"source"`
+	// 主传感器和校验传感器不一致
+	Disagree bool       `json:"disagree"`
+	Readings []*Reading `json:"readings"`
+}
+
+// 同类传感器多个通道数量相加
+func Sum(readings []*Reading, kind string) (int, bool) {
+	var qty int
+	var ok bool
+
+	for _, v := range readings {
+		if v.Kind == kind {
+			qty += v.Qty
+			ok = true
+		}
+	}
+
+	return qty, ok
+}
+
+// 主传感器优先,校验传感器超出误差时标记不一致,主传感器无读数时用校验传感器
+func Fuse(rule *Rule, readings []*Reading) (*Result, error) {
+	res := &Result{
+		Source:   make([]string, 0),
+		Readings: readings,
+	}
+
+	primary, hasPrimary := Sum(readings, rule.Primary)
+
+	var check int
+	var hasCheck bool
+	if len(rule.Check) > 0 && rule.Check != rule.Primary {
+		check, hasCheck = Sum(readings, rule.Check)
+	}
+
+	switch {
+	case !hasPrimary && !hasCheck:
+		return nil, errors.As(ErrNoReading, rule.Primary, rule.Check)
+
+	case !hasPrimary:
+		res.Qty = check
+		res.Source = append(res.Source, rule.Check)
+
+	case !hasCheck:
+		res.Qty = primary
+		res.Source = append(res.Source, rule.Primary)
+
+	default:
+		res.Qty = primary
+		res.Source = append(res.Source, rule.Primary)
+
+		diff := primary - check
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if diff > rule.Tolerance {
+			res.Disagree = true
+		} else {
+			res.Source = append(res.Source, rule.Check)
+		}
+	}
+
+	return res, nil
+}
+
+// 按单个重量换算数量,余数在误差范围内算一个
+func WeightQty(value, unit, comeUp, lower int) int {
+	if value <= 0 || unit <= 0 {
+		return 0
+	}
+
+	minQty := unit - lower
+	maxQty := unit + comeUp
+
+	num := value / unit
+	subQty := value - num*unit
+
+	if minQty <= subQty && subQty <= maxQty {
+		return num + 1
+	}
+
+	return num
+}
+
+// 按测距换算堆叠数量,empty为空格子距离
+func HeightQty(empty, distance, unit, comeUp, lower int) int {
+	return WeightQty(empty-distance, unit, comeUp, lower)
+}
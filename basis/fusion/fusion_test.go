@@ -0,0 +1,82 @@
+package fusion
+
+import (
+	"testing"
+)
+
+var weightData = []struct {
+	Value  int
+	Unit   int
+	ComeUp int
+	Lower  int
+	Out    int
+}{
+	{0, 100, 5, 5, 0},
+	{300, 100, 5, 5, 3},
+	{296, 100, 5, 5, 3},
+	{395, 100, 5, 5, 4},
+	{250, 100, 5, 5, 2},
+	{100, 0, 5, 5, 0},
+}
+
+func TestWeightQty(t *testing.T) {
+	for _, v := range weightData {
+		qty := WeightQty(v.Value, v.Unit, v.ComeUp, v.Lower)
+		if qty != v.Out {
+			t.Fatal("out err: ", v.Value, v.Out, qty)
+		}
+	}
+}
+
+func TestHeightQty(t *testing.T) {
+	if qty := HeightQty(500, 200, 100, 5, 5); qty != 3 {
+		t.Fatal("out err: ", qty)
+	}
+
+	if qty := HeightQty(500, 510, 100, 5, 5); qty != 0 {
+		t.Fatal("out err: ", qty)
+	}
+}
+
+var fuseData = []struct {
+	Rule     *Rule
+	Readings []*Reading
+	Qty      int
+	Source   int
+	Disagree bool
+	Err      bool
+}{
+	// 只有主传感器
+	{&Rule{Primary: WEIGHT}, []*Reading{{Kind: WEIGHT, Qty: 3}}, 3, 1, false, false},
+	// 多通道相加,校验一致
+	{&Rule{Primary: WEIGHT, Check: IMAGE}, []*Reading{{Kind: WEIGHT, Qty: 2}, {Kind: WEIGHT, Qty: 1}, {Kind: IMAGE, Qty: 3}}, 3, 2, false, false},
+	// 误差范围内
+	{&Rule{Primary: WEIGHT, Check: ULTRASONIC, Tolerance: 1}, []*Reading{{Kind: WEIGHT, Qty: 3}, {Kind: ULTRASONIC, Qty: 4}}, 3, 2, false, false},
+	// 不一致
+	{&Rule{Primary: WEIGHT, Check: RFID}, []*Reading{{Kind: WEIGHT, Qty: 3}, {Kind: RFID, Qty: 5}}, 3, 1, true, false},
+	// 主传感器无读数
+	{&Rule{Primary: WEIGHT, Check: RFID}, []*Reading{{Kind: RFID, Qty: 5}}, 5, 1, false, false},
+	// 无读数
+	{&Rule{Primary: WEIGHT}, []*Reading{{Kind: IMAGE, Qty: 5}}, 0, 0, false, true},
+}
+
+func TestFuse(t *testing.T) {
+	for i, v := range fuseData {
+		res, err := Fuse(v.Rule, v.Readings)
+		if v.Err {
+			if !ErrNoReading.Equal(err) {
+				t.Fatal("err: ", i, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		if res.Qty != v.Qty || len(res.Source) != v.Source || res.Disagree != v.Disagree {
+			t.Fatal("out err: ", i, res.Qty, res.Source, res.Disagree)
+		}
+	}
+}
@@ -32,6 +32,12 @@ type Request struct {
 	Path       string
 	Values     Values
 	PostValues PostValues
+	// 自定义请求头
+	Headers map[string]string
+	// 原始请求体,不为nil时不序列化PostValues
+	RawBody []byte
+	// 超时,0使用默认
+	Timeout time.Duration
 }
 
 func (r *Request) init() {
@@ -57,6 +63,24 @@ func (r *Request) PostQuerys(m PostValues) *Request {
 	return r
 }
 
+func (r *Request) Header(k, v string) *Request {
+	if r.Headers == nil {
+		r.Headers = make(map[string]string)
+	}
+	r.Headers[k] = v
+	return r
+}
+
+func (r *Request) Body(body []byte) *Request {
+	r.RawBody = body
+	return r
+}
+
+func (r *Request) WithTimeout(timeout time.Duration) *Request {
+	r.Timeout = timeout
+	return r
+}
+
 func (r Request) End() ([]byte, error) {
 	resp, err := r.do()
 	if err != nil {
@@ -82,6 +106,12 @@ func (r *Request) do() (resp *http.Response, err error) {
 	}
 
 	client := DefaultClient()
+	if r.Timeout > 0 {
+		client = &http.Client{
+			Timeout: r.Timeout,
+		}
+	}
+
 	switch r.Method {
 	case "GET":
 		uri := r.Path
@@ -89,15 +119,26 @@ func (r *Request) do() (resp *http.Response, err error) {
 		if len(query) > 0 {
 			uri = uri + "?" + query
 		}
-		resp, err = client.Get(uri)
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range r.Headers {
+			req.Header.Set(k, v)
+		}
+		return client.Do(req)
 
 	case "POST", "PUT":
 		// resp, err = client.PostForm(r.Path, values)
 
 		// marshal
-		jsonBytes, err := json.Marshal(r.PostValues)
-		if err != nil {
-			return nil, err
+		jsonBytes := r.RawBody
+		if jsonBytes == nil {
+			jsonBytes, err = json.Marshal(r.PostValues)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		req, err := http.NewRequest(r.Method, r.Path, bytes.NewBuffer(jsonBytes))
@@ -107,7 +148,10 @@ func (r *Request) do() (resp *http.Response, err error) {
 
 		req.Header.Set("X-Custom-Header", "admin-supplier")
 		req.Header.Set("Content-Type", "application/json")
-		resp, err = client.Do(req)
+		for k, v := range r.Headers {
+			req.Header.Set(k, v)
+		}
+		return client.Do(req)
 
 	case "DELETE":
 		req, err := http.NewRequest("DELETE", r.Path, nil)
@@ -117,7 +161,7 @@ func (r *Request) do() (resp *http.Response, err error) {
 
 		req.Header.Set("X-Custom-Header", "admin-supplier")
 		req.Header.Set("Content-Type", "application/json")
-		resp, err = client.Do(req)
+		return client.Do(req)
 	}
 
 	if err != nil {
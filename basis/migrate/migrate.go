@@ -0,0 +1,195 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrVersionIllegal   = errors.New("migration version is illegal")
+	ErrVersionDuplicate = errors.New("migration version duplicate")
+	ErrVersionUnknown   = errors.New("migration version unknown")
+	ErrIrreversible     = errors.New("migration is irreversible")
+)
+
+// 在迁移的事务中执行SQL
+// 检查表、列或索引是否存在也要用Count,sqlite只有一个连接
+type Execer interface {
+	// 数据库驱动,决定DDL的写法
+	Driver() string
+	Exec(sql string, args ...interface{}) error
+	// 查询一个整数
+	Count(sql string, args ...interface{}) (int, error)
+}
+
+// 一个版本的迁移,版本号从1开始递增
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ex Execer) error
+	// 为空时不能回滚
+	Down func(ex Execer) error
+}
+
+// 版本记录,由数据库实现
+type Store interface {
+	// 创建版本表
+	Init() error
+	// 已执行的版本和执行时间
+	Applied() (map[int]string, error)
+	// 在一个事务中执行迁移并记录或删除版本
+	Apply(m *Migration, up bool) error
+}
+
+// 版本状态
+type Status struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	// 执行时间,未执行为空
+	AppliedAt string `json:"appliedAt"`
+}
+
+type Migrator struct {
+	store Store
+	list  []*Migration
+}
+
+// 按版本排序,版本必须大于0且不重复
+func New(store Store, list ...*Migration) (*Migrator, error) {
+	sorted := make([]*Migration, len(list))
+	copy(sorted, list)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i, v := range sorted {
+		if v.Version <= 0 || v.Up == nil {
+			return nil, ErrVersionIllegal
+		}
+
+		if i > 0 && sorted[i-1].Version == v.Version {
+			return nil, ErrVersionDuplicate
+		}
+	}
+
+	return &Migrator{store: store, list: sorted}, nil
+}
+
+// 最新版本
+func (m *Migrator) Latest() int {
+	if len(m.list) == 0 {
+		return 0
+	}
+
+	return m.list[len(m.list)-1].Version
+}
+
+func (m *Migrator) applied() (map[int]string, error) {
+	if err := m.store.Init(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.store.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	// 数据库版本比程序新时不能迁移
+	known := make(map[int]bool, len(m.list))
+	for _, v := range m.list {
+		known[v.Version] = true
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return nil, ErrVersionUnknown
+		}
+	}
+
+	return applied, nil
+}
+
+// 按版本顺序执行未执行的迁移,target为0时到最新版本
+// 返回执行的迁移
+func (m *Migrator) Up(target int) ([]*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	if target <= 0 {
+		target = m.Latest()
+	}
+
+	done := make([]*Migration, 0)
+	for _, v := range m.list {
+		if v.Version > target {
+			break
+		}
+
+		if _, ok := applied[v.Version]; ok {
+			continue
+		}
+
+		if err := m.store.Apply(v, true); err != nil {
+			return done, fmt.Errorf("migration %d %s: %v", v.Version, v.Name, err)
+		}
+
+		done = append(done, v)
+	}
+
+	return done, nil
+}
+
+// 从最新版本开始回滚steps个已执行的迁移
+// 返回回滚的迁移
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]*Migration, 0)
+	for i := len(m.list) - 1; i >= 0 && len(done) < steps; i-- {
+		v := m.list[i]
+		if _, ok := applied[v.Version]; !ok {
+			continue
+		}
+
+		if v.Down == nil {
+			return done, ErrIrreversible
+		}
+
+		if err := m.store.Apply(v, false); err != nil {
+			return done, fmt.Errorf("migration %d %s: %v", v.Version, v.Name, err)
+		}
+
+		done = append(done, v)
+	}
+
+	return done, nil
+}
+
+// 所有迁移的状态
+func (m *Migrator) Status() ([]*Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Status, 0, len(m.list))
+	for _, v := range m.list {
+		at, ok := applied[v.Version]
+		list = append(list, &Status{
+			Version:   v.Version,
+			Name:      v.Name,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+
+	return list, nil
+}
@@ -0,0 +1,230 @@
+package migrate
+
+import (
+	"fmt"
+	"testing"
+)
+
+// 内存中的版本记录
+type memStore struct {
+	applied map[int]string
+	sqls    []string
+	fail    int
+}
+
+func (s *memStore) Init() error {
+	if s.applied == nil {
+		s.applied = make(map[int]string)
+	}
+	return nil
+}
+
+func (s *memStore) Applied() (map[int]string, error) {
+	applied := make(map[int]string, len(s.applied))
+	for k, v := range s.applied {
+		applied[k] = v
+	}
+	return applied, nil
+}
+
+func (s *memStore) Exec(sql string, args ...interface{}) error {
+	s.sqls = append(s.sqls, sql)
+	return nil
+}
+
+func (s *memStore) Driver() string {
+	return "sqlite3"
+}
+
+func (s *memStore) Count(sql string, args ...interface{}) (int, error) {
+	return 0, nil
+}
+
+func (s *memStore) Apply(m *Migration, up bool) error {
+	if m.Version == s.fail {
+		return fmt.Errorf("fail %d", m.Version)
+	}
+
+	if up {
+		if err := m.Up(s); err != nil {
+			return err
+		}
+		s.applied[m.Version] = "2020-01-01 00:00:00"
+		return nil
+	}
+
+	if err := m.Down(s); err != nil {
+		return err
+	}
+	delete(s.applied, m.Version)
+	return nil
+}
+
+func sqlMigration(version int, down bool) *Migration {
+	m := &Migration{
+		Version: version,
+		Name:    fmt.Sprintf("m%d", version),
+		Up: func(ex Execer) error {
+			return ex.Exec(fmt.Sprintf("up %d", version))
+		},
+	}
+
+	if down {
+		m.Down = func(ex Execer) error {
+			return ex.Exec(fmt.Sprintf("down %d", version))
+		}
+	}
+
+	return m
+}
+
+func versions(list []*Migration) []int {
+	out := make([]int, 0, len(list))
+	for _, v := range list {
+		out = append(out, v.Version)
+	}
+	return out
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(&memStore{}, sqlMigration(1, true), sqlMigration(1, true)); err != ErrVersionDuplicate {
+		t.Fatal("duplicate err: ", err)
+	}
+
+	if _, err := New(&memStore{}, sqlMigration(0, true)); err != ErrVersionIllegal {
+		t.Fatal("illegal err: ", err)
+	}
+
+	m, err := New(&memStore{}, sqlMigration(3, true), sqlMigration(1, true), sqlMigration(2, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Latest() != 3 {
+		t.Fatal("latest err: ", m.Latest())
+	}
+}
+
+func TestUp(t *testing.T) {
+	store := &memStore{}
+
+	m, err := New(store, sqlMigration(2, true), sqlMigration(1, true), sqlMigration(3, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(versions(done)) != "[1 2]" {
+		t.Fatal("up target err: ", versions(done))
+	}
+
+	done, err = m.Up(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(versions(done)) != "[3]" {
+		t.Fatal("up latest err: ", versions(done))
+	}
+
+	// 已是最新
+	done, err = m.Up(0)
+	if err != nil || len(done) != 0 {
+		t.Fatal("up again err: ", versions(done), err)
+	}
+
+	if fmt.Sprint(store.sqls) != "[up 1 up 2 up 3]" {
+		t.Fatal("sqls err: ", store.sqls)
+	}
+}
+
+func TestUpFail(t *testing.T) {
+	store := &memStore{fail: 2}
+
+	m, err := New(store, sqlMigration(1, true), sqlMigration(2, true), sqlMigration(3, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 失败后停止,不执行后面的版本
+	done, err := m.Up(0)
+	if err == nil {
+		t.Fatal("fail err")
+	}
+
+	if fmt.Sprint(versions(done)) != "[1]" {
+		t.Fatal("fail done err: ", versions(done))
+	}
+
+	if _, ok := store.applied[3]; ok {
+		t.Fatal("fail applied err")
+	}
+}
+
+func TestDown(t *testing.T) {
+	store := &memStore{}
+
+	m, err := New(store, sqlMigration(1, false), sqlMigration(2, true), sqlMigration(3, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Down(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(versions(done)) != "[3]" {
+		t.Fatal("down err: ", versions(done))
+	}
+
+	// 1不能回滚
+	done, err = m.Down(5)
+	if err != ErrIrreversible {
+		t.Fatal("irreversible err: ", err)
+	}
+
+	if fmt.Sprint(versions(done)) != "[2]" {
+		t.Fatal("down irreversible err: ", versions(done))
+	}
+}
+
+func TestStatus(t *testing.T) {
+	store := &memStore{}
+
+	m, err := New(store, sqlMigration(1, true), sqlMigration(2, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(1); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || !list[0].Applied || list[0].AppliedAt == "" || list[1].Applied {
+		t.Fatal("status err: ", list[0], list[1])
+	}
+
+	// 数据库版本比程序新
+	store.applied[9] = "2020-01-01 00:00:00"
+	if _, err := m.Status(); err != ErrVersionUnknown {
+		t.Fatal("unknown err: ", err)
+	}
+
+	if _, err := m.Up(0); err != ErrVersionUnknown {
+		t.Fatal("unknown up err: ", err)
+	}
+}
@@ -0,0 +1,243 @@
+package report
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// 导出格式
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+var ErrFormat = errors.New("report format is illegal")
+
+// 逐行写入,不缓存全部数据
+type Writer interface {
+	// 表头,只写一次
+	WriteHeader(columns []string) error
+	// 一行数据,数字在xlsx中保留为数字
+	WriteRow(row []interface{}) error
+	// 结束并刷新
+	Close() error
+}
+
+// 按格式创建
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return NewCsvWriter(w), nil
+	case XLSX:
+		return NewXlsxWriter(w)
+	}
+
+	return nil, ErrFormat
+}
+
+// 下载的Content-Type
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+
+	return "application/octet-stream"
+}
+
+// 单元格转为字符串
+func String(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// 是否数字
+func number(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+
+	return false
+}
+
+// -------------------------
+// csv
+
+type csvWriter struct {
+	w   *csv.Writer
+	buf []string
+}
+
+// 带BOM,Excel直接打开不乱码
+func NewCsvWriter(w io.Writer) Writer {
+	w.Write([]byte("\xEF\xBB\xBF"))
+
+	return &csvWriter{
+		w: csv.NewWriter(w),
+	}
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(row []interface{}) error {
+	c.buf = c.buf[:0]
+	for _, v := range row {
+		c.buf = append(c.buf, String(v))
+	}
+
+	if err := c.w.Write(c.buf); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// -------------------------
+// xlsx,只有一个工作表,行直接写入zip流
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+const xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const xlsxSheetEnd = `</sheetData></worksheet>`
+
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+func NewXlsxWriter(w io.Writer) (Writer, error) {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// 工作表最后创建,之后只写这一个文件
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := bufio.NewWriter(fw)
+	if _, err := sheet.WriteString(xlsxSheetStart); err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{
+		zw:    zw,
+		sheet: sheet,
+	}, nil
+}
+
+func (x *xlsxWriter) WriteHeader(columns []string) error {
+	row := make([]interface{}, 0, len(columns))
+	for _, v := range columns {
+		row = append(row, v)
+	}
+
+	return x.WriteRow(row)
+}
+
+func (x *xlsxWriter) WriteRow(row []interface{}) error {
+	x.row++
+
+	x.sheet.WriteString(`<row r="` + strconv.Itoa(x.row) + `">`)
+	for i, v := range row {
+		ref := column(i) + strconv.Itoa(x.row)
+
+		if number(v) {
+			x.sheet.WriteString(`<c r="` + ref + `"><v>` + String(v) + `</v></c>`)
+			continue
+		}
+
+		x.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(x.sheet, []byte(String(v))); err != nil {
+			return err
+		}
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+
+	return x.zw.Close()
+}
+
+// 列名,0->A,26->AA
+func column(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+
+	return name
+}
@@ -0,0 +1,110 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestColumn(t *testing.T) {
+	cases := map[int]string{
+		0:   "A",
+		25:  "Z",
+		26:  "AA",
+		51:  "AZ",
+		52:  "BA",
+		701: "ZZ",
+		702: "AAA",
+	}
+
+	for i, want := range cases {
+		if v := column(i); v != want {
+			t.Fatal("column err: ", i, v)
+		}
+	}
+}
+
+func TestCsv(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	w, err := NewWriter(CSV, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteHeader([]string{"name", "qty"})
+	w.WriteRow([]interface{}{"a,b", int64(3)})
+	w.WriteRow([]interface{}{[]byte("c"), 1.5})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\xEF\xBB\xBFname,qty\n\"a,b\",3\nc,1.5\n"
+	if buf.String() != want {
+		t.Fatalf("csv err: %q", buf.String())
+	}
+}
+
+func TestXlsx(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	w, err := NewWriter(XLSX, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteHeader([]string{"name", "qty"})
+	w.WriteRow([]interface{}{"<a&b>", 3})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(rc)
+		rc.Close()
+
+		files[f.Name] = string(body)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Fatal("file not found: ", name)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(sheet, `<c r="B1" t="inlineStr"><is><t xml:space="preserve">qty</t></is></c>`) {
+		t.Fatal("header err: ", sheet)
+	}
+
+	if !strings.Contains(sheet, `&lt;a&amp;b&gt;`) {
+		t.Fatal("escape err: ", sheet)
+	}
+
+	if !strings.Contains(sheet, `<c r="B2"><v>3</v></c>`) {
+		t.Fatal("number err: ", sheet)
+	}
+
+	if !strings.HasSuffix(sheet, `</sheetData></worksheet>`) {
+		t.Fatal("end err: ", sheet)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", &bytes.Buffer{}); err != ErrFormat {
+		t.Fatal("format err")
+	}
+}
@@ -0,0 +1,167 @@
+package stream
+
+import (
+	"sync"
+)
+
+// 推送消息,Id在发布时分配,用于断线续传
+type Message interface {
+	MessageId() int64
+	SetMessageId(int64)
+}
+
+// 过滤订阅消息,返回true推送
+type Filter func(Message) bool
+
+// 同步处理,在Publish中调用
+type Handler func(Message)
+
+// 订阅者
+type Subscriber struct {
+	id     int
+	filter Filter
+	ch     chan Message
+	closed bool
+}
+
+// 消息通道,订阅者处理过慢时关闭
+func (s *Subscriber) C() <-chan Message {
+	return s.ch
+}
+
+// 消息中心,保存最近size条消息
+type Hub struct {
+	lock sync.RWMutex
+	size int
+	buf  []Message
+	// 最后分配的消息序号
+	msgId    int64
+	seq      int
+	subs     map[int]*Subscriber
+	handlers []Handler
+}
+
+func NewHub(size int) *Hub {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &Hub{
+		size: size,
+		buf:  make([]Message, 0, size),
+		subs: make(map[int]*Subscriber),
+	}
+}
+
+// 设置起始序号,之后发布的消息从id+1开始
+func (h *Hub) SetId(id int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.msgId = id
+}
+
+// 添加同步处理
+func (h *Hub) Handle(handler Handler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.handlers = append(h.handlers, handler)
+}
+
+// 发布消息,在锁内分配序号,保证缓存中的消息有序
+func (h *Hub) Publish(msg Message) int64 {
+	h.lock.Lock()
+	h.msgId++
+	id := h.msgId
+	msg.SetMessageId(id)
+
+	if len(h.buf) == h.size {
+		copy(h.buf, h.buf[1:])
+		h.buf = h.buf[:h.size-1]
+	}
+	h.buf = append(h.buf, msg)
+
+	handlers := h.handlers
+
+	for subId, sub := range h.subs {
+		if sub.filter != nil && !sub.filter(msg) {
+			continue
+		}
+
+		select {
+		case sub.ch <- msg:
+		default:
+			// 处理过慢,断开后由客户端续传
+			sub.closed = true
+			close(sub.ch)
+			delete(h.subs, subId)
+		}
+	}
+	h.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+
+	return id
+}
+
+// 订阅,返回lastId之后的缓存消息
+func (h *Hub) Subscribe(lastId int64, filter Filter, size int) (*Subscriber, []Message) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if size <= 0 {
+		size = h.size
+	}
+
+	h.seq++
+	sub := &Subscriber{
+		id:     h.seq,
+		filter: filter,
+		ch:     make(chan Message, size),
+	}
+	h.subs[sub.id] = sub
+
+	backlog := make([]Message, 0)
+	if lastId <= 0 {
+		return sub, backlog
+	}
+
+	for _, msg := range h.buf {
+		if msg.MessageId() <= lastId {
+			continue
+		}
+
+		if filter != nil && !filter(msg) {
+			continue
+		}
+
+		backlog = append(backlog, msg)
+	}
+
+	return sub, backlog
+}
+
+// 取消订阅
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	sub.closed = true
+	close(sub.ch)
+	delete(h.subs, sub.id)
+}
+
+// 当前订阅数
+func (h *Hub) Count() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.subs)
+}
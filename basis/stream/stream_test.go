@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"sync"
+	"testing"
+)
+
+type testMsg struct {
+	id  int64
+	typ string
+}
+
+func (m *testMsg) MessageId() int64 {
+	return m.id
+}
+
+func (m *testMsg) SetMessageId(id int64) {
+	m.id = id
+}
+
+func TestPublish(t *testing.T) {
+	h := NewHub(10)
+
+	var handled int
+	h.Handle(func(Message) {
+		handled++
+	})
+
+	sub, backlog := h.Subscribe(0, func(m Message) bool {
+		return m.(*testMsg).typ == "a"
+	}, 10)
+	if len(backlog) != 0 {
+		t.Fatal("backlog err: ", len(backlog))
+	}
+
+	h.Publish(&testMsg{1, "a"})
+	h.Publish(&testMsg{2, "b"})
+	h.Publish(&testMsg{3, "a"})
+
+	if handled != 3 {
+		t.Fatal("handled err: ", handled)
+	}
+
+	if m := <-sub.C(); m.MessageId() != 1 {
+		t.Fatal("msg err: ", m.MessageId())
+	}
+
+	if m := <-sub.C(); m.MessageId() != 3 {
+		t.Fatal("msg err: ", m.MessageId())
+	}
+
+	h.Unsubscribe(sub)
+	if _, ok := <-sub.C(); ok {
+		t.Fatal("unsubscribe err")
+	}
+
+	// 重复取消
+	h.Unsubscribe(sub)
+
+	if h.Count() != 0 {
+		t.Fatal("count err: ", h.Count())
+	}
+}
+
+func TestResume(t *testing.T) {
+	h := NewHub(3)
+
+	for i := int64(1); i <= 5; i++ {
+		h.Publish(&testMsg{i, "a"})
+	}
+
+	// 只保留最近3条
+	_, backlog := h.Subscribe(1, nil, 0)
+	if len(backlog) != 3 || backlog[0].MessageId() != 3 {
+		t.Fatal("backlog err: ", len(backlog))
+	}
+
+	_, backlog = h.Subscribe(4, nil, 0)
+	if len(backlog) != 1 || backlog[0].MessageId() != 5 {
+		t.Fatal("backlog err: ", len(backlog))
+	}
+}
+
+func TestSlow(t *testing.T) {
+	h := NewHub(10)
+
+	sub, _ := h.Subscribe(0, nil, 1)
+
+	h.Publish(&testMsg{1, "a"})
+	h.Publish(&testMsg{2, "a"})
+
+	// 缓冲满后断开
+	if m := <-sub.C(); m.MessageId() != 1 {
+		t.Fatal("msg err: ", m.MessageId())
+	}
+
+	if _, ok := <-sub.C(); ok {
+		t.Fatal("slow err")
+	}
+
+	if h.Count() != 0 {
+		t.Fatal("count err: ", h.Count())
+	}
+}
+
+func TestSetId(t *testing.T) {
+	h := NewHub(10)
+	h.SetId(100)
+
+	if id := h.Publish(&testMsg{typ: "a"}); id != 101 {
+		t.Fatal("id err: ", id)
+	}
+}
+
+func TestConcurrentPublish(t *testing.T) {
+	h := NewHub(1000)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				h.Publish(&testMsg{typ: "a"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 缓存中的序号连续递增,续传不会漏掉消息
+	_, backlog := h.Subscribe(500, nil, 0)
+	if len(backlog) != 500 {
+		t.Fatal("backlog err: ", len(backlog))
+	}
+
+	for i, msg := range backlog {
+		if msg.MessageId() != int64(501+i) {
+			t.Fatal("order err: ", i, msg.MessageId())
+		}
+	}
+}
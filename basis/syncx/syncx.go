@@ -0,0 +1,198 @@
+package syncx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/httpx/rest"
+)
+
+// 冲突时保留哪一方
+const (
+	LOCAL  = "local"
+	REMOTE = "remote"
+)
+
+// 变更动作
+const (
+	CREATE = "create"
+	UPDATE = "update"
+	DELETE = "delete"
+)
+
+// 一条变更
+type Change struct {
+	// 本地发件箱ID,拉取时为0
+	Seq     int64           `json:"seq"`
+	Entity  string          `json:"entity"`
+	Id      int             `json:"id"`
+	Action  string          `json:"action"`
+	Updated string          `json:"updated"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// 本地未推送修改和服务器修改冲突时,更新时间晚的保留,相同时服务器优先
+func Resolve(local, remote *Change) string {
+	if local == nil {
+		return REMOTE
+	}
+
+	if local.Updated > remote.Updated {
+		return LOCAL
+	}
+
+	return REMOTE
+}
+
+// 按更新时间、实体、ID排序,保证每台设备应用顺序一致
+func Sort(list []*Change) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Updated != b.Updated {
+			return a.Updated < b.Updated
+		}
+
+		if a.Entity != b.Entity {
+			return a.Entity < b.Entity
+		}
+
+		return a.Id < b.Id
+	})
+}
+
+// 读取JSON中的updated,没有时用created
+func Updated(payload []byte) string {
+	v := struct {
+		Created string `json:"created"`
+		Updated string `json:"updated"`
+	}{}
+
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return ""
+	}
+
+	if len(v.Updated) > 0 {
+		return v.Updated
+	}
+
+	return v.Created
+}
+
+// 推送
+type PushRequest struct {
+	DeviceId string    `json:"deviceId"`
+	Changes  []*Change `json:"changes"`
+}
+
+type PushResult struct {
+	// 服务器已保存的Seq
+	Accepted []int64 `json:"accepted"`
+}
+
+// 拉取
+type PullResult struct {
+	Changes []*Change `json:"changes"`
+	// 下次拉取的位置
+	Cursor string `json:"cursor"`
+}
+
+// 服务器统一返回
+type response struct {
+	Code int             `json:"code"`
+	Err  string          `json:"err"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 中心服务器
+type Client struct {
+	Url      string
+	Token    string
+	DeviceId string
+	Timeout  time.Duration
+}
+
+func NewClient(url, token, deviceId string, timeout time.Duration) *Client {
+	return &Client{
+		Url:      url,
+		Token:    token,
+		DeviceId: deviceId,
+		Timeout:  timeout,
+	}
+}
+
+// 推送本地变更
+func (c *Client) Push(changes []*Change) (*PushResult, error) {
+	body, err := json.Marshal(&PushRequest{
+		DeviceId: c.DeviceId,
+		Changes:  changes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req := rest.Post(c.Url+"/push").Body(body).WithTimeout(c.Timeout).Header("Token", c.Token)
+
+	res := &PushResult{}
+	if err := c.do(req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// 拉取cursor之后的主数据
+func (c *Client) Pull(entity, cursor string) (*PullResult, error) {
+	req := rest.Get(c.Url+"/pull").WithTimeout(c.Timeout).Header("Token", c.Token).Querys(rest.Values{
+		"deviceId": c.DeviceId,
+		"entity":   entity,
+		"cursor":   cursor,
+	})
+
+	res := &PullResult{}
+	if err := c.do(req, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) do(req *rest.Request, data interface{}) error {
+	resp, err := req.Do()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("sync server status %d", resp.StatusCode)
+	}
+
+	res := &response{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return err
+	}
+
+	if res.Code != 200 {
+		return errors.New("sync server error: " + res.Err)
+	}
+
+	if len(res.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(res.Data, data)
+}
+
+// 服务器地址是否配置
+func Valid(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "http" || u.Scheme == "https"
+}
@@ -0,0 +1,128 @@
+package syncx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	remote := &Change{Updated: "2020-01-02 00:00:00"}
+
+	if Resolve(nil, remote) != REMOTE {
+		t.Fatal("resolve nil err")
+	}
+
+	if Resolve(&Change{Updated: "2020-01-03 00:00:00"}, remote) != LOCAL {
+		t.Fatal("resolve local err")
+	}
+
+	if Resolve(&Change{Updated: "2020-01-01 00:00:00"}, remote) != REMOTE {
+		t.Fatal("resolve remote err")
+	}
+
+	// 时间相同服务器优先
+	if Resolve(&Change{Updated: "2020-01-02 00:00:00"}, remote) != REMOTE {
+		t.Fatal("resolve equal err")
+	}
+}
+
+func TestSort(t *testing.T) {
+	list := []*Change{
+		{Entity: "material", Id: 2, Updated: "2020-01-02 00:00:00"},
+		{Entity: "material", Id: 1, Updated: "2020-01-02 00:00:00"},
+		{Entity: "account", Id: 9, Updated: "2020-01-02 00:00:00"},
+		{Entity: "material", Id: 3, Updated: "2020-01-01 00:00:00"},
+	}
+
+	Sort(list)
+
+	want := []int{3, 9, 1, 2}
+	for i, v := range list {
+		if v.Id != want[i] {
+			t.Fatal("sort err: ", i, v.Id)
+		}
+	}
+}
+
+func TestUpdated(t *testing.T) {
+	if v := Updated([]byte(`{"created":"a","updated":"b"}`)); v != "b" {
+		t.Fatal("updated err: ", v)
+	}
+
+	if v := Updated([]byte(`{"created":"a"}`)); v != "a" {
+		t.Fatal("created err: ", v)
+	}
+
+	if v := Updated([]byte(`[]`)); v != "" {
+		t.Fatal("illegal err: ", v)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Token") != "token" {
+			w.WriteHeader(401)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/push":
+			req := &PushRequest{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.DeviceId != "dev" {
+				w.Write([]byte(`{"code":400,"err":"params"}`))
+				return
+			}
+
+			seqs := make([]int64, 0)
+			for _, v := range req.Changes {
+				seqs = append(seqs, v.Seq)
+			}
+
+			bytes, _ := json.Marshal(map[string]interface{}{
+				"code": 200,
+				"data": &PushResult{Accepted: seqs},
+			})
+			w.Write(bytes)
+
+		case "/pull":
+			if r.URL.Query().Get("entity") != "material" || r.URL.Query().Get("cursor") != "c1" {
+				w.Write([]byte(`{"code":400,"err":"params"}`))
+				return
+			}
+
+			w.Write([]byte(`{"code":200,"data":{"changes":[{"entity":"material","id":1,"action":"update","payload":{"id":1}}],"cursor":"c2"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "token", "dev", time.Second)
+
+	push, err := client.Push([]*Change{{Seq: 1}, {Seq: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(push.Accepted) != 2 || push.Accepted[1] != 2 {
+		t.Fatal("push err: ", push.Accepted)
+	}
+
+	pull, err := client.Pull("material", "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pull.Cursor != "c2" || len(pull.Changes) != 1 || pull.Changes[0].Id != 1 {
+		t.Fatal("pull err: ", pull.Cursor)
+	}
+
+	if _, err := NewClient(server.URL, "wrong", "dev", time.Second).Pull("material", "c1"); err == nil {
+		t.Fatal("token err")
+	}
+
+	if _, err := client.Pull("account", "c1"); err == nil {
+		t.Fatal("code err")
+	}
+}
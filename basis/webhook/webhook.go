@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/httpx/rest"
+)
+
+// 请求头
+const (
+	HEADER_EVENT     = "X-Webhook-Event"
+	HEADER_DELIVERY  = "X-Webhook-Delivery"
+	HEADER_TIMESTAMP = "X-Webhook-Timestamp"
+	HEADER_SIGNATURE = "X-Webhook-Signature"
+)
+
+// 响应最多保存长度
+const MaxResponse = 1024
+
+// 签名 sha256=hex(hmac(secret, timestamp.body))
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 校验签名
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// 第attempt次失败后的等待时间,指数增长不超过max
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt <= 0 {
+		return base
+	}
+
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+
+	return d
+}
+
+// 发送结果
+type Result struct {
+	StatusCode int
+	Response   string
+	Duration   time.Duration
+}
+
+// 2xx为成功
+func (r *Result) Success() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// 发送
+func Send(url, secret, event, delivery string, body []byte, timeout time.Duration) (*Result, error) {
+	start := time.Now()
+	timestamp := start.Unix()
+
+	req := rest.Post(url).
+		Body(body).
+		WithTimeout(timeout).
+		Header(HEADER_EVENT, event).
+		Header(HEADER_DELIVERY, delivery).
+		Header(HEADER_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+
+	if len(secret) > 0 {
+		req.Header(HEADER_SIGNATURE, Sign(secret, timestamp, body))
+	}
+
+	resp, err := req.Do()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes) > MaxResponse {
+		bytes = bytes[:MaxResponse]
+	}
+
+	return &Result{
+		StatusCode: resp.StatusCode,
+		Response:   string(bytes),
+		Duration:   time.Since(start),
+	}, nil
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+
+	// echo -n '1500000000.{"id":1}' | openssl dgst -sha256 -hmac secret
+	sign := Sign("secret", 1500000000, body)
+	if sign != "sha256=a20c58e8656725b578b31dc3828ea089639cedaa5464055bc03757918299a19c" {
+		t.Fatal("sign err: ", sign)
+	}
+
+	if !Verify("secret", 1500000000, body, sign) {
+		t.Fatal("verify err")
+	}
+
+	if Verify("other", 1500000000, body, sign) {
+		t.Fatal("verify secret err")
+	}
+
+	if Verify("secret", 1500000001, body, sign) {
+		t.Fatal("verify timestamp err")
+	}
+}
+
+var backoffData = []struct {
+	Attempt int
+	Out     time.Duration
+}{
+	{0, time.Second},
+	{1, time.Second},
+	{2, 2 * time.Second},
+	{3, 4 * time.Second},
+	{6, 32 * time.Second},
+	{7, time.Minute},
+	{20, time.Minute},
+}
+
+func TestBackoff(t *testing.T) {
+	for _, v := range backoffData {
+		if d := Backoff(v.Attempt, time.Second, time.Minute); d != v.Out {
+			t.Fatal("backoff err: ", v.Attempt, v.Out, d)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"id":1}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bytes, _ := ioutil.ReadAll(r.Body)
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(HEADER_TIMESTAMP), 10, 64)
+		if err != nil || !Verify("secret", timestamp, bytes, r.Header.Get(HEADER_SIGNATURE)) {
+			w.WriteHeader(401)
+			return
+		}
+
+		if r.Header.Get(HEADER_EVENT) != "stock.changed" || r.Header.Get(HEADER_DELIVERY) != "7" {
+			w.WriteHeader(400)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	res, err := Send(server.URL, "secret", "stock.changed", "7", body, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Success() || res.Response != "ok" {
+		t.Fatal("send err: ", res.StatusCode, res.Response)
+	}
+
+	res, err = Send(server.URL, "wrong", "stock.changed", "7", body, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != 401 {
+		t.Fatal("send err: ", res.StatusCode)
+	}
+}
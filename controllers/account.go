@@ -7,6 +7,7 @@ import (
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
 	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/audit"
 )
 
 type AccountController struct {
@@ -60,11 +61,14 @@ func (c *AccountController) AddAccount() {
 
 	obj.Status = 1
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := account.InsertAccount(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "account", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -105,12 +109,16 @@ func (c *AccountController) EditAccount() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := account.UpdateAccount(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "account", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -152,12 +160,18 @@ func (c *AccountController) EditPassword() {
 		return
 	}
 
+	before := *acc
+
 	acc.Password = password
+	acc.Updated = timex.String()
+	acc.UpdatedBy = c.Operator()
 	if err := account.UpdateAccount(acc); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "account", acc.Id, &before, acc)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -177,11 +191,25 @@ func (c *AccountController) DelAccount() {
 		return
 	}
 
+	// 删除前数据
+	before, err := account.AccountById(accountId)
+	if err != nil {
+		if account.ErrAccountNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := account.DelAccount(accountId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "account", accountId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -267,7 +295,11 @@ func (c *AccountController) LoginByCard() {
 		return
 	}
 
-	acc.Token = OAuth.Add()
+	acc.Token = OAuth.Add(&Identity{
+		Type: IDENTITY_ACCOUNT,
+		Id:   acc.Id,
+		Name: acc.Username,
+	})
 
 	c.WriteHttpResponse(200, acc, nil)
 	return
@@ -300,7 +332,11 @@ func (c *AccountController) LoginByUsername() {
 		return
 	}
 
-	acc.Token = OAuth.Add()
+	acc.Token = OAuth.Add(&Identity{
+		Type: IDENTITY_ACCOUNT,
+		Id:   acc.Id,
+		Name: acc.Username,
+	})
 
 	c.WriteHttpResponse(200, acc, nil)
 	return
@@ -308,47 +344,19 @@ func (c *AccountController) LoginByUsername() {
 
 // 查询所有用户
 func (c *AccountController) AccountList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
 	name := c.GetString("name")
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("id:asc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	total, list, err := account.AccountList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-	}, page, pageSize)
-	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
-		return
-	}
-
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		data = list
-	}
-
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	where := r.Where()
+	where["name"] = name
 
+	total, list, err := account.AccountList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
 	return
 }
 
@@ -367,7 +375,14 @@ func (c *AccountController) AccountByFinger() {
 		return
 	}
 
-	acc, err := account.AccountByFinger(fingerId)
+	// 指纹所在的柜子
+	boxId, err := c.GetInt("boxId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	acc, err := account.AccountByFinger(boxId, fingerId)
 	if err != nil {
 		if account.ErrAccountNotFound.Equal(err) {
 			c.WriteHttpResponse(404, nil, errors.As(err))
@@ -378,7 +393,11 @@ func (c *AccountController) AccountByFinger() {
 		return
 	}
 
-	acc.Token = OAuth.Add()
+	acc.Token = OAuth.Add(&Identity{
+		Type: IDENTITY_ACCOUNT,
+		Id:   acc.Id,
+		Name: acc.Username,
+	})
 
 	c.WriteHttpResponse(200, acc, nil)
 	return
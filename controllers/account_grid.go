@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/box"
 )
 
@@ -44,11 +45,14 @@ func (c *AccountGridController) AddAccount() {
 
 	obj.Status = 1
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := box.InsertAccount(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "account_grid", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -82,12 +86,16 @@ func (c *AccountGridController) EditAccount() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := box.UpdateAccount(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "account_grid", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -107,11 +115,25 @@ func (c *AccountGridController) DelAccount() {
 		return
 	}
 
+	// 删除前数据
+	before, err := box.AccountById(id)
+	if err != nil {
+		if box.ErrAccountNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := box.DelAccount(id); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "account_grid", id, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -147,10 +169,6 @@ func (c *AccountGridController) AccountById() {
 
 // 查询所有
 func (c *AccountGridController) AccountList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
 	accountIdStr := c.Input().Get("accountId")
 	boxIdStr := c.Input().Get("boxId")
 
@@ -174,44 +192,17 @@ func (c *AccountGridController) AccountList() {
 		}
 	}
 
-	page, err := c.GetInt("page")
+	r, err := c.ListRequest("id:asc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	pageSize, err := c.GetInt("pageSize")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	total, list, err := box.AccountList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-		"accountId": accountId,
-		"boxId":     boxId,
-	}, page, pageSize)
-	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
-		return
-	}
-
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		data = list
-	}
-
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	where := r.Where()
+	where["accountId"] = accountId
+	where["boxId"] = boxId
 
+	total, list, err := box.AccountList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
 	return
 }
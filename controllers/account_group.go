@@ -7,6 +7,7 @@ import (
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
 	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/audit"
 )
 
 type AccountGroupController struct {
@@ -43,10 +44,13 @@ func (c *AccountGroupController) AddAccountGroup() {
 	if acc == nil {
 		obj.Status = 1
 		obj.Created = timex.String()
+		obj.CreatedBy = c.Operator()
 		if err := account.InsertAccountGroup(obj); err != nil {
 			c.WriteHttpResponse(500, nil, errors.As(err))
 			return
 		}
+
+		c.Audit(audit.CREATE, "account_group", obj.Id, nil, obj)
 	} else {
 		// 存在修改
 		acc.Status = 1
@@ -107,6 +111,8 @@ func (c *AccountGroupController) DelAccountGroup() {
 		return
 	}
 
+	c.Audit(audit.DELETE, "account_group", acc.Id, acc, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -119,19 +125,13 @@ func (c *AccountGroupController) AccountByGroupId() {
 		return
 	}
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := account.AccountByGroupId(groupId, page, pageSize)
+	list, err := account.AccountByGroupId(groupId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -0,0 +1,375 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/adjust"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/ledger"
+)
+
+// 权限标签
+const (
+	// 手工调整库存
+	PERMISSION_STOCK_ADJUST = "stock_adjust"
+	// 格子间调拨
+	PERMISSION_STOCK_TRANSFER = "stock_transfer"
+)
+
+// 调整和调拨错误的状态码
+func adjustErrCode(err error) int {
+	switch {
+	case adjust.ErrReasonIllegal.Equal(err),
+		adjust.ErrQtyIllegal.Equal(err),
+		adjust.ErrQtyNotEnough.Equal(err),
+		adjust.ErrQtyOverflow.Equal(err),
+		adjust.ErrSameGrid.Equal(err):
+		return 400
+	}
+
+	return 500
+}
+
+// 调整和调拨的格子,RFID格子按标签计数不能手工修改
+func adjustGrid(id int) (*box.Grid, int, error) {
+	if id <= 0 {
+		return nil, 400, errors.New("grid id is empty")
+	}
+
+	grid, err := box.GridById(id)
+	if err != nil {
+		if box.ErrGridNotFound.Equal(err) {
+			return nil, 404, errors.As(err, id)
+		}
+
+		return nil, 500, errors.As(err)
+	}
+
+	if grid.Mode == box.MODE_RFID {
+		return nil, 400, errors.New("rfid grid stock is counted by tags").As(id)
+	}
+
+	return grid, 200, nil
+}
+
+// 调整和调拨订单的领料人,管理员操作时为0
+func adjustAccountId(identity *Identity) int {
+	if identity == nil || identity.Type != IDENTITY_ACCOUNT {
+		return 0
+	}
+
+	return identity.Id
+}
+
+type AdjustController struct {
+	BaseController
+}
+
+type AdjustmentRequest struct {
+	GridId int `json:"gridId"`
+	// 为空时为格子绑定的物料
+	MaterialId int `json:"materialId"`
+	// damaged/lost/found/expired/write_off
+	Reason string `json:"reason"`
+	// 正数,方向由原因决定
+	Qty  int    `json:"qty"`
+	Note string `json:"note"`
+}
+
+// 手工调整库存
+func (c *AdjustController) AddAdjustment() {
+	if !c.CheckPermission(PERMISSION_STOCK_ADJUST) {
+		return
+	}
+
+	obj := &AdjustmentRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if !adjust.ValidReason(obj.Reason) {
+		c.WriteHttpResponse(400, nil, errors.As(adjust.ErrReasonIllegal, obj.Reason))
+		return
+	}
+
+	grid, code, err := adjustGrid(obj.GridId)
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	if obj.MaterialId <= 0 {
+		obj.MaterialId = grid.MaterialId
+	}
+
+	if obj.MaterialId <= 0 {
+		c.WriteHttpResponse(400, nil, errors.New("material id is empty"))
+		return
+	}
+
+	a := &adjust.Adjustment{
+		Created:    timex.String(),
+		CreatedBy:  c.Operator(),
+		GridId:     grid.Id,
+		MaterialId: obj.MaterialId,
+		Reason:     obj.Reason,
+		Qty:        obj.Qty,
+		Note:       obj.Note,
+	}
+
+	before, after, err := adjust.Settle(a, grid.Qty, adjustAccountId(c.Identity()), ledgerSource(c.Identity(), nil))
+	if err != nil {
+		c.WriteHttpResponse(adjustErrCode(err), nil, errors.As(err))
+		return
+	}
+
+	PublishStockChanged(c.Identity(), c.Ctx.Request.Method, c.Ctx.Request.URL.Path, &StockRef{
+		Reason:  ledger.ADJUST,
+		RefType: "adjustment",
+		RefId:   a.Id,
+		Note:    a.Reason,
+	}, before, after)
+
+	c.Audit(audit.CREATE, "adjustment", a.Id, nil, a)
+
+	c.WriteHttpResponse(200, a, nil)
+	return
+}
+
+// 根据ID查询
+func (c *AdjustController) AdjustmentById() {
+	idStr := c.Ctx.Input.Param(":id")
+	if len(idStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("adjustment id is empty"))
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := adjust.AdjustmentById(id)
+	if err != nil {
+		if adjust.ErrAdjustmentNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有
+func (c *AdjustController) AdjustmentList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"gridId", "materialId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+	where["reason"] = c.GetString("reason")
+
+	total, list, err := adjust.AdjustmentList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+type TransferRequest struct {
+	FromGridId int `json:"fromGridId"`
+	ToGridId   int `json:"toGridId"`
+	// 为空时为调出格子绑定的物料
+	MaterialId int    `json:"materialId"`
+	Qty        int    `json:"qty"`
+	Note       string `json:"note"`
+}
+
+// 打开格子的门,不称重,由调拨结算
+func (c *AdjustController) openGrid(grid *box.Grid) error {
+	where := make(map[string]interface{})
+	where["boxId"] = grid.Addr
+	where["gridId"] = grid.Channel
+	where["operation"] = LOCK_UNWEIGHT
+
+	bytes, err := SerialByAddr(grid.Addr).Post(SERIAL_OPEN, where)
+	if err != nil {
+		return errors.As(err, grid.Id)
+	}
+
+	c.DoorOpened("grid", grid.Id, where)
+
+	log.Info("Transfer open %d %s", grid.Id, string(bytes))
+	return nil
+}
+
+// 格子间调拨,可跨柜子,结算两边库存后打开两边的门
+func (c *AdjustController) AddTransfer() {
+	if !c.CheckPermission(PERMISSION_STOCK_TRANSFER) {
+		return
+	}
+
+	obj := &TransferRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if obj.Qty <= 0 {
+		c.WriteHttpResponse(400, nil, errors.As(adjust.ErrQtyIllegal, obj.Qty))
+		return
+	}
+
+	if obj.FromGridId == obj.ToGridId {
+		c.WriteHttpResponse(400, nil, errors.As(adjust.ErrSameGrid, obj.FromGridId))
+		return
+	}
+
+	from, code, err := adjustGrid(obj.FromGridId)
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	to, code, err := adjustGrid(obj.ToGridId)
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	if obj.MaterialId <= 0 {
+		obj.MaterialId = from.MaterialId
+	}
+
+	if obj.MaterialId <= 0 {
+		c.WriteHttpResponse(400, nil, errors.New("material id is empty"))
+		return
+	}
+
+	// 调入格子绑定了其他物料
+	if to.MaterialId > 0 && to.MaterialId != obj.MaterialId {
+		c.WriteHttpResponse(400, nil, errors.New("grid is bound to another material").As(to.Id, to.MaterialId))
+		return
+	}
+
+	t := &adjust.Transfer{
+		Created:    timex.String(),
+		CreatedBy:  c.Operator(),
+		MaterialId: obj.MaterialId,
+		Qty:        obj.Qty,
+		FromGridId: from.Id,
+		ToGridId:   to.Id,
+		Note:       obj.Note,
+	}
+
+	// 库存不足等结算失败时不开门
+	fromSide, toSide, err := adjust.SettleTransfer(t, to.Qty, adjustAccountId(c.Identity()), ledgerSource(c.Identity(), nil))
+	if err != nil {
+		c.WriteHttpResponse(adjustErrCode(err), nil, errors.As(err))
+		return
+	}
+
+	ref := &StockRef{
+		Reason:  ledger.TRANSFER,
+		RefType: "transfer",
+		RefId:   t.Id,
+		Note:    t.Note,
+	}
+	PublishStockChanged(c.Identity(), c.Ctx.Request.Method, c.Ctx.Request.URL.Path, ref, fromSide.Before, fromSide.After)
+	PublishStockChanged(c.Identity(), c.Ctx.Request.Method, c.Ctx.Request.URL.Path, ref, toSide.Before, toSide.After)
+
+	c.Audit(audit.CREATE, "transfer", t.Id, nil, t)
+
+	// 已结算,开门失败时返回错误,调拨记录保留
+	for _, grid := range []*box.Grid{from, to} {
+		if err := c.openGrid(grid); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err, t.Id))
+			return
+		}
+	}
+
+	c.WriteHttpResponse(200, t, nil)
+	return
+}
+
+// 根据ID查询
+func (c *AdjustController) TransferById() {
+	idStr := c.Ctx.Input.Param(":id")
+	if len(idStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("transfer id is empty"))
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := adjust.TransferById(id)
+	if err != nil {
+		if adjust.ErrTransferNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有
+func (c *AdjustController) TransferList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"gridId", "materialId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	total, list, err := adjust.TransferList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
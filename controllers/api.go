@@ -5,9 +5,7 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/beego/ms304w-client/basis/conf"
 	"github.com/beego/ms304w-client/basis/errors"
-	"github.com/beego/ms304w-client/basis/httpx/rest"
 )
 
 type SerialController struct {
@@ -19,29 +17,32 @@ const (
 	LOCK_WEIGHT      = 1           // 称重
 	LOCK_SUM         = 2           // 计数
 	LOCK_CHECK       = 3           // 盘点
+	LOCK_RFID        = 4           // RFID对账
 	WEIGHT_UNDEFINED = "undefined" // UUID不存在，只称重，不处理数据
 	// 灯
 	LIGHT_OPEN  int = 1
 	LIGHT_CLOSE int = 0
 )
 
-var (
-	// API路径
-	API_URL = conf.String("api_server")
+// 串口服务路径
+const (
+	SERIAL_OPEN = "/v1/serial/open"
+
+	SERIAL_WEIGHT = "/v1/serial/weight"
 
-	SERIAL_OPEN_URL = API_URL + "/v1/serial/open"
+	SERIAL_WEIGHT_ZERO = "/v1/serial/weight/zero"
 
-	SERIAL_WEIGHT_URL = API_URL + "/v1/serial/weight"
+	SERIAL_WEIGHT_MEASURE = "/v1/serial/weight/measure"
 
-	SERIAL_WEIGHT_ZERO = API_URL + "/v1/serial/weight/zero"
+	SERIAL_WEIGHT_CHECK = "/v1/serial/weight/check"
 
-	SERIAL_WEIGHT_MEASURE = API_URL + "/v1/serial/weight/measure"
+	SERIAL_LIGHT = "/v1/serial/light"
 
-	SERIAL_WEIGHT_CHECK = API_URL + "/v1/serial/weight/check"
+	SERIAL_ALL_STATUS = "/v1/serial/box/%d/status"
 
-	SERIAL_LIGHT = API_URL + "/v1/serial/light"
+	SERIAL_FINGER_ENROLL = "/v1/serial/finger/enroll"
 
-	SERIAL_ALL_STATUS = API_URL + "/v1/serial/box/%d/status"
+	SERIAL_FINGER_DELETE = "/v1/serial/finger/delete"
 )
 
 type ApiData struct {
@@ -68,6 +69,8 @@ type ApiData struct {
 	Code string `json:"code"`
 	// 指纹
 	Finger int `json:"finger"`
+	// 关门后格子内标签
+	Rfids []string `json:"rfid"`
 }
 
 // 开门
@@ -113,14 +116,14 @@ func (c *SerialController) Open() {
 	where["gridId"] = gridId
 	where["operation"] = operation
 
-	log.Info("Post %s", SERIAL_OPEN_URL)
-
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxId).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("box", boxId, where)
+
 	log.Info("Open Res %s", string(bytes))
 
 	c.WriteHttpResponse(200, nil, nil)
@@ -161,7 +164,7 @@ func (c *SerialController) Weight() {
 	where["boxId"] = boxId
 	where["gridId"] = gridId
 
-	bytes, err := rest.Post(SERIAL_WEIGHT_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxId).Post(SERIAL_WEIGHT, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -207,7 +210,7 @@ func (c *SerialController) Zero() {
 	where["boxId"] = boxId
 	where["gridId"] = gridId
 
-	bytes, err := rest.Post(SERIAL_WEIGHT_ZERO).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxId).Post(SERIAL_WEIGHT_ZERO, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -261,7 +264,7 @@ func (c *SerialController) Measure() {
 	where["gridId"] = gridId
 	where["weight"] = weight
 
-	bytes, err := rest.Post(SERIAL_WEIGHT_MEASURE).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxId).Post(SERIAL_WEIGHT_MEASURE, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -313,7 +316,7 @@ func (c *SerialController) Check() {
 	where["boxId"] = boxId
 	where["gridId"] = gridId
 
-	bytes, err := rest.Post(SERIAL_WEIGHT_CHECK).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxId).Post(SERIAL_WEIGHT_CHECK, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -348,7 +351,7 @@ func (c *SerialController) BoxStatus() {
 		return
 	}
 
-	bytes, err := rest.Get(fmt.Sprintf(SERIAL_ALL_STATUS, boxId)).End()
+	bytes, err := SerialByAddr(boxId).Get(fmt.Sprintf(SERIAL_ALL_STATUS, boxId))
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -402,7 +405,7 @@ func (c *SerialController) Light() {
 	where["gridId"] = gridId
 	where["operation"] = operation
 
-	bytes, err := rest.Post(SERIAL_LIGHT).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxId).Post(SERIAL_LIGHT, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/audit"
+)
+
+type AuditController struct {
+	BaseController
+}
+
+// 根据ID查询
+func (c *AuditController) AuditById() {
+	auditIdStr := c.Ctx.Input.Param(":id")
+	log.Debug(auditIdStr)
+	if len(auditIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("audit id is empty"))
+		return
+	}
+
+	auditId, err := strconv.Atoi(auditIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := audit.AuditById(auditId)
+	if err != nil {
+		if audit.ErrAuditNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有
+func (c *AuditController) AuditList() {
+	actorType := c.GetString("actorType")
+	action := c.GetString("action")
+	entityType := c.GetString("entityType")
+
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// actorId
+	actorIdStr := c.Input().Get("actorId")
+	var actorId int
+
+	if len(actorIdStr) > 0 {
+		actorId, err = strconv.Atoi(actorIdStr)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+	}
+
+	// entityId
+	entityIdStr := c.Input().Get("entityId")
+	var entityId int
+
+	if len(entityIdStr) > 0 {
+		entityId, err = strconv.Atoi(entityIdStr)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+	}
+
+	where := r.Where()
+	where["actorType"] = actorType
+	where["actorId"] = actorId
+	where["action"] = action
+	where["entityType"] = entityType
+	where["entityId"] = entityId
+
+	total, list, err := audit.AuditList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 校验哈希链
+func (c *AuditController) AuditVerify() {
+	total, brokenId, err := audit.VerifyAudit()
+	if err != nil && !audit.ErrAuditTampered.Equal(err) {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, struct {
+		Total    int64 `json:"total"`
+		Valid    bool  `json:"valid"`
+		BrokenId int   `json:"brokenId"`
+	}{
+		Total:    total,
+		Valid:    brokenId == 0,
+		BrokenId: brokenId,
+	}, nil)
+
+	return
+}
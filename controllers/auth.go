@@ -8,59 +8,96 @@ import (
 	"github.com/satori/go.uuid"
 )
 
+const (
+	// 操作员
+	IDENTITY_ACCOUNT = "account"
+	// 后台用户
+	IDENTITY_USER = "user"
+	// 硬件回调/定时任务
+	IDENTITY_SYSTEM = "system"
+)
+
 var (
 	AuthTimeout = conf.Int("auth_timeout")
 
 	timeout = time.Minute * time.Duration(AuthTimeout)
 
 	OAuth *Auth = NewAuth()
+
+	// 未登录或回调请求
+	SystemIdentity = &Identity{
+		Type: IDENTITY_SYSTEM,
+		Name: IDENTITY_SYSTEM,
+	}
 )
 
+// 登录身份
+type Identity struct {
+	Type string `json:"type"`
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type session struct {
+	expire   time.Time
+	identity *Identity
+}
+
 type Auth struct {
 	lock *sync.RWMutex
-	list map[string]time.Time
+	list map[string]*session
 }
 
 func NewAuth() *Auth {
 	return &Auth{
 		lock: new(sync.RWMutex),
-		list: make(map[string]time.Time),
+		list: make(map[string]*session),
 	}
 }
 
-func (m *Auth) Add() string {
+func (m *Auth) Add(identity *Identity) string {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
 	token := uuid.Must(uuid.NewV4()).String()
-	m.list[token] = time.Now().Add(timeout)
+	m.list[token] = &session{
+		expire:   time.Now().Add(timeout),
+		identity: identity,
+	}
 
 	return token
 }
 
 func (m *Auth) Get(token string) bool {
-	m.lock.RLock()
-	defer m.lock.RUnlock()
+	return m.Identity(token) != nil
+}
+
+// 根据token查询登录身份,过期返回nil
+func (m *Auth) Identity(token string) *Identity {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
 	if v, ok := m.list[token]; ok {
-		if time.Now().After(v) {
+		if time.Now().After(v.expire) {
 			// del
 			delete(m.list, token)
 
-			return false
+			return nil
 		}
 
-		return true
+		return v.identity
 	}
 
-	return false
+	return nil
 }
 
 func (m *Auth) Set(token string) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	m.list[token] = time.Now().Add(timeout)
+	if v, ok := m.list[token]; ok {
+		v.expire = time.Now().Add(timeout)
+	}
 }
 
 func (m *Auth) Del(token string) {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/order"
 	"github.com/robfig/cron"
 )
@@ -66,7 +67,7 @@ func reloadAutoConf() {
 
 func runAutoConf() {
 	// socket
-	Server.BroadcastTo("login", "auto", "success")
+	Publish(&AutoStarted{})
 }
 
 // 添加
@@ -105,6 +106,8 @@ func (c *AutoConfController) AddAutoConf() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "auto_conf", obj.Id, nil, obj)
+
 	reloadAutoConf()
 
 	c.WriteHttpResponse(200, nil, nil)
@@ -146,6 +149,8 @@ func (c *AutoConfController) EditAutoConf() {
 		return
 	}
 
+	c.Audit(audit.UPDATE, "auto_conf", obj.Id, acc, obj)
+
 	reloadAutoConf()
 
 	c.WriteHttpResponse(200, nil, nil)
@@ -167,11 +172,25 @@ func (c *AutoConfController) DelAutoConf() {
 		return
 	}
 
+	// 删除前数据
+	before, err := order.AutoConfById(autoId)
+	if err != nil {
+		if order.ErrAutoConfNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := order.DelAutoConf(autoId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "auto_conf", autoId, before, nil)
+
 	reloadAutoConf()
 
 	c.WriteHttpResponse(200, nil, nil)
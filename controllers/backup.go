@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	bk "github.com/beego/ms304w-client/basis/backup"
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/dialect"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/backup"
+	"github.com/beego/ms304w-client/models/migrate"
+	"github.com/robfig/cron"
+)
+
+var (
+	backupCron = cron.New()
+	// 同一时间只执行一次备份或恢复
+	backupLock sync.Mutex
+	// 恢复时进入维护模式,拒绝其他请求
+	maintenance int32
+	// 恢复时暂停后台写入,后台任务每次处理时加读锁
+	writerLock sync.RWMutex
+)
+
+// 是否维护中
+func Maintenance() bool {
+	return atomic.LoadInt32(&maintenance) == 1
+}
+
+// 启动定时备份,只支持sqlite
+func StartBackup() {
+	if conf.DefaultString("db_driver", dialect.SQLITE) != dialect.SQLITE || !conf.DefaultBool("backup_enable", true) {
+		return
+	}
+
+	// 秒 分 时 日 月 周,默认每天3点
+	if err := backupCron.AddFunc(conf.DefaultString("backup_spec", "0 0 3 * * *"), runBackup); err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	backupCron.Start()
+}
+
+func runBackup() {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	file, err := backup.Create()
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	log.Info("backup: %s %d", file.Name, file.Size)
+}
+
+// 备份错误的状态码
+func backupErrCode(err error) int {
+	switch {
+	case errors.Equal(err, backup.ErrNotSupported), errors.Equal(err, bk.ErrName):
+		return 400
+	case errors.Equal(err, bk.ErrNotFound):
+		return 404
+	case errors.Equal(err, bk.ErrBusy):
+		return 503
+	}
+
+	return 500
+}
+
+type BackupController struct {
+	BaseController
+}
+
+// 列表
+func (c *BackupController) BackupList() {
+	list, err := backup.List()
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, struct {
+		Total int64       `json:"total"`
+		Dir   string      `json:"dir"`
+		Data  interface{} `json:"data"`
+	}{
+		Total: int64(len(list)),
+		Dir:   backup.Dir(),
+		Data:  list,
+	}, nil)
+	return
+}
+
+// 立即备份
+func (c *BackupController) AddBackup() {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	file, err := backup.Create()
+	if err != nil {
+		c.WriteHttpResponse(backupErrCode(err), nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "backup", 0, nil, file)
+
+	c.WriteHttpResponse(200, file, nil)
+	return
+}
+
+type BackupRestoreRequest struct {
+	Name string `json:"name"`
+}
+
+// 从备份恢复,恢复期间其他请求返回503
+func (c *BackupController) RestoreBackup() {
+	obj := &BackupRestoreRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil || len(obj.Name) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	before, err := restoreBackup(obj.Name)
+	if err != nil {
+		c.WriteHttpResponse(backupErrCode(err), before, errors.As(err))
+		return
+	}
+
+	// 恢复后重新加载配置
+	reloadAutoConf()
+	reloadCabinets()
+
+	c.Audit(audit.RESTORE, "backup", 0, before, obj)
+
+	c.WriteHttpResponse(200, struct {
+		Name   string   `json:"name"`
+		Before *bk.File `json:"before"`
+	}{
+		Name:   obj.Name,
+		Before: before,
+	}, nil)
+	return
+}
+
+// 维护模式下恢复并迁移到当前版本,期间不同步也不执行后台写入
+// 迁移失败时恢复到恢复前的备份
+func restoreBackup(name string) (*bk.File, error) {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	writerLock.Lock()
+	defer writerLock.Unlock()
+
+	atomic.StoreInt32(&maintenance, 1)
+	defer atomic.StoreInt32(&maintenance, 0)
+
+	before, err := backup.Restore(name)
+	if err != nil {
+		return before, errors.As(err)
+	}
+
+	// 备份可能是旧版本的结构
+	if _, err := migrate.Migrate(); err != nil {
+		if _, e := backup.Restore(before.Name); e != nil {
+			log.Error("%v", errors.As(e, before.Name))
+		}
+
+		return before, errors.As(err, name)
+	}
+
+	return before, nil
+}
+
+// 检查数据库完整性
+func (c *BackupController) CheckBackup() {
+	if err := backup.Check(); err != nil {
+		c.WriteHttpResponse(backupErrCode(err), nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, "ok", nil)
+	return
+}
@@ -5,9 +5,16 @@ import (
 	"fmt"
 
 	"github.com/astaxie/beego"
+	"github.com/beego/ms304w-client/basis/conf"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/permission"
 )
 
+// 请求上下文中保存登录身份的key
+const IdentityKey = "identity"
+
 type BaseController struct {
 	beego.Controller
 }
@@ -84,3 +91,100 @@ func (c *BaseController) WriteHttpResponse(code int, data interface{}, err error
 	c.ServeJSON()
 	// c.StopRun()
 }
+
+// 当前请求的登录身份,未登录返回系统身份
+func (c *BaseController) Identity() *Identity {
+	if v, ok := c.Ctx.Input.GetData(IdentityKey).(*Identity); ok && v != nil {
+		return v
+	}
+
+	if v := OAuth.Identity(c.Ctx.Request.Header.Get("Token")); v != nil {
+		return v
+	}
+
+	return SystemIdentity
+}
+
+// 检查后台用户权限,无权限时返回403
+// 未开启登录验证时不检查
+func (c *BaseController) CheckPermission(tag string) bool {
+	if !conf.DefaultBool("oauth", false) {
+		return true
+	}
+
+	identity := c.Identity()
+	if identity.Type == IDENTITY_USER {
+		ok, err := permission.UserHasPermission(identity.Id, tag)
+		if err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return false
+		}
+
+		if ok {
+			return true
+		}
+	}
+
+	c.WriteHttpResponse(403, nil, errors.New("permission denied").As(tag))
+	return false
+}
+
+// 当前操作人,用于CreatedBy/UpdatedBy
+func (c *BaseController) Operator() string {
+	return c.Identity().Name
+}
+
+// 记录审计日志,失败只记录错误不影响业务
+func (c *BaseController) Audit(action, entityType string, entityId int, before, after interface{}) {
+	WriteAudit(c.Identity(), c.Ctx.Request.Method, c.Ctx.Request.URL.Path, action, entityType, entityId, before, after)
+}
+
+// 记录审计日志,供回调等非控制器调用
+func WriteAudit(identity *Identity, method, route, action, entityType string, entityId int, before, after interface{}) {
+	if identity == nil {
+		identity = SystemIdentity
+	}
+
+	beforeStr, err := audit.Marshal(before)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	afterStr, err := audit.Marshal(after)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	if err := audit.InsertAudit(&audit.Audit{
+		Created:    timex.String(),
+		ActorType:  identity.Type,
+		ActorId:    identity.Id,
+		ActorName:  identity.Name,
+		Method:     method,
+		Route:      route,
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Before:     beforeStr,
+		After:      afterStr,
+	}); err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	// 开门不是数据变更
+	if action == audit.OPEN {
+		return
+	}
+
+	Publish(&EntityChanged{
+		Identity:   identity,
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Before:     before,
+		After:      after,
+	})
+}
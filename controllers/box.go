@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/syncx"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+)
+
+type BoxController struct {
+	BaseController
+}
+
+// 校验地址和串口服务
+func validBox(obj *box.Box) error {
+	if obj.Addr <= 0 {
+		return errors.New("addr is illegal").As(obj.Addr)
+	}
+
+	if len(obj.Url) > 0 && !syncx.Valid(obj.Url) {
+		return errors.New("url is illegal").As(obj.Url)
+	}
+
+	// 地址用于路由回调,不能重复
+	old, err := box.BoxByAddr(obj.Addr)
+	if err != nil {
+		if !box.ErrBoxNotFound.Equal(err) {
+			return errors.As(err)
+		}
+
+		return nil
+	}
+
+	if old.Id != obj.Id {
+		return errors.As(box.ErrBoxAlreadyExist, obj.Addr)
+	}
+
+	return nil
+}
+
+// 重新加载柜子
+func reloadCabinets() {
+	if err := LoadCabinets(); err != nil {
+		log.Error("%v", errors.As(err))
+	}
+}
+
+// 添加
+func (c *BoxController) AddBox() {
+	obj := &box.Box{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	obj.Id = 0
+	if err := validBox(obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := box.InsertBox(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "box", obj.Id, nil, obj)
+
+	reloadCabinets()
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 修改
+func (c *BoxController) EditBox() {
+	obj := &box.Box{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := box.BoxById(obj.Id)
+	if err != nil {
+		if box.ErrBoxNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := validBox(obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj.Created = old.Created
+	obj.CreatedBy = old.CreatedBy
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := box.UpdateBox(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "box", obj.Id, old, obj)
+
+	reloadCabinets()
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 删除,柜子下还有格子时不能删除
+func (c *BoxController) DelBox() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := box.BoxById(id)
+	if err != nil {
+		if box.ErrBoxNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	total, _, err := box.GridList(map[string]interface{}{
+		"startDate": "",
+		"endDate":   "",
+		"boxId":     id,
+		"sensorId":  0,
+		"name":      "",
+	}, 1, 1)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if total > 0 {
+		c.WriteHttpResponse(400, nil, errors.New("box has grids").As(id, total))
+		return
+	}
+
+	if err := box.DelBox(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "box", id, old, nil)
+
+	reloadCabinets()
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 根据ID查询
+func (c *BoxController) BoxById() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := box.BoxById(id)
+	if err != nil {
+		if box.ErrBoxNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有
+func (c *BoxController) BoxList() {
+	name := c.GetString("name")
+
+	r, err := c.ListRequest("id:asc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["name"] = name
+
+	total, list, err := box.BoxList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 所有柜子健康状态
+func (c *BoxController) Health() {
+	c.WriteHttpResponse(200, CabinetHealthList(), nil)
+	return
+}
+
+// 单个柜子健康状态,按柜子地址
+func (c *BoxController) HealthByAddr() {
+	addr, err := strconv.Atoi(c.Ctx.Input.Param(":addr"))
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	for _, v := range CabinetHealthList() {
+		if v.Addr == addr {
+			c.WriteHttpResponse(200, v, nil)
+			return
+		}
+	}
+
+	c.WriteHttpResponse(404, nil, errors.As(box.ErrBoxNotFound, addr))
+	return
+}
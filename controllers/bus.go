@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"github.com/beego/ms304w-client/basis/bus"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 业务事件
+const (
+	// 订单结算
+	TOPIC_ORDER_SETTLED = "order.settled"
+	// 库存变化
+	TOPIC_STOCK_CHANGED = "stock.changed"
+	// 开门
+	TOPIC_DOOR_OPENED = "door.opened"
+	// 关门
+	TOPIC_DOOR_CLOSED = "door.closed"
+	// 低于安全库存
+	TOPIC_LOW_STOCK = "stock.low"
+	// 刷卡
+	TOPIC_CARD_SWIPED = "card.swiped"
+	// 清0、矫正完成
+	TOPIC_CALIBRATION_DONE = "calibration.done"
+	// 自动盘点开始
+	TOPIC_AUTO_STARTED = "auto.started"
+	// 数据增删改,审计日志写入后发布
+	TOPIC_ENTITY_CHANGED = "entity.changed"
+)
+
+// 进程内事件总线
+var Bus = bus.New()
+
+var topics = map[string]bool{
+	TOPIC_ORDER_SETTLED:    true,
+	TOPIC_STOCK_CHANGED:    true,
+	TOPIC_DOOR_OPENED:      true,
+	TOPIC_DOOR_CLOSED:      true,
+	TOPIC_LOW_STOCK:        true,
+	TOPIC_CARD_SWIPED:      true,
+	TOPIC_CALIBRATION_DONE: true,
+	TOPIC_AUTO_STARTED:     true,
+	TOPIC_ENTITY_CHANGED:   true,
+}
+
+// 是否为已定义事件
+func ValidTopic(topic string) bool {
+	return topics[topic]
+}
+
+type OrderSettled struct {
+	Order  *order.Order `json:"order"`
+	Result *ResData     `json:"result"`
+	Route  string       `json:"route"`
+}
+
+func (e *OrderSettled) Topic() string {
+	return TOPIC_ORDER_SETTLED
+}
+
+// 库存变化的原因和来源单据
+type StockRef struct {
+	Reason  string `json:"reason"`
+	RefType string `json:"refType"`
+	RefId   int    `json:"refId"`
+	Note    string `json:"note"`
+}
+
+// Before为nil是新增,After为nil是删除
+type StockChanged struct {
+	Identity *Identity    `json:"identity"`
+	Method   string       `json:"method"`
+	Route    string       `json:"route"`
+	Ref      *StockRef    `json:"ref"`
+	Before   *order.Stock `json:"before"`
+	After    *order.Stock `json:"after"`
+}
+
+func (e *StockChanged) Topic() string {
+	return TOPIC_STOCK_CHANGED
+}
+
+func (e *StockChanged) Action() string {
+	if e.Before == nil {
+		return audit.CREATE
+	}
+
+	if e.After == nil {
+		return audit.DELETE
+	}
+
+	return audit.UPDATE
+}
+
+func (e *StockChanged) Stock() *order.Stock {
+	if e.After != nil {
+		return e.After
+	}
+
+	return e.Before
+}
+
+type DoorOpened struct {
+	Identity *Identity `json:"identity"`
+	Method   string    `json:"method"`
+	Route    string    `json:"route"`
+	// box或grid
+	EntityType string `json:"entityType"`
+	EntityId   int    `json:"entityId"`
+	// 柜子通信ID
+	BoxId int `json:"boxId"`
+	// 串口开门参数
+	Params map[string]interface{} `json:"params"`
+}
+
+func (e *DoorOpened) Topic() string {
+	return TOPIC_DOOR_OPENED
+}
+
+type DoorClosed struct {
+	UUID      string `json:"uuid"`
+	BoxId     int    `json:"boxId"`
+	GridId    int    `json:"gridId"`
+	Operation int    `json:"operation"`
+	Weight    int    `json:"weight"`
+}
+
+func (e *DoorClosed) Topic() string {
+	return TOPIC_DOOR_CLOSED
+}
+
+type LowStock struct {
+	GridId     int `json:"gridId"`
+	MaterialId int `json:"materialId"`
+	Qty        int `json:"qty"`
+	SafeQty    int `json:"safeQty"`
+}
+
+func (e *LowStock) Topic() string {
+	return TOPIC_LOW_STOCK
+}
+
+// 不含密码和token
+type CardSwiped struct {
+	Card   string `json:"card"`
+	Reader string `json:"reader"`
+	// 刷卡的柜子通信ID,0为本机读卡器
+	BoxId int `json:"boxId"`
+	// 用户,未绑定为0
+	AccountId int    `json:"accountId"`
+	Username  string `json:"username"`
+}
+
+func (e *CardSwiped) Topic() string {
+	return TOPIC_CARD_SWIPED
+}
+
+type CalibrationDone struct {
+	// zero或measure
+	Kind string  `json:"kind"`
+	Data *CbData `json:"data"`
+}
+
+func (e *CalibrationDone) Topic() string {
+	return TOPIC_CALIBRATION_DONE
+}
+
+type AutoStarted struct {
+}
+
+func (e *AutoStarted) Topic() string {
+	return TOPIC_AUTO_STARTED
+}
+
+// Before为nil是新增,After为nil是删除
+type EntityChanged struct {
+	Identity   *Identity   `json:"identity"`
+	Action     string      `json:"action"`
+	EntityType string      `json:"entityType"`
+	EntityId   int         `json:"entityId"`
+	Before     interface{} `json:"before"`
+	After      interface{} `json:"after"`
+}
+
+func (e *EntityChanged) Topic() string {
+	return TOPIC_ENTITY_CHANGED
+}
+
+// 发布事件,处理失败只记录错误
+func Publish(e bus.Event) {
+	if err := Bus.Publish(e); err != nil {
+		log.Error("%s %v", e.Topic(), errors.As(err))
+	}
+}
+
+// 发布库存变化
+func PublishStockChanged(identity *Identity, method, route string, ref *StockRef, before, after *order.Stock) {
+	if before != nil {
+		b := *before
+		before = &b
+	}
+
+	if after != nil {
+		a := *after
+		after = &a
+	}
+
+	Publish(&StockChanged{
+		Identity: identity,
+		Method:   method,
+		Route:    route,
+		Ref:      ref,
+		Before:   before,
+		After:    after,
+	})
+}
+
+// 发布开门
+func (c *BaseController) DoorOpened(entityType string, entityId int, params map[string]interface{}) {
+	boxId, _ := params["boxId"].(int)
+
+	Publish(&DoorOpened{
+		Identity:   c.Identity(),
+		Method:     c.Ctx.Request.Method,
+		Route:      c.Ctx.Request.URL.Path,
+		EntityType: entityType,
+		EntityId:   entityId,
+		BoxId:      boxId,
+		Params:     params,
+	})
+}
+
+func init() {
+	Bus.OnError(func(e bus.Event, err error) {
+		log.Error("%s %v", e.Topic(), errors.As(err))
+	})
+
+	Bus.Subscribe(bus.ALL, socketSubscriber)
+	Bus.Subscribe(TOPIC_STOCK_CHANGED, auditSubscriber)
+	Bus.Subscribe(TOPIC_DOOR_OPENED, auditSubscriber)
+	Bus.Subscribe(TOPIC_ORDER_SETTLED, inspectionSubscriber)
+	Bus.Subscribe(TOPIC_ORDER_SETTLED, kitSubscriber)
+	Bus.SubscribeAsync(TOPIC_STOCK_CHANGED, lowStockSubscriber, 100)
+}
+
+// 推送给socket和WebSocket、SSE客户端
+func socketSubscriber(e bus.Event) error {
+	switch v := e.(type) {
+	case *OrderSettled:
+		EmitGrid(v.Order.GridId, EVENT_INVENTORY, v.Result)
+		EmitAccount(v.Order.AccountId, EVENT_INVENTORY, v.Result)
+
+	case *DoorOpened:
+		EmitBox(v.BoxId, EVENT_DOOR_OPENED, v.Params)
+
+	case *DoorClosed:
+		EmitBox(v.BoxId, EVENT_WEIGHT, v.Weight)
+
+	case *LowStock:
+		EmitGrid(v.GridId, EVENT_LOW_STOCK, v)
+
+	case *CalibrationDone:
+		EmitBox(v.Data.BoxId, v.Kind, v.Data)
+
+	case *AutoStarted:
+		EmitBox(0, EVENT_AUTO, "success")
+	}
+
+	return nil
+}
+
+// 库存变化和开门写审计日志
+func auditSubscriber(e bus.Event) error {
+	switch v := e.(type) {
+	case *StockChanged:
+		WriteAudit(v.Identity, v.Method, v.Route, v.Action(), "stock", v.Stock().Id, v.Before, v.After)
+
+	case *DoorOpened:
+		WriteAudit(v.Identity, v.Method, v.Route, audit.OPEN, v.EntityType, v.EntityId, nil, v.Params)
+	}
+
+	return nil
+}
+
+// 库存降到安全库存以下时发布LowStock
+func lowStockSubscriber(e bus.Event) error {
+	v, ok := e.(*StockChanged)
+	if !ok {
+		return nil
+	}
+
+	// 恢复备份时等待
+	writerLock.RLock()
+	defer writerLock.RUnlock()
+
+	stock := v.Stock()
+
+	grid, err := box.GridById(stock.GridId)
+	if err != nil {
+		return errors.As(err, stock.GridId)
+	}
+
+	if grid.SafeQty <= 0 {
+		return nil
+	}
+
+	var before, after int
+	if v.Before != nil {
+		before = v.Before.Qty
+	} else {
+		before = grid.SafeQty
+	}
+	if v.After != nil {
+		after = v.After.Qty
+	}
+
+	// 只在跌破时发布一次
+	if after >= grid.SafeQty || before < grid.SafeQty {
+		return nil
+	}
+
+	Publish(&LowStock{
+		GridId:     grid.Id,
+		MaterialId: stock.MaterialId,
+		Qty:        after,
+		SafeQty:    grid.SafeQty,
+	})
+
+	return nil
+}
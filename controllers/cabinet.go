@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/box"
+)
+
+// 柜子健康状态
+type CabinetHealth struct {
+	BoxId int    `json:"boxId"`
+	Addr  int    `json:"addr"`
+	Name  string `json:"name"`
+	Url   string `json:"url"`
+	Port  string `json:"port"`
+	// 串口服务是否可达
+	Online bool `json:"online"`
+	// 最后一次收到回调或命令成功
+	LastSeen string `json:"lastSeen"`
+	// 最后一次检查
+	LastCheck string `json:"lastCheck"`
+	LastErr   string `json:"lastErr"`
+	// 连续失败次数
+	Failures int `json:"failures"`
+	// 连接的柜子客户端数量
+	Kiosks int `json:"kiosks"`
+}
+
+type cabinet struct {
+	transport Transport
+	health    CabinetHealth
+}
+
+var (
+	cabinetLock = &sync.RWMutex{}
+	// 按柜子地址
+	cabinets = make(map[int]*cabinet)
+)
+
+// 按柜子发送,带上串口并记录健康状态
+type cabinetTransport struct {
+	addr      int
+	port      string
+	transport Transport
+}
+
+func (t *cabinetTransport) Post(path string, params map[string]interface{}) ([]byte, error) {
+	if len(t.port) > 0 {
+		params["port"] = t.port
+	}
+
+	bytes, err := t.transport.Post(path, params)
+	markCabinet(t.addr, err)
+
+	return bytes, err
+}
+
+func (t *cabinetTransport) Get(path string) ([]byte, error) {
+	bytes, err := t.transport.Get(path)
+	markCabinet(t.addr, err)
+
+	return bytes, err
+}
+
+// 启动时加载柜子并定时检查
+func StartCabinets() {
+	if err := LoadCabinets(); err != nil {
+		log.Error("%v", errors.As(err))
+	}
+
+	go cabinetWorker()
+}
+
+// 重新加载柜子,保留已有健康状态
+func LoadCabinets() error {
+	list, err := box.EnableBoxes()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	cabinetLock.Lock()
+	defer cabinetLock.Unlock()
+
+	m := make(map[int]*cabinet, len(list))
+	for _, v := range list {
+		url := v.Url
+		if len(url) == 0 {
+			url = API_URL
+		}
+
+		obj := &cabinet{
+			transport: &cabinetTransport{
+				addr:      v.Addr,
+				port:      v.Port,
+				transport: NewRestTransport(url),
+			},
+		}
+
+		if old, ok := cabinets[v.Addr]; ok {
+			obj.health = old.health
+		}
+
+		obj.health.BoxId = v.Id
+		obj.health.Addr = v.Addr
+		obj.health.Name = v.Name
+		obj.health.Url = url
+		obj.health.Port = v.Port
+
+		m[v.Addr] = obj
+	}
+
+	cabinets = m
+
+	return nil
+}
+
+// 柜子是否启用,没有配置柜子时只有默认柜子
+func CabinetEnabled(addr int) bool {
+	cabinetLock.RLock()
+	defer cabinetLock.RUnlock()
+
+	if len(cabinets) == 0 {
+		return addr > 0
+	}
+
+	_, ok := cabinets[addr]
+	return ok
+}
+
+// 柜子的串口服务,未配置时使用默认服务
+func SerialByAddr(addr int) Transport {
+	cabinetLock.RLock()
+	defer cabinetLock.RUnlock()
+
+	if obj, ok := cabinets[addr]; ok {
+		return obj.transport
+	}
+
+	return Serial
+}
+
+// 格子所在柜子的串口服务
+func SerialByGrid(gridId int) (Transport, error) {
+	grid, err := box.GridById(gridId)
+	if err != nil {
+		return nil, errors.As(err, gridId)
+	}
+
+	return SerialByAddr(grid.Addr), nil
+}
+
+// 所有柜子的地址,没有柜子时返回空
+func CabinetAddrs() []int {
+	cabinetLock.RLock()
+	defer cabinetLock.RUnlock()
+
+	list := make([]int, 0, len(cabinets))
+	for addr := range cabinets {
+		list = append(list, addr)
+	}
+
+	return list
+}
+
+// 收到柜子回调
+func TouchCabinet(addr int) {
+	markCabinet(addr, nil)
+}
+
+// 记录命令结果,在线状态变化时推送
+func markCabinet(addr int, err error) {
+	cabinetLock.Lock()
+	obj, ok := cabinets[addr]
+	if !ok {
+		cabinetLock.Unlock()
+		return
+	}
+
+	online := obj.health.Online
+	if err != nil {
+		obj.health.Failures++
+		obj.health.LastErr = err.Error()
+		// 连续失败才认为离线
+		if obj.health.Failures >= conf.DefaultInt("cabinet_max_failures", 3) {
+			obj.health.Online = false
+		}
+	} else {
+		obj.health.Failures = 0
+		obj.health.LastErr = ""
+		obj.health.LastSeen = timex.String()
+		obj.health.Online = true
+	}
+
+	health := obj.health
+	cabinetLock.Unlock()
+
+	if health.Online != online {
+		log.Warn("box %d online: %v", addr, health.Online)
+		EmitBox(addr, EVENT_BOX_HEALTH, &health)
+	}
+}
+
+// 所有柜子健康状态
+func CabinetHealthList() []*CabinetHealth {
+	cabinetLock.RLock()
+	list := make([]*CabinetHealth, 0, len(cabinets))
+	for _, v := range cabinets {
+		health := v.health
+		list = append(list, &health)
+	}
+	cabinetLock.RUnlock()
+
+	for _, v := range list {
+		v.Kiosks = roomCount(RoomBox(v.Addr))
+	}
+
+	return list
+}
+
+// 房间内连接数量
+func roomCount(room string) int {
+	socketLock.Lock()
+	defer socketLock.Unlock()
+
+	count := 0
+	for _, sess := range socketSessions {
+		if sess.rooms[room] {
+			count++
+		}
+	}
+
+	return count
+}
+
+// 定时查询柜子状态
+func cabinetWorker() {
+	interval := time.Duration(conf.DefaultInt("cabinet_check_interval", 30)) * time.Second
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkCabinets()
+	}
+}
+
+// 查询一次所有柜子,恢复备份时等待,回调在维护中会被拒绝
+func checkCabinets() {
+	writerLock.RLock()
+	defer writerLock.RUnlock()
+
+	for _, addr := range CabinetAddrs() {
+		cabinetLock.Lock()
+		if obj, ok := cabinets[addr]; ok {
+			obj.health.LastCheck = timex.String()
+		}
+		cabinetLock.Unlock()
+
+		// 状态通过boxStatus回调返回
+		if _, err := SerialByAddr(addr).Get(fmt.Sprintf(SERIAL_ALL_STATUS, addr)); err != nil {
+			log.Warn("%v", errors.As(err, addr))
+		}
+	}
+}
@@ -1,258 +1,107 @@
 package controllers
 
 import (
-	"encoding/hex"
-	"fmt"
-	"io"
-	"reflect"
-	"strings"
 	"time"
 
+	"github.com/beego/ms304w-client/basis/card"
 	"github.com/beego/ms304w-client/basis/conf"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/account"
 	"github.com/tarm/goserial"
 )
 
-const (
-	// 命令头
-	HDR byte = 0x1b
-)
-
 var cardCom = &serial.Config{
-	Name:        conf.String("com_card_name"),
-	Baud:        conf.Int("com_card_baud"),
-	ReadTimeout: time.Duration(conf.Int("com_card_read_timeout")) * time.Millisecond,
+	Name:        conf.DefaultString("com_card_name", ""),
+	Baud:        conf.DefaultInt("com_card_baud", 9600),
+	ReadTimeout: time.Duration(conf.DefaultInt("com_card_read_timeout", 500)) * time.Millisecond,
 }
 
-var (
-	cardRw io.ReadWriteCloser
-	// 全局队列
-	cardQueue = make(chan byte, 255)
-)
-
-func init() {
-	/*
-		if cardRw != nil {
-			return
-		}
-
-		s, err := serial.OpenPort(cardCom)
-		if err != nil {
-			panic(err)
-		}
-
-		cardRw = s
-	*/
-
-	/*
-		// 写数据到串口
-		w := NewWriteCardCom()
-		go WriteCardToCom(w.ComData())
-
-		// 从串口读数据到队列
-		go ReadCardToQueue()
-
-		// 处理队列数据
-		go ReadCardQueue()
-	*/
-}
+var cardDriver *card.Driver
 
-// -------------------------------------
-// 定义写操作结构体
-// var dataArray = []string{"1b", "01", "00", "00", "00", "00", "00"}
-// var dataArray = []byte{27, 1, 0, 0, 0, 0, 0}
-type WriterCardCom struct {
-	Hdr   byte // 1命令头 0x1b
-	Cmd   byte // 2命令码
-	Seq   byte // 3命令序号，指定天线板序号 0..
-	State byte // 4命令状态
-	Opt1  byte // 5命令操作码，保留
-	Opt2  byte // 6命令操作码，保留
-	Opt3  byte // 7命令操作码，保留
+// 刷卡登录结果
+type CardLogin struct {
+	// 卡号
+	Card string `json:"card"`
+	// 读卡器类型
+	Reader string `json:"reader"`
+	// 用户,未绑定为空
+	Account *LoginAccount `json:"account"`
 }
 
-func NewWriteCardCom() *WriterCardCom {
-	// writer
-	return &WriterCardCom{
-		Hdr:   HDR,
-		Cmd:   0x01,
-		Seq:   0x00,
-		State: 0x00,
-		Opt1:  0x00,
-		Opt2:  0x00,
-		Opt3:  0x00,
+// 启动读卡器,card_enable关闭时由串口服务回调刷卡
+func StartCardReader() error {
+	if !conf.DefaultBool("card_enable", false) {
+		return nil
 	}
-}
-
-func (w *WriterCardCom) ComData() []byte {
-	var bytes = make([]byte, 0)
 
-	t := reflect.TypeOf(*w)
-	v := reflect.ValueOf(*w)
-
-	for i := 0; i < t.NumField(); i++ {
-		bytes = append(bytes, v.Field(i).Interface().(byte))
+	reader, err := newCardReader(conf.DefaultString("card_reader", card.RF))
+	if err != nil {
+		return errors.As(err)
 	}
 
-	fmt.Printf("write: %X\n", bytes)
+	cardDriver = card.NewDriver(reader, time.Duration(conf.DefaultInt("card_retry", 1000))*time.Millisecond)
+	cardDriver.Start()
 
-	return bytes
-}
+	go func() {
+		for event := range cardDriver.Events() {
+			LoginByCardEvent(event, 0)
+		}
+	}()
 
-// ----------------------------------
-// 定义读操作结构体
-type ReaderCardCom struct {
-	Hdr   byte   // 命令头 0x1b
-	Cmd   byte   // 命令码
-	Seq   byte   // 命令序号，指定天线板序号 0..
-	State byte   // 命令状态
-	Opt   byte   // 命令操作码，保留
-	Len   byte   // 命令数据长度，不超过255
-	Data  []byte // 命令数据内容
-	Sign  byte   // 校验码
-	// 当前位置
-	Flag int // 一次读一个字节，依次处理
-	// 异常
-	Err error
+	return nil
 }
 
-func NewReaderCardCom() *ReaderCardCom {
-	return &ReaderCardCom{
-		Data: make([]byte, 0),
+func newCardReader(name string) (card.Reader, error) {
+	switch name {
+	case card.RF:
+		interval := time.Duration(conf.DefaultInt("card_poll_interval", 1000)) * time.Millisecond
+		return card.NewRfReader(card.NewSerialPort(cardCom), interval), nil
+	case card.WIEGAND:
+		return card.NewWiegandReader(card.NewSerialPort(cardCom)), nil
+	case card.WEDGE:
+		return card.NewWedgeReader(card.NewFilePort(conf.String("card_wedge_device"))), nil
 	}
+
+	return nil, errors.New("card reader undefined").As(name)
 }
 
-func (r *ReaderCardCom) Card() {
-	if len(r.Data) > 0 {
-		card := hex.EncodeToString(r.Data)
-		card = strings.ToUpper(card)
-		log.Info("card: %s", card)
+// 刷卡登录,成功时下发token,boxId为刷卡的柜子,0为本机读卡器
+func LoginByCardEvent(event *card.Event, boxId int) {
+	log.Info("card: %s, reader: %s, box: %d", event.Card, event.Reader, boxId)
 
-		Server.BroadcastTo("login", "loginByCard", card)
+	swiped := &CardSwiped{
+		Card:   event.Card,
+		Reader: event.Reader,
+		BoxId:  boxId,
 	}
-}
 
-// 往串口写数据
-func WriteCardToCom(bytes []byte) {
-	for {
-		fmt.Println("writing.....")
-		if _, err := cardRw.Write(bytes); err != nil {
-			log.Error("WriteCardToCom: %v", errors.As(err))
-		}
-
-		time.Sleep(1 * 1e9)
+	result := &CardLogin{
+		Card:   event.Card,
+		Reader: event.Reader,
 	}
-}
 
-// 从串口读数据到队列
-func ReadCardToQueue() {
-	for {
-		fmt.Println("reading to queue.....")
-		buf := make([]byte, 1)
-		n, err := cardRw.Read(buf)
-		if err != nil {
-			panic(err)
+	acc, err := account.AccountByCard(event.Card)
+	if err != nil {
+		if !account.ErrAccountNotFound.Equal(err) {
+			log.Error("LoginByCardEvent: %v", errors.As(err))
 		}
-		fmt.Printf("read n: %d, buf: %X\n", n, buf)
-
-		if n == 1 {
-			cardQueue <- buf[0]
+	} else {
+		swiped.AccountId = acc.Id
+		swiped.Username = acc.Username
+
+		result.Account = &LoginAccount{
+			Id:       acc.Id,
+			Username: acc.Username,
+			Token: OAuth.Add(&Identity{
+				Type: IDENTITY_ACCOUNT,
+				Id:   acc.Id,
+				Name: acc.Username,
+			}),
 		}
 	}
-}
-
-func ReadCardQueue() {
-	rc := NewReaderCardCom()
-
-	// 处理数据
-	for {
-		fmt.Println("reading queue..........")
-		select {
-		case q := <-cardQueue:
-			fmt.Printf("queue: %X\n", q)
-
-			fmt.Println("Flag.........", rc.Flag)
-			switch rc.Flag {
-			case 0: // 命令头
-				fmt.Println("00000000000", q == HDR)
-				if q == HDR {
-					rc.Hdr = q
-					rc.Flag = rc.Flag + 1
-				}
-
-				break
-			case 1: // 命令码
-				fmt.Println("11111111111")
-				rc.Cmd = q
-				rc.Flag = rc.Flag + 1
-
-				break
-
-			case 2: // 命令序号
-				fmt.Println("22222222222222")
-				rc.Seq = q
-				rc.Flag = rc.Flag + 1
-
-				break
-			case 3: // 命令状态
-				fmt.Println("3333333333333")
-				rc.State = q
-				rc.Flag = rc.Flag + 1
-
-				break
-			case 4: // 命令操作码
-				fmt.Println("4444444444444")
-				rc.Opt = q
-				rc.Flag = rc.Flag + 1
-
-				break
-			case 5: // 命令数据长度
-				fmt.Println("5555555555")
-				rc.Len = q
-				if int(rc.Len) == 0 {
-					// 没有数据内容
-					rc.Flag = rc.Flag + 2
-				} else {
-					rc.Flag = rc.Flag + 1
-				}
 
-				break
-			case 6: // 数据内容
-				fmt.Println("6666666666666", int(rc.Len))
-				fmt.Println(int(rc.Len), len(rc.Data))
+	// token只推送到刷卡的柜子,事件总线上不带token
+	emitLogin(boxId, EVENT_LOGIN_BY_CARD, result)
 
-				rc.Data = append(rc.Data, q)
-
-				rc.Sign = rc.Sign ^ q
-
-				if int(rc.Len) == len(rc.Data) {
-					rc.Flag = rc.Flag + 1
-				}
-
-				fmt.Printf("Data........%X\n", rc.Data)
-
-				break
-			case 7:
-				fmt.Println("77777777777777777")
-				if rc.Sign == q {
-					rc.Sign = q
-					rc.Flag = rc.Flag + 1
-
-					fmt.Println("success----------------")
-
-					// 处理业务
-					rc.Card()
-				}
-
-				// 初始化
-				rc = &ReaderCardCom{
-					Data: make([]byte, 0),
-				}
-
-				break
-			default:
-				log.Warn("%v", errors.New("undefined").As(rc.Flag))
-			}
-		}
-	}
+	Publish(swiped)
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/material"
 )
 
@@ -44,11 +45,14 @@ func (c *CategoryController) AddCategory() {
 	}
 
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := material.InsertCategory(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "category", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -82,12 +86,16 @@ func (c *CategoryController) EditCategory() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := material.UpdateCategory(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "category", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -107,11 +115,25 @@ func (c *CategoryController) DelCategory() {
 		return
 	}
 
+	// 删除前数据
+	before, err := material.CategoryById(categoryId)
+	if err != nil {
+		if material.ErrCategoryNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := material.DelCategory(categoryId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "category", categoryId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -4,9 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/beego/ms304w-client/basis/card"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/fusion"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/costcenter"
+	"github.com/beego/ms304w-client/models/inventory"
+	"github.com/beego/ms304w-client/models/ledger"
 	"github.com/beego/ms304w-client/models/material"
 	"github.com/beego/ms304w-client/models/order"
 )
@@ -15,6 +24,18 @@ type CallbackController struct {
 	BaseController
 }
 
+// 收到回调说明柜子在线
+func (c *CallbackController) Prepare() {
+	obj := &SerialRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, obj); err != nil {
+		return
+	}
+
+	if obj.Data != nil && obj.Data.BoxId > 0 {
+		TouchCabinet(obj.Data.BoxId)
+	}
+}
+
 type SerialRequest struct {
 	Api  string  `json:"api"`
 	Code int     `json:"code"`
@@ -68,7 +89,16 @@ func (c *CallbackController) Card() {
 		return
 	}
 
-	Server.BroadcastTo("login", "loginByCard", obj.Data)
+	if obj.Data == nil || len(obj.Data.Card) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("card is empty"))
+		return
+	}
+
+	LoginByCardEvent(&card.Event{
+		Reader: "serial",
+		Card:   strings.ToUpper(obj.Data.Card),
+		Time:   time.Now(),
+	}, obj.Data.BoxId)
 
 	c.WriteHttpResponse(200, nil, nil)
 	return
@@ -97,7 +127,13 @@ func (c *CallbackController) Weight() {
 		return
 	}
 
-	Server.BroadcastTo("login", "weight", cbData.Weight)
+	Publish(&DoorClosed{
+		UUID:      cbData.UUID,
+		BoxId:     cbData.BoxId,
+		GridId:    cbData.GridId,
+		Operation: cbData.Operation,
+		Weight:    cbData.Weight,
+	})
 
 	if cbData.Operation != LOCK_WEIGHT {
 		i := WeightCallback(cbData.UUID, cbData.Weight)
@@ -127,13 +163,6 @@ func WeightCallback(orderIdStr string, gridWeight int) int {
 		return 0
 	}
 
-	// 结果返回
-	resData := &ResData{
-		MaterialId: o.MaterialId,
-		Type:       o.Type,
-	}
-
-	var qty int
 	// 查询物料传感器配置参数
 	materialSensor, err := material.SensorByMaterialId(o.MaterialId, o.SensorId)
 	if err != nil {
@@ -147,36 +176,60 @@ func WeightCallback(orderIdStr string, gridWeight int) int {
 		return 0
 	}
 
-	if gridWeight > 0 {
-		minQty := params.Weight - params.Lower
-		maxQty := params.Weight + params.ComeUp
-		log.Info("WEIGHT value %d, params weight %d, min %d, max %d", gridWeight, params.Weight, minQty, maxQty)
+	qty := fusion.WeightQty(gridWeight, params.Weight, params.ComeUp, params.Lower)
+	log.Info("WEIGHT value %d, params weight %d, qty %d", gridWeight, params.Weight, qty)
 
-		// 取余数量
-		num := gridWeight / params.Weight
+	if _, err := SettleOrder(o, qty, "/v1/callback/weight"); err != nil {
+		log.Error("%v", errors.As(err))
+		return 0
+	}
 
-		// 剩余数量
-		subQty := gridWeight - num*params.Weight
+	return 1
+}
 
-		log.Info("weight %d", num)
+// 按结算数量更新订单和库存
+func SettleOrder(o *order.Order, qty int, route string) (*ResData, error) {
+	// 结果返回
+	resData := &ResData{
+		MaterialId: o.MaterialId,
+		Type:       o.Type,
+	}
 
-		if minQty <= subQty && subQty <= maxQty {
-			qty = num + 1
-		} else {
-			qty = num
-		}
+	log.Info("----------QTY---------- %d", qty)
 
-		log.Info("weight %d", qty)
+	// RFID格子的库存由标签计算,不按重量结算
+	grid, err := box.GridById(o.GridId)
+	if err != nil {
+		return nil, errors.As(err, o.GridId)
 	}
 
-	log.Info("----------QTY---------- %d", qty)
+	if grid.Mode == box.MODE_RFID {
+		return nil, errors.As(box.ErrGridRfid, o.GridId)
+	}
+
+	// 订单操作人
+	identity := &Identity{
+		Type: IDENTITY_ACCOUNT,
+		Id:   o.AccountId,
+	}
+
+	ref := &StockRef{
+		Reason:  ledger.SETTLE,
+		RefType: "order",
+		RefId:   o.Id,
+	}
+
+	// 订单、库存、台账和成本在同一事务中结算
+	v, err := settlement(o, ledgerSource(identity, ref))
+	if err != nil {
+		return nil, errors.As(err)
+	}
 
 	// 查询库存,如果新上料没有库存,领料和回收有库存
 	stockObj, err := order.StockByMaterialId(o.MaterialId, o.GridId)
 	if err != nil {
 		if !order.ErrStockNotFound.Equal(err) {
-			log.Error("%v", errors.As(err))
-			return 0
+			return nil, errors.As(err)
 		}
 
 		// 更新订单
@@ -184,29 +237,32 @@ func WeightCallback(orderIdStr string, gridWeight int) int {
 		o.BeforeQty = 0
 		o.Qty = qty
 		o.AfterQty = qty
-		if err := order.UpdateOrder(o); err != nil {
-			log.Error("%v", errors.As(err))
-			return 0
-		}
 
 		// insert
-		if err := order.InsertStock(&order.Stock{
+		v.Stock = &order.Stock{
 			Created:    timex.String(),
 			GridId:     o.GridId,
 			SensorId:   o.SensorId,
 			MaterialId: o.MaterialId,
 			Qty:        qty,
-		}); err != nil {
-			log.Error("%v", errors.As(err))
-			return 0
+		}
+		v.Cost.Qty = o.Qty
+		if err := inventory.Settle(v); err != nil {
+			return nil, errors.As(err)
 		}
 
+		PublishStockChanged(identity, "POST", route, ref, nil, v.Stock)
+
 		// res
 		resData.Qty = qty
 
 		log.Warn("result %s", resData.String())
-		Server.BroadcastTo("login", "inventory", resData)
-		return 1
+		Publish(&OrderSettled{
+			Order:  o,
+			Result: resData,
+			Route:  route,
+		})
+		return resData, nil
 	}
 
 	var updateQty int
@@ -219,15 +275,6 @@ func WeightCallback(orderIdStr string, gridWeight int) int {
 		// 领料
 		updateQty = stockObj.Qty - qty
 
-		// 删除空格子
-		// TODO:格子已为空
-		if qty == 0 {
-			if err := order.DelStockByGridId(o.GridId); err != nil {
-				log.Error("%v", errors.As(err))
-				return 0
-			}
-		}
-
 	case order.RECYCLE:
 		// 回收
 		updateQty = qty - stockObj.Qty
@@ -239,42 +286,60 @@ func WeightCallback(orderIdStr string, gridWeight int) int {
 	o.BeforeQty = stockObj.Qty
 	o.Qty = updateQty
 	o.AfterQty = qty
-	if err := order.UpdateOrder(o); err != nil {
-		log.Error("%v", errors.As(err))
-		return 0
-	}
 
-	// 更新库存
-	stockObj.Qty = qty
-	stockObj.Updated = timex.String()
-	if err := order.UpdateStock(stockObj); err != nil {
-		log.Error("%v", errors.As(err))
-		return 0
+	// 更新库存,领空时删除空格子
+	// TODO:格子已为空
+	before := *stockObj
+	v.Before = &before
+	if o.Type != order.OUT || qty != 0 {
+		stockObj.Qty = qty
+		stockObj.Updated = timex.String()
+		v.Stock = stockObj
 	}
+	v.Cost.Qty = o.Qty
+	if err := inventory.Settle(v); err != nil {
+		return nil, errors.As(err)
+	}
+
+	PublishStockChanged(identity, "POST", route, ref, v.Before, v.Stock)
 
 	// res
 	resData.Qty = updateQty
 
 	log.Warn("result %s", resData.String())
-	Server.BroadcastTo("login", "inventory", resData)
-	return 1
+	Publish(&OrderSettled{
+		Order:  o,
+		Result: resData,
+		Route:  route,
+	})
+	return resData, nil
 }
 
 func (c *CallbackController) Zero() {
-	resData := string(c.Ctx.Input.RequestBody)
-	log.Info("Zero: %s", resData)
+	data := c.callbackData(EVENT_ZERO)
+	if data == nil {
+		return
+	}
 
-	Server.BroadcastTo("login", "zero", resData)
+	Publish(&CalibrationDone{
+		Kind: EVENT_ZERO,
+		Data: data,
+	})
 
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
 
 func (c *CallbackController) Measure() {
-	resData := string(c.Ctx.Input.RequestBody)
-	log.Info("Measure: %s", resData)
+	data := c.callbackData(EVENT_MEASURE)
+	if data == nil {
+		return
+	}
 
-	Server.BroadcastTo("login", "measure", resData)
+	Publish(&CalibrationDone{
+		Kind: EVENT_MEASURE,
+		Data: data,
+	})
 
 	c.WriteHttpResponse(200, nil, nil)
 	return
@@ -340,27 +405,8 @@ func AutoInventory(orderIdStr string, gridWeight int) int {
 		return 0
 	}
 
-	if gridWeight > 0 {
-		minQty := params.Weight - params.Lower
-		maxQty := params.Weight + params.ComeUp
-		log.Info("WEIGHT value %d, params weight %d, min %d, max %d", gridWeight, params.Weight, minQty, maxQty)
-
-		// 取余数量
-		num := gridWeight / params.Weight
-
-		// 剩余数量
-		subQty := gridWeight - (num * params.Weight)
-
-		log.Info("weight %d", num)
-
-		if minQty <= subQty && subQty <= maxQty {
-			qty = num + 1
-		} else {
-			qty = num
-		}
-
-		log.Info("weight %d", qty)
-	}
+	qty = fusion.WeightQty(gridWeight, params.Weight, params.ComeUp, params.Lower)
+	log.Info("WEIGHT value %d, params weight %d, qty %d", gridWeight, params.Weight, qty)
 
 	log.Info("----------QTY---------- %d", qty)
 
@@ -380,45 +426,41 @@ func AutoInventory(orderIdStr string, gridWeight int) int {
 		return 0
 	}
 
+	identity := &Identity{
+		Type: IDENTITY_ACCOUNT,
+		Id:   o.AccountId,
+	}
+
+	ref := &StockRef{
+		Reason:  ledger.STOCKTAKE,
+		RefType: "auto",
+		RefId:   o.Id,
+	}
+
 	// 更新库存
+	before := *stockObj
 	stockObj.Qty = qty
 	stockObj.Updated = timex.String()
-	if err := order.UpdateStock(stockObj); err != nil {
+	if err := ledger.UpdateStock(&before, stockObj, ledgerSource(identity, ref)); err != nil {
 		log.Error("%v", errors.As(err))
 		return 0
 	}
 
+	PublishStockChanged(identity, "POST", "/v1/callback/weight/check", ref, &before, stockObj)
+
 	return 1
 }
 
 func (c *CallbackController) BoxStatus() {
-	resData := string(c.Ctx.Input.RequestBody)
-	log.Info("BoxStatus: %s", resData)
-
-	Server.BroadcastTo("login", "boxStatus", resData)
-
-	c.WriteHttpResponse(200, nil, nil)
-	return
+	c.emitCallback(EVENT_BOX_STATUS)
 }
 
 func (c *CallbackController) DoorStatus() {
-	resData := string(c.Ctx.Input.RequestBody)
-	log.Info("DoorStatus: %s", resData)
-
-	Server.BroadcastTo("login", "doorStatus", resData)
-
-	c.WriteHttpResponse(200, nil, nil)
-	return
+	c.emitCallback(EVENT_DOOR_STATUS)
 }
 
 func (c *CallbackController) Light() {
-	resData := string(c.Ctx.Input.RequestBody)
-	log.Info("Light: %s", resData)
-
-	Server.BroadcastTo("login", "light", resData)
-
-	c.WriteHttpResponse(200, nil, nil)
-	return
+	c.emitCallback(EVENT_LIGHT)
 }
 
 // -------------------------
@@ -438,7 +480,25 @@ func (c *CallbackController) Barcode() {
 		return
 	}
 
-	Server.BroadcastTo("login", "scanner", obj.Data)
+	// 条码是工单号时推送工单,领料时填入
+	if obj.Data != nil && obj.Data.Code != "" {
+		wo, err := costcenter.WorkOrderByCode(obj.Data.Code)
+		if err != nil {
+			if !costcenter.ErrWorkOrderNotFound.Equal(err) {
+				c.WriteHttpResponse(500, nil, errors.As(err))
+				return
+			}
+		}
+
+		if wo != nil {
+			EmitBox(obj.Data.BoxId, EVENT_WORK_ORDER, wo)
+
+			c.WriteHttpResponse(200, nil, nil)
+			return
+		}
+	}
+
+	EmitBox(0, EVENT_SCANNER, obj.Data)
 
 	c.WriteHttpResponse(200, nil, nil)
 	return
@@ -461,7 +521,7 @@ func (c *CallbackController) Qrcode() {
 		return
 	}
 
-	Server.BroadcastTo("login", "scanner", obj.Data)
+	EmitBox(0, EVENT_SCANNER, obj.Data)
 
 	c.WriteHttpResponse(200, nil, nil)
 	return
@@ -484,7 +544,75 @@ func (c *CallbackController) Finger() {
 		return
 	}
 
-	Server.BroadcastTo("login", "finger", obj)
+	if obj.Data == nil {
+		EmitBox(0, EVENT_FINGER, obj)
+
+		c.WriteHttpResponse(200, nil, nil)
+		return
+	}
+
+	// 录入回调,uuid为录入ID
+	if enrollId, err := strconv.Atoi(obj.Data.UUID); err == nil {
+		enroll, err := account.FingerEnrollById(enrollId)
+		if err != nil {
+			if account.ErrFingerEnrollNotFound.Equal(err) {
+				c.WriteHttpResponse(404, nil, errors.As(err))
+				return
+			}
+
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		if enroll.Status != account.FINGER_PENDING {
+			c.WriteHttpResponse(400, nil, errors.New("finger enroll is not pending"))
+			return
+		}
+
+		if obj.Code != 0 || obj.Data.Finger <= 0 {
+			enroll.Status = account.FINGER_CANCELLED
+		} else {
+			enroll.Finger = obj.Data.Finger
+			enroll.Status = account.FINGER_CAPTURED
+		}
+		enroll.Updated = timex.String()
+
+		if err := account.UpdateFingerEnroll(enroll); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		EmitBox(0, EVENT_FINGER_ENROLL, enroll)
+		EmitAccount(enroll.AccountId, EVENT_FINGER_ENROLL, enroll)
+
+		c.WriteHttpResponse(200, nil, nil)
+		return
+	}
+
+	// 登录回调,模板ID只在回调的柜子内有效
+	acc, err := account.AccountByFinger(obj.Data.BoxId, obj.Data.Finger)
+	if err != nil {
+		if account.ErrAccountNotFound.Equal(err) {
+			EmitBox(0, EVENT_FINGER, obj)
+
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	// 指纹模块比对成功后才下发token
+	emitLogin(obj.Data.BoxId, EVENT_LOGIN_BY_FINGER, &LoginAccount{
+		Id:       acc.Id,
+		Username: acc.Username,
+		Token: OAuth.Add(&Identity{
+			Type: IDENTITY_ACCOUNT,
+			Id:   acc.Id,
+			Name: acc.Username,
+		}),
+	})
 
 	c.WriteHttpResponse(200, nil, nil)
 	return
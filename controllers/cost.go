@@ -0,0 +1,397 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/cost"
+	"github.com/beego/ms304w-client/models/inventory"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+// 默认计价方法
+func CostMethod() string {
+	method := conf.DefaultString("cost_method", cost.STANDARD)
+	if !cost.ValidMethod(method) {
+		return cost.STANDARD
+	}
+
+	return method
+}
+
+// 结算时的订单成本,随订单结算在同一事务中记录
+func settlement(o *order.Order, src *ledger.Movement) (*inventory.Settlement, error) {
+	m, err := material.MaterialById(o.MaterialId)
+	if err != nil {
+		return nil, errors.As(err, o.MaterialId)
+	}
+
+	// 入库单价优先使用供应商价格
+	receipt := m.Price
+	sc, err := cost.SupplierCostBy(m.Id, m.SupplierId)
+	if err != nil {
+		if !cost.ErrSupplierCostNotFound.Equal(err) {
+			return nil, errors.As(err)
+		}
+	} else {
+		receipt = sc.Cost
+	}
+
+	return &inventory.Settlement{
+		Order:  o,
+		Source: src,
+		Cost: &cost.OrderCost{
+			Created:    timex.String(),
+			OrderId:    o.Id,
+			Type:       o.Type,
+			AccountId:  o.AccountId,
+			GridId:     o.GridId,
+			MaterialId: o.MaterialId,
+			Method:     CostMethod(),
+		},
+		Standard:   m.Price,
+		Receipt:    receipt,
+		SupplierId: m.SupplierId,
+	}, nil
+}
+
+// 库存列表带上单价和金额
+type StockValue struct {
+	*order.Stock
+	Method   string  `json:"method"`
+	UnitCost float64 `json:"unitCost"`
+	Value    float64 `json:"value"`
+}
+
+type MaterialStockValue struct {
+	*order.MaterialStock
+	Method   string  `json:"method"`
+	UnitCost float64 `json:"unitCost"`
+	Value    float64 `json:"value"`
+	// 替代物料折合数量和合计可用数量,不含放回格子待检验的回收
+	SubstituteQty int `json:"substituteQty"`
+	AvailableQty  int `json:"availableQty"`
+}
+
+// 单价,查询失败时不影响库存列表
+func unitCosts(method string, materialIds []int) map[int]float64 {
+	m, err := cost.UnitCosts(method, materialIds)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return map[int]float64{}
+	}
+
+	return m
+}
+
+type CostController struct {
+	BaseController
+}
+
+// 查询计价方法参数
+func (c *CostController) method() (string, error) {
+	method := c.GetString("method", CostMethod())
+	if !cost.ValidMethod(method) {
+		return "", errors.As(cost.ErrMethodIllegal, method)
+	}
+
+	return method, nil
+}
+
+// 添加供应商价格
+func (c *CostController) AddSupplierCost() {
+	obj := &cost.SupplierCost{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if obj.MaterialId <= 0 || obj.SupplierId <= 0 || obj.Cost < 0 {
+		c.WriteHttpResponse(400, nil, errors.New("params is illegal"))
+		return
+	}
+
+	// 同一物料同一供应商只有一个价格
+	old, err := cost.SupplierCostBy(obj.MaterialId, obj.SupplierId)
+	if err != nil {
+		if !cost.ErrSupplierCostNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+	}
+
+	if old != nil {
+		c.WriteHttpResponse(400, nil, errors.As(cost.ErrSupplierCostAlreadyExist))
+		return
+	}
+
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := cost.InsertSupplierCost(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "supplier_cost", obj.Id, nil, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 修改供应商价格
+func (c *CostController) EditSupplierCost() {
+	obj := &cost.SupplierCost{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := cost.SupplierCostById(obj.Id)
+	if err != nil {
+		if cost.ErrSupplierCostNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if obj.Cost < 0 {
+		c.WriteHttpResponse(400, nil, errors.New("cost is illegal").As(obj.Cost))
+		return
+	}
+
+	// 只能修改价格
+	v := *old
+	v.Cost = obj.Cost
+	v.Updated = timex.String()
+	v.UpdatedBy = c.Operator()
+	if err := cost.UpdateSupplierCost(&v); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "supplier_cost", v.Id, old, &v)
+
+	c.WriteHttpResponse(200, &v, nil)
+	return
+}
+
+// 删除供应商价格
+func (c *CostController) DelSupplierCost() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := cost.SupplierCostById(id)
+	if err != nil {
+		if cost.ErrSupplierCostNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := cost.DelSupplierCost(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "supplier_cost", id, old, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 物料所有供应商价格
+func (c *CostController) SupplierCostList() {
+	materialId, err := c.GetInt("materialId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	list, err := cost.SupplierCostList(materialId)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, list, nil)
+	return
+}
+
+// 成本层
+func (c *CostController) LayerList() {
+	lot := c.GetString("lot")
+
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	materialId, err := c.GetInt("materialId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	remaining, err := c.GetBool("remaining", false)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["materialId"] = materialId
+	where["lot"] = lot
+	where["remaining"] = remaining
+
+	total, list, err := cost.LayerList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 修改批次号和单价,只影响之后的先进先出计价
+func (c *CostController) EditLayer() {
+	obj := &cost.Layer{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := cost.LayerById(obj.Id)
+	if err != nil {
+		if cost.ErrLayerNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if obj.Cost < 0 {
+		c.WriteHttpResponse(400, nil, errors.New("cost is illegal").As(obj.Cost))
+		return
+	}
+
+	v := *old
+	v.Lot = obj.Lot
+	v.Cost = obj.Cost
+	v.Updated = timex.String()
+	if err := cost.UpdateLayer(&v); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "cost_layer", v.Id, old, &v)
+
+	c.WriteHttpResponse(200, &v, nil)
+	return
+}
+
+// 订单成本
+func (c *CostController) OrderCostList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"orderId", "materialId", "accountId", "type"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	total, list, err := cost.OrderCostList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 库存金额
+func (c *CostController) Valuation() {
+	method, err := c.method()
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	r, err := c.ListRequest("id:asc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	materialId, err := c.GetInt("materialId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	categoryId, err := c.GetInt("categoryId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["materialId"] = materialId
+	where["categoryId"] = categoryId
+
+	total, list, err := cost.ValuationList(method, where, r.Page, r.PageSize)
+	if err != nil {
+		c.WriteList(r, total, nil, err)
+		return
+	}
+
+	c.WriteHttpResponse(200, struct {
+		ListResponse
+		Method string `json:"method"`
+	}{
+		ListResponse: ListResponse{
+			Total: total,
+			Next:  query.NextCursor(list, r.Sort, r.PageSize),
+			Data:  list,
+		},
+		Method: method,
+	}, nil)
+	return
+}
@@ -0,0 +1,586 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/costcenter"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+var (
+	ErrCostCenterRequired  = errors.New("cost center is required")
+	ErrWorkOrderRequired   = errors.New("work order is required")
+	ErrWorkOrderCostCenter = errors.New("work order not belong to cost center")
+)
+
+// 领料请求,可指定成本中心和工单号,库存不足时可指定替代物料
+type OutRequest struct {
+	order.Request
+	CostCenterId int    `json:"costCenterId"`
+	WorkOrder    string `json:"workOrder"`
+	// 指定的替代物料
+	SubstituteId int `json:"substituteId"`
+	// 库存不足时允许自动替代
+	AllowSubstitute bool `json:"allowSubstitute"`
+}
+
+// 校验并确定领料记账,返回http状态码
+// 未指定成本中心时依次取工单、用户、组的成本中心
+func resolveCharge(obj *OutRequest) (*costcenter.Charge, int, error) {
+	charge := &costcenter.Charge{
+		CostCenterId: obj.CostCenterId,
+		WorkOrder:    obj.WorkOrder,
+	}
+
+	if charge.WorkOrder == "" && conf.DefaultBool("work_order_required", false) {
+		return nil, 400, errors.As(ErrWorkOrderRequired)
+	}
+
+	if charge.WorkOrder != "" {
+		wo, err := costcenter.WorkOrderByCode(charge.WorkOrder)
+		if err != nil {
+			if !costcenter.ErrWorkOrderNotFound.Equal(err) {
+				return nil, 500, errors.As(err)
+			}
+
+			// 默认只允许列表中的工单号
+			if conf.DefaultBool("work_order_strict", true) {
+				return nil, 400, errors.As(err)
+			}
+		}
+
+		if wo != nil {
+			if wo.Status != costcenter.OPEN {
+				return nil, 400, errors.As(costcenter.ErrWorkOrderClosed, wo.Code)
+			}
+
+			if wo.CostCenterId > 0 {
+				if charge.CostCenterId > 0 && charge.CostCenterId != wo.CostCenterId {
+					return nil, 400, errors.As(ErrWorkOrderCostCenter, wo.Code, charge.CostCenterId)
+				}
+				charge.CostCenterId = wo.CostCenterId
+			}
+		}
+	}
+
+	if charge.CostCenterId <= 0 {
+		id, err := costcenter.DefaultCostCenterId(obj.AccountId)
+		if err != nil {
+			return nil, 500, errors.As(err)
+		}
+		charge.CostCenterId = id
+	}
+
+	if charge.CostCenterId <= 0 {
+		if conf.DefaultBool("cost_center_required", false) {
+			return nil, 400, errors.As(ErrCostCenterRequired)
+		}
+
+		return charge, 200, nil
+	}
+
+	cc, err := costcenter.CostCenterById(charge.CostCenterId)
+	if err != nil {
+		if costcenter.ErrCostCenterNotFound.Equal(err) {
+			return nil, 400, errors.As(err)
+		}
+
+		return nil, 500, errors.As(err)
+	}
+
+	if cc.Status != 1 {
+		return nil, 400, errors.As(costcenter.ErrCostCenterDisabled, cc.Code)
+	}
+
+	return charge, 200, nil
+}
+
+type CostCenterController struct {
+	BaseController
+}
+
+// 添加
+func (c *CostCenterController) AddCostCenter() {
+	obj := &costcenter.CostCenter{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if obj.Code == "" {
+		c.WriteHttpResponse(400, nil, errors.New("code is illegal"))
+		return
+	}
+
+	// 编号不能重复
+	old, err := costcenter.CostCenterByCode(obj.Code)
+	if err != nil {
+		if !costcenter.ErrCostCenterNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+	}
+
+	if old != nil {
+		c.WriteHttpResponse(400, nil, errors.As(costcenter.ErrCostCenterAlreadyExist, obj.Code))
+		return
+	}
+
+	obj.Status = 1
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := costcenter.InsertCostCenter(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "cost_center", obj.Id, nil, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 修改
+func (c *CostCenterController) EditCostCenter() {
+	obj := &costcenter.CostCenter{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := costcenter.CostCenterById(obj.Id)
+	if err != nil {
+		if costcenter.ErrCostCenterNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if obj.Code == "" {
+		c.WriteHttpResponse(400, nil, errors.New("code is illegal"))
+		return
+	}
+
+	if obj.Code != old.Code {
+		exist, err := costcenter.CostCenterByCode(obj.Code)
+		if err != nil {
+			if !costcenter.ErrCostCenterNotFound.Equal(err) {
+				c.WriteHttpResponse(500, nil, errors.As(err))
+				return
+			}
+		}
+
+		if exist != nil {
+			c.WriteHttpResponse(400, nil, errors.As(costcenter.ErrCostCenterAlreadyExist, obj.Code))
+			return
+		}
+	}
+
+	v := *old
+	v.Code = obj.Code
+	v.Name = obj.Name
+	v.Remark = obj.Remark
+	v.Status = obj.Status
+	v.Updated = timex.String()
+	v.UpdatedBy = c.Operator()
+	if err := costcenter.UpdateCostCenter(&v); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "cost_center", v.Id, old, &v)
+
+	c.WriteHttpResponse(200, &v, nil)
+	return
+}
+
+// 删除,已有领料记录的成本中心只能停用
+func (c *CostCenterController) DelCostCenter() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := costcenter.CostCenterById(id)
+	if err != nil {
+		if costcenter.ErrCostCenterNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	total, _, err := costcenter.ChargeList(map[string]interface{}{
+		"costCenterId": id,
+	}, 1, 1)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if total > 0 {
+		c.WriteHttpResponse(400, nil, errors.New("cost center has charges").As(id))
+		return
+	}
+
+	if err := costcenter.DelCostCenter(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "cost_center", id, old, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 查询所有
+func (c *CostCenterController) CostCenterList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["status"] = status
+
+	total, list, err := costcenter.CostCenterList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 分配给组或用户作为默认成本中心
+func (c *CostCenterController) AddAssign() {
+	obj := &costcenter.Assign{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	// 只能分配给组或用户其中一个
+	if (obj.GroupId > 0) == (obj.AccountId > 0) {
+		c.WriteHttpResponse(400, nil, errors.New("groupId or accountId is illegal"))
+		return
+	}
+
+	if _, err := costcenter.CostCenterById(obj.CostCenterId); err != nil {
+		if costcenter.ErrCostCenterNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	old, err := costcenter.AssignBy(obj.GroupId, obj.AccountId)
+	if err != nil {
+		if !costcenter.ErrAssignNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+	}
+
+	if old != nil {
+		c.WriteHttpResponse(400, nil, errors.As(costcenter.ErrAssignAlreadyExist, old.CostCenterId))
+		return
+	}
+
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	if err := costcenter.InsertAssign(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "cost_center_assign", obj.Id, nil, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 删除分配
+func (c *CostCenterController) DelAssign() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := costcenter.AssignById(id)
+	if err != nil {
+		if costcenter.ErrAssignNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := costcenter.DelAssign(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "cost_center_assign", id, old, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 成本中心的所有分配
+func (c *CostCenterController) AssignList() {
+	id, err := c.GetInt("costCenterId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	list, err := costcenter.AssignList(id)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, list, nil)
+	return
+}
+
+// 添加工单
+func (c *CostCenterController) AddWorkOrder() {
+	obj := &costcenter.WorkOrder{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if obj.Code == "" {
+		c.WriteHttpResponse(400, nil, errors.New("code is illegal"))
+		return
+	}
+
+	if code, err := c.checkCostCenter(obj.CostCenterId); err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	old, err := costcenter.WorkOrderByCode(obj.Code)
+	if err != nil {
+		if !costcenter.ErrWorkOrderNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+	}
+
+	if old != nil {
+		c.WriteHttpResponse(400, nil, errors.As(costcenter.ErrWorkOrderAlreadyExist, obj.Code))
+		return
+	}
+
+	obj.Status = costcenter.OPEN
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := costcenter.InsertWorkOrder(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "work_order", obj.Id, nil, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 修改工单,工单号不能修改
+func (c *CostCenterController) EditWorkOrder() {
+	obj := &costcenter.WorkOrder{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := costcenter.WorkOrderById(obj.Id)
+	if err != nil {
+		if costcenter.ErrWorkOrderNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if code, err := c.checkCostCenter(obj.CostCenterId); err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	v := *old
+	v.Name = obj.Name
+	v.CostCenterId = obj.CostCenterId
+	v.Status = obj.Status
+	v.Updated = timex.String()
+	v.UpdatedBy = c.Operator()
+	if err := costcenter.UpdateWorkOrder(&v); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "work_order", v.Id, old, &v)
+
+	c.WriteHttpResponse(200, &v, nil)
+	return
+}
+
+// 删除工单
+func (c *CostCenterController) DelWorkOrder() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := costcenter.WorkOrderById(id)
+	if err != nil {
+		if costcenter.ErrWorkOrderNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := costcenter.DelWorkOrder(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "work_order", id, old, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 查询所有工单
+func (c *CostCenterController) WorkOrderList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	costCenterId, err := c.GetInt("costCenterId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["costCenterId"] = costCenterId
+	where["status"] = status
+
+	total, list, err := costcenter.WorkOrderList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 领料记账
+func (c *CostCenterController) ChargeList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["workOrder"] = c.GetString("workOrder")
+
+	for _, key := range []string{"orderId", "costCenterId", "accountId", "materialId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	total, list, err := costcenter.ChargeList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 工单指定的成本中心必须存在,0不指定
+func (c *CostCenterController) checkCostCenter(id int) (int, error) {
+	if id <= 0 {
+		return 200, nil
+	}
+
+	if _, err := costcenter.CostCenterById(id); err != nil {
+		if costcenter.ErrCostCenterNotFound.Equal(err) {
+			return 400, errors.As(err)
+		}
+
+		return 500, errors.As(err)
+	}
+
+	return 200, nil
+}
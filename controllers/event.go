@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/stream"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/box"
+)
+
+// 事件版本,结构不兼容修改时加1
+const EVENT_VERSION = 1
+
+// 事件类型
+const (
+	// 称重
+	EVENT_WEIGHT = "weight"
+	// 结算结果
+	EVENT_INVENTORY = "inventory"
+	// 清0
+	EVENT_ZERO = "zero"
+	// 矫正
+	EVENT_MEASURE = "measure"
+	// 所有门状态
+	EVENT_BOX_STATUS = "boxStatus"
+	// 当前门状态
+	EVENT_DOOR_STATUS = "doorStatus"
+	// 灯状态
+	EVENT_LIGHT = "light"
+	// 扫码
+	EVENT_SCANNER = "scanner"
+	// 扫到工单号
+	EVENT_WORK_ORDER = "workOrder"
+	// 指纹
+	EVENT_FINGER = "finger"
+	// 指纹录入
+	EVENT_FINGER_ENROLL = "fingerEnroll"
+	// 指纹登录
+	EVENT_LOGIN_BY_FINGER = "loginByFinger"
+	// 刷卡登录
+	EVENT_LOGIN_BY_CARD = "loginByCard"
+	// 自动盘点
+	EVENT_AUTO = "auto"
+	// RFID对账
+	EVENT_RFID_INVENTORY = "rfidInventory"
+	// 多传感器结算
+	EVENT_FUSION = "fusion"
+	// 开门
+	EVENT_DOOR_OPENED = "doorOpened"
+	// 低于安全库存
+	EVENT_LOW_STOCK = "lowStock"
+	// 柜子上线或离线
+	EVENT_BOX_HEALTH = "boxHealth"
+	// 连接错误
+	EVENT_ERROR = "error"
+)
+
+// 房间
+const (
+	// 不区分柜子的客户端,接收所有事件
+	ROOM_ALL = "login"
+	// 本机设备事件(刷卡、指纹、扫码)
+	ROOM_DEVICE = "device"
+)
+
+// 柜子房间,boxId为柜子通信ID
+func RoomBox(boxId int) string {
+	return fmt.Sprintf("box:%d", boxId)
+}
+
+// 用户房间
+func RoomAccount(accountId int) string {
+	return fmt.Sprintf("account:%d", accountId)
+}
+
+// 推送给客户端的事件
+type Event struct {
+	// 序号,客户端可用于去重
+	Id      int64  `json:"id"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	// 柜子通信ID,0为本机设备
+	BoxId int `json:"boxId"`
+	// 用户ID,0为不区分用户
+	AccountId int         `json:"accountId"`
+	Created   string      `json:"created"`
+	Data      interface{} `json:"data"`
+}
+
+func (e *Event) MessageId() int64 {
+	return e.Id
+}
+
+func (e *Event) SetMessageId(id int64) {
+	e.Id = id
+}
+
+// socket.io、WebSocket和SSE共用
+var Events = newEvents()
+
+// 序号按启动时间开始递增,重启后客户端续传不会错乱
+func newEvents() *stream.Hub {
+	h := stream.NewHub(conf.DefaultInt("event_buffer", 1000))
+	h.SetId(time.Now().UnixNano() / int64(time.Microsecond))
+
+	return h
+}
+
+// 事件序号在发布时分配
+
+func NewEvent(typ string, boxId, accountId int, data interface{}) *Event {
+	return &Event{
+		Version:   EVENT_VERSION,
+		Type:      typ,
+		BoxId:     boxId,
+		AccountId: accountId,
+		Created:   timex.String(),
+		Data:      data,
+	}
+}
+
+// 推送柜子事件,boxId为0时为本机设备事件
+func EmitBox(boxId int, typ string, data interface{}) {
+	Events.Publish(NewEvent(typ, boxId, 0, data))
+}
+
+// 推送用户事件
+func EmitAccount(accountId int, typ string, data interface{}) {
+	if accountId <= 0 {
+		return
+	}
+
+	Events.Publish(NewEvent(typ, 0, accountId, data))
+}
+
+// 登录结果,只含用户ID、用户名和token
+type LoginAccount struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+// 登录结果只推送到刷卡或按指纹的柜子房间,boxId为0时推送到本机设备房间
+// 含token,不进入事件缓存,不推送给后台用户、WebSocket、SSE和webhook
+func emitLogin(boxId int, typ string, data interface{}) {
+	room := ROOM_DEVICE
+	if boxId > 0 {
+		room = RoomBox(boxId)
+	}
+
+	Server.BroadcastTo(room, typ, NewEvent(typ, boxId, 0, data))
+}
+
+// 按事件的柜子和用户推送到socket.io房间
+func broadcastEvent(msg stream.Message) {
+	event, ok := msg.(*Event)
+	if !ok {
+		return
+	}
+
+	if event.AccountId > 0 {
+		Server.BroadcastTo(RoomAccount(event.AccountId), event.Type, event)
+		return
+	}
+
+	// 不区分柜子的客户端接收所有事件
+	Server.BroadcastTo(ROOM_ALL, event.Type, event)
+
+	if event.BoxId > 0 {
+		Server.BroadcastTo(RoomBox(event.BoxId), event.Type, event)
+	} else {
+		Server.BroadcastTo(ROOM_DEVICE, event.Type, event)
+	}
+}
+
+// 客户端是否可以接收事件
+func (e *Event) Visible(identity *Identity, boxId int, types map[string]bool) bool {
+	if len(types) > 0 && !types[e.Type] {
+		return false
+	}
+
+	// 用户事件只推送给本人
+	if e.AccountId > 0 {
+		return identity != nil && identity.Type == IDENTITY_ACCOUNT && identity.Id == e.AccountId
+	}
+
+	// 没有绑定柜子时只有后台用户接收所有事件
+	if boxId == 0 {
+		return isUser(identity)
+	}
+
+	if e.BoxId > 0 && e.BoxId != boxId {
+		return false
+	}
+
+	return true
+}
+
+// 推送格子事件,按格子所在柜子分房间
+func EmitGrid(gridId int, typ string, data interface{}) {
+	var boxId int
+
+	grid, err := box.GridById(gridId)
+	if err != nil {
+		log.Error("%v", errors.As(err, gridId))
+	} else {
+		boxId = grid.Addr
+	}
+
+	EmitBox(boxId, typ, data)
+}
+
+// 解析串口回调数据,失败时返回nil
+func (c *CallbackController) callbackData(typ string) *CbData {
+	log.Info("%s: %s", typ, string(c.Ctx.Input.RequestBody))
+
+	obj := &SerialRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return nil
+	}
+
+	if obj.Data == nil {
+		c.WriteHttpResponse(400, nil, errors.New("callback data is empty"))
+		return nil
+	}
+
+	return obj.Data
+}
+
+// 推送串口回调数据
+func (c *CallbackController) emitCallback(typ string) {
+	data := c.callbackData(typ)
+	if data == nil {
+		return
+	}
+
+	EmitBox(data.BoxId, typ, data)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var ErrEventNotFound = errors.New("event not found")
+
+// 事件外层结构
+const eventEnvelopeSchema = `{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "type": "object",
+    "required": ["id", "version", "type", "boxId", "accountId", "created", "data"],
+    "properties": {
+        "id": {"type": "integer"},
+        "version": {"type": "integer"},
+        "type": {"type": "string"},
+        "boxId": {"type": "integer"},
+        "accountId": {"type": "integer"},
+        "created": {"type": "string"},
+        "data": {}
+    }
+}`
+
+// 串口回调数据
+const cbDataSchema = `{
+    "type": "object",
+    "properties": {
+        "uuid": {"type": "string"},
+        "boxId": {"type": "integer"},
+        "gridId": {"type": "integer"},
+        "operation": {"type": "integer"},
+        "weight": {"type": "integer"},
+        "doorStatusList": {"type": "string"},
+        "doorStatus": {"type": "integer"},
+        "lightStatus": {"type": "integer"},
+        "card": {"type": "string"},
+        "code": {"type": "string"},
+        "finger": {"type": "integer"},
+        "rfid": {"type": "array", "items": {"type": "string"}}
+    }
+}`
+
+// 结算结果
+const resDataSchema = `{
+    "type": "object",
+    "required": ["materialId", "type", "qty"],
+    "properties": {
+        "materialId": {"type": "integer"},
+        "type": {"type": "integer", "enum": [1, 2, 3]},
+        "qty": {"type": "integer"}
+    }
+}`
+
+const accountSchema = `{
+    "type": "object",
+    "required": ["id", "username"],
+    "properties": {
+        "id": {"type": "integer"},
+        "username": {"type": "string"},
+        "token": {"type": "string"}
+    }
+}`
+
+// 各事件data结构
+var eventSchemas = map[string]string{
+	EVENT_WEIGHT:      `{"type": "integer"}`,
+	EVENT_INVENTORY:   resDataSchema,
+	EVENT_ZERO:        cbDataSchema,
+	EVENT_MEASURE:     cbDataSchema,
+	EVENT_BOX_STATUS:  cbDataSchema,
+	EVENT_DOOR_STATUS: cbDataSchema,
+	EVENT_LIGHT:       cbDataSchema,
+	EVENT_SCANNER:     cbDataSchema,
+	EVENT_FINGER:      cbDataSchema,
+	EVENT_WORK_ORDER: `{
+    "type": "object",
+    "required": ["id", "code", "costCenterId", "status"],
+    "properties": {
+        "id": {"type": "integer"},
+        "code": {"type": "string"},
+        "name": {"type": "string"},
+        "costCenterId": {"type": "integer"},
+        "status": {"type": "integer", "enum": [0, 1]}
+    }
+}`,
+	EVENT_FINGER_ENROLL: `{
+    "type": "object",
+    "required": ["id", "accountId", "finger", "status"],
+    "properties": {
+        "id": {"type": "integer"},
+        "accountId": {"type": "integer"},
+        "finger": {"type": "integer"},
+        "status": {"type": "integer", "enum": [0, 1, 2, 3]}
+    }
+}`,
+	EVENT_LOGIN_BY_FINGER: accountSchema,
+	EVENT_LOGIN_BY_CARD: `{
+    "type": "object",
+    "required": ["card", "reader", "account"],
+    "properties": {
+        "card": {"type": "string"},
+        "reader": {"type": "string"},
+        "account": {"oneOf": [{"type": "null"}, ` + accountSchema + `]}
+    }
+}`,
+	EVENT_AUTO: `{"type": "string", "enum": ["success"]}`,
+	EVENT_RFID_INVENTORY: `{
+    "type": "object",
+    "required": ["sessionId", "accountId", "gridId", "items", "unknown"],
+    "properties": {
+        "sessionId": {"type": "integer"},
+        "accountId": {"type": "integer"},
+        "gridId": {"type": "integer"},
+        "items": {
+            "type": "array",
+            "items": {
+                "type": "object",
+                "properties": {
+                    "materialId": {"type": "integer"},
+                    "type": {"type": "integer"},
+                    "qty": {"type": "integer"},
+                    "orderId": {"type": "integer"},
+                    "rfids": {"type": "array", "items": {"type": "string"}}
+                }
+            }
+        },
+        "unknown": {"type": "array", "items": {"type": "string"}}
+    }
+}`,
+	EVENT_FUSION: `{
+    "type": "object",
+    "required": ["materialId", "type", "qty", "orderId", "source", "disagree"],
+    "properties": {
+        "materialId": {"type": "integer"},
+        "type": {"type": "integer"},
+        "qty": {"type": "integer"},
+        "orderId": {"type": "integer"},
+        "source": {"type": "array", "items": {"type": "string"}},
+        "disagree": {"type": "boolean"}
+    }
+}`,
+	EVENT_DOOR_OPENED: `{
+    "type": "object",
+    "properties": {
+        "uuid": {"type": "string"},
+        "boxId": {"type": "integer"},
+        "gridId": {"type": "integer"},
+        "operation": {"type": "integer"}
+    }
+}`,
+	EVENT_BOX_HEALTH: `{
+    "type": "object",
+    "required": ["boxId", "addr", "online"],
+    "properties": {
+        "boxId": {"type": "integer"},
+        "addr": {"type": "integer"},
+        "name": {"type": "string"},
+        "online": {"type": "boolean"},
+        "lastSeen": {"type": "string"},
+        "lastErr": {"type": "string"},
+        "failures": {"type": "integer"}
+    }
+}`,
+	EVENT_LOW_STOCK: `{
+    "type": "object",
+    "required": ["gridId", "materialId", "qty", "safeQty"],
+    "properties": {
+        "gridId": {"type": "integer"},
+        "materialId": {"type": "integer"},
+        "qty": {"type": "integer"},
+        "safeQty": {"type": "integer"}
+    }
+}`,
+	EVENT_ERROR: `{"type": "string"}`,
+}
+
+// 事件完整结构
+func EventSchema(typ string) (map[string]interface{}, error) {
+	data, ok := eventSchemas[typ]
+	if !ok {
+		return nil, errors.As(ErrEventNotFound, typ)
+	}
+
+	schema := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(eventEnvelopeSchema), &schema); err != nil {
+		return nil, errors.As(err)
+	}
+
+	dataSchema := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(data), &dataSchema); err != nil {
+		return nil, errors.As(err, typ)
+	}
+
+	schema["title"] = typ
+	schema["properties"].(map[string]interface{})["type"] = map[string]interface{}{
+		"type":  "string",
+		"const": typ,
+	}
+	schema["properties"].(map[string]interface{})["version"] = map[string]interface{}{
+		"type":  "integer",
+		"const": EVENT_VERSION,
+	}
+	schema["properties"].(map[string]interface{})["data"] = dataSchema
+
+	return schema, nil
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/audit"
+)
+
+type FingerController struct {
+	BaseController
+}
+
+// 开始录入指纹
+func (c *FingerController) StartEnroll() {
+	accountId, err := c.GetInt("accountId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// 在哪个柜子的指纹模块录入
+	boxId, err := c.GetInt("boxId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	acc, err := account.AccountById(accountId)
+	if err != nil {
+		if account.ErrAccountNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	// 取消之前未完成的录入
+	if err := account.CancelFingerEnroll(acc.Id, timex.String()); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	obj := &account.FingerEnroll{
+		Created:   timex.String(),
+		CreatedBy: c.Operator(),
+		AccountId: acc.Id,
+		BoxId:     boxId,
+		Status:    account.FINGER_PENDING,
+		Updated:   timex.String(),
+	}
+
+	if err := account.InsertFingerEnroll(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	// 通知指纹模块开始录入,回调时带回uuid
+	if _, err := SerialByAddr(boxId).Post(SERIAL_FINGER_ENROLL, map[string]interface{}{
+		"uuid":  strconv.Itoa(obj.Id),
+		"boxId": boxId,
+	}); err != nil {
+		obj.Status = account.FINGER_CANCELLED
+		obj.Updated = timex.String()
+		if err := account.UpdateFingerEnroll(obj); err != nil {
+			log.Warn("%v", err)
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询录入状态
+func (c *FingerController) EnrollById() {
+	enrollIdStr := c.Ctx.Input.Param(":id")
+	log.Debug(enrollIdStr)
+	if len(enrollIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("enroll id is empty"))
+		return
+	}
+
+	enrollId, err := strconv.Atoi(enrollIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := account.FingerEnrollById(enrollId)
+	if err != nil {
+		if account.ErrFingerEnrollNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 确认录入,绑定指纹到用户
+func (c *FingerController) ConfirmEnroll() {
+	enrollId, err := c.GetInt("id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := account.FingerEnrollById(enrollId)
+	if err != nil {
+		if account.ErrFingerEnrollNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if obj.Status != account.FINGER_CAPTURED || obj.Finger <= 0 {
+		c.WriteHttpResponse(400, nil, errors.As(account.ErrFingerNotCaptured))
+		return
+	}
+
+	acc, err := account.AccountById(obj.AccountId)
+	if err != nil {
+		if account.ErrAccountNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	// 指纹已被其他用户绑定,模板ID只在录入的柜子内唯一
+	if other, err := account.AccountByFinger(obj.BoxId, obj.Finger); err == nil {
+		if other.Id != acc.Id {
+			c.WriteHttpResponse(409, nil, errors.As(account.ErrFingerAlreadyExist))
+			return
+		}
+	} else if !account.ErrAccountNotFound.Equal(err) {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	finger := &account.AccountFinger{
+		Created:   timex.String(),
+		AccountId: acc.Id,
+		BoxId:     obj.BoxId,
+		Finger:    obj.Finger,
+	}
+
+	old, err := account.BindFinger(finger)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	// 删除该柜子上替换掉的模板
+	if old != nil && old.Finger != finger.Finger {
+		if err := delFinger(old.BoxId, old.Finger); err != nil {
+			log.Warn("%v", err)
+		}
+	}
+
+	obj.Status = account.FINGER_CONFIRMED
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+
+	if err := account.UpdateFingerEnroll(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "account_finger", finger.Id, old, finger)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 删除用户指纹
+func (c *FingerController) DelFinger() {
+	accountIdStr := c.Ctx.Input.Param(":accountId")
+	log.Debug(accountIdStr)
+	if len(accountIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("account id is empty"))
+		return
+	}
+
+	accountId, err := strconv.Atoi(accountIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	acc, err := account.AccountById(accountId)
+	if err != nil {
+		if account.ErrAccountNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	fingers, err := account.FingersByAccountId(acc.Id)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if len(fingers) == 0 {
+		c.WriteHttpResponse(400, nil, errors.As(account.ErrFingerNotBound))
+		return
+	}
+
+	// 逐个删除各柜子指纹模块中的模板和绑定
+	for _, v := range fingers {
+		if err := delFinger(v.BoxId, v.Finger); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		if err := account.DelAccountFinger(v.Id); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		c.Audit(audit.DELETE, "account_finger", v.Id, v, nil)
+	}
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 删除柜子指纹模块中的模板,柜子ID为0时使用默认服务
+func delFinger(boxId, finger int) error {
+	if _, err := SerialByAddr(boxId).Post(SERIAL_FINGER_DELETE, map[string]interface{}{
+		"finger": finger,
+		"boxId":  boxId,
+	}); err != nil {
+		return errors.As(err, boxId, finger)
+	}
+
+	return nil
+}
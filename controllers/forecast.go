@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	fc "github.com/beego/ms304w-client/basis/forecast"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/forecast"
+)
+
+// 格子物料的用量和建议值
+type ForecastSuggestion struct {
+	*forecast.GridMaterial
+	Usage      *fc.Usage      `json:"usage"`
+	Suggestion *fc.Suggestion `json:"suggestion"`
+	// 建议值和当前设置不同
+	Changed bool `json:"changed"`
+}
+
+// 按最近days天的领料计算建议值
+// leadTime大于0时覆盖供应商交货期
+func forecastSuggestions(where map[string]interface{}, days, leadTime int) ([]*ForecastSuggestion, error) {
+	grids, err := forecast.GridMaterialList(where)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	// 包含今天
+	startDate := time.Now().AddDate(0, 0, 1-days).Format("2006-01-02")
+
+	dailyList, err := forecast.DailyList(where, startDate)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	daily := make(map[[2]int][]int)
+	for _, v := range dailyList {
+		key := [2]int{v.GridId, v.MaterialId}
+		daily[key] = append(daily[key], v.Qty)
+	}
+
+	defaultLeadTime := conf.DefaultInt("forecast_lead_time", 7)
+
+	list := make([]*ForecastSuggestion, 0, len(grids))
+	for _, v := range grids {
+		lt := v.LeadTime
+		if leadTime > 0 {
+			lt = leadTime
+		}
+		if lt <= 0 {
+			lt = defaultLeadTime
+		}
+
+		usage := fc.Compute(daily[[2]int{v.GridId, v.MaterialId}], days)
+		s := fc.Suggest(usage, lt, v.MaxQty)
+
+		list = append(list, &ForecastSuggestion{
+			GridMaterial: v,
+			Usage:        usage,
+			Suggestion:   s,
+			Changed:      s.SafeQty != v.SafeQty || s.ReorderQty != v.ReorderQty,
+		})
+	}
+
+	return list, nil
+}
+
+type ForecastController struct {
+	BaseController
+}
+
+// 查询参数
+func (c *ForecastController) params() (map[string]interface{}, int, int, error) {
+	days, err := c.GetInt("days", conf.DefaultInt("forecast_days", 30))
+	if err != nil {
+		return nil, 0, 0, errors.As(err)
+	}
+
+	if days <= 0 {
+		return nil, 0, 0, errors.New("days is illegal").As(days)
+	}
+
+	leadTime, err := c.GetInt("leadTime", 0)
+	if err != nil {
+		return nil, 0, 0, errors.As(err)
+	}
+
+	where := make(map[string]interface{})
+	for _, key := range []string{"boxId", "gridId", "materialId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			return nil, 0, 0, errors.As(err, key)
+		}
+		where[key] = id
+	}
+
+	return where, days, leadTime, nil
+}
+
+// 预览建议值
+func (c *ForecastController) Preview() {
+	where, days, leadTime, err := c.params()
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	list, err := forecastSuggestions(where, days, leadTime)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, struct {
+		Total int64       `json:"total"`
+		Days  int         `json:"days"`
+		Data  interface{} `json:"data"`
+	}{
+		Total: int64(len(list)),
+		Days:  days,
+		Data:  list,
+	}, nil)
+	return
+}
+
+type ForecastApplyRequest struct {
+	// 统计天数,0使用默认值
+	Days int `json:"days"`
+	// 交货期,0使用供应商交货期
+	LeadTime int `json:"leadTime"`
+	// 应用的格子,为空应用所有有变化的格子
+	GridIds []int `json:"gridIds"`
+}
+
+// 应用建议值到格子的安全库存和订货点
+func (c *ForecastController) Apply() {
+	obj := &ForecastApplyRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if obj.Days <= 0 {
+		obj.Days = conf.DefaultInt("forecast_days", 30)
+	}
+
+	list, err := forecastSuggestions(map[string]interface{}{
+		"gridIds": obj.GridIds,
+	}, obj.Days, obj.LeadTime)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	applied := make([]*ForecastSuggestion, 0)
+	for _, v := range list {
+		if !v.Changed {
+			continue
+		}
+
+		old, err := box.GridById(v.GridId)
+		if err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		updated := timex.String()
+		if err := box.UpdateGridQty(v.GridId, v.Suggestion.SafeQty, v.Suggestion.ReorderQty, updated, c.Operator()); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		grid := *old
+		grid.SafeQty = v.Suggestion.SafeQty
+		grid.ReorderQty = v.Suggestion.ReorderQty
+		grid.Updated = updated
+		grid.UpdatedBy = c.Operator()
+		c.Audit(audit.UPDATE, "grid", grid.Id, old, &grid)
+
+		applied = append(applied, v)
+	}
+
+	c.WriteHttpResponse(200, struct {
+		Total int64       `json:"total"`
+		Days  int         `json:"days"`
+		Data  interface{} `json:"data"`
+	}{
+		Total: int64(len(applied)),
+		Days:  obj.Days,
+		Data:  applied,
+	}, nil)
+	return
+}
@@ -0,0 +1,468 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/fusion"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	fm "github.com/beego/ms304w-client/models/fusion"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+type FusionController struct {
+	BaseController
+}
+
+// 关门传感器数据
+type SensorData struct {
+	// 订单ID
+	UUID        string        `json:"uuid"`
+	DoorId      int           `json:"door_id"`
+	Weights     []*ChValue    `json:"weight"`
+	UltraSonics []*ChValue    `json:"ultra_sonic"`
+	Images      []*ImageCount `json:"image"`
+	Rfids       []string      `json:"rfid"`
+}
+
+type ChValue struct {
+	Channel int `json:"ch"`
+	Value   int `json:"value"`
+}
+
+type ImageCount struct {
+	// 图像识别区域,对应格子通道
+	Type  int `json:"type"`
+	Count int `json:"count"`
+}
+
+// 融合结算结果
+type FusionRes struct {
+	*ResData
+	OrderId  int      `json:"orderId"`
+	Source   []string `json:"source"`
+	Disagree bool     `json:"disagree"`
+}
+
+// -------------------------
+// 关门多传感器回调
+
+func (c *CallbackController) Sensor() {
+	log.Info("Sensor: %s", string(c.Ctx.Input.RequestBody))
+
+	obj := &SensorData{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(500, nil, err)
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	res, err := SensorCallback(obj)
+	if err != nil {
+		if order.ErrOrderNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		if fusion.ErrNoReading.Equal(err) {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, res, nil)
+	return
+}
+
+const sensorCallbackRoute = "/v1/callback/sensor"
+
+// 按格子所有通道换算数量,按物料融合规则确定结算数量
+func SensorCallback(data *SensorData) (*FusionRes, error) {
+	orderId, err := strconv.Atoi(data.UUID)
+	if err != nil {
+		return nil, errors.As(err, data.UUID)
+	}
+
+	o, err := order.OrderById(orderId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	channels, err := box.SensorByGrid(o.GridId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	readings := make([]*fusion.Reading, 0, len(channels))
+	for _, ch := range channels {
+		reading, err := sensorReading(o, ch, data)
+		if err != nil {
+			log.Warn("%v", errors.As(err))
+			continue
+		}
+
+		if reading != nil {
+			readings = append(readings, reading)
+		}
+	}
+
+	rule, err := material.FusionByMaterialId(o.MaterialId)
+	if err != nil {
+		if !material.ErrFusionNotFound.Equal(err) {
+			return nil, errors.As(err)
+		}
+
+		rule = material.DefaultFusion
+	}
+
+	result, err := fusion.Fuse(rule.Rule(), readings)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	if result.Disagree {
+		log.Warn("fusion disagree order %d, readings %+v", o.Id, result.Readings)
+	}
+
+	resData, err := SettleOrder(o, result.Qty, sensorCallbackRoute)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	readingsBytes, err := json.Marshal(result.Readings)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	ruleBytes, err := json.Marshal(rule.Rule())
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	settle := &fm.Settle{
+		Created:    timex.String(),
+		OrderId:    o.Id,
+		GridId:     o.GridId,
+		MaterialId: o.MaterialId,
+		Qty:        result.Qty,
+		Source:     strings.Join(result.Source, ","),
+		Readings:   string(readingsBytes),
+		Rule:       string(ruleBytes),
+	}
+
+	if result.Disagree {
+		settle.Disagree = 1
+	}
+
+	if err := fm.InsertSettle(settle); err != nil {
+		return nil, errors.As(err)
+	}
+
+	res := &FusionRes{
+		ResData:  resData,
+		OrderId:  o.Id,
+		Source:   result.Source,
+		Disagree: result.Disagree,
+	}
+
+	EmitGrid(o.GridId, EVENT_FUSION, res)
+	EmitAccount(o.AccountId, EVENT_FUSION, res)
+
+	return res, nil
+}
+
+// 单个通道读数,没有数据返回nil
+func sensorReading(o *order.Order, ch *box.Channel, data *SensorData) (*fusion.Reading, error) {
+	reading := &fusion.Reading{
+		Kind:    ch.Kind,
+		Channel: ch.Channel,
+	}
+
+	switch ch.Kind {
+	case fusion.WEIGHT, fusion.ULTRASONIC:
+		values := data.Weights
+		if ch.Kind == fusion.ULTRASONIC {
+			values = data.UltraSonics
+		}
+
+		var found bool
+		for _, v := range values {
+			if v.Channel == ch.Channel {
+				reading.Value = v.Value
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+		materialSensor, err := material.SensorByMaterialId(o.MaterialId, ch.SensorId)
+		if err != nil {
+			return nil, errors.As(err, ch.SensorId)
+		}
+
+		params, err := materialSensor.ParamsObj()
+		if err != nil {
+			return nil, errors.As(err, ch.SensorId)
+		}
+
+		if ch.Kind == fusion.WEIGHT {
+			reading.Qty = fusion.WeightQty(reading.Value, params.Weight, params.ComeUp, params.Lower)
+		} else {
+			reading.Qty = fusion.HeightQty(ch.Height, reading.Value, params.Height, params.ComeUp, params.Lower)
+		}
+
+	case fusion.IMAGE:
+		var found bool
+		for _, v := range data.Images {
+			if v.Type == ch.Channel {
+				reading.Value = v.Count
+				reading.Qty = v.Count
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+	case fusion.RFID:
+		// 只统计绑定本物料的标签
+		for _, v := range data.Rfids {
+			tag, err := material.MaterialRfidByRfid(strings.ToUpper(v))
+			if err != nil {
+				if material.ErrMaterialRfidNotFound.Equal(err) {
+					continue
+				}
+
+				return nil, errors.As(err)
+			}
+
+			if tag.MaterialId == o.MaterialId {
+				reading.Qty++
+			}
+		}
+
+		reading.Value = len(data.Rfids)
+
+	default:
+		return nil, errors.New("sensor kind undefined").As(ch.Kind)
+	}
+
+	return reading, nil
+}
+
+// 设置物料融合规则,已存在则修改
+func (c *FusionController) AddFusion() {
+	obj := &material.Fusion{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if err := obj.Valid(); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if _, err := material.MaterialById(obj.MaterialId); err != nil {
+		if material.ErrMaterialNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	acc, err := material.FusionByMaterialId(obj.MaterialId)
+	if err != nil {
+		if !material.ErrFusionNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		obj.Created = timex.String()
+		obj.CreatedBy = c.Operator()
+		if err := material.InsertFusion(obj); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		c.Audit(audit.CREATE, "material_fusion", obj.Id, nil, obj)
+
+		c.WriteHttpResponse(200, obj, nil)
+		return
+	}
+
+	obj.Id = acc.Id
+	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := material.UpdateFusion(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "material_fusion", obj.Id, acc, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 根据物料查询融合规则,未设置返回默认规则
+func (c *FusionController) FusionByMaterialId() {
+	materialIdStr := c.Ctx.Input.Param(":materialId")
+	log.Debug(materialIdStr)
+	if len(materialIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("material id is empty"))
+		return
+	}
+
+	materialId, err := strconv.Atoi(materialIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := material.FusionByMaterialId(materialId)
+	if err != nil {
+		if !material.ErrFusionNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		def := *material.DefaultFusion
+		def.MaterialId = materialId
+		obj = &def
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 删除融合规则,恢复只用称重
+func (c *FusionController) DelFusion() {
+	materialIdStr := c.Ctx.Input.Param(":materialId")
+	log.Debug(materialIdStr)
+	if len(materialIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("material id is empty"))
+		return
+	}
+
+	materialId, err := strconv.Atoi(materialIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// 删除前数据
+	before, err := material.FusionByMaterialId(materialId)
+	if err != nil {
+		if material.ErrFusionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := material.DelFusion(before.Id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "material_fusion", before.Id, before, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 根据订单查询结算
+func (c *FusionController) SettleByOrderId() {
+	orderIdStr := c.Ctx.Input.Param(":orderId")
+	log.Debug(orderIdStr)
+	if len(orderIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("order id is empty"))
+		return
+	}
+
+	orderId, err := strconv.Atoi(orderIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := fm.SettleByOrderId(orderId)
+	if err != nil {
+		if fm.ErrSettleNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询结算,disagree=1只看不一致
+func (c *FusionController) SettleList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	gridId, err := c.GetInt("gridId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	materialId, err := c.GetInt("materialId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	disagree, err := c.GetInt("disagree", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["gridId"] = gridId
+	where["materialId"] = materialId
+	where["disagree"] = disagree
+
+	total, list, err := fm.SettleList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
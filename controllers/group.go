@@ -7,6 +7,7 @@ import (
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
 	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/material"
 )
 
@@ -46,11 +47,14 @@ func (c *GroupController) AddGroup() {
 
 	obj.Status = 1
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := account.InsertGroup(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "group", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -84,12 +88,16 @@ func (c *GroupController) EditGroup() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := account.UpdateGroup(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "group", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -133,11 +141,25 @@ func (c *GroupController) DelGroup() {
 		return
 	}
 
+	// 删除前数据
+	before, err := account.GroupById(groupId)
+	if err != nil {
+		if account.ErrGroupNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := account.DelGroup(groupId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "group", groupId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -174,19 +196,13 @@ func (c *GroupController) GroupById() {
 
 // 查询所有
 func (c *GroupController) GroupList() {
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := account.GroupList(page, pageSize)
+	list, err := account.GroupList(r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/material"
 )
 
@@ -43,23 +44,31 @@ func (c *GroupMaterialController) AddGroupMaterial() {
 	if gm == nil {
 		obj.Status = 1
 		obj.Created = timex.String()
+		obj.CreatedBy = c.Operator()
 		if err := material.InsertGroupMaterial(obj); err != nil {
 			c.WriteHttpResponse(500, nil, errors.As(err))
 			return
 		}
 
+		c.Audit(audit.CREATE, "group_material", obj.Id, nil, obj)
+
 		c.WriteHttpResponse(200, nil, nil)
 		return
 	}
 
 	// 存在修改
+	before := *gm
+
 	gm.Status = 1
 	gm.Updated = timex.String()
+	gm.UpdatedBy = c.Operator()
 	if err := material.UpdateGroupMaterial(gm); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "group_material", gm.Id, &before, gm)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -110,6 +119,8 @@ func (c *GroupMaterialController) DelGroupMaterial() {
 		return
 	}
 
+	c.Audit(audit.DELETE, "group_material", gm.Id, gm, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -122,19 +133,13 @@ func (c *GroupMaterialController) MaterialByGroupId() {
 		return
 	}
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := material.MaterialByGroupId(groupId, page, pageSize)
+	list, err := material.MaterialByGroupId(groupId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/bus"
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/adjust"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/inspect"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 检验回收的权限标签
+const PERMISSION_RETURN_INSPECT = "return_inspect"
+
+// 回收是否需要检验
+func returnInspection() bool {
+	return conf.DefaultBool("return_inspection", false)
+}
+
+// 隔离格子,0时回收放回物料格子并标记待检验
+func quarantineGrid() int {
+	if !returnInspection() {
+		return 0
+	}
+
+	return conf.DefaultInt("quarantine_grid", 0)
+}
+
+// 放回物料格子待检验的数量,查询失败时不影响库存列表
+func flaggedQtys(materialIds []int) map[int]int {
+	m, err := inspect.FlaggedQtys(materialIds)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return map[int]int{}
+	}
+
+	return m
+}
+
+// 回收放回物料格子结算后标记待检验
+// 已计库存,检验前从可领库存中扣除
+func inspectionSubscriber(e bus.Event) error {
+	v, ok := e.(*OrderSettled)
+	if !ok || v.Order == nil || v.Order.Type != order.RECYCLE || v.Order.Qty <= 0 || !returnInspection() {
+		return nil
+	}
+
+	o := v.Order
+
+	if err := inspect.InsertInspection(&inspect.Inspection{
+		Created:    timex.String(),
+		OrderId:    o.Id,
+		AccountId:  o.AccountId,
+		MaterialId: o.MaterialId,
+		GridId:     o.GridId,
+		Qty:        o.Qty,
+		Status:     inspect.PENDING,
+	}); err != nil {
+		return errors.As(err, o.Id)
+	}
+
+	return nil
+}
+
+// 回收放入隔离格子,不称重不计库存,检验入库时再计
+func (c *StockController) recycleToQuarantine(accountId, materialId, sensorId, qty, gridId int) {
+	grid, err := box.GridById(gridId)
+	if err != nil {
+		if box.ErrGridNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err, "quarantine", gridId))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	o := &order.Order{
+		Created:    timex.String(),
+		AccountId:  accountId,
+		Type:       order.RECYCLE,
+		GridId:     grid.Id,
+		MaterialId: materialId,
+		SensorId:   sensorId,
+		Channel:    grid.Channel,
+		Qty:        qty,
+		Status:     1,
+	}
+
+	if err := order.InsertOrder(o); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
+	obj := &inspect.Inspection{
+		Created:    timex.String(),
+		OrderId:    o.Id,
+		AccountId:  accountId,
+		MaterialId: materialId,
+		GridId:     grid.Id,
+		Quarantine: 1,
+		Qty:        qty,
+		Status:     inspect.PENDING,
+	}
+	if err := inspect.InsertInspection(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	where := make(map[string]interface{})
+	where["boxId"] = grid.Addr
+	where["gridId"] = grid.Channel
+	where["operation"] = LOCK_UNWEIGHT
+
+	bytes, err := SerialByAddr(grid.Addr).Post(SERIAL_OPEN, where)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.DoorOpened("grid", grid.Id, where)
+
+	log.Info("StockRecycle quarantine %s", string(bytes))
+
+	c.WriteHttpResponse(200, struct {
+		Channel      int `json:"channel"`
+		InspectionId int `json:"inspectionId"`
+	}{
+		Channel:      grid.Channel,
+		InspectionId: obj.Id,
+	}, nil)
+	return
+}
+
+type InspectController struct {
+	BaseController
+}
+
+type InspectRequest struct {
+	AcceptedQty int `json:"acceptedQty"`
+	ScrappedQty int `json:"scrappedQty"`
+	// 报废原因 damaged/used/expired/contaminated/other
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+	// 隔离的回收入库的格子,为空时为物料绑定的格子
+	GridId int `json:"gridId"`
+}
+
+// 物料绑定的第一个称重格子
+func materialGrid(materialId int) (int, error) {
+	list, err := box.GridByMaterialId(materialId)
+	if err != nil {
+		return 0, errors.As(err)
+	}
+
+	for _, v := range list {
+		if v.Mode != box.MODE_RFID {
+			return v.Id, nil
+		}
+	}
+
+	return 0, errors.As(box.ErrGridNotFound, materialId)
+}
+
+// 检验回收,入库或报废
+func (c *InspectController) Inspect() {
+	if !c.CheckPermission(PERMISSION_RETURN_INSPECT) {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Ctx.Input.Param(":id"))
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	req := &InspectRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if req == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	obj, err := inspect.InspectionById(id)
+	if err != nil {
+		if inspect.ErrInspectionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	r := &inspect.Result{
+		AcceptedQty: req.AcceptedQty,
+		ScrappedQty: req.ScrappedQty,
+		Reason:      req.Reason,
+		Note:        req.Note,
+		InspectedBy: c.Operator(),
+		Inspected:   timex.String(),
+	}
+
+	// 隔离的回收入库到物料格子
+	if obj.Quarantine == 1 && req.AcceptedQty > 0 {
+		if req.GridId <= 0 {
+			req.GridId, err = materialGrid(obj.MaterialId)
+			if err != nil {
+				if box.ErrGridNotFound.Equal(err) {
+					c.WriteHttpResponse(400, nil, errors.As(err))
+					return
+				}
+
+				c.WriteHttpResponse(500, nil, errors.As(err))
+				return
+			}
+		}
+
+		grid, code, err := adjustGrid(req.GridId)
+		if err != nil {
+			c.WriteHttpResponse(code, nil, errors.As(err))
+			return
+		}
+
+		if grid.MaterialId > 0 && grid.MaterialId != obj.MaterialId {
+			c.WriteHttpResponse(400, nil, errors.New("grid is bound to another material").As(grid.Id, grid.MaterialId))
+			return
+		}
+
+		r.GridId = grid.Id
+		r.MaxQty = grid.Qty
+	}
+
+	old := *obj
+	before, after, err := inspect.Inspect(obj, r, ledgerSource(c.Identity(), nil))
+	if err != nil {
+		switch {
+		case inspect.ErrInspected.Equal(err):
+			c.WriteHttpResponse(409, nil, errors.As(err))
+		case inspect.ErrQtyMismatch.Equal(err),
+			inspect.ErrReasonIllegal.Equal(err),
+			adjust.ErrQtyNotEnough.Equal(err),
+			adjust.ErrQtyOverflow.Equal(err):
+			c.WriteHttpResponse(400, nil, errors.As(err))
+		default:
+			c.WriteHttpResponse(500, nil, errors.As(err))
+		}
+		return
+	}
+
+	if after != nil {
+		PublishStockChanged(c.Identity(), c.Ctx.Request.Method, c.Ctx.Request.URL.Path, &StockRef{
+			Reason:  ledger.INSPECT,
+			RefType: "inspection",
+			RefId:   obj.Id,
+			Note:    obj.Reason,
+		}, before, after)
+	}
+
+	c.Audit(audit.UPDATE, "inspection", obj.Id, &old, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 根据ID查询
+func (c *InspectController) InspectionById() {
+	id, err := strconv.Atoi(c.Ctx.Input.Param(":id"))
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := inspect.InspectionById(id)
+	if err != nil {
+		if inspect.ErrInspectionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有,status不传时返回全部
+func (c *InspectController) InspectionList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"gridId", "materialId", "accountId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err, "status"))
+		return
+	}
+	where["status"] = status
+	where["reason"] = c.GetString("reason")
+
+	total, list, err := inspect.InspectionList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
@@ -0,0 +1,708 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/bom"
+	"github.com/beego/ms304w-client/basis/bus"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/inventory"
+	"github.com/beego/ms304w-client/models/kit"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 套件的领料订单结算后更新明细并关灯
+func kitSubscriber(e bus.Event) error {
+	v, ok := e.(*OrderSettled)
+	if !ok || v.Order == nil || v.Order.Type != order.OUT {
+		return nil
+	}
+
+	o := v.Order
+
+	if _, err := kit.SettleLine(o.Id, o.Qty, timex.String()); err != nil {
+		if kit.ErrPickLineNotFound.Equal(err) {
+			return nil
+		}
+
+		return errors.As(err, o.Id)
+	}
+
+	grid, err := box.GridById(o.GridId)
+	if err != nil {
+		return errors.As(err, o.GridId)
+	}
+
+	if err := gridLight(grid.Addr, grid.Channel, LIGHT_CLOSE); err != nil {
+		return errors.As(err, o.Id)
+	}
+
+	return nil
+}
+
+// 格子指示灯
+func gridLight(boxAddr, channel, operation int) error {
+	where := make(map[string]interface{})
+	where["boxId"] = boxAddr
+	where["gridId"] = channel
+	where["operation"] = operation
+
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_LIGHT, where)
+	if err != nil {
+		return errors.As(err, boxAddr, channel)
+	}
+
+	log.Info("Light Res %s", string(bytes))
+	return nil
+}
+
+// 物料的传感器和格子的通道,同领料
+func outChannel(materialId, gridId int) (int, int, error) {
+	_, sensor, err := material.SensorList(map[string]interface{}{
+		"startDate":  "",
+		"endDate":    "",
+		"name":       "",
+		"materialId": materialId,
+	}, 1, 1000)
+	if err != nil {
+		return 0, 0, errors.As(err)
+	}
+
+	if len(sensor) != 1 {
+		return 0, 0, errors.New("material and sensor not connect").As(materialId)
+	}
+
+	sensorId := sensor[0].SensorId
+
+	_, ch, err := box.ChannelList(map[string]interface{}{
+		"startDate": "",
+		"endDate":   "",
+		"name":      "",
+		"gridId":    gridId,
+		"sensorId":  sensorId,
+	}, 1, 1000)
+	if err != nil {
+		return 0, 0, errors.As(err)
+	}
+
+	if len(ch) == 0 {
+		return 0, 0, errors.New("gridId and sensorId not connect").As(gridId, sensorId)
+	}
+
+	return sensorId, ch[0].Channel, nil
+}
+
+type KitController struct {
+	BaseController
+}
+
+// 校验套件,编号不能重复
+func checkKit(obj *kit.Kit, id int) (int, error) {
+	if obj.Code == "" {
+		return 400, errors.New("code is illegal")
+	}
+
+	if err := kit.CheckItems(obj.Items); err != nil {
+		return 400, errors.As(err)
+	}
+
+	exist, err := kit.KitByCode(obj.Code)
+	if err != nil {
+		if !kit.ErrKitNotFound.Equal(err) {
+			return 500, errors.As(err)
+		}
+	}
+
+	if exist != nil && exist.Id != id {
+		return 400, errors.As(kit.ErrKitAlreadyExist, obj.Code)
+	}
+
+	return 200, nil
+}
+
+// 添加
+func (c *KitController) AddKit() {
+	obj := &kit.Kit{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if code, err := checkKit(obj, 0); err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	obj.Status = 1
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := kit.InsertKit(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "kit", obj.Id, nil, obj)
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 修改,清单整体替换
+func (c *KitController) EditKit() {
+	obj := &kit.Kit{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := kit.KitById(obj.Id)
+	if err != nil {
+		if kit.ErrKitNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if code, err := checkKit(obj, old.Id); err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	v := *old
+	v.Code = obj.Code
+	v.Name = obj.Name
+	v.GroupId = obj.GroupId
+	v.Remark = obj.Remark
+	v.Status = obj.Status
+	v.Items = obj.Items
+	v.Updated = timex.String()
+	v.UpdatedBy = c.Operator()
+	if err := kit.UpdateKit(&v); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "kit", v.Id, old, &v)
+
+	c.WriteHttpResponse(200, &v, nil)
+	return
+}
+
+// 删除
+func (c *KitController) DelKit() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := kit.KitById(id)
+	if err != nil {
+		if kit.ErrKitNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := kit.DelKit(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "kit", id, old, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 根据ID查询,包括清单
+func (c *KitController) KitById() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := kit.KitById(id)
+	if err != nil {
+		if kit.ErrKitNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有
+func (c *KitController) KitList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"groupId", "materialId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err, "status"))
+		return
+	}
+	where["status"] = status
+
+	total, list, err := kit.KitList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+type PickRequest struct {
+	AccountId int `json:"accountId"`
+	// 套数,为空时为1
+	Qty int `json:"qty"`
+	// 库存不足时按顺序使用清单的替代物料
+	AllowSubstitute bool `json:"allowSubstitute"`
+	// 指定替代物料,清单物料ID:替代物料ID
+	Substitutes map[int]int `json:"substitutes"`
+	// 缺料时是否领取有库存的部分,否则不开门
+	Partial      bool   `json:"partial"`
+	CostCenterId int    `json:"costCenterId"`
+	WorkOrder    string `json:"workOrder"`
+}
+
+// 领取计划
+type KitPlan struct {
+	Picks      []*bom.Pick      `json:"picks"`
+	Shortfalls []*bom.Shortfall `json:"shortfalls"`
+
+	// 格子的柜子地址和通道
+	sources map[int]*kit.Source
+}
+
+// 读取请求和套件,校验领料人所在组
+func (c *KitController) pickRequest() (*kit.Kit, *PickRequest, int, error) {
+	id, err := strconv.Atoi(c.Ctx.Input.Param(":id"))
+	if err != nil {
+		return nil, nil, 400, errors.As(err)
+	}
+
+	req := &PickRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		return nil, nil, 400, errors.As(err)
+	}
+
+	if req == nil {
+		return nil, nil, 400, errors.New("params is empty")
+	}
+
+	if req.AccountId <= 0 {
+		return nil, nil, 400, errors.New("accountId is illegal")
+	}
+
+	if req.Qty == 0 {
+		req.Qty = 1
+	}
+
+	if req.Qty < 0 {
+		return nil, nil, 400, errors.New("qty is illegal")
+	}
+
+	k, err := kit.KitById(id)
+	if err != nil {
+		if kit.ErrKitNotFound.Equal(err) {
+			return nil, nil, 404, errors.As(err)
+		}
+
+		return nil, nil, 500, errors.As(err)
+	}
+
+	if k.Status != 1 {
+		return nil, nil, 400, errors.As(kit.ErrKitDisabled, k.Code)
+	}
+
+	// 指定组的套件只有组内用户能领
+	if k.GroupId > 0 {
+		ag, err := account.AccountGroupById(k.GroupId, req.AccountId)
+		if err != nil {
+			if account.ErrAccountGroupNotFound.Equal(err) {
+				return nil, nil, 403, errors.As(err, k.GroupId, req.AccountId)
+			}
+
+			return nil, nil, 500, errors.As(err)
+		}
+
+		if ag.Status != 1 {
+			return nil, nil, 403, errors.As(account.ErrAccountGroupNotFound, k.GroupId, req.AccountId)
+		}
+	}
+
+	return k, req, 200, nil
+}
+
+// 按清单和格子库存分配
+func kitPlan(k *kit.Kit, req *PickRequest) (*KitPlan, int, error) {
+	lines := []*bom.Line{}
+	for _, v := range k.Items {
+		// 清单的替代物料优先,其次是物料的替代物料
+		candidates := []*bom.Material{}
+		for _, id := range v.Substitutes {
+			candidates = append(candidates, &bom.Material{MaterialId: id, Ratio: 1})
+		}
+
+		subs, err := material.Substitutes(v.MaterialId)
+		if err != nil {
+			return nil, 500, errors.As(err)
+		}
+
+		for _, s := range subs {
+			if findMaterial(candidates, s.SubstituteId) == nil {
+				candidates = append(candidates, &bom.Material{MaterialId: s.SubstituteId, Ratio: s.Ratio})
+			}
+		}
+
+		materials := []*bom.Material{{MaterialId: v.MaterialId, Ratio: 1}}
+		if req.AllowSubstitute {
+			materials = append(materials, candidates...)
+		}
+
+		// 指定的只能是清单或物料的替代物料
+		if id, ok := req.Substitutes[v.MaterialId]; ok && id != v.MaterialId {
+			m := findMaterial(candidates, id)
+			if m == nil {
+				return nil, 400, errors.As(kit.ErrItemIllegal, "substitute", v.MaterialId, id)
+			}
+
+			materials = []*bom.Material{m}
+		}
+
+		lines = append(lines, &bom.Line{
+			ItemId:     v.Id,
+			MaterialId: v.MaterialId,
+			Qty:        v.Qty * req.Qty,
+			Materials:  materials,
+		})
+	}
+
+	p := &KitPlan{
+		sources: make(map[int]*kit.Source),
+	}
+
+	stocks := []*bom.Stock{}
+	loaded := make(map[int]bool)
+	for _, line := range lines {
+		for _, m := range line.Materials {
+			if loaded[m.MaterialId] {
+				continue
+			}
+			loaded[m.MaterialId] = true
+
+			list, err := kit.SourceList(m.MaterialId)
+			if err != nil {
+				return nil, 500, errors.As(err)
+			}
+
+			for _, v := range list {
+				p.sources[v.GridId] = v
+				stocks = append(stocks, &bom.Stock{
+					GridId:     v.GridId,
+					MaterialId: v.MaterialId,
+					Qty:        v.Qty,
+				})
+			}
+		}
+	}
+
+	p.Picks, p.Shortfalls = bom.Plan(lines, stocks)
+
+	return p, 200, nil
+}
+
+func findMaterial(list []*bom.Material, materialId int) *bom.Material {
+	for _, v := range list {
+		if v.MaterialId == materialId {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// 预览领取计划,不开门
+func (c *KitController) Plan() {
+	k, req, code, err := c.pickRequest()
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	p, code, err := kitPlan(k, req)
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, p, nil)
+	return
+}
+
+// 领取套件,每个格子一个领料订单,打开格子的门和指示灯,称重后按行分摊结算
+// 缺料时不开门并返回计划,partial时领取有库存的部分并记录缺料
+func (c *KitController) PickKit() {
+	k, req, code, err := c.pickRequest()
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	// 成本中心和工单
+	out := &OutRequest{
+		CostCenterId: req.CostCenterId,
+		WorkOrder:    req.WorkOrder,
+	}
+	out.AccountId = req.AccountId
+
+	charge, code, err := resolveCharge(out)
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	p, code, err := kitPlan(k, req)
+	if err != nil {
+		c.WriteHttpResponse(code, nil, errors.As(err))
+		return
+	}
+
+	if len(p.Picks) == 0 || (len(p.Shortfalls) > 0 && !req.Partial) {
+		c.WriteHttpResponse(409, p, errors.As(kit.ErrShortfall, k.Code))
+		return
+	}
+
+	// 清单行的物料
+	items := make(map[int]int)
+	for _, v := range k.Items {
+		items[v.Id] = v.MaterialId
+	}
+
+	obj := &kit.Pick{
+		Created:   timex.String(),
+		CreatedBy: c.Operator(),
+		KitId:     k.Id,
+		AccountId: req.AccountId,
+		Qty:       req.Qty,
+		Updated:   timex.String(),
+	}
+
+	// 同一格子的领取合并为一个订单,只开一次门
+	outs := []*inventory.Out{}
+	grids := make(map[int]*inventory.Out)
+	for _, v := range p.Picks {
+		out, ok := grids[v.GridId]
+		if !ok {
+			// 先查询所有通道,避免只开了部分门
+			sensorId, channel, err := outChannel(v.MaterialId, v.GridId)
+			if err != nil {
+				c.WriteHttpResponse(500, nil, errors.As(err))
+				return
+			}
+
+			out = &inventory.Out{
+				Order: &order.Order{
+					Created:    timex.String(),
+					AccountId:  req.AccountId,
+					Type:       order.OUT,
+					GridId:     v.GridId,
+					MaterialId: v.MaterialId,
+					SensorId:   sensorId,
+					Channel:    channel,
+					Status:     1,
+				},
+			}
+
+			// 每个订单一条记账
+			if charge != nil {
+				ch := *charge
+				out.Charge = &ch
+			}
+
+			grids[v.GridId] = out
+			outs = append(outs, out)
+		}
+
+		if out.Order.MaterialId != v.MaterialId {
+			c.WriteHttpResponse(500, nil, errors.New("grid material not match").As(v.GridId, v.MaterialId))
+			return
+		}
+		out.Order.Qty += v.Qty
+
+		line := &kit.PickLine{
+			MaterialId:     items[v.ItemId],
+			PickMaterialId: v.MaterialId,
+			GridId:         v.GridId,
+			Qty:            v.Qty,
+			LineQty:        v.LineQty,
+		}
+		obj.Lines = append(obj.Lines, line)
+
+		if !v.Substitute {
+			continue
+		}
+		line.Substitute = 1
+
+		// 记录订单的替代,未指定时为自动替代
+		// 一个订单一条替代记录,同一格子替代多个清单物料时记第一个
+		if out.Substitution == nil {
+			out.Substitution = &material.Substitution{
+				AccountId:    req.AccountId,
+				MaterialId:   line.MaterialId,
+				SubstituteId: v.MaterialId,
+				Ratio:        v.Ratio,
+				Auto:         1,
+				Source:       "kit",
+			}
+			if _, ok := req.Substitutes[line.MaterialId]; ok {
+				out.Substitution.Auto = 0
+			}
+		}
+		out.Substitution.Qty += v.LineQty
+		out.Substitution.SubstituteQty += v.Qty
+	}
+
+	for _, v := range p.Shortfalls {
+		obj.Lines = append(obj.Lines, &kit.PickLine{
+			MaterialId:   v.MaterialId,
+			ShortfallQty: v.Qty,
+			Status:       1,
+		})
+	}
+
+	if err := kit.InsertPick(obj, outs); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	for _, v := range outs {
+		c.Audit(audit.CREATE, "order", v.Order.Id, nil, v.Order)
+	}
+	c.Audit(audit.CREATE, "kit_pick", obj.Id, nil, obj)
+
+	// 每个格子开一次门并打开指示灯
+	for _, v := range outs {
+		s := p.sources[v.Order.GridId]
+
+		where := make(map[string]interface{})
+		where["uuid"] = strconv.Itoa(v.Order.Id)
+		where["boxId"] = s.Addr
+		where["gridId"] = s.Channel
+		where["operation"] = LOCK_SUM
+
+		bytes, err := SerialByAddr(s.Addr).Post(SERIAL_OPEN, where)
+		if err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err, v.Order.GridId))
+			return
+		}
+
+		c.DoorOpened("grid", v.Order.GridId, where)
+
+		log.Info("PickKit %d %s", v.Order.GridId, string(bytes))
+
+		if err := gridLight(s.Addr, s.Channel, LIGHT_OPEN); err != nil {
+			log.Warn("PickKit light %v", err)
+		}
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 根据ID查询领取记录,包括明细
+func (c *KitController) PickById() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := kit.PickById(id)
+	if err != nil {
+		if kit.ErrPickNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有领取记录,status=2为缺料
+func (c *KitController) PickList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"kitId", "accountId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err, "status"))
+		return
+	}
+	where["status"] = status
+
+	total, list, err := kit.PickList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
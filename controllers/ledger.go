@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/ledger"
+)
+
+// 台账的原因、来源和操作人,和库存在同一事务中写入
+func ledgerSource(identity *Identity, ref *StockRef) *ledger.Movement {
+	if identity == nil {
+		identity = SystemIdentity
+	}
+
+	src := &ledger.Movement{
+		ActorType: identity.Type,
+		ActorId:   identity.Id,
+	}
+
+	if ref != nil {
+		src.Reason = ref.Reason
+		src.RefType = ref.RefType
+		src.RefId = ref.RefId
+		src.Note = ref.Note
+	}
+
+	return src
+}
+
+type LedgerController struct {
+	BaseController
+}
+
+// 查询条件中的ID
+func (c *LedgerController) ids(keys ...string) (map[string]interface{}, error) {
+	where := make(map[string]interface{})
+	for _, key := range keys {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			return nil, errors.As(err, key)
+		}
+		where[key] = id
+	}
+
+	return where, nil
+}
+
+// 根据ID查询
+func (c *LedgerController) MovementById() {
+	idStr := c.Ctx.Input.Param(":id")
+	if len(idStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("movement id is empty"))
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := ledger.MovementById(id)
+	if err != nil {
+		if ledger.ErrMovementNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有变动
+func (c *LedgerController) MovementList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	ids, err := c.ids("boxId", "gridId", "materialId", "refId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for k, v := range ids {
+		where[k] = v
+	}
+	where["reason"] = c.GetString("reason")
+	where["refType"] = c.GetString("refType")
+
+	total, list, err := ledger.MovementList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 某一时刻格子物料的数量,at为空时为当前
+func (c *LedgerController) Balance() {
+	where, err := c.ids("boxId", "gridId", "materialId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// 只有日期时为当天结束
+	at := c.GetString("at")
+	if len(at) == 10 {
+		at += " 23:59:59"
+	}
+
+	list, err := ledger.BalanceList(where, at)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	var qty int
+	for _, v := range list {
+		qty += v.Qty
+	}
+
+	c.WriteHttpResponse(200, struct {
+		At    string      `json:"at"`
+		Total int64       `json:"total"`
+		Qty   int         `json:"qty"`
+		Data  interface{} `json:"data"`
+	}{
+		At:    at,
+		Total: int64(len(list)),
+		Qty:   qty,
+		Data:  list,
+	}, nil)
+	return
+}
+
+// 用台账校验库存
+func (c *LedgerController) Verify() {
+	list, err := ledger.Verify()
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, struct {
+		Valid bool        `json:"valid"`
+		Total int64       `json:"total"`
+		Data  interface{} `json:"data"`
+	}{
+		Valid: len(list) == 0,
+		Total: int64(len(list)),
+		Data:  list,
+	}, nil)
+	return
+}
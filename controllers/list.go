@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var ErrParamUnsupported = errors.New("param is not supported")
+
+// 列表请求公共参数
+type ListRequest struct {
+	StartDate string
+	EndDate   string
+	Name      string
+	// 不传时为1
+	Page int
+	// 不传时为list_page_size,不超过list_max_page_size
+	PageSize int
+	// 字段:asc|desc,不传时为列表的默认排序
+	Sort string
+	// 上一页返回的next
+	Cursor string
+	// 只返回的字段,为空返回全部
+	Fields []string
+}
+
+// 列表响应
+type ListResponse struct {
+	Total int64 `json:"total"`
+	// 下一页游标,没有下一页时为空
+	Next string      `json:"next"`
+	Data interface{} `json:"data"`
+}
+
+// 解析列表公共参数,sort为列表查询的默认排序
+// sort为空时列表不支持排序和游标,传了返回错误
+func (c *BaseController) ListRequest(sort string) (*ListRequest, error) {
+	if sort == "" {
+		if err := c.Unsupported("sort", "cursor"); err != nil {
+			return nil, errors.As(err)
+		}
+	}
+
+	r := &ListRequest{
+		StartDate: c.GetString("startDate"),
+		EndDate:   c.GetString("endDate"),
+		Name:      c.GetString("name"),
+		Sort:      c.GetString("sort"),
+		Cursor:    c.GetString("cursor"),
+	}
+
+	page, err := c.GetInt("page", 1)
+	if err != nil {
+		return nil, errors.As(err, "page")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	r.Page = page
+
+	pageSize, err := c.GetInt("pageSize", conf.DefaultInt("list_page_size", 20))
+	if err != nil {
+		return nil, errors.As(err, "pageSize")
+	}
+
+	if pageSize < 1 {
+		pageSize = conf.DefaultInt("list_page_size", 20)
+	}
+
+	if max := conf.DefaultInt("list_max_page_size", 1000); pageSize > max {
+		pageSize = max
+	}
+	r.PageSize = pageSize
+
+	if _, _, ok := query.ParseSort(r.Sort); r.Sort != "" && !ok {
+		return nil, errors.As(query.ErrSortIllegal, r.Sort)
+	}
+
+	// 查询和下一页游标使用相同的排序
+	if r.Sort == "" {
+		r.Sort = sort
+	}
+
+	if r.Cursor != "" {
+		if _, err := query.DecodeCursor(r.Cursor); err != nil {
+			return nil, errors.As(err)
+		}
+	}
+
+	if fields := c.GetString("fields"); fields != "" {
+		for _, v := range strings.Split(fields, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				r.Fields = append(r.Fields, v)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// 列表不支持的参数,传了返回错误,防止被静默忽略
+func (c *BaseController) Unsupported(keys ...string) error {
+	for _, key := range keys {
+		if len(c.GetString(key)) > 0 {
+			return errors.As(ErrParamUnsupported, key)
+		}
+	}
+
+	return nil
+}
+
+// 查询条件,包含公共参数,可再添加其他条件
+func (r *ListRequest) Where() map[string]interface{} {
+	return map[string]interface{}{
+		"startDate": r.StartDate,
+		"endDate":   r.EndDate,
+		"name":      r.Name,
+		"sort":      r.Sort,
+		"cursor":    r.Cursor,
+	}
+}
+
+// 输出列表,排序和游标错误返回400
+func (c *BaseController) WriteList(r *ListRequest, total int64, list interface{}, err error) {
+	if err != nil {
+		if query.ErrSortIllegal.Equal(err) || query.ErrCursorIllegal.Equal(err) {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	resp := &ListResponse{
+		Total: total,
+		Next:  query.NextCursor(list, r.Sort, r.PageSize),
+		Data:  list,
+	}
+
+	// 空列表返回[]
+	if v := reflect.ValueOf(list); !v.IsValid() || (v.Kind() == reflect.Slice && v.IsNil()) {
+		resp.Data = make([]interface{}, 0)
+	}
+
+	if len(r.Fields) > 0 {
+		data, err := selectFields(resp.Data, r.Fields)
+		if err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+		resp.Data = data
+	}
+
+	c.WriteHttpResponse(200, resp, nil)
+}
+
+// 每行只保留指定字段,id总是保留
+func selectFields(list interface{}, fields []string) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, errors.As(err)
+	}
+
+	for i, row := range rows {
+		v := make(map[string]interface{})
+		if id, ok := row["id"]; ok {
+			v["id"] = id
+		}
+		for _, f := range fields {
+			if value, ok := row[f]; ok {
+				v[f] = value
+			}
+		}
+		rows[i] = v
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/material"
+)
+
+type MaterialRfidController struct {
+	BaseController
+}
+
+// 绑定标签,rfids可批量绑定
+func (c *MaterialRfidController) AddMaterialRfid() {
+	obj := &material.MaterialRfidObj{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil || obj.MaterialRfid == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	materialId := obj.MaterialId
+	if _, err := material.MaterialById(materialId); err != nil {
+		if material.ErrMaterialNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	rfids := obj.Rfids
+	if len(obj.Rfid) > 0 {
+		rfids = append(rfids, obj.Rfid)
+	}
+
+	if len(rfids) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("rfid is empty"))
+		return
+	}
+
+	list := make([]*material.MaterialRfid, 0, len(rfids))
+	for _, v := range rfids {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if len(v) == 0 {
+			continue
+		}
+
+		list = append(list, &material.MaterialRfid{
+			Created:    timex.String(),
+			CreatedBy:  c.Operator(),
+			MaterialId: materialId,
+			Rfid:       v,
+			Status:     1,
+			State:      material.RFID_NEW,
+		})
+	}
+
+	if err := material.InsertMaterialRfids(list); err != nil {
+		if material.ErrMaterialRfidAlreadyExist.Equal(err) {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	for _, v := range list {
+		c.Audit(audit.CREATE, "material_rfid", v.Id, nil, v)
+	}
+
+	c.WriteHttpResponse(200, list, nil)
+	return
+}
+
+// 修改
+func (c *MaterialRfidController) EditMaterialRfid() {
+	obj := &material.MaterialRfid{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	// 查询是否存在
+	acc, err := material.MaterialRfidById(obj.Id)
+	if err != nil {
+		if material.ErrMaterialRfidNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	obj.Rfid = strings.ToUpper(strings.TrimSpace(obj.Rfid))
+
+	// 标签是否已绑定其他物料
+	if obj.Rfid != acc.Rfid {
+		if _, err := material.MaterialRfidByRfid(obj.Rfid); err == nil {
+			c.WriteHttpResponse(400, nil, errors.As(material.ErrMaterialRfidAlreadyExist))
+			return
+		} else if !material.ErrMaterialRfidNotFound.Equal(err) {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+	}
+
+	// 位置只由关门对账修改
+	obj.State = acc.State
+	obj.GridId = acc.GridId
+	obj.AccountId = acc.AccountId
+
+	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := material.UpdateMaterialRfid(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "material_rfid", obj.Id, acc, obj)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 解绑
+func (c *MaterialRfidController) DelMaterialRfid() {
+	idStr := c.Ctx.Input.Param(":id")
+	log.Debug(idStr)
+	if len(idStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("material rfid id is empty"))
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// 删除前数据
+	before, err := material.MaterialRfidById(id)
+	if err != nil {
+		if material.ErrMaterialRfidNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := material.DelMaterialRfid(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	// 在柜标签解绑后重新计算库存
+	if before.State == material.RFID_IN && before.GridId > 0 {
+		if err := SyncRfidStock(c.Identity(), c.Ctx.Request.Method, c.Ctx.Request.URL.Path, &StockRef{
+			Reason:  ledger.ADJUST,
+			RefType: "material_rfid",
+			RefId:   id,
+		}, before.GridId, before.MaterialId); err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+	}
+
+	c.Audit(audit.DELETE, "material_rfid", id, before, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 根据标签查询物料
+func (c *MaterialRfidController) MaterialByRfid() {
+	rfid := c.Ctx.Input.Param(":rfid")
+	log.Debug(rfid)
+	if len(rfid) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("rfid is empty"))
+		return
+	}
+
+	obj, err := material.MaterialByRfid(strings.ToUpper(rfid))
+	if err != nil {
+		if material.ErrMaterialRfidNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 查询所有
+func (c *MaterialRfidController) MaterialRfidList() {
+	rfid := c.GetString("rfid")
+
+	r, err := c.ListRequest("id:asc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// materialId
+	materialIdStr := c.Input().Get("materialId")
+
+	var materialId int
+	if len(materialIdStr) > 0 {
+		materialId, err = strconv.Atoi(materialIdStr)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+	}
+
+	// gridId
+	gridIdStr := c.Input().Get("gridId")
+
+	var gridId int
+	if len(gridIdStr) > 0 {
+		gridId, err = strconv.Atoi(gridIdStr)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+	}
+
+	// state,不传查询所有
+	stateStr := c.Input().Get("state")
+
+	state := -1
+	if len(stateStr) > 0 {
+		state, err = strconv.Atoi(stateStr)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+	}
+
+	where := r.Where()
+	where["materialId"] = materialId
+	where["gridId"] = gridId
+	where["state"] = state
+	where["rfid"] = strings.ToUpper(rfid)
+
+	total, list, err := material.MaterialRfidList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
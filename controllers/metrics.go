@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"github.com/beego/ms304w-client/basis/bus"
+)
+
+type MetricsController struct {
+	BaseController
+}
+
+// 事件总线统计
+func (c *MetricsController) Events() {
+	c.WriteHttpResponse(200, struct {
+		Topics map[string]bus.Stats `json:"topics"`
+		// WebSocket和SSE连接数
+		Streams int `json:"streams"`
+	}{
+		Topics:  Bus.Stats(),
+		Streams: Events.Count(),
+	}, nil)
+	return
+}
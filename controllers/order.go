@@ -7,6 +7,8 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/inventory"
 	"github.com/beego/ms304w-client/models/order"
 )
 
@@ -40,6 +42,8 @@ func (c *OrderController) AddOrder() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -79,6 +83,8 @@ func (c *OrderController) EditOrder() {
 		return
 	}
 
+	c.Audit(audit.UPDATE, "order", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -98,11 +104,25 @@ func (c *OrderController) DelOrder() {
 		return
 	}
 
+	// 删除前数据
+	before, err := order.OrderById(orderId)
+	if err != nil {
+		if order.ErrOrderNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := order.DelOrder(orderId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "order", orderId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -169,10 +189,6 @@ func (c *OrderController) OrderByAccountId() {
 
 // 查询所有
 func (c *OrderController) OrderList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
 	accountIdStr := c.Input().Get("accountId")
 	typeIdStr := c.Input().Get("type")
 
@@ -196,49 +212,35 @@ func (c *OrderController) OrderList() {
 		}
 	}
 
-	page, err := c.GetInt("page")
+	r, err := c.ListRequest("id:desc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	pageSize, err := c.GetInt("pageSize")
+	// 格子所在柜子
+	boxId, err := c.GetInt("boxId", 0)
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	total, list, err := order.OrderList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-		"accountId": accountId,
-		"type":      typeId,
-	}, page, pageSize)
+	where := r.Where()
+	where["accountId"] = accountId
+	where["type"] = typeId
+	where["boxId"] = boxId
+
+	total, list, err := inventory.OrderList(where, r.Page, r.PageSize)
 	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
+		c.WriteList(r, total, nil, err)
 		return
 	}
 
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		for _, v := range list {
-			v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
-		}
-
-		data = list
+	for _, v := range list {
+		v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
 	}
 
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
-
+	c.WriteList(r, total, list, nil)
 	return
 }
 
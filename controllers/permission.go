@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/permission"
 )
 
@@ -44,11 +45,14 @@ func (c *PermissionController) AddPermission() {
 	}
 
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := permission.InsertPermission(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "permission", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -82,12 +86,16 @@ func (c *PermissionController) EditPermission() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := permission.UpdatePermission(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "permission", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -107,11 +115,25 @@ func (c *PermissionController) DelPermission() {
 		return
 	}
 
+	// 删除前数据
+	before, err := permission.PermissionById(permissionId)
+	if err != nil {
+		if permission.ErrPermissionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := permission.DelPermission(permissionId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "permission", permissionId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	rp "github.com/beego/ms304w-client/basis/report"
+	"github.com/beego/ms304w-client/models/report"
+)
+
+type ReportController struct {
+	BaseController
+}
+
+// 所有报表
+func (c *ReportController) ReportList() {
+	c.WriteHttpResponse(200, report.Reports(), nil)
+	return
+}
+
+// 导出,按行写入响应
+func (c *ReportController) Export() {
+	name := c.Ctx.Input.Param(":name")
+
+	format := c.GetString("format", rp.CSV)
+	if format != rp.CSV && format != rp.XLSX {
+		c.WriteHttpResponse(400, nil, errors.As(rp.ErrFormat, format))
+		return
+	}
+
+	where := map[string]interface{}{
+		"by":        c.GetString("by"),
+		"method":    c.GetString("method", CostMethod()),
+		"startDate": c.GetString("startDate"),
+		"endDate":   c.GetString("endDate"),
+	}
+
+	for _, key := range []string{"boxId", "gridId", "materialId", "categoryId", "accountId", "costCenterId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	q, err := report.NewQuery(name, where)
+	if err != nil {
+		if report.ErrReportNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	c.EnableRender = false
+
+	w := c.Ctx.ResponseWriter
+	w.Header().Set("Content-Type", rp.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("20060102150405"), format))
+
+	out, err := rp.NewWriter(format, w)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	if err := out.WriteHeader(q.Report.Columns); err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	// 已开始输出,出错只能记录日志
+	if err := q.Each(out.WriteRow); err != nil {
+		log.Error("%v", errors.As(err, name))
+	}
+
+	if err := out.Close(); err != nil {
+		log.Error("%v", errors.As(err, name))
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/permission"
 )
 
@@ -45,11 +46,14 @@ func (c *RoleController) AddRole() {
 
 	obj.Status = 1
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := permission.InsertRole(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "role", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, obj, nil)
 	return
 }
@@ -83,12 +87,16 @@ func (c *RoleController) EditRole() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := permission.UpdateRole(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "role", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -108,11 +116,25 @@ func (c *RoleController) DelRole() {
 		return
 	}
 
+	// 删除前数据
+	before, err := permission.RoleById(roleId)
+	if err != nil {
+		if permission.ErrRoleNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := permission.DelRole(roleId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "role", roleId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -149,46 +171,18 @@ func (c *RoleController) RoleById() {
 
 // 查询所有
 func (c *RoleController) RoleList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
 	name := c.GetString("name")
 
-	page, err := c.GetInt("page")
+	r, err := c.ListRequest("id:asc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	pageSize, err := c.GetInt("pageSize")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	total, list, err := permission.RoleList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-	}, page, pageSize)
-	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
-		return
-	}
-
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		data = list
-	}
-
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	where := r.Where()
+	where["name"] = name
 
+	total, list, err := permission.RoleList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
 	return
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/permission"
 )
 
@@ -43,10 +44,13 @@ func (c *RolePermissionController) AddRolePermission() {
 	if acc == nil {
 		obj.Status = 1
 		obj.Created = timex.String()
+		obj.CreatedBy = c.Operator()
 		if err := permission.InsertRolePermission(obj); err != nil {
 			c.WriteHttpResponse(500, nil, errors.As(err))
 			return
 		}
+
+		c.Audit(audit.CREATE, "role_permission", obj.Id, nil, obj)
 	} else {
 		// 存在修改
 		acc.Status = 1
@@ -109,6 +113,8 @@ func (c *RolePermissionController) DelRolePermission() {
 		return
 	}
 
+	c.Audit(audit.DELETE, "role_permission", acc.Id, acc, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -121,19 +127,13 @@ func (c *RolePermissionController) PermissionByRoleId() {
 		return
 	}
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := permission.PermissionByRoleId(roleId, page, pageSize)
+	list, err := permission.PermissionByRoleId(roleId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -151,20 +151,14 @@ func (c *RolePermissionController) PermissionByUserId() {
 		return
 	}
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
 	// 根据用户查询角色
-	roles, err := permission.RoleByUserId(userId, page, pageSize)
+	roles, err := permission.RoleByUserId(userId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -177,7 +171,7 @@ func (c *RolePermissionController) PermissionByUserId() {
 
 	roleId := roles[0].Id
 
-	list, err := permission.PermissionByRoleId(roleId, page, pageSize)
+	list, err := permission.PermissionByRoleId(roleId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
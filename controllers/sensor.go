@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/sensor"
 )
 
@@ -50,6 +51,8 @@ func (c *SensorController) AddSensor() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "sensor", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -89,6 +92,8 @@ func (c *SensorController) EditSensor() {
 		return
 	}
 
+	c.Audit(audit.UPDATE, "sensor", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -108,11 +113,25 @@ func (c *SensorController) DelSensor() {
 		return
 	}
 
+	// 删除前数据
+	before, err := sensor.SensorById(sensorId)
+	if err != nil {
+		if sensor.ErrSensorNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := sensor.DelSensor(sensorId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "sensor", sensorId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -149,19 +168,13 @@ func (c *SensorController) SensorById() {
 
 // 查询所有
 func (c *SensorController) SensorList() {
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := sensor.SensorList(page, pageSize)
+	list, err := sensor.SensorList(r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
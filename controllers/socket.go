@@ -1,12 +1,59 @@
 package controllers
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/beego/ms304w-client/basis/conf"
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/googollee/go-socket.io"
 )
 
 var Server *socketio.Server
 
+type SocketController struct {
+	BaseController
+}
+
+var ErrSocketForbidden = errors.New("socket forbidden")
+
+// 客户端命令
+const (
+	// 心跳
+	CMD_PING = "ping"
+	// 查询柜子门状态
+	CMD_STATUS = "status"
+	// 订阅柜子事件
+	CMD_SUBSCRIBE = "subscribe"
+	// 取消订阅
+	CMD_UNSUBSCRIBE = "unsubscribe"
+	// 登录后绑定用户
+	CMD_AUTH = "auth"
+)
+
+// 客户端命令
+type SocketCommand struct {
+	Cmd   string `json:"cmd"`
+	BoxId int    `json:"boxId"`
+	Token string `json:"token"`
+}
+
+// 连接信息
+type socketSession struct {
+	identity *Identity
+	// 连接时绑定的柜子
+	boxId int
+	rooms map[string]bool
+}
+
+var (
+	socketLock     = &sync.Mutex{}
+	socketSessions = make(map[string]*socketSession)
+)
+
 func init() {
 	if Server != nil {
 		return
@@ -19,31 +66,288 @@ func init() {
 
 	Server = server
 
+	Events.Handle(broadcastEvent)
+
 	server.On("connection", func(so socketio.Socket) {
 		log.Info("on connection: %s", so.Id())
 
-		so.Join("login")
+		query := so.Request().URL.Query()
+
+		// 连接时携带登录token
+		identity := OAuth.Identity(query.Get("token"))
+		if identity == nil && conf.DefaultBool("oauth", false) {
+			so.Emit(EVENT_ERROR, NewEvent(EVENT_ERROR, 0, 0, ErrSocketForbidden.Error()))
+			so.Disconnect()
+			return
+		}
+
+		// 柜子客户端只能绑定启用的柜子
+		var boxId int
+		if v := query.Get("boxId"); len(v) > 0 {
+			id, err := strconv.Atoi(v)
+			if err != nil || !CabinetEnabled(id) {
+				so.Emit(EVENT_ERROR, NewEvent(EVENT_ERROR, 0, 0, errors.As(ErrSocketForbidden, v).Error()))
+				so.Disconnect()
+				return
+			}
+			boxId = id
+		}
+
+		sess := &socketSession{
+			identity: identity,
+			boxId:    boxId,
+			rooms:    make(map[string]bool),
+		}
 
-		/*
-			so.On("message", func(msg string){
-				log.Info("on connection news: %s", msg)
+		socketLock.Lock()
+		socketSessions[so.Id()] = sess
+		socketLock.Unlock()
 
-				// so.Emit("message", msg)
+		// 柜子客户端只加入自己的柜子,后台用户接收所有事件
+		// 其他客户端只接收自己的用户事件
+		if boxId > 0 {
+			joinRoom(so, RoomBox(boxId))
+			joinRoom(so, ROOM_DEVICE)
+		} else if isUser(identity) {
+			joinRoom(so, ROOM_ALL)
+		}
 
-				server.BroadcastTo("login", "news", msg)
-			})
-		*/
+		if identity != nil && identity.Type == IDENTITY_ACCOUNT {
+			joinRoom(so, RoomAccount(identity.Id))
+		}
 
-		// so.Emit("connected", "connected!")
+		so.On("command", func(msg string) string {
+			return socketCommand(so, msg).String()
+		})
 	})
 
 	server.On("disconnection", func(so socketio.Socket) {
 		log.Info("on disconnection: %s", so.Id())
 
-		so.Leave("login")
+		socketLock.Lock()
+		sess, ok := socketSessions[so.Id()]
+		delete(socketSessions, so.Id())
+		socketLock.Unlock()
+
+		if !ok {
+			return
+		}
+
+		for room := range sess.rooms {
+			so.Leave(room)
+		}
 	})
 
 	server.On("error", func(so socketio.Socket, err error) {
-		log.Info("on error")
+		log.Info("on error %v", err)
 	})
 }
+
+func isUser(identity *Identity) bool {
+	return identity != nil && identity.Type == IDENTITY_USER
+}
+
+// 后台用户可以订阅所有柜子,柜子客户端只能订阅绑定的柜子
+func checkSocketBox(so socketio.Socket, boxId int) error {
+	socketLock.Lock()
+	sess, ok := socketSessions[so.Id()]
+	var identity *Identity
+	var bound int
+	if ok {
+		identity = sess.identity
+		bound = sess.boxId
+	}
+	socketLock.Unlock()
+
+	if !ok {
+		return errors.As(ErrSocketForbidden, boxId)
+	}
+
+	if isUser(identity) && CabinetEnabled(boxId) {
+		return nil
+	}
+
+	if bound > 0 && bound == boxId {
+		return nil
+	}
+
+	return errors.As(ErrSocketForbidden, boxId)
+}
+
+func socketRooms(so socketio.Socket) []string {
+	socketLock.Lock()
+	defer socketLock.Unlock()
+
+	list := []string{}
+	if sess, ok := socketSessions[so.Id()]; ok {
+		for room := range sess.rooms {
+			list = append(list, room)
+		}
+	}
+
+	return list
+}
+
+func joinRoom(so socketio.Socket, room string) {
+	if err := so.Join(room); err != nil {
+		log.Error("%v", errors.As(err, room))
+		return
+	}
+
+	socketLock.Lock()
+	if sess, ok := socketSessions[so.Id()]; ok {
+		sess.rooms[room] = true
+	}
+	socketLock.Unlock()
+}
+
+func leaveRoom(so socketio.Socket, room string) {
+	if err := so.Leave(room); err != nil {
+		log.Error("%v", errors.As(err, room))
+		return
+	}
+
+	socketLock.Lock()
+	if sess, ok := socketSessions[so.Id()]; ok {
+		delete(sess.rooms, room)
+	}
+	socketLock.Unlock()
+}
+
+// 处理客户端命令
+func socketCommand(so socketio.Socket, msg string) *HttpResponse {
+	log.Info("command %s: %s", so.Id(), msg)
+
+	cmd := &SocketCommand{}
+	if err := json.Unmarshal([]byte(msg), cmd); err != nil {
+		return NewHttpResponse(400, nil, errors.As(err))
+	}
+
+	switch cmd.Cmd {
+	case CMD_PING:
+		return NewHttpResponse(200, CMD_PING, nil)
+
+	case CMD_STATUS:
+		if cmd.BoxId <= 0 {
+			return NewHttpResponse(400, nil, errors.New("boxId is empty"))
+		}
+
+		if err := checkSocketBox(so, cmd.BoxId); err != nil {
+			return NewHttpResponse(403, nil, errors.As(err))
+		}
+
+		// 门状态通过boxStatus事件返回
+		bytes, err := SerialByAddr(cmd.BoxId).Get(fmt.Sprintf(SERIAL_ALL_STATUS, cmd.BoxId))
+		if err != nil {
+			return NewHttpResponse(500, nil, errors.As(err))
+		}
+
+		log.Info("All Status Res %s", string(bytes))
+
+		joinRoom(so, RoomBox(cmd.BoxId))
+		return NewHttpResponse(200, nil, nil)
+
+	case CMD_SUBSCRIBE:
+		if cmd.BoxId <= 0 {
+			return NewHttpResponse(400, nil, errors.New("boxId is empty"))
+		}
+
+		if err := checkSocketBox(so, cmd.BoxId); err != nil {
+			return NewHttpResponse(403, nil, errors.As(err))
+		}
+
+		joinRoom(so, RoomBox(cmd.BoxId))
+		return NewHttpResponse(200, nil, nil)
+
+	case CMD_UNSUBSCRIBE:
+		if cmd.BoxId <= 0 {
+			return NewHttpResponse(400, nil, errors.New("boxId is empty"))
+		}
+
+		leaveRoom(so, RoomBox(cmd.BoxId))
+		return NewHttpResponse(200, nil, nil)
+
+	case CMD_AUTH:
+		identity := OAuth.Identity(cmd.Token)
+		if identity == nil {
+			return NewHttpResponse(401, nil, errors.As(ErrSocketForbidden))
+		}
+
+		socketLock.Lock()
+		sess, ok := socketSessions[so.Id()]
+		var old *Identity
+		var boxId int
+		if ok {
+			old = sess.identity
+			boxId = sess.boxId
+			sess.identity = identity
+		}
+		socketLock.Unlock()
+
+		// 切换用户
+		if old != nil && old.Type == IDENTITY_ACCOUNT {
+			leaveRoom(so, RoomAccount(old.Id))
+		}
+
+		// 不再是后台用户时离开其他柜子
+		if isUser(old) && !isUser(identity) {
+			for _, room := range socketRooms(so) {
+				if room == ROOM_ALL || (strings.HasPrefix(room, "box:") && room != RoomBox(boxId)) {
+					leaveRoom(so, room)
+				}
+			}
+		}
+
+		if identity.Type == IDENTITY_ACCOUNT {
+			joinRoom(so, RoomAccount(identity.Id))
+		}
+
+		if isUser(identity) && boxId == 0 {
+			joinRoom(so, ROOM_ALL)
+		}
+
+		return NewHttpResponse(200, identity, nil)
+	}
+
+	return NewHttpResponse(400, nil, errors.New("unknown command"))
+}
+
+// 事件定义
+func (c *SocketController) Schema() {
+	typ := c.GetString("type")
+	if len(typ) > 0 {
+		schema, err := EventSchema(typ)
+		if err != nil {
+			if ErrEventNotFound.Equal(err) {
+				c.WriteHttpResponse(404, nil, errors.As(err))
+				return
+			}
+
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(200, schema, nil)
+		return
+	}
+
+	list := make(map[string]interface{})
+	for typ := range eventSchemas {
+		schema, err := EventSchema(typ)
+		if err != nil {
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		list[typ] = schema
+	}
+
+	c.WriteHttpResponse(200, struct {
+		Version int                    `json:"version"`
+		Events  map[string]interface{} `json:"events"`
+	}{
+		Version: EVENT_VERSION,
+		Events:  list,
+	}, nil)
+	return
+}
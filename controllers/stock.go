@@ -7,9 +7,11 @@ import (
 
 	// "github.com/beego/ms304w-client/basis/bytex"
 	"github.com/beego/ms304w-client/basis/errors"
-	"github.com/beego/ms304w-client/basis/httpx/rest"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/inventory"
+	"github.com/beego/ms304w-client/models/kit"
 	"github.com/beego/ms304w-client/models/material"
 	"github.com/beego/ms304w-client/models/order"
 )
@@ -71,47 +73,22 @@ func (c *StockController) StockIn() {
 	// 物料传感器
 	sensorId := sensor[0].SensorId
 
-	// 查询物料绑定的格子
-	gridList, err := box.GridByMaterialId(materialId)
+	// 领料的格子
+	src, err := outGrid(materialId, qty)
 	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
-		return
-	}
-
-	// 物料未绑定格子
-	if len(gridList) == 0 {
-		c.WriteHttpResponse(404, nil, errors.As(box.ErrGridNotFound))
-		return
-	}
-
-	// 如果有指定格子，判断是否已超过最大容量
-	var boxAddr int
-	var gridId int
-	var gridChannel int
-
-	for _, v := range gridList {
-		maxQty := v.Qty
-		totalQty := v.TotalQty
-
-		// 判断是否大于最大库存
-		if totalQty >= maxQty && maxQty != 0 {
-			// 格子已满
-			continue
-		} else {
-			// 指定格子
-			boxAddr = v.Addr
-			gridId = v.Id
-			gridChannel = v.Channel
-			break
+		if box.ErrGridNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
 		}
-	}
 
-	// 没有分配格子
-	if gridId <= 0 {
-		c.WriteHttpResponse(404, nil, errors.As(box.ErrGridNotFound))
+		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	boxAddr := src.Addr
+	gridId := src.GridId
+	gridChannel := src.Channel
+
 	log.Info("boxAddr %d, gridId %d, gridChannel %d", boxAddr, gridId, gridChannel)
 
 	// 查询通道
@@ -152,6 +129,8 @@ func (c *StockController) StockIn() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
 	/*
 		boxBytes, err := bytex.IntToBytes(int32(boxAddr))
 		if err != nil {
@@ -172,14 +151,14 @@ func (c *StockController) StockIn() {
 	where["gridId"] = gridChannel
 	where["operation"] = 2
 
-	log.Info("Post %s", SERIAL_OPEN_URL)
-
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("grid", gridId, where)
+
 	log.Info("StockIn %s", string(bytes))
 
 	c.WriteHttpResponse(200, struct {
@@ -201,7 +180,7 @@ func (c *StockController) StockInConfirm() {
 
 // 领料
 func (c *StockController) StockOut() {
-	obj := &order.Request{}
+	obj := &OutRequest{}
 
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
@@ -231,6 +210,30 @@ func (c *StockController) StockOut() {
 		return
 	}
 
+	// 成本中心和工单
+	charge, status, err := resolveCharge(obj)
+	if err != nil {
+		c.WriteHttpResponse(status, nil, errors.As(err))
+		return
+	}
+
+	// 库存不足时使用替代物料
+	substitution, offer, status, err := resolveSubstitute(obj)
+	if err != nil {
+		if offer != nil {
+			c.WriteHttpResponse(status, offer, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(status, nil, errors.As(err))
+		return
+	}
+
+	if substitution != nil {
+		materialId = substitution.SubstituteId
+		qty = substitution.SubstituteQty
+	}
+
 	// 根据物料查询传感器
 	_, sensor, err := material.SensorList(map[string]interface{}{
 		"startDate":  "",
@@ -263,10 +266,28 @@ func (c *StockController) StockOut() {
 		return
 	}
 
-	// 如果有指定格子，判断是否已超过最大容量
-	boxAddr := gridList[0].Addr
-	gridId := gridList[0].Id
-	gridChannel := gridList[0].Channel
+	// 领料的格子
+	var boxAddr int
+	var gridId int
+	var gridChannel int
+
+	for _, v := range gridList {
+		// RFID格子按标签计数
+		if v.Mode == box.MODE_RFID {
+			continue
+		}
+
+		boxAddr = v.Addr
+		gridId = v.Id
+		gridChannel = v.Channel
+		break
+	}
+
+	// 没有称重格子
+	if gridId <= 0 {
+		c.WriteHttpResponse(404, nil, errors.As(box.ErrGridNotFound))
+		return
+	}
 
 	log.Info("boxAddr %d, gridId %d, gridChannel %d", boxAddr, gridId, gridChannel)
 
@@ -303,11 +324,22 @@ func (c *StockController) StockOut() {
 		Status:     1,
 	}
 
-	if err := order.InsertOrder(o); err != nil {
+	// 订单和记账、替代记录一起添加
+	if err := inventory.InsertOut(&inventory.Out{
+		Order:        o,
+		Charge:       charge,
+		Substitution: substitution,
+	}); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
+	if substitution != nil {
+		c.Audit(audit.CREATE, "order_substitution", substitution.Id, nil, substitution)
+	}
+
 	/*
 		boxBytes, err := bytex.IntToBytes(int32(boxAddr))
 		if err != nil {
@@ -328,22 +360,66 @@ func (c *StockController) StockOut() {
 	where["gridId"] = gridChannel
 	where["operation"] = 2
 
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("grid", gridId, where)
+
 	log.Info("StockOut %s", string(bytes))
 
 	c.WriteHttpResponse(200, struct {
-		Channel int `json:"channel"`
+		Channel      int                    `json:"channel"`
+		Substitution *material.Substitution `json:"substitution,omitempty"`
 	}{
-		Channel: channel,
+		Channel:      channel,
+		Substitution: substitution,
 	}, nil)
 	return
 }
 
+// 领料的格子,同套件领取的顺序,优先库存足够的称重格子,其次库存最多的
+// 都没有可领库存时使用物料绑定的第一个称重格子,没有称重格子返回ErrGridNotFound
+func outGrid(materialId, qty int) (*kit.Source, error) {
+	list, err := kit.SourceList(materialId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	for _, v := range list {
+		if v.Qty >= qty {
+			return v, nil
+		}
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	grids, err := box.GridByMaterialId(materialId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	for _, v := range grids {
+		// RFID格子按标签计数
+		if v.Mode == box.MODE_RFID {
+			continue
+		}
+
+		return &kit.Source{
+			GridId:     v.Id,
+			MaterialId: materialId,
+			Addr:       v.Addr,
+			Channel:    v.Channel,
+		}, nil
+	}
+
+	return nil, errors.As(box.ErrGridNotFound, materialId)
+}
+
 // 领料确认
 func (c *StockController) StockOutConfirm() {
 	log.Info("StockOutConfirm: %s", string(c.Ctx.Input.RequestBody))
@@ -403,6 +479,12 @@ func (c *StockController) StockRecycle() {
 
 	sensorId := sensor[0].SensorId
 
+	// 配置了隔离格子时回收放入隔离格子待检验
+	if gridId := quarantineGrid(); gridId > 0 {
+		c.recycleToQuarantine(accountId, materialId, sensorId, qty, gridId)
+		return
+	}
+
 	// 查询物料绑定的格子
 	gridList, err := box.GridByMaterialId(materialId)
 	if err != nil {
@@ -422,6 +504,11 @@ func (c *StockController) StockRecycle() {
 	var gridChannel int
 
 	for _, v := range gridList {
+		// RFID格子按标签计数
+		if v.Mode == box.MODE_RFID {
+			continue
+		}
+
 		maxQty := v.Qty
 		totalQty := v.TotalQty
 
@@ -484,6 +571,8 @@ func (c *StockController) StockRecycle() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
 	/*
 		boxBytes, err := bytex.IntToBytes(int32(boxAddr))
 		if err != nil {
@@ -504,12 +593,14 @@ func (c *StockController) StockRecycle() {
 	where["gridId"] = gridChannel
 	where["operation"] = 2
 
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("grid", gridId, where)
+
 	log.Info("StockRecycle %s", string(bytes))
 
 	c.WriteHttpResponse(200, struct {
@@ -530,17 +621,7 @@ func (c *StockController) StockRecycleConfirm() {
 
 // 格子库存
 func (c *StockController) StockList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("id:desc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
@@ -582,54 +663,52 @@ func (c *StockController) StockList() {
 		}
 	}
 
-	total, list, err := order.StockList(map[string]interface{}{
-		"startDate":  startDate,
-		"endDate":    endDate,
-		"name":       name,
-		"gridId":     gridId,
-		"categoryId": categoryId,
-		"materialId": materialId,
-	}, page, pageSize)
+	// 格子所在柜子
+	boxId, err := c.GetInt("boxId", 0)
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		for _, v := range list {
-			v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
-		}
+	where := r.Where()
+	where["gridId"] = gridId
+	where["categoryId"] = categoryId
+	where["materialId"] = materialId
+	where["boxId"] = boxId
 
-		data = list
+	total, list, err := inventory.StockList(where, r.Page, r.PageSize)
+	if err != nil {
+		c.WriteList(r, total, nil, err)
+		return
 	}
 
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	method := CostMethod()
 
+	ids := make([]int, 0, len(list))
+	for _, v := range list {
+		ids = append(ids, v.MaterialId)
+	}
+	costs := unitCosts(method, ids)
+
+	items := make([]*StockValue, 0, len(list))
+	for _, v := range list {
+		v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
+
+		items = append(items, &StockValue{
+			Stock:    v,
+			Method:   method,
+			UnitCost: costs[v.MaterialId],
+			Value:    float64(v.Qty) * costs[v.MaterialId],
+		})
+	}
+
+	c.WriteList(r, total, items, nil)
 	return
 }
 
 // 物料库存
 func (c *StockController) MaterialStockList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
@@ -659,42 +738,53 @@ func (c *StockController) MaterialStockList() {
 		}
 	}
 
-	total, list, err := order.MaterialStockList(map[string]interface{}{
-		"startDate":  startDate,
-		"endDate":    endDate,
-		"name":       name,
-		"categoryId": categoryId,
-		"materialId": materialId,
-	}, page, pageSize)
+	// 格子所在柜子
+	boxId, err := c.GetInt("boxId", 0)
 	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
+		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		data = list
+	where := r.Where()
+	where["categoryId"] = categoryId
+	where["materialId"] = materialId
+	where["boxId"] = boxId
+
+	total, list, err := inventory.MaterialStockList(where, r.Page, r.PageSize)
+
+	if err != nil {
+		c.WriteList(r, total, nil, err)
+		return
 	}
 
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	method := CostMethod()
 
+	ids := make([]int, 0, len(list))
+	for _, v := range list {
+		ids = append(ids, v.MaterialId)
+	}
+	costs := unitCosts(method, ids)
+	substitutes := substituteQtys(ids)
+	flagged := flaggedQtys(ids)
+
+	items := make([]*MaterialStockValue, 0, len(list))
+	for _, v := range list {
+		items = append(items, &MaterialStockValue{
+			MaterialStock: v,
+			Method:        method,
+			UnitCost:      costs[v.MaterialId],
+			Value:         float64(v.Qty) * costs[v.MaterialId],
+			SubstituteQty: substitutes[v.MaterialId],
+			AvailableQty:  v.Qty - flagged[v.MaterialId] + substitutes[v.MaterialId],
+		})
+	}
+
+	c.WriteList(r, total, items, nil)
 	return
 }
 
 // 组物料库存
 func (c *StockController) GroupStockList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
 	// accountId
 	accountId, err := c.GetInt("accountId")
 	if err != nil {
@@ -702,15 +792,7 @@ func (c *StockController) GroupStockList() {
 		return
 	}
 
-	// page
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	// pageSize
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
@@ -740,37 +822,21 @@ func (c *StockController) GroupStockList() {
 		}
 	}
 
-	total, list, err := order.GroupStock(map[string]interface{}{
-		"startDate":  startDate,
-		"endDate":    endDate,
-		"name":       name,
-		"categoryId": categoryId,
-		"materialId": materialId,
-	}, accountId, page, pageSize)
+	where := r.Where()
+	where["categoryId"] = categoryId
+	where["materialId"] = materialId
+
+	total, list, err := order.GroupStock(where, accountId, r.Page, r.PageSize)
 	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
+		c.WriteList(r, total, nil, err)
 		return
 	}
 
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		for _, v := range list {
-			v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
-		}
-
-		data = list
+	for _, v := range list {
+		v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
 	}
 
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
-
+	c.WriteList(r, total, list, nil)
 	return
 }
 
@@ -904,6 +970,8 @@ func (c *StockController) Auto() {
 			return
 		}
 
+		c.Audit(audit.CREATE, "auto", auto.Id, nil, auto)
+
 		// 查询格子配置
 		_, list, err := box.ChannelList(map[string]interface{}{
 			"startDate": "",
@@ -938,12 +1006,14 @@ func (c *StockController) Auto() {
 		where["boxId"] = boxAddr
 		where["gridId"] = channel
 
-		bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+		bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 		if err != nil {
 			c.WriteHttpResponse(500, nil, errors.As(err))
 			return
 		}
 
+		c.DoorOpened("grid", gridId, where)
+
 		log.Info("StockIn %s", string(bytes))
 
 	}
@@ -954,34 +1024,19 @@ func (c *StockController) Auto() {
 
 // 自动盘点查询
 func (c *StockController) AutoList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
-	page, err := c.GetInt("page")
+	r, err := c.ListRequest("id:desc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	pageSize, err := c.GetInt("pageSize")
+	// 格子所在柜子
+	boxId, err := c.GetInt("boxId", 0)
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	// boxId
-	boxIdStr := c.Input().Get("boxId")
-	var boxId int
-
-	if len(boxIdStr) > 0 {
-		boxId, err = strconv.Atoi(boxIdStr)
-		if err != nil {
-			c.WriteHttpResponse(400, nil, errors.As(err))
-			return
-		}
-	}
-
 	// accountId
 	accountIdStr := c.Input().Get("accountId")
 	var accountId int
@@ -994,36 +1049,20 @@ func (c *StockController) AutoList() {
 		}
 	}
 
-	total, list, err := order.AutoList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-		"boxId":     boxId,
-		"accountId": accountId,
-	}, page, pageSize)
+	where := r.Where()
+	where["accountId"] = accountId
+	where["boxId"] = boxId
+
+	total, list, err := inventory.AutoList(where, r.Page, r.PageSize)
 	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
+		c.WriteList(r, total, nil, err)
 		return
 	}
 
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		for _, v := range list {
-			v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
-		}
-
-		data = list
+	for _, v := range list {
+		v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
 	}
 
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
-
+	c.WriteList(r, total, list, nil)
 	return
 }
@@ -5,9 +5,10 @@ import (
 	"strconv"
 
 	"github.com/beego/ms304w-client/basis/errors"
-	"github.com/beego/ms304w-client/basis/httpx/rest"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/inventory"
 	"github.com/beego/ms304w-client/models/material"
 	"github.com/beego/ms304w-client/models/order"
 )
@@ -56,6 +57,12 @@ func (c *StockCodeController) StockIn() {
 		return
 	}
 
+	// RFID格子按标签计数,不能称重出入库
+	if g.Mode == box.MODE_RFID {
+		c.WriteHttpResponse(400, nil, errors.As(box.ErrGridRfid, g.Id))
+		return
+	}
+
 	materialId := g.MaterialId
 	boxAddr := g.Addr
 	gridId := g.Id
@@ -122,6 +129,8 @@ func (c *StockCodeController) StockIn() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
 	/*
 		boxBytes, err := bytex.IntToBytes(int32(boxAddr))
 		if err != nil {
@@ -142,12 +151,14 @@ func (c *StockCodeController) StockIn() {
 	where["gridId"] = gridChannel
 	where["operation"] = 2
 
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("grid", gridId, where)
+
 	log.Info("StockIn %s", string(bytes))
 
 	c.WriteHttpResponse(200, struct {
@@ -165,7 +176,7 @@ func (c *StockCodeController) StockIn() {
 
 // 领料
 func (c *StockCodeController) StockOut() {
-	obj := &order.Request{}
+	obj := &OutRequest{}
 
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
@@ -191,6 +202,13 @@ func (c *StockCodeController) StockOut() {
 
 	qty := obj.Qty
 
+	// 成本中心和工单
+	charge, status, err := resolveCharge(obj)
+	if err != nil {
+		c.WriteHttpResponse(status, nil, errors.As(err))
+		return
+	}
+
 	// 查询code对应的格子和物料
 	g, err := box.GridByCode(code)
 	if err != nil {
@@ -203,11 +221,50 @@ func (c *StockCodeController) StockOut() {
 		return
 	}
 
+	// RFID格子按标签计数,不能称重出入库
+	if g.Mode == box.MODE_RFID {
+		c.WriteHttpResponse(400, nil, errors.As(box.ErrGridRfid, g.Id))
+		return
+	}
+
 	materialId := g.MaterialId
 	boxAddr := g.Addr
 	gridId := g.Id
 	gridChannel := g.Channel
 
+	// 库存不足时使用替代物料,改为替代物料的格子
+	obj.MaterialId = materialId
+	substitution, offer, status, err := resolveSubstitute(obj)
+	if err != nil {
+		if offer != nil {
+			c.WriteHttpResponse(status, offer, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(status, nil, errors.As(err))
+		return
+	}
+
+	if substitution != nil {
+		materialId = substitution.SubstituteId
+		qty = substitution.SubstituteQty
+
+		src, err := outGrid(materialId, qty)
+		if err != nil {
+			if box.ErrGridNotFound.Equal(err) {
+				c.WriteHttpResponse(404, nil, errors.As(err))
+				return
+			}
+
+			c.WriteHttpResponse(500, nil, errors.As(err))
+			return
+		}
+
+		boxAddr = src.Addr
+		gridId = src.GridId
+		gridChannel = src.Channel
+	}
+
 	log.Info("%#v", gridChannel)
 
 	// 根据物料查询传感器
@@ -262,11 +319,22 @@ func (c *StockCodeController) StockOut() {
 		Status:     1,
 	}
 
-	if err := order.InsertOrder(o); err != nil {
+	// 订单和记账、替代记录一起添加
+	if err := inventory.InsertOut(&inventory.Out{
+		Order:        o,
+		Charge:       charge,
+		Substitution: substitution,
+	}); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
+	if substitution != nil {
+		c.Audit(audit.CREATE, "order_substitution", substitution.Id, nil, substitution)
+	}
+
 	/*
 		boxBytes, err := bytex.IntToBytes(int32(boxAddr))
 		if err != nil {
@@ -287,24 +355,28 @@ func (c *StockCodeController) StockOut() {
 	where["gridId"] = gridChannel
 	where["operation"] = 2
 
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("grid", gridId, where)
+
 	log.Info("StockIn %s", string(bytes))
 
 	c.WriteHttpResponse(200, struct {
-		MaterialId   int    `json:"materialId"`
-		MaterialCode string `json:"materialCode"`
-		Qty          int    `json:"qty"`
-		MaterialName string `json:"materialName"`
+		MaterialId   int                    `json:"materialId"`
+		MaterialCode string                 `json:"materialCode"`
+		Qty          int                    `json:"qty"`
+		MaterialName string                 `json:"materialName"`
+		Substitution *material.Substitution `json:"substitution,omitempty"`
 	}{
-		MaterialId:   materialId,
+		MaterialId:   g.MaterialId,
 		MaterialCode: g.MaterialCode,
 		Qty:          g.TotalQty,
 		MaterialName: g.MaterialName,
+		Substitution: substitution,
 	}, nil)
 
 	return
@@ -350,6 +422,12 @@ func (c *StockCodeController) StockRecycle() {
 		return
 	}
 
+	// RFID格子按标签计数,不能称重出入库
+	if g.Mode == box.MODE_RFID {
+		c.WriteHttpResponse(400, nil, errors.As(box.ErrGridRfid, g.Id))
+		return
+	}
+
 	materialId := g.MaterialId
 	boxAddr := g.Addr
 	gridId := g.Id
@@ -414,6 +492,8 @@ func (c *StockCodeController) StockRecycle() {
 		return
 	}
 
+	c.Audit(audit.CREATE, "order", o.Id, nil, o)
+
 	/*
 		boxBytes, err := bytex.IntToBytes(int32(boxAddr))
 		if err != nil {
@@ -434,12 +514,14 @@ func (c *StockCodeController) StockRecycle() {
 	where["gridId"] = gridChannel
 	where["operation"] = 2
 
-	bytes, err := rest.Post(SERIAL_OPEN_URL).PostQuerys(where).End()
+	bytes, err := SerialByAddr(boxAddr).Post(SERIAL_OPEN, where)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.DoorOpened("grid", gridId, where)
+
 	log.Info("StockRecycle %s", string(bytes))
 
 	c.WriteHttpResponse(200, struct {
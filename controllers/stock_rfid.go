@@ -0,0 +1,565 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/rfid"
+)
+
+type StockRfidController struct {
+	BaseController
+}
+
+type RfidRequest struct {
+	AccountId int `json:"accountId"`
+	GridId    int `json:"gridId"`
+}
+
+// 对账结果,按物料和类型汇总
+type RfidItem struct {
+	MaterialId int      `json:"materialId"`
+	Type       int      `json:"type"`
+	Qty        int      `json:"qty"`
+	OrderId    int      `json:"orderId"`
+	Rfids      []string `json:"rfids"`
+}
+
+type RfidResult struct {
+	SessionId int         `json:"sessionId"`
+	AccountId int         `json:"accountId"`
+	GridId    int         `json:"gridId"`
+	Items     []*RfidItem `json:"items"`
+	// 未绑定物料的标签
+	Unknown []string `json:"unknown"`
+}
+
+// 开门,关门后按标签差异生成上料、领料和回收
+func (c *StockRfidController) Open() {
+	obj := &RfidRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if obj.AccountId <= 0 {
+		c.WriteHttpResponse(400, nil, errors.New("accountId is illegal"))
+		return
+	}
+
+	grid, err := box.GridById(obj.GridId)
+	if err != nil {
+		if box.ErrGridNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if grid.Mode != box.MODE_RFID {
+		c.WriteHttpResponse(400, nil, errors.As(box.ErrGridNotRfid))
+		return
+	}
+
+	// 开门前在柜标签
+	tags, err := material.RfidByGridId(grid.Id)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	rfids := make([]string, 0, len(tags))
+	for _, v := range tags {
+		rfids = append(rfids, v.Rfid)
+	}
+
+	bytes, err := json.Marshal(rfids)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	session := &rfid.Session{
+		Created:    timex.String(),
+		CreatedBy:  c.Operator(),
+		AccountId:  obj.AccountId,
+		GridId:     grid.Id,
+		Status:     rfid.SESSION_OPEN,
+		BeforeTags: string(bytes),
+		Updated:    timex.String(),
+	}
+
+	if err := rfid.InsertSession(session); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	where := make(map[string]interface{})
+	where["uuid"] = strconv.Itoa(session.Id)
+	where["boxId"] = grid.Addr
+	where["gridId"] = grid.Channel
+	where["operation"] = LOCK_RFID
+
+	res, err := SerialByAddr(grid.Addr).Post(SERIAL_OPEN, where)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.DoorOpened("grid", grid.Id, where)
+
+	log.Info("StockRfid Open %s", string(res))
+
+	c.WriteHttpResponse(200, session, nil)
+	return
+}
+
+// 根据ID查询开关门记录
+func (c *StockRfidController) SessionById() {
+	sessionIdStr := c.Ctx.Input.Param(":id")
+	log.Debug(sessionIdStr)
+	if len(sessionIdStr) == 0 {
+		c.WriteHttpResponse(400, nil, errors.New("session id is empty"))
+		return
+	}
+
+	sessionId, err := strconv.Atoi(sessionIdStr)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := rfid.SessionById(sessionId)
+	if err != nil {
+		if rfid.ErrSessionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 标签库存
+func (c *StockRfidController) StockList() {
+	gridId, err := c.GetInt("gridId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	materialId, err := c.GetInt("materialId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	list, err := material.RfidStockList(gridId, materialId)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, list, nil)
+	return
+}
+
+// 标签出入记录
+func (c *StockRfidController) RecordList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	sessionId, err := c.GetInt("sessionId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	accountId, err := c.GetInt("accountId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	gridId, err := c.GetInt("gridId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	materialId, err := c.GetInt("materialId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["sessionId"] = sessionId
+	where["accountId"] = accountId
+	where["gridId"] = gridId
+	where["materialId"] = materialId
+
+	total, list, err := rfid.RecordList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// -------------------------
+// 关门标签对账
+
+func (c *CallbackController) Rfid() {
+	log.Info("Rfid: %s", string(c.Ctx.Input.RequestBody))
+
+	obj := &SerialRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(500, nil, err)
+		return
+	}
+
+	if obj == nil || obj.Data == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	result, err := RfidCallback(obj.Data.UUID, obj.Data.Rfids)
+	if err != nil {
+		if rfid.ErrSessionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		if rfid.ErrSessionClosed.Equal(err) {
+			c.WriteHttpResponse(400, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	EmitGrid(result.GridId, EVENT_RFID_INVENTORY, result)
+	EmitAccount(result.AccountId, EVENT_RFID_INVENTORY, result)
+
+	c.WriteHttpResponse(200, result, nil)
+	return
+}
+
+const rfidCallbackRoute = "/v1/callback/rfid"
+
+// 对比开门前后标签,取出的为领料,放入的为上料或回收
+// 开门前标签取开门时的快照,结算在一个事务中完成
+func RfidCallback(sessionIdStr string, tags []string) (*RfidResult, error) {
+	sessionId, err := strconv.Atoi(sessionIdStr)
+	if err != nil {
+		return nil, errors.As(err, sessionIdStr)
+	}
+
+	session, err := rfid.SessionById(sessionId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	if session.Status != rfid.SESSION_OPEN {
+		return nil, errors.As(rfid.ErrSessionClosed, sessionId)
+	}
+
+	identity := &Identity{
+		Type: IDENTITY_ACCOUNT,
+		Id:   session.AccountId,
+	}
+
+	gridId := session.GridId
+
+	// 开门前
+	beforeTags := []string{}
+	if len(session.BeforeTags) > 0 {
+		if err := json.Unmarshal([]byte(session.BeforeTags), &beforeTags); err != nil {
+			return nil, errors.As(err, sessionId)
+		}
+	}
+
+	beforeList := make([]*material.MaterialRfid, 0, len(beforeTags))
+	before := make(map[string]*material.MaterialRfid)
+	beforeQty := make(map[int]int)
+	for _, v := range beforeTags {
+		if _, ok := before[v]; ok {
+			continue
+		}
+
+		tag, err := material.MaterialRfidByRfid(v)
+		if err != nil {
+			// 开门后解绑的标签不再计算
+			if material.ErrMaterialRfidNotFound.Equal(err) {
+				continue
+			}
+
+			return nil, errors.As(err)
+		}
+
+		beforeList = append(beforeList, tag)
+		before[v] = tag
+		beforeQty[tag.MaterialId]++
+	}
+
+	// 关门后
+	after := make(map[string]bool)
+	afterTags := make([]string, 0, len(tags))
+	for _, v := range tags {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if len(v) == 0 || after[v] {
+			continue
+		}
+
+		after[v] = true
+		afterTags = append(afterTags, v)
+	}
+
+	result := &RfidResult{
+		SessionId: sessionId,
+		AccountId: session.AccountId,
+		GridId:    gridId,
+		Items:     make([]*RfidItem, 0),
+		Unknown:   make([]string, 0),
+	}
+
+	// 按物料和类型汇总
+	items := make(map[[2]int]*RfidItem)
+	settles := make(map[[2]int]*rfid.SettleItem)
+	afterQty := make(map[int]int)
+	for k, v := range beforeQty {
+		afterQty[k] = v
+	}
+
+	// 受影响的格子和物料,用于重新计算库存
+	affected := map[[2]int]bool{}
+
+	updated := timex.String()
+
+	add := func(tag *material.MaterialRfid, typ int) {
+		key := [2]int{tag.MaterialId, typ}
+		item, ok := items[key]
+		if !ok {
+			item = &RfidItem{
+				MaterialId: tag.MaterialId,
+				Type:       typ,
+				Rfids:      make([]string, 0),
+			}
+			items[key] = item
+			settles[key] = &rfid.SettleItem{}
+		}
+
+		item.Qty++
+		item.Rfids = append(item.Rfids, tag.Rfid)
+
+		tag.AccountId = session.AccountId
+		tag.Updated = updated
+		settles[key].Tags = append(settles[key].Tags, tag)
+	}
+
+	// 取出
+	for _, v := range beforeList {
+		if after[v.Rfid] {
+			continue
+		}
+
+		add(v, order.OUT)
+		afterQty[v.MaterialId]--
+
+		v.State = material.RFID_OUT
+		v.GridId = 0
+		affected[[2]int{gridId, v.MaterialId}] = true
+	}
+
+	// 放入
+	for _, v := range afterTags {
+		if _, ok := before[v]; ok {
+			continue
+		}
+
+		tag, err := material.MaterialRfidByRfid(v)
+		if err != nil {
+			if !material.ErrMaterialRfidNotFound.Equal(err) {
+				return nil, errors.As(err)
+			}
+
+			result.Unknown = append(result.Unknown, v)
+			continue
+		}
+
+		// 已领出的为回收,其他为上料
+		if tag.State == material.RFID_OUT {
+			add(tag, order.RECYCLE)
+		} else {
+			add(tag, order.IN)
+		}
+
+		// 从其他格子移入
+		if tag.State == material.RFID_IN && tag.GridId != gridId {
+			affected[[2]int{tag.GridId, tag.MaterialId}] = true
+		}
+
+		afterQty[tag.MaterialId]++
+
+		tag.State = material.RFID_IN
+		tag.GridId = gridId
+		affected[[2]int{gridId, tag.MaterialId}] = true
+	}
+
+	keys := make([][2]int, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+
+		return keys[i][1] < keys[j][1]
+	})
+
+	// 生成订单
+	list := make([]*rfid.SettleItem, 0, len(keys))
+	for _, k := range keys {
+		item := items[k]
+
+		settle := settles[k]
+		settle.Order = &order.Order{
+			Created:    updated,
+			AccountId:  session.AccountId,
+			Type:       item.Type,
+			GridId:     gridId,
+			MaterialId: item.MaterialId,
+			BeforeQty:  beforeQty[item.MaterialId],
+			Qty:        item.Qty,
+			AfterQty:   afterQty[item.MaterialId],
+			Status:     1,
+			Updated:    updated,
+		}
+
+		list = append(list, settle)
+		result.Items = append(result.Items, item)
+	}
+
+	affectedList := make([][2]int, 0, len(affected))
+	for k := range affected {
+		affectedList = append(affectedList, k)
+	}
+
+	sort.Slice(affectedList, func(i, j int) bool {
+		if affectedList[i][0] != affectedList[j][0] {
+			return affectedList[i][0] < affectedList[j][0]
+		}
+
+		return affectedList[i][1] < affectedList[j][1]
+	})
+
+	bytes, err := json.Marshal(afterTags)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	session.AfterTags = string(bytes)
+	session.Updated = updated
+
+	ref := &StockRef{
+		Reason:  ledger.SETTLE,
+		RefType: "rfid_session",
+		RefId:   sessionId,
+	}
+
+	changes, err := rfid.Settle(session, list, affectedList, ledgerSource(identity, ref))
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	session.Status = rfid.SESSION_CLOSED
+
+	for i, v := range list {
+		result.Items[i].OrderId = v.Order.Id
+
+		WriteAudit(identity, "POST", rfidCallbackRoute, audit.CREATE, "order", v.Order.Id, nil, v.Order)
+	}
+
+	for _, v := range changes {
+		PublishStockChanged(identity, "POST", rfidCallbackRoute, ref, v.Before, v.After)
+	}
+
+	return result, nil
+}
+
+// 按在柜标签数量更新格子库存
+func SyncRfidStock(identity *Identity, method, route string, ref *StockRef, gridId, materialId int) error {
+	list, err := material.RfidStockList(gridId, materialId)
+	if err != nil {
+		return errors.As(err)
+	}
+
+	var qty int
+	for _, v := range list {
+		qty += v.Qty
+	}
+
+	stockObj, err := order.StockByMaterialId(materialId, gridId)
+	if err != nil {
+		if !order.ErrStockNotFound.Equal(err) {
+			return errors.As(err)
+		}
+
+		if qty == 0 {
+			return nil
+		}
+
+		stockObj = &order.Stock{
+			Created:    timex.String(),
+			GridId:     gridId,
+			MaterialId: materialId,
+			Qty:        qty,
+			Updated:    timex.String(),
+		}
+		if err := ledger.InsertStock(stockObj, ledgerSource(identity, ref)); err != nil {
+			return errors.As(err)
+		}
+
+		PublishStockChanged(identity, method, route, ref, nil, stockObj)
+		return nil
+	}
+
+	if stockObj.Qty == qty {
+		return nil
+	}
+
+	before := *stockObj
+	stockObj.Qty = qty
+	stockObj.Updated = timex.String()
+	if err := ledger.UpdateStock(&before, stockObj, ledgerSource(identity, ref)); err != nil {
+		return errors.As(err)
+	}
+
+	PublishStockChanged(identity, method, route, ref, &before, stockObj)
+	return nil
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/stream"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 写超时
+	streamWriteWait = 10 * time.Second
+	// 心跳间隔
+	streamPingPeriod = 30 * time.Second
+	// 每个连接缓存事件数
+	streamBufferSize = 256
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+type StreamController struct {
+	BaseController
+}
+
+// 订阅参数
+type streamQuery struct {
+	identity *Identity
+	boxId    int
+	types    map[string]bool
+	lastId   int64
+}
+
+// type=inventory,doorStatus&boxId=1&lastEventId=100
+func (c *StreamController) query() (*streamQuery, error) {
+	q := &streamQuery{
+		types: make(map[string]bool),
+	}
+
+	token := c.Ctx.Request.Header.Get("Token")
+	if len(token) == 0 {
+		token = c.GetString("token")
+	}
+	q.identity = OAuth.Identity(token)
+
+	if v := c.GetString("boxId"); len(v) > 0 {
+		boxId, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.As(err, v)
+		}
+
+		// 只能绑定启用的柜子
+		if !CabinetEnabled(boxId) {
+			return nil, errors.As(ErrSocketForbidden, boxId)
+		}
+		q.boxId = boxId
+	}
+
+	for _, typ := range strings.Split(c.GetString("type"), ",") {
+		typ = strings.TrimSpace(typ)
+		if len(typ) == 0 {
+			continue
+		}
+
+		if _, ok := eventSchemas[typ]; !ok {
+			return nil, errors.As(ErrEventNotFound, typ)
+		}
+
+		q.types[typ] = true
+	}
+
+	// SSE断线重连时浏览器自动带Last-Event-ID
+	lastId := c.Ctx.Request.Header.Get("Last-Event-ID")
+	if len(lastId) == 0 {
+		lastId = c.GetString("lastEventId")
+	}
+	if len(lastId) > 0 {
+		id, err := strconv.ParseInt(lastId, 10, 64)
+		if err != nil {
+			return nil, errors.As(err, lastId)
+		}
+		q.lastId = id
+	}
+
+	return q, nil
+}
+
+func (q *streamQuery) filter(msg stream.Message) bool {
+	event, ok := msg.(*Event)
+	if !ok {
+		return false
+	}
+
+	return event.Visible(q.identity, q.boxId, q.types)
+}
+
+// WebSocket
+func (c *StreamController) WebSocket() {
+	q, err := c.query()
+	if err != nil {
+		if ErrSocketForbidden.Equal(err) {
+			c.WriteHttpResponse(403, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	c.EnableRender = false
+
+	conn, err := upgrader.Upgrade(c.Ctx.ResponseWriter, c.Ctx.Request, nil)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+	defer conn.Close()
+
+	sub, backlog := Events.Subscribe(q.lastId, q.filter, streamBufferSize)
+	defer Events.Unsubscribe(sub)
+
+	// 客户端关闭
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * streamPingPeriod))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(2 * streamPingPeriod))
+			return nil
+		})
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(msg stream.Message) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		return conn.WriteJSON(msg)
+	}
+
+	for _, msg := range backlog {
+		if err := write(msg); err != nil {
+			log.Warn("websocket %v", errors.As(err))
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-sub.C():
+			if !ok {
+				// 处理过慢被断开,客户端按lastEventId续传
+				conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "slow consumer"))
+				return
+			}
+
+			if err := write(msg); err != nil {
+				log.Warn("websocket %v", errors.As(err))
+				return
+			}
+
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// Server-Sent Events
+func (c *StreamController) Sse() {
+	q, err := c.query()
+	if err != nil {
+		if ErrSocketForbidden.Equal(err) {
+			c.WriteHttpResponse(403, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	c.EnableRender = false
+
+	w := c.Ctx.ResponseWriter
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	w.Flush()
+
+	sub, backlog := Events.Subscribe(q.lastId, q.filter, streamBufferSize)
+	defer Events.Unsubscribe(sub)
+
+	write := func(msg stream.Message) error {
+		event := msg.(*Event)
+
+		bytes, err := json.Marshal(event)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, bytes); err != nil {
+			return errors.As(err)
+		}
+
+		w.Flush()
+		return nil
+	}
+
+	for _, msg := range backlog {
+		if err := write(msg); err != nil {
+			log.Warn("sse %v", err)
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+
+	done := c.Ctx.Request.Context().Done()
+
+	for {
+		select {
+		case msg, ok := <-sub.C():
+			if !ok {
+				return
+			}
+
+			if err := write(msg); err != nil {
+				log.Warn("sse %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+
+		case <-done:
+			return
+		}
+	}
+}
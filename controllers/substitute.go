@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/beego/ms304w-client/basis/bom"
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/material"
+)
+
+var (
+	ErrStockNotEnough = errors.New("material stock is not enough")
+)
+
+// 所有领料都允许自动替代,否则只有请求允许时
+func substituteAuto() bool {
+	return conf.DefaultBool("substitute_auto", false)
+}
+
+// 物料和替代物料的库存
+type Availability struct {
+	MaterialId int `json:"materialId"`
+	Qty        int `json:"qty"`
+	// 替代物料折合数量
+	SubstituteQty int `json:"substituteQty"`
+	// 合计可用数量
+	TotalQty    int                    `json:"totalQty"`
+	Substitutes []*material.Substitute `json:"substitutes"`
+}
+
+// 物料的合计可用数量
+func availability(materialId int) (*Availability, error) {
+	qty, err := material.StockQty(materialId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	list, err := material.Substitutes(materialId)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	a := &Availability{
+		MaterialId:  materialId,
+		Qty:         qty,
+		Substitutes: list,
+	}
+
+	for _, v := range list {
+		a.SubstituteQty += v.EquivalentQty
+	}
+	a.TotalQty = a.Qty + a.SubstituteQty
+
+	return a, nil
+}
+
+// 替代物料折合数量,查询失败时不影响库存列表
+func substituteQtys(materialIds []int) map[int]int {
+	m, err := material.SubstituteQtys(materialIds)
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return map[int]int{}
+	}
+
+	return m
+}
+
+// 领料的替代物料,不需要替代时返回nil
+// 指定替代物料时使用指定的,库存不足且允许自动替代时按优先级使用库存足够的
+// 库存不足又不能自动替代时返回409和可用的替代物料
+func resolveSubstitute(obj *OutRequest) (*material.Substitution, *Availability, int, error) {
+	if obj.SubstituteId > 0 {
+		s, err := material.SubstituteBy(obj.MaterialId, obj.SubstituteId)
+		if err != nil {
+			if material.ErrSubstituteNotFound.Equal(err) {
+				return nil, nil, 400, errors.As(err)
+			}
+
+			return nil, nil, 500, errors.As(err)
+		}
+
+		if s.Status != 1 {
+			return nil, nil, 400, errors.As(material.ErrSubstituteIllegal, obj.MaterialId, obj.SubstituteId)
+		}
+
+		return substitution(obj, s, 0), nil, 200, nil
+	}
+
+	a, err := availability(obj.MaterialId)
+	if err != nil {
+		return nil, nil, 500, errors.As(err)
+	}
+
+	if a.Qty >= obj.Qty {
+		return nil, nil, 200, nil
+	}
+
+	// 库存足够的替代物料
+	enough := []*material.Substitute{}
+	for _, v := range a.Substitutes {
+		if v.Qty >= bom.Convert(obj.Qty, v.Ratio) {
+			enough = append(enough, v)
+		}
+	}
+
+	// 没有可用的替代物料时按原物料领取
+	if len(enough) == 0 {
+		return nil, nil, 200, nil
+	}
+
+	if obj.AllowSubstitute || substituteAuto() {
+		for _, v := range enough {
+			if v.Auto == 1 {
+				return substitution(obj, v, 1), nil, 200, nil
+			}
+		}
+	}
+
+	return nil, a, 409, errors.As(ErrStockNotEnough, obj.MaterialId, a.Qty, obj.Qty)
+}
+
+// 替代记录,订单添加后补充订单ID
+func substitution(obj *OutRequest, s *material.Substitute, auto int) *material.Substitution {
+	return &material.Substitution{
+		AccountId:     obj.AccountId,
+		MaterialId:    obj.MaterialId,
+		Qty:           obj.Qty,
+		SubstituteId:  s.SubstituteId,
+		SubstituteQty: bom.Convert(obj.Qty, s.Ratio),
+		Ratio:         s.Ratio,
+		Auto:          auto,
+		Source:        "stock",
+	}
+}
+
+type SubstituteController struct {
+	BaseController
+}
+
+type SubstituteRequest struct {
+	material.Substitute
+	// 互为替代,同时添加反向的替代,比例为倒数
+	Mutual bool `json:"mutual"`
+}
+
+// 添加
+func (c *SubstituteController) AddSubstitute() {
+	req := &SubstituteRequest{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if req == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	obj := &req.Substitute
+	if err := material.CheckSubstitute(obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	list := []*material.Substitute{obj}
+	if req.Mutual {
+		list = append(list, &material.Substitute{
+			MaterialId:   obj.SubstituteId,
+			SubstituteId: obj.MaterialId,
+			Priority:     obj.Priority,
+			Ratio:        1 / obj.Ratio,
+			Auto:         obj.Auto,
+		})
+	}
+
+	for _, v := range list {
+		for _, id := range []int{v.MaterialId, v.SubstituteId} {
+			if _, err := material.MaterialById(id); err != nil {
+				if material.ErrMaterialNotFound.Equal(err) {
+					c.WriteHttpResponse(400, nil, errors.As(err, id))
+					return
+				}
+
+				c.WriteHttpResponse(500, nil, errors.As(err))
+				return
+			}
+		}
+
+		// 同一物料的替代物料不能重复
+		old, err := material.SubstituteBy(v.MaterialId, v.SubstituteId)
+		if err != nil {
+			if !material.ErrSubstituteNotFound.Equal(err) {
+				c.WriteHttpResponse(500, nil, errors.As(err))
+				return
+			}
+		}
+
+		if old != nil {
+			c.WriteHttpResponse(400, nil, errors.As(material.ErrSubstituteAlreadyExist, v.MaterialId, v.SubstituteId))
+			return
+		}
+
+		v.Id = 0
+		v.Status = 1
+		v.Created = timex.String()
+		v.CreatedBy = c.Operator()
+		v.Updated = timex.String()
+		v.UpdatedBy = c.Operator()
+	}
+
+	if err := material.InsertSubstitute(list...); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	for _, v := range list {
+		c.Audit(audit.CREATE, "material_substitute", v.Id, nil, v)
+	}
+
+	c.WriteHttpResponse(200, list, nil)
+	return
+}
+
+// 修改优先级、比例、自动替代和状态
+func (c *SubstituteController) EditSubstitute() {
+	obj := &material.Substitute{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	old, err := material.SubstituteById(obj.Id)
+	if err != nil {
+		if material.ErrSubstituteNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	v := *old
+	v.Priority = obj.Priority
+	v.Ratio = obj.Ratio
+	v.Auto = obj.Auto
+	v.Status = obj.Status
+	if err := material.CheckSubstitute(&v); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	v.Updated = timex.String()
+	v.UpdatedBy = c.Operator()
+	if err := material.UpdateSubstitute(&v); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "material_substitute", v.Id, old, &v)
+
+	c.WriteHttpResponse(200, &v, nil)
+	return
+}
+
+// 删除
+func (c *SubstituteController) DelSubstitute() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := material.SubstituteById(id)
+	if err != nil {
+		if material.ErrSubstituteNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := material.DelSubstitute(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "material_substitute", id, old, nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 查询所有
+func (c *SubstituteController) SubstituteList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"materialId", "substituteId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err, "status"))
+		return
+	}
+	where["status"] = status
+
+	total, list, err := material.SubstituteList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 物料和替代物料的合计可用数量
+func (c *SubstituteController) Availability() {
+	materialId, err := c.GetInt(":materialId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	a, err := availability(materialId)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, a, nil)
+	return
+}
+
+// 领料订单的替代记录
+func (c *SubstituteController) SubstitutionList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	for _, key := range []string{"materialId", "substituteId", "accountId"} {
+		id, err := c.GetInt(key, 0)
+		if err != nil {
+			c.WriteHttpResponse(400, nil, errors.As(err, key))
+			return
+		}
+		where[key] = id
+	}
+	where["source"] = c.GetString("source")
+
+	total, list, err := material.SubstitutionList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 根据订单查询替代记录
+func (c *SubstituteController) SubstitutionByOrderId() {
+	orderId, err := c.GetInt(":orderId")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := material.SubstitutionByOrderId(orderId)
+	if err != nil {
+		if material.ErrSubstitutionNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
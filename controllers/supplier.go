@@ -7,6 +7,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/material"
 )
 
@@ -46,11 +47,14 @@ func (c *SupplierController) AddSupplier() {
 
 	obj.Status = 1
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := material.InsertSupplier(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "supplier", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, struct {
 		SupplierId int `json:"supplierIdId"`
 	}{
@@ -88,12 +92,16 @@ func (c *SupplierController) EditSupplier() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := material.UpdateSupplier(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "supplier", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -113,11 +121,25 @@ func (c *SupplierController) DelSupplier() {
 		return
 	}
 
+	// 删除前数据
+	before, err := material.SupplierById(supplierId)
+	if err != nil {
+		if material.ErrSupplierNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := material.DelSupplier(supplierId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "supplier", supplierId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -154,56 +176,24 @@ func (c *SupplierController) SupplierById() {
 
 // 查询所有
 func (c *SupplierController) SupplierList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
 	name := c.GetString("name")
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("id:asc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	total, list, err := material.SupplierList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-	}, page, pageSize)
-	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
-		return
-	}
-
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		data = list
-	}
-
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	where := r.Where()
+	where["name"] = name
 
+	total, list, err := material.SupplierList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
 	return
 }
 
 // 查询所有物料
 func (c *SupplierController) MaterialList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
-	name := c.GetString("name")
-
 	categoryIdStr := c.Input().Get("categoryId")
 
 	var categoryId int
@@ -216,47 +206,25 @@ func (c *SupplierController) MaterialList() {
 		}
 	}
 
-	page, err := c.GetInt("page")
+	r, err := c.ListRequest("id:asc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	pageSize, err := c.GetInt("pageSize")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
+	where := r.Where()
+	where["categoryId"] = categoryId
 
-	total, list, err := material.SupplierMaterialList(map[string]interface{}{
-		"startDate":  startDate,
-		"endDate":    endDate,
-		"name":       name,
-		"categoryId": categoryId,
-	}, page, pageSize)
+	total, list, err := material.SupplierMaterialList(where, r.Page, r.PageSize)
 	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
+		c.WriteList(r, total, nil, err)
 		return
 	}
 
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		for _, v := range list {
-			v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
-		}
-
-		data = list
+	for _, v := range list {
+		v.Img = fmt.Sprintf("%s/%s%s", ImgHost, ImgMaterialDir, v.Img)
 	}
 
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
-
+	c.WriteList(r, total, list, nil)
 	return
 }
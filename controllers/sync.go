@@ -0,0 +1,500 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/bus"
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/syncx"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/outbox"
+	"github.com/beego/ms304w-client/models/permission"
+	"github.com/satori/go.uuid"
+)
+
+// 每次推送数量
+const syncBatch = 100
+
+// 从服务器拉取的主数据,名称和审计日志实体类型一致,按依赖顺序
+var syncEntities = []string{
+	"category",
+	"supplier",
+	"material",
+	"group",
+	"group_material",
+	"account",
+	"account_group",
+	"permission",
+	"role",
+	"role_permission",
+	"user",
+	"user_role",
+}
+
+var syncModels = map[string]func() interface{}{
+	"category":        func() interface{} { return &material.Category{} },
+	"supplier":        func() interface{} { return &material.Supplier{} },
+	"material":        func() interface{} { return &material.Material{} },
+	"group":           func() interface{} { return &account.Group{} },
+	"group_material":  func() interface{} { return &material.GroupMaterial{} },
+	"account":         func() interface{} { return &account.Account{} },
+	"account_group":   func() interface{} { return &account.AccountGroup{} },
+	"permission":      func() interface{} { return &permission.Permission{} },
+	"role":            func() interface{} { return &permission.Role{} },
+	"role_permission": func() interface{} { return &permission.RolePermission{} },
+	"user":            func() interface{} { return &permission.User{} },
+	"user_role":       func() interface{} { return &permission.UserRole{} },
+}
+
+// 同步状态
+type SyncStatus struct {
+	Enable   bool   `json:"enable"`
+	Url      string `json:"url"`
+	DeviceId string `json:"deviceId"`
+	// 服务器是否可达
+	Online   bool   `json:"online"`
+	LastPush string `json:"lastPush"`
+	LastPull string `json:"lastPull"`
+	LastErr  string `json:"lastErr"`
+	Pending  int64  `json:"pending"`
+}
+
+var (
+	syncClient *syncx.Client
+	syncStatus = &SyncStatus{}
+	// 同一时间只执行一次同步
+	syncLock sync.Mutex
+	syncMu   sync.RWMutex
+	syncWake = make(chan struct{}, 1)
+)
+
+// 启动同步,未配置服务器时离线运行
+func StartSync() {
+	url := conf.DefaultString("sync_url", "")
+	if !syncx.Valid(url) {
+		return
+	}
+
+	deviceId, err := syncDeviceId()
+	if err != nil {
+		log.Error("%v", errors.As(err))
+		return
+	}
+
+	syncClient = syncx.NewClient(url, conf.DefaultString("sync_token", ""), deviceId, time.Duration(conf.DefaultInt("sync_timeout", 30))*time.Second)
+
+	syncMu.Lock()
+	syncStatus.Enable = true
+	syncStatus.Url = url
+	syncStatus.DeviceId = deviceId
+	syncMu.Unlock()
+
+	// 同步订阅,保证变更写入发件箱
+	Bus.Subscribe(TOPIC_ORDER_SETTLED, syncSubscriber)
+	Bus.Subscribe(TOPIC_STOCK_CHANGED, syncSubscriber)
+	Bus.Subscribe(TOPIC_ENTITY_CHANGED, syncSubscriber)
+
+	go syncWorker()
+}
+
+// 设备ID,未配置时生成并保存
+func syncDeviceId() (string, error) {
+	if id := conf.DefaultString("sync_device", ""); len(id) > 0 {
+		return id, nil
+	}
+
+	id, err := outbox.StateValue("device_id")
+	if err != nil {
+		return "", errors.As(err)
+	}
+
+	if len(id) > 0 {
+		return id, nil
+	}
+
+	id = uuid.Must(uuid.NewV4()).String()
+	if err := outbox.SetState("device_id", id, timex.String()); err != nil {
+		return "", errors.As(err)
+	}
+
+	return id, nil
+}
+
+// 变更写入发件箱
+func syncSubscriber(e bus.Event) error {
+	var (
+		entity string
+		id     int
+		action string
+		data   interface{}
+	)
+
+	switch v := e.(type) {
+	case *OrderSettled:
+		if v.Order == nil {
+			return nil
+		}
+		entity, id, action, data = "order", v.Order.Id, syncx.CREATE, v.Order
+
+	case *StockChanged:
+		stock := v.Stock()
+		if stock == nil {
+			return nil
+		}
+		entity, id, action, data = "stock", stock.Id, v.Action(), stock
+
+	case *EntityChanged:
+		if _, ok := syncModels[v.EntityType]; !ok {
+			return nil
+		}
+		entity, id, action, data = v.EntityType, v.EntityId, v.Action, v.After
+		if data == nil {
+			data = v.Before
+		}
+
+	default:
+		return nil
+	}
+
+	// 和审计日志一样去掉密码和token
+	payload, err := audit.Marshal(data)
+	if err != nil {
+		return errors.As(err, entity, id)
+	}
+
+	updated := syncx.Updated([]byte(payload))
+	if len(updated) == 0 {
+		updated = timex.String()
+	}
+
+	obj := &outbox.Outbox{
+		Created:       timex.String(),
+		Entity:        entity,
+		EntityId:      id,
+		Action:        syncAction(action),
+		EntityUpdated: updated,
+		Payload:       payload,
+		Status:        outbox.OUTBOX_PENDING,
+	}
+	if err := outbox.InsertOutbox(obj); err != nil {
+		return errors.As(err, entity, id)
+	}
+
+	wakeSync()
+
+	return nil
+}
+
+// 审计动作转为同步动作
+func syncAction(action string) string {
+	switch action {
+	case audit.CREATE:
+		return syncx.CREATE
+	case audit.DELETE:
+		return syncx.DELETE
+	}
+
+	return syncx.UPDATE
+}
+
+// 有新变更时唤醒
+func wakeSync() {
+	select {
+	case syncWake <- struct{}{}:
+	default:
+	}
+}
+
+// 定时推送和拉取,服务器不可达时等待下次
+func syncWorker() {
+	interval := time.Duration(conf.DefaultInt("sync_interval", 60)) * time.Second
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := RunSync(); err != nil {
+			log.Warn("%v", errors.As(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-syncWake:
+		}
+	}
+}
+
+// 执行一次同步
+func RunSync() error {
+	if syncClient == nil {
+		return errors.New("sync is disabled")
+	}
+
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	err := syncPush()
+	if err == nil {
+		err = syncPull()
+	}
+
+	syncMu.Lock()
+	syncStatus.Online = err == nil
+	if err != nil {
+		syncStatus.LastErr = err.Error()
+	} else {
+		syncStatus.LastErr = ""
+	}
+	syncMu.Unlock()
+
+	return err
+}
+
+// 推送发件箱
+func syncPush() error {
+	for {
+		list, err := outbox.PendingOutbox(syncBatch)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		if len(list) == 0 {
+			break
+		}
+
+		changes := make([]*syncx.Change, 0, len(list))
+		ids := make([]int, 0, len(list))
+		for _, v := range list {
+			changes = append(changes, &syncx.Change{
+				Seq:     int64(v.Id),
+				Entity:  v.Entity,
+				Id:      v.EntityId,
+				Action:  v.Action,
+				Updated: v.EntityUpdated,
+				Payload: json.RawMessage(v.Payload),
+			})
+			ids = append(ids, v.Id)
+		}
+
+		res, err := syncClient.Push(changes)
+		if err != nil {
+			if err := outbox.MarkFailed(ids, err.Error()); err != nil {
+				log.Error("%v", errors.As(err))
+			}
+
+			return errors.As(err)
+		}
+
+		accepted := make([]int, 0, len(res.Accepted))
+		for _, v := range res.Accepted {
+			accepted = append(accepted, int(v))
+		}
+
+		if err := outbox.MarkSent(accepted, timex.String()); err != nil {
+			return errors.As(err)
+		}
+
+		// 服务器未全部接收,下次再推送
+		if len(accepted) < len(list) {
+			break
+		}
+	}
+
+	syncMu.Lock()
+	syncStatus.LastPush = timex.String()
+	syncMu.Unlock()
+
+	return nil
+}
+
+// 拉取主数据
+func syncPull() error {
+	for _, entity := range syncEntities {
+		if err := syncPullEntity(entity); err != nil {
+			return errors.As(err, entity)
+		}
+	}
+
+	syncMu.Lock()
+	syncStatus.LastPull = timex.String()
+	syncMu.Unlock()
+
+	return nil
+}
+
+func syncPullEntity(entity string) error {
+	name := "pull:" + entity
+
+	cursor, err := outbox.StateValue(name)
+	if err != nil {
+		return errors.As(err)
+	}
+
+	for {
+		res, err := syncClient.Pull(entity, cursor)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		syncx.Sort(res.Changes)
+		for _, v := range res.Changes {
+			if err := applyChange(v); err != nil {
+				return errors.As(err, v.Id)
+			}
+		}
+
+		// 全部应用后才移动位置
+		if len(res.Cursor) == 0 || res.Cursor == cursor {
+			return nil
+		}
+
+		if err := outbox.SetState(name, res.Cursor, timex.String()); err != nil {
+			return errors.As(err)
+		}
+		cursor = res.Cursor
+
+		if len(res.Changes) == 0 {
+			return nil
+		}
+	}
+}
+
+// 应用服务器变更,和本地未推送修改冲突时按更新时间处理
+func applyChange(remote *syncx.Change) error {
+	factory, ok := syncModels[remote.Entity]
+	if !ok {
+		log.Warn("sync entity %s is not supported", remote.Entity)
+		return nil
+	}
+
+	pending, err := outbox.PendingByEntity(remote.Entity, remote.Id)
+	if err != nil && !outbox.ErrOutboxNotFound.Equal(err) {
+		return errors.As(err)
+	}
+
+	if pending != nil {
+		resolution := syncx.Resolve(&syncx.Change{Updated: pending.EntityUpdated}, remote)
+
+		if err := outbox.InsertConflict(&outbox.Conflict{
+			Created:    timex.String(),
+			Entity:     remote.Entity,
+			EntityId:   remote.Id,
+			Local:      pending.Payload,
+			Remote:     string(remote.Payload),
+			Resolution: resolution,
+		}); err != nil {
+			return errors.As(err)
+		}
+
+		// 保留本地,等推送覆盖服务器
+		if resolution == syncx.LOCAL {
+			return nil
+		}
+
+		if err := outbox.Supersede(remote.Entity, remote.Id); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	obj := factory()
+	if remote.Action != syncx.DELETE {
+		if err := json.Unmarshal(remote.Payload, obj); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	if err := outbox.ApplyRemote(obj, remote.Payload, remote.Id, remote.Action == syncx.DELETE); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+type SyncController struct {
+	BaseController
+}
+
+// 同步状态
+func (c *SyncController) Status() {
+	pending, err := outbox.OutboxCount(outbox.OUTBOX_PENDING)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	syncMu.RLock()
+	status := *syncStatus
+	syncMu.RUnlock()
+
+	status.Pending = pending
+
+	c.WriteHttpResponse(200, &status, nil)
+	return
+}
+
+// 立即同步
+func (c *SyncController) Run() {
+	if syncClient == nil {
+		c.WriteHttpResponse(400, nil, errors.New("sync is disabled"))
+		return
+	}
+
+	if err := RunSync(); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Status()
+	return
+}
+
+// 发件箱
+func (c *SyncController) OutboxList() {
+	entity := c.GetString("entity")
+
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["entity"] = entity
+	where["status"] = status
+
+	total, list, err := outbox.OutboxList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 冲突记录
+func (c *SyncController) ConflictList() {
+	entity := c.GetString("entity")
+	resolution := c.GetString("resolution")
+
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["entity"] = entity
+	where["resolution"] = resolution
+
+	total, list, err := outbox.ConflictList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/httpx/rest"
+)
+
+var (
+	// API路径
+	API_URL = conf.String("api_server")
+
+	// 串口操作统一通过Serial发送
+	Serial Transport = NewRestTransport(API_URL)
+)
+
+// 硬件通信
+type Transport interface {
+	// 发送命令
+	Post(path string, params map[string]interface{}) ([]byte, error)
+	// 查询状态
+	Get(path string) ([]byte, error)
+}
+
+// 通过HTTP转发到串口服务
+type restTransport struct {
+	host string
+}
+
+func NewRestTransport(host string) Transport {
+	return &restTransport{
+		host: host,
+	}
+}
+
+func (t *restTransport) Post(path string, params map[string]interface{}) ([]byte, error) {
+	log.Info("Post %s%s", t.host, path)
+
+	return rest.Post(t.host + path).PostQuerys(params).End()
+}
+
+func (t *restTransport) Get(path string) ([]byte, error) {
+	log.Info("Get %s%s", t.host, path)
+
+	return rest.Get(t.host + path).End()
+}
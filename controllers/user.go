@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/permission"
 )
 
@@ -45,11 +46,14 @@ func (c *UserController) AddUser() {
 
 	obj.Status = 1
 	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
 	if err := permission.InsertUser(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.CREATE, "user", obj.Id, nil, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -88,12 +92,16 @@ func (c *UserController) EditUser() {
 	}
 
 	obj.Created = acc.Created
+	obj.CreatedBy = acc.CreatedBy
 	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
 	if err := permission.UpdateUser(obj); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "user", obj.Id, acc, obj)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -133,12 +141,18 @@ func (c *UserController) EditPassword() {
 		return
 	}
 
+	before := *acc
+
 	acc.Password = password
+	acc.Updated = timex.String()
+	acc.UpdatedBy = c.Operator()
 	if err := permission.UpdateUser(acc); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.UPDATE, "user", acc.Id, &before, acc)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -158,11 +172,25 @@ func (c *UserController) DelUser() {
 		return
 	}
 
+	// 删除前数据
+	before, err := permission.UserById(userId)
+	if err != nil {
+		if permission.ErrUserNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
 	if err := permission.DelUser(userId); err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
 	}
 
+	c.Audit(audit.DELETE, "user", userId, before, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -224,7 +252,11 @@ func (c *UserController) Login() {
 		return
 	}
 
-	acc.Token = OAuth.Add()
+	acc.Token = OAuth.Add(&Identity{
+		Type: IDENTITY_USER,
+		Id:   acc.Id,
+		Name: acc.Username,
+	})
 
 	c.WriteHttpResponse(200, acc, nil)
 	return
@@ -232,46 +264,18 @@ func (c *UserController) Login() {
 
 // 查询所有用户
 func (c *UserController) UserList() {
-	startDate := c.GetString("startDate")
-	endDate := c.GetString("endDate")
 	name := c.GetString("name")
 
-	page, err := c.GetInt("page")
+	r, err := c.ListRequest("id:asc")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	pageSize, err := c.GetInt("pageSize")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	total, list, err := permission.UserList(map[string]interface{}{
-		"startDate": startDate,
-		"endDate":   endDate,
-		"name":      name,
-	}, page, pageSize)
-	if err != nil {
-		c.WriteHttpResponse(500, nil, errors.As(err))
-		return
-	}
-
-	var data interface{}
-	if list == nil {
-		data = make([]interface{}, 0)
-	} else {
-		data = list
-	}
-
-	c.WriteHttpResponse(200, struct {
-		Total int64       `json:"total"`
-		Data  interface{} `json:"data"`
-	}{
-		Total: total,
-		Data:  data,
-	}, nil)
+	where := r.Where()
+	where["name"] = name
 
+	total, list, err := permission.UserList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
 	return
 }
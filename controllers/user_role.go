@@ -6,6 +6,7 @@ import (
 
 	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
 	"github.com/beego/ms304w-client/models/permission"
 )
 
@@ -43,10 +44,13 @@ func (c *UserRoleController) AddUserRole() {
 	if acc == nil {
 		obj.Status = 1
 		obj.Created = timex.String()
+		obj.CreatedBy = c.Operator()
 		if err := permission.InsertUserRole(obj); err != nil {
 			c.WriteHttpResponse(500, nil, errors.As(err))
 			return
 		}
+
+		c.Audit(audit.CREATE, "user_role", obj.Id, nil, obj)
 	} else {
 		// 存在修改
 		acc.Status = 1
@@ -109,6 +113,8 @@ func (c *UserRoleController) DelUserRole() {
 		return
 	}
 
+	c.Audit(audit.DELETE, "user_role", acc.Id, acc, nil)
+
 	c.WriteHttpResponse(200, nil, nil)
 	return
 }
@@ -121,19 +127,13 @@ func (c *UserRoleController) UserByRoleId() {
 		return
 	}
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := permission.UserByRoleId(roleId, page, pageSize)
+	list, err := permission.UserByRoleId(roleId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -151,19 +151,13 @@ func (c *UserRoleController) RoleByUserId() {
 		return
 	}
 
-	page, err := c.GetInt("page")
-	if err != nil {
-		c.WriteHttpResponse(400, nil, errors.As(err))
-		return
-	}
-
-	pageSize, err := c.GetInt("pageSize")
+	r, err := c.ListRequest("")
 	if err != nil {
 		c.WriteHttpResponse(400, nil, errors.As(err))
 		return
 	}
 
-	list, err := permission.RoleByUserId(userId, page, pageSize)
+	list, err := permission.RoleByUserId(userId, r.Page, r.PageSize)
 	if err != nil {
 		c.WriteHttpResponse(500, nil, errors.As(err))
 		return
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/webhook"
+	"github.com/satori/go.uuid"
+)
+
+type WebhookController struct {
+	BaseController
+}
+
+// 返回时隐藏密钥
+func maskWebhook(obj *webhook.Webhook) *webhook.Webhook {
+	v := *obj
+	if len(v.Secret) > 0 {
+		v.Secret = "******"
+	}
+
+	return &v
+}
+
+// 校验地址和事件类型
+func validWebhook(obj *webhook.Webhook) error {
+	u, err := url.Parse(obj.Url)
+	if err != nil {
+		return errors.As(err, obj.Url)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("url is illegal").As(obj.Url)
+	}
+
+	events := strings.Split(obj.Events, ",")
+	for i, v := range events {
+		v = strings.TrimSpace(v)
+		if v != webhook.ALL && !ValidTopic(v) {
+			return errors.New("event is illegal").As(v)
+		}
+		events[i] = v
+	}
+	obj.Events = strings.Join(events, ",")
+
+	return nil
+}
+
+// 添加
+func (c *WebhookController) AddWebhook() {
+	obj := &webhook.Webhook{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	if err := validWebhook(obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	// 未指定时生成密钥,只在添加时返回
+	if len(obj.Secret) == 0 {
+		obj.Secret = strings.Replace(uuid.Must(uuid.NewV4()).String(), "-", "", -1)
+	}
+
+	obj.Created = timex.String()
+	obj.CreatedBy = c.Operator()
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := webhook.InsertWebhook(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.CREATE, "webhook", obj.Id, nil, maskWebhook(obj))
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
+
+// 修改,secret为空时不修改密钥
+func (c *WebhookController) EditWebhook() {
+	obj := &webhook.Webhook{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if obj == nil {
+		c.WriteHttpResponse(400, nil, errors.New("params is empty"))
+		return
+	}
+
+	// 查询是否存在
+	old, err := webhook.WebhookById(obj.Id)
+	if err != nil {
+		if webhook.ErrWebhookNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := validWebhook(obj); err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	if len(obj.Secret) == 0 {
+		obj.Secret = old.Secret
+	}
+
+	obj.Created = old.Created
+	obj.CreatedBy = old.CreatedBy
+	obj.Updated = timex.String()
+	obj.UpdatedBy = c.Operator()
+	if err := webhook.UpdateWebhook(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "webhook", obj.Id, maskWebhook(old), maskWebhook(obj))
+
+	c.WriteHttpResponse(200, maskWebhook(obj), nil)
+	return
+}
+
+// 删除
+func (c *WebhookController) DelWebhook() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	old, err := webhook.WebhookById(id)
+	if err != nil {
+		if webhook.ErrWebhookNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if err := webhook.DelWebhook(id); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.DELETE, "webhook", id, maskWebhook(old), nil)
+
+	c.WriteHttpResponse(200, nil, nil)
+	return
+}
+
+// 根据ID查询
+func (c *WebhookController) WebhookById() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := webhook.WebhookById(id)
+	if err != nil {
+		if webhook.ErrWebhookNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, maskWebhook(obj), nil)
+	return
+}
+
+// 查询所有
+func (c *WebhookController) WebhookList() {
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["status"] = status
+
+	total, list, err := webhook.WebhookList(where, r.Page, r.PageSize)
+
+	data := make([]*webhook.Webhook, 0, len(list))
+	for _, v := range list {
+		data = append(data, maskWebhook(v))
+	}
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 推送记录
+func (c *WebhookController) DeliveryList() {
+	topic := c.GetString("topic")
+	endDate := c.GetString("endDate")
+
+	r, err := c.ListRequest("id:desc")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	webhookId, err := c.GetInt("webhookId", 0)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	status, err := c.GetInt("status", -1)
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	where := r.Where()
+	where["webhookId"] = webhookId
+	where["topic"] = topic
+	where["status"] = status
+	where["endDate"] = endDate
+
+	total, list, err := webhook.DeliveryList(where, r.Page, r.PageSize)
+	c.WriteList(r, total, list, err)
+	return
+}
+
+// 推送详情和每次发送记录
+func (c *WebhookController) DeliveryById() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := webhook.DeliveryById(id)
+	if err != nil {
+		if webhook.ErrDeliveryNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	attempts, err := webhook.AttemptList(id)
+	if err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.WriteHttpResponse(200, struct {
+		*webhook.Delivery
+		AttemptList []*webhook.Attempt `json:"attemptList"`
+	}{
+		Delivery:    obj,
+		AttemptList: attempts,
+	}, nil)
+	return
+}
+
+// 重新发送
+func (c *WebhookController) RetryDelivery() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.WriteHttpResponse(400, nil, errors.As(err))
+		return
+	}
+
+	obj, err := webhook.DeliveryById(id)
+	if err != nil {
+		if webhook.ErrDeliveryNotFound.Equal(err) {
+			c.WriteHttpResponse(404, nil, errors.As(err))
+			return
+		}
+
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	if obj.Status == webhook.DELIVERY_PENDING {
+		c.WriteHttpResponse(400, nil, errors.New("delivery is pending"))
+		return
+	}
+
+	before := *obj
+	obj.Status = webhook.DELIVERY_PENDING
+	obj.Attempts = 0
+	obj.NextAttempt = timex.String()
+	obj.Updated = timex.String()
+	if err := webhook.UpdateDelivery(obj); err != nil {
+		c.WriteHttpResponse(500, nil, errors.As(err))
+		return
+	}
+
+	c.Audit(audit.UPDATE, "webhook_delivery", obj.Id, &before, obj)
+
+	wakeWebhook()
+
+	c.WriteHttpResponse(200, obj, nil)
+	return
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/beego/ms304w-client/basis/bus"
+	"github.com/beego/ms304w-client/basis/conf"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	wh "github.com/beego/ms304w-client/basis/webhook"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/webhook"
+	"github.com/satori/go.uuid"
+)
+
+// 每次取出待发送数量
+const webhookBatch = 50
+
+var webhookWake = make(chan struct{}, 1)
+
+// 推送内容
+type WebhookPayload struct {
+	// 事件ID,同一事件推送给多个webhook时相同
+	Id      string      `json:"id"`
+	Topic   string      `json:"topic"`
+	Created string      `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// 启动webhook推送
+func StartWebhook() {
+	if !conf.DefaultBool("webhook_enable", true) {
+		return
+	}
+
+	Bus.SubscribeAsync(bus.ALL, webhookSubscriber, conf.DefaultInt("webhook_queue", 1000))
+
+	go webhookWorker()
+}
+
+// 有新推送时唤醒
+func wakeWebhook() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// 事件写入推送队列
+func webhookSubscriber(e bus.Event) error {
+	writerLock.RLock()
+	defer writerLock.RUnlock()
+
+	hooks, err := webhook.EnableWebhooks()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	var body []byte
+	for _, hook := range hooks {
+		if !hook.Match(e.Topic()) {
+			continue
+		}
+
+		if body == nil {
+			body, err = json.Marshal(&WebhookPayload{
+				Id:      uuid.Must(uuid.NewV4()).String(),
+				Topic:   e.Topic(),
+				Created: timex.String(),
+				Data:    webhookData(e),
+			})
+			if err != nil {
+				return errors.As(err, e.Topic())
+			}
+		}
+
+		obj := &webhook.Delivery{
+			Created:     timex.String(),
+			WebhookId:   hook.Id,
+			Topic:       e.Topic(),
+			Payload:     string(body),
+			Status:      webhook.DELIVERY_PENDING,
+			NextAttempt: timex.String(),
+			Updated:     timex.String(),
+		}
+		if err := webhook.InsertDelivery(obj); err != nil {
+			return errors.As(err, hook.Id)
+		}
+	}
+
+	if body != nil {
+		wakeWebhook()
+	}
+
+	return nil
+}
+
+// 推送数据,去掉密码和token
+func webhookData(e bus.Event) interface{} {
+	switch v := e.(type) {
+	case *EntityChanged:
+		// 和审计日志一样去掉敏感字段
+		before, _ := audit.Marshal(v.Before)
+		after, _ := audit.Marshal(v.After)
+
+		return struct {
+			Identity   *Identity       `json:"identity"`
+			Action     string          `json:"action"`
+			EntityType string          `json:"entityType"`
+			EntityId   int             `json:"entityId"`
+			Before     json.RawMessage `json:"before"`
+			After      json.RawMessage `json:"after"`
+		}{
+			Identity:   v.Identity,
+			Action:     v.Action,
+			EntityType: v.EntityType,
+			EntityId:   v.EntityId,
+			Before:     rawJson(before),
+			After:      rawJson(after),
+		}
+	}
+
+	return e
+}
+
+// 空字符串为null
+func rawJson(s string) json.RawMessage {
+	if len(s) == 0 {
+		return json.RawMessage("null")
+	}
+
+	return json.RawMessage(s)
+}
+
+// 发送到期推送,重启后继续发送未完成的
+func webhookWorker() {
+	interval := time.Duration(conf.DefaultInt("webhook_interval", 5)) * time.Second
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deliverDue()
+
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// 发送所有到期推送,恢复备份时等待
+func deliverDue() {
+	writerLock.RLock()
+	defer writerLock.RUnlock()
+
+	for {
+		list, err := webhook.DueDeliveries(timex.String(), webhookBatch)
+		if err != nil {
+			log.Error("%v", errors.As(err))
+			return
+		}
+
+		for _, v := range list {
+			if err := deliverWebhook(v); err != nil {
+				log.Error("%v", errors.As(err, v.Id))
+			}
+		}
+
+		if len(list) < webhookBatch {
+			return
+		}
+	}
+}
+
+// 发送一次,失败按指数退避重试
+func deliverWebhook(obj *webhook.Delivery) error {
+	maxAttempts := conf.DefaultInt("webhook_max_attempts", 10)
+	backoff := time.Duration(conf.DefaultInt("webhook_backoff", 10)) * time.Second
+	maxBackoff := time.Duration(conf.DefaultInt("webhook_max_backoff", 3600)) * time.Second
+	timeout := time.Duration(conf.DefaultInt("webhook_timeout", 10)) * time.Second
+
+	obj.Attempts++
+	obj.Updated = timex.String()
+
+	attempt := &webhook.Attempt{
+		Created:    timex.String(),
+		DeliveryId: obj.Id,
+		WebhookId:  obj.WebhookId,
+		Attempt:    obj.Attempts,
+	}
+
+	hook, err := webhook.WebhookById(obj.WebhookId)
+	if err != nil {
+		if !webhook.ErrWebhookNotFound.Equal(err) {
+			return errors.As(err)
+		}
+
+		// webhook已删除
+		attempt.Err = errors.ParseErr(err).Key()
+		obj.Status = webhook.DELIVERY_FAILED
+	} else if hook.Status != webhook.WEBHOOK_ENABLE {
+		attempt.Err = "webhook is disabled"
+		obj.Status = webhook.DELIVERY_FAILED
+	} else {
+		res, err := wh.Send(hook.Url, hook.Secret, obj.Topic, strconv.Itoa(obj.Id), []byte(obj.Payload), timeout)
+		if err != nil {
+			attempt.Err = err.Error()
+		} else {
+			attempt.StatusCode = res.StatusCode
+			attempt.Response = res.Response
+			attempt.Duration = int(res.Duration / time.Millisecond)
+		}
+
+		switch {
+		case res != nil && res.Success():
+			obj.Status = webhook.DELIVERY_SUCCESS
+		case obj.Attempts >= maxAttempts:
+			obj.Status = webhook.DELIVERY_FAILED
+		default:
+			obj.NextAttempt = time.Now().Add(wh.Backoff(obj.Attempts, backoff, maxBackoff)).Format("2006-01-02 15:04:05")
+		}
+	}
+
+	if err := webhook.InsertAttempt(attempt); err != nil {
+		return errors.As(err)
+	}
+
+	if err := webhook.UpdateDelivery(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
@@ -2,20 +2,58 @@ package main
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/astaxie/beego"
 	"github.com/beego/ms304w-client/basis/conf"
 	l "github.com/beego/ms304w-client/basis/log"
 	"github.com/beego/ms304w-client/controllers"
+	"github.com/beego/ms304w-client/models/backup"
+	"github.com/beego/ms304w-client/models/migrate"
 	_ "github.com/beego/ms304w-client/routers"
 )
 
 var log = l.New("main")
 
 func main() {
+	// 数据库迁移命令
+	if migrate.IsCommand() {
+		if err := migrate.RunCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 数据库备份命令
+	if backup.IsCommand() {
+		if err := backup.RunCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Info("start main...")
 	beego.ErrorController(&controllers.ErrorController{})
 
+	// 读卡器
+	if err := controllers.StartCardReader(); err != nil {
+		log.Error(err)
+	}
+
+	// 柜子
+	controllers.StartCabinets()
+
+	// webhook
+	controllers.StartWebhook()
+
+	// 中心服务器同步
+	controllers.StartSync()
+
+	// 定时备份
+	controllers.StartBackup()
+
 	h := func(w http.ResponseWriter, r *http.Request) {
 		if origin := r.Header.Get("Origin"); origin != "" {
 			log.Warn(origin)
@@ -33,15 +71,19 @@ func main() {
 	}
 
 	// socket
-	http.HandleFunc("/socket.io/", h)
+	beego.Handler("/socket.io/", http.HandlerFunc(h), true)
 
-	// http.Handle("/socket.io/", controllers.Server)
+	// 兼容旧客户端单独端口
+	if addr := conf.DefaultString("socket_url", ""); len(addr) > 0 {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/socket.io/", h)
 
-	go func() {
-		if err := http.ListenAndServe(conf.String("socket_url"), nil); err != nil {
-			panic(err)
-		}
-	}()
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				panic(err)
+			}
+		}()
+	}
 
 	beego.SetStaticPath("/admin", "admin")
 	beego.SetStaticPath("/client", "client")
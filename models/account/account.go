@@ -1,10 +1,11 @@
 package account
 
 import (
-	"fmt"
+	"strings"
 
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -34,7 +35,7 @@ type Account struct {
 	Card string `orm:"column(card);unique" json:"card"`
 	// 密码
 	Password string `orm:"column(password)" json:"password"`
-	// 指纹
+	// 指纹,旧版本的全局模板ID,现在按柜子记在AccountFinger
 	Finger int `orm:"column(finger);unique" json:"finger"`
 	// 状态0停用1启用
 	Status int `orm:"column(status);default(1)" json:"status"`
@@ -55,6 +56,8 @@ func (t *Account) TableName() string {
 func InsertAccount(obj *Account) error {
 	o := orm.NewOrm()
 
+	obj.Card = CardNo(obj.Card)
+
 	if _, err := o.Insert(obj); err != nil {
 		return errors.As(err)
 	}
@@ -81,6 +84,8 @@ func DelAccount(id int) error {
 func UpdateAccount(obj *Account) error {
 	o := orm.NewOrm()
 
+	obj.Card = CardNo(obj.Card)
+
 	if _, err := o.Update(obj); err != nil {
 		return errors.As(err)
 	}
@@ -126,12 +131,17 @@ func AccountByName(username string) (*Account, error) {
 	return obj, nil
 }
 
+// 卡号统一保存为大写,读卡器和串口回调的大小写不一致
+func CardNo(card string) string {
+	return strings.ToUpper(strings.TrimSpace(card))
+}
+
 // 根据卡查询
 func AccountByCard(card string) (*Account, error) {
 	o := orm.NewOrm()
 
 	obj := &Account{
-		Card: card,
+		Card: CardNo(card),
 	}
 
 	if err := o.Read(obj, "Card"); err != nil {
@@ -150,7 +160,7 @@ func LoginByCard(card, password string) (*Account, error) {
 	o := orm.NewOrm()
 
 	obj := &Account{
-		Card:     card,
+		Card:     CardNo(card),
 		Password: password,
 	}
 
@@ -187,45 +197,31 @@ func LoginByUsername(username, password string) (*Account, error) {
 
 // 查询所有
 func AccountList(where map[string]interface{}, page, pageSize int) (int64, []*Account, error) {
-	o := orm.NewOrm()
-
 	list := []*Account{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.username LIKE '%" + fmt.Sprintf("%s", name) + "%'"
-			sql += " OR t1.card LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(accountListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t1.username", "t1.card").
+		Sort(where["sort"], accountSorts, "id:asc").
+		Cursor(where["cursor"])
 
-	// 查询所有
-	if _, err := o.Raw(accountListSql+sql+" ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(accountListCountSql, accountListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var accountSorts = map[string]string{
+	"id":       "t1.id",
+	"created":  "t1.created",
+	"updated":  "t1.updated",
+	"username": "t1.username",
+	"status":   "t1.status",
+}
+
 const accountListCountSql = `
 SELECT
     COUNT(*)
@@ -255,15 +251,12 @@ ON
 WHERE
 `
 
-// 根据指纹查询
-func AccountByFinger(finger int) (*Account, error) {
+// 根据柜子和指纹模板ID查询
+func AccountByFinger(boxId, finger int) (*Account, error) {
 	o := orm.NewOrm()
 
-	obj := &Account{
-		Finger: finger,
-	}
-
-	if err := o.Read(obj, "Finger"); err != nil {
+	obj := &Account{}
+	if err := o.Raw(accountByFingerSql, boxId, finger).QueryRow(obj); err != nil {
 		if err == orm.ErrNoRows {
 			return nil, errors.As(ErrAccountNotFound)
 		}
@@ -273,3 +266,28 @@ func AccountByFinger(finger int) (*Account, error) {
 
 	return obj, nil
 }
+
+const accountByFingerSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.username,
+    t1.role,
+    t1.card,
+    t1.password,
+    t1.finger,
+    t1.status,
+    t1.updated,
+    t1.updated_by
+FROM
+    account AS t1
+INNER JOIN
+    account_finger AS t2
+ON
+    t2.account_id = t1.id
+WHERE
+    t2.box_id = ?
+AND
+    t2.finger = ?
+`
@@ -0,0 +1,228 @@
+package account
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var (
+	ErrFingerEnrollNotFound = errors.New("finger enroll not found")
+	ErrFingerAlreadyExist   = errors.New("finger already exist")
+	ErrFingerNotCaptured    = errors.New("finger not captured")
+	ErrFingerNotBound       = errors.New("finger not bound")
+)
+
+const (
+	// 等待录入
+	FINGER_PENDING = iota
+	// 已采集模板
+	FINGER_CAPTURED
+	// 已确认绑定
+	FINGER_CONFIRMED
+	// 已取消
+	FINGER_CANCELLED
+)
+
+// 指纹录入
+type FingerEnroll struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 用户ID
+	AccountId int `orm:"column(account_id)" json:"accountId"`
+	// 录入的柜子
+	BoxId int `orm:"column(box_id)" json:"boxId"`
+	// 指纹模板ID,由指纹模块回调
+	Finger int `orm:"column(finger)" json:"finger"`
+	// 状态0等待录入1已采集2已确认3已取消
+	Status int `orm:"column(status);default(0)" json:"status"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+}
+
+func (t *FingerEnroll) TableName() string {
+	return "finger_enroll"
+}
+
+// 添加
+func InsertFingerEnroll(obj *FingerEnroll) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateFingerEnroll(obj *FingerEnroll) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func FingerEnrollById(id int) (*FingerEnroll, error) {
+	o := orm.NewOrm()
+
+	obj := &FingerEnroll{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrFingerEnrollNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 取消用户未完成的录入
+func CancelFingerEnroll(accountId int, updated string) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Raw(cancelFingerEnrollSql, FINGER_CANCELLED, updated, accountId, FINGER_PENDING, FINGER_CAPTURED).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const cancelFingerEnrollSql = `
+UPDATE
+    finger_enroll
+SET
+    status = ?,
+    updated = ?
+WHERE
+    account_id = ?
+AND
+    status IN (?, ?)
+`
+
+// 用户指纹,每个柜子的指纹模块各自分配模板ID
+// 柜子ID同回调的boxId,为0是默认服务的指纹模块
+type AccountFinger struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	AccountId int    `orm:"column(account_id)" json:"accountId"`
+	BoxId     int    `orm:"column(box_id)" json:"boxId"`
+	// 指纹模板ID
+	Finger int `orm:"column(finger)" json:"finger"`
+}
+
+func (t *AccountFinger) TableName() string {
+	return "account_finger"
+}
+
+// 模板ID在柜子内唯一
+func (t *AccountFinger) TableUnique() [][]string {
+	return [][]string{
+		{"BoxId", "Finger"},
+	}
+}
+
+// 用户在各柜子的指纹
+func FingersByAccountId(accountId int) ([]*AccountFinger, error) {
+	o := orm.NewOrm()
+
+	list := []*AccountFinger{}
+	if _, err := o.Raw(accountFingersSql, accountId).QueryRows(&list); err != nil {
+		return nil, errors.As(err, accountId)
+	}
+
+	return list, nil
+}
+
+const accountFingersSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.account_id,
+    t1.box_id,
+    t1.finger
+FROM
+    account_finger AS t1
+WHERE
+    t1.account_id = ?
+ORDER BY t1.box_id
+`
+
+// 绑定用户在柜子上的指纹,替换该用户在该柜子原有的指纹
+// 同一模板ID残留的绑定一并删除,返回被替换的指纹
+func BindFinger(obj *AccountFinger) (*AccountFinger, error) {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	var old *AccountFinger
+	list := []*AccountFinger{}
+	if _, err := o.Raw(boxFingerSql, obj.AccountId, obj.BoxId).QueryRows(&list); err != nil {
+		o.Rollback()
+		return nil, errors.As(err, obj.AccountId, obj.BoxId)
+	}
+	if len(list) > 0 {
+		old = list[0]
+	}
+
+	if _, err := o.Raw(unbindFingerSql, obj.AccountId, obj.BoxId, obj.BoxId, obj.Finger).Exec(); err != nil {
+		o.Rollback()
+		return nil, errors.As(err, obj.AccountId, obj.BoxId)
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		o.Rollback()
+		return nil, errors.As(err, obj.AccountId, obj.BoxId)
+	}
+
+	if err := o.Commit(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return old, nil
+}
+
+const boxFingerSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.account_id,
+    t1.box_id,
+    t1.finger
+FROM
+    account_finger AS t1
+WHERE
+    t1.account_id = ?
+AND
+    t1.box_id = ?
+`
+
+const unbindFingerSql = `
+DELETE FROM account_finger WHERE (account_id = ? AND box_id = ?) OR (box_id = ? AND finger = ?)
+`
+
+// 删除指纹
+func DelAccountFinger(id int) error {
+	o := orm.NewOrm()
+
+	obj := &AccountFinger{
+		Id: id,
+	}
+
+	if _, err := o.Delete(obj); err != nil {
+		return errors.As(err, id)
+	}
+
+	return nil
+}
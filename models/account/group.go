@@ -120,6 +120,6 @@ SELECT
     updated,
     updated_by
 FROM
-    'group'
+    "group"
 LIMIT ? OFFSET ?
 `
@@ -0,0 +1,303 @@
+package adjust
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrAdjustmentNotFound = errors.New("adjustment not found")
+	ErrReasonIllegal      = errors.New("adjustment reason is illegal")
+	ErrQtyIllegal         = errors.New("qty is illegal")
+	ErrQtyNotEnough       = errors.New("stock qty is not enough")
+	ErrQtyOverflow        = errors.New("grid qty is over max")
+)
+
+// 调整和调拨记入订单历史的类型,接在order.IN、order.OUT、order.RECYCLE之后
+// 不是领料和回收,不计入消耗、成本中心和预测
+const (
+	ORDER_ADJUST = iota + order.RECYCLE + 1
+	ORDER_TRANSFER
+)
+
+// 调整原因
+const (
+	// 损坏
+	DAMAGED = "damaged"
+	// 丢失
+	LOST = "lost"
+	// 盘盈
+	FOUND = "found"
+	// 过期
+	EXPIRED = "expired"
+	// 报废
+	WRITE_OFF = "write_off"
+)
+
+// 原因对应的数量方向,只有盘盈增加
+var reasons = map[string]int{
+	DAMAGED:   -1,
+	LOST:      -1,
+	FOUND:     1,
+	EXPIRED:   -1,
+	WRITE_OFF: -1,
+}
+
+// 是否为已定义原因
+func ValidReason(reason string) bool {
+	_, ok := reasons[reason]
+	return ok
+}
+
+// 手工调整库存,创建时即结算
+type Adjustment struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	GridId    int    `orm:"column(grid_id)" json:"gridId"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 原因
+	Reason string `orm:"column(reason)" json:"reason"`
+	// 调整前数量
+	BeforeQty int `orm:"column(before_qty)" json:"beforeQty"`
+	// 调整数量,增加为正,减少为负
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 调整后数量
+	AfterQty int `orm:"column(after_qty)" json:"afterQty"`
+	// 备注
+	Note string `orm:"column(note);null" json:"note"`
+	// 订单历史中的记录
+	OrderId int `orm:"column(order_id)" json:"orderId"`
+}
+
+func (t *Adjustment) TableName() string {
+	return "stock_adjustment"
+}
+
+// 添加并结算库存,qty为正数,方向由原因决定
+// maxQty为格子最大数量,0不限制,accountId为订单的领料人
+// src为台账的操作人
+// 返回调整前后的库存,调整前没有库存时before为nil
+func Settle(obj *Adjustment, maxQty, accountId int, src *ledger.Movement) (*order.Stock, *order.Stock, error) {
+	sign, ok := reasons[obj.Reason]
+	if !ok {
+		return nil, nil, errors.As(ErrReasonIllegal, obj.Reason)
+	}
+
+	if obj.Qty <= 0 {
+		return nil, nil, errors.As(ErrQtyIllegal, obj.Qty)
+	}
+
+	obj.Qty *= sign
+
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	before, after, err := ChangeStock(o, obj.GridId, obj.MaterialId, obj.Qty, maxQty, obj.Created)
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err, obj.GridId, obj.MaterialId)
+	}
+
+	if before != nil {
+		obj.BeforeQty = before.Qty
+	}
+	obj.AfterQty = after.Qty
+
+	obj.OrderId, err = insertOrder(o, ORDER_ADJUST, accountId, before, after)
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	src.Reason = ledger.ADJUST
+	src.RefType = "adjustment"
+	src.RefId = obj.Id
+	src.Note = obj.Reason
+	if err := ledger.Record(o, src, before, after); err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	return before, after, nil
+}
+
+// 在事务中添加订单,调整和调拨也记入订单历史
+// typ为ORDER_ADJUST或ORDER_TRANSFER,数量为变化数量,减少为负数
+func insertOrder(o orm.Ormer, typ, accountId int, before, after *order.Stock) (int, error) {
+	var beforeQty int
+	if before != nil {
+		beforeQty = before.Qty
+	}
+
+	obj := &order.Order{
+		Created:    after.Updated,
+		AccountId:  accountId,
+		Type:       typ,
+		GridId:     after.GridId,
+		MaterialId: after.MaterialId,
+		SensorId:   after.SensorId,
+		BeforeQty:  beforeQty,
+		Qty:        after.Qty - beforeQty,
+		AfterQty:   after.Qty,
+		Status:     1,
+		Updated:    after.Updated,
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		return 0, errors.As(err, after.GridId, after.MaterialId)
+	}
+
+	return obj.Id, nil
+}
+
+// 在事务中修改格子物料库存,没有库存时添加
+// qty为变化数量,maxQty为格子最大数量,0不限制
+func ChangeStock(o orm.Ormer, gridId, materialId, qty, maxQty int, updated string) (*order.Stock, *order.Stock, error) {
+	stock := &order.Stock{}
+	if err := o.Raw(stockSql, gridId, materialId).QueryRow(stock); err != nil {
+		if err != orm.ErrNoRows {
+			return nil, nil, errors.As(err)
+		}
+
+		if qty < 0 {
+			return nil, nil, errors.As(ErrQtyNotEnough, 0, qty)
+		}
+
+		if maxQty > 0 && qty > maxQty {
+			return nil, nil, errors.As(ErrQtyOverflow, qty, maxQty)
+		}
+
+		after := &order.Stock{
+			Created:    updated,
+			GridId:     gridId,
+			MaterialId: materialId,
+			Qty:        qty,
+			Updated:    updated,
+		}
+		if _, err := o.Insert(after); err != nil {
+			return nil, nil, errors.As(err)
+		}
+
+		return nil, after, nil
+	}
+
+	if stock.Qty+qty < 0 {
+		return nil, nil, errors.As(ErrQtyNotEnough, stock.Qty, qty)
+	}
+
+	if maxQty > 0 && qty > 0 && stock.Qty+qty > maxQty {
+		return nil, nil, errors.As(ErrQtyOverflow, stock.Qty+qty, maxQty)
+	}
+
+	before := *stock
+	stock.Qty += qty
+	stock.Updated = updated
+	if _, err := o.Raw(updateStockSql, stock.Qty, stock.Updated, stock.Id).Exec(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	return &before, stock, nil
+}
+
+const stockSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.grid_id,
+    t1.sensor_id,
+    t1.material_id,
+    t1.qty,
+    t1.updated
+FROM
+    stock AS t1
+WHERE
+    t1.grid_id = ?
+AND
+    t1.material_id = ?
+ORDER BY t1.id
+LIMIT 1
+`
+
+const updateStockSql = `
+UPDATE stock SET qty = ?, updated = ? WHERE id = ?
+`
+
+// 根据ID查询
+func AdjustmentById(id int) (*Adjustment, error) {
+	o := orm.NewOrm()
+
+	obj := &Adjustment{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrAdjustmentNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func AdjustmentList(where map[string]interface{}, page, pageSize int) (int64, []*Adjustment, error) {
+	list := []*Adjustment{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.material_id", where["materialId"]).
+		Equal("t1.reason", where["reason"]).
+		Search(where["name"], "t1.note", "t1.created_by").
+		Sort(where["sort"], adjustmentSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(adjustmentListCountSql, adjustmentListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var adjustmentSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"qty":     "t1.qty",
+}
+
+const adjustmentListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    stock_adjustment AS t1
+WHERE
+`
+
+const adjustmentListSql = `
+SELECT
+    t1.*
+FROM
+    stock_adjustment AS t1
+WHERE
+`
@@ -0,0 +1,189 @@
+package adjust
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrSameGrid         = errors.New("transfer from and to the same grid")
+)
+
+// 格子间调拨,出入两边在一个事务中结算
+type Transfer struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 调拨数量
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 调出格子
+	FromGridId    int `orm:"column(from_grid_id)" json:"fromGridId"`
+	FromBeforeQty int `orm:"column(from_before_qty)" json:"fromBeforeQty"`
+	FromAfterQty  int `orm:"column(from_after_qty)" json:"fromAfterQty"`
+	// 调入格子
+	ToGridId    int `orm:"column(to_grid_id)" json:"toGridId"`
+	ToBeforeQty int `orm:"column(to_before_qty)" json:"toBeforeQty"`
+	ToAfterQty  int `orm:"column(to_after_qty)" json:"toAfterQty"`
+	// 备注
+	Note string `orm:"column(note);null" json:"note"`
+	// 订单历史中两边的记录
+	FromOrderId int `orm:"column(from_order_id)" json:"fromOrderId"`
+	ToOrderId   int `orm:"column(to_order_id)" json:"toOrderId"`
+}
+
+func (t *Transfer) TableName() string {
+	return "stock_transfer"
+}
+
+// 结算的一边
+type TransferSide struct {
+	Before *order.Stock
+	After  *order.Stock
+}
+
+// 添加并结算两边库存,toMaxQty为调入格子最大数量,0不限制
+// accountId为订单的领料人,src为台账的操作人
+func SettleTransfer(obj *Transfer, toMaxQty, accountId int, src *ledger.Movement) (*TransferSide, *TransferSide, error) {
+	if obj.FromGridId == obj.ToGridId {
+		return nil, nil, errors.As(ErrSameGrid, obj.FromGridId)
+	}
+
+	if obj.Qty <= 0 {
+		return nil, nil, errors.As(ErrQtyIllegal, obj.Qty)
+	}
+
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	fromBefore, fromAfter, err := ChangeStock(o, obj.FromGridId, obj.MaterialId, -obj.Qty, 0, obj.Created)
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err, obj.FromGridId, obj.MaterialId)
+	}
+
+	toBefore, toAfter, err := ChangeStock(o, obj.ToGridId, obj.MaterialId, obj.Qty, toMaxQty, obj.Created)
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err, obj.ToGridId, obj.MaterialId)
+	}
+
+	// 调出格子一定有库存
+	obj.FromBeforeQty = fromBefore.Qty
+	obj.FromAfterQty = fromAfter.Qty
+	if toBefore != nil {
+		obj.ToBeforeQty = toBefore.Qty
+	}
+	obj.ToAfterQty = toAfter.Qty
+
+	obj.FromOrderId, err = insertOrder(o, ORDER_TRANSFER, accountId, fromBefore, fromAfter)
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	obj.ToOrderId, err = insertOrder(o, ORDER_TRANSFER, accountId, toBefore, toAfter)
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	src.Reason = ledger.TRANSFER
+	src.RefType = "transfer"
+	src.RefId = obj.Id
+	src.Note = obj.Note
+	if err := ledger.Record(o, src, fromBefore, fromAfter); err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	if err := ledger.Record(o, src, toBefore, toAfter); err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	return &TransferSide{fromBefore, fromAfter}, &TransferSide{toBefore, toAfter}, nil
+}
+
+// 根据ID查询
+func TransferById(id int) (*Transfer, error) {
+	o := orm.NewOrm()
+
+	obj := &Transfer{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrTransferNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有,gridId为调出或调入格子
+func TransferList(where map[string]interface{}, page, pageSize int) (int64, []*Transfer, error) {
+	list := []*Transfer{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.material_id", where["materialId"]).
+		Search(where["name"], "t1.note", "t1.created_by")
+
+	if gridId := query.Int(where["gridId"], 0); gridId > 0 {
+		f.Where("(t1.from_grid_id = ? OR t1.to_grid_id = ?)", gridId, gridId)
+	}
+
+	f.Sort(where["sort"], transferSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(transferListCountSql, transferListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var transferSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"qty":     "t1.qty",
+}
+
+const transferListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    stock_transfer AS t1
+WHERE
+`
+
+const transferListSql = `
+SELECT
+    t1.*
+FROM
+    stock_transfer AS t1
+WHERE
+`
@@ -0,0 +1,339 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrAuditNotFound = errors.New("audit not found")
+	ErrAuditTampered = errors.New("audit chain tampered")
+)
+
+const (
+	// 添加
+	CREATE = "create"
+	// 修改
+	UPDATE = "update"
+	// 删除
+	DELETE = "delete"
+	// 开门
+	OPEN = "open"
+	// 恢复备份
+	RESTORE = "restore"
+)
+
+// 保证哈希链顺序写入
+var chainLock = new(sync.Mutex)
+
+type Audit struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 操作人类型 account/user/system
+	ActorType string `orm:"column(actor_type)" json:"actorType"`
+	// 操作人ID
+	ActorId int `orm:"column(actor_id)" json:"actorId"`
+	// 操作人名称
+	ActorName string `orm:"column(actor_name)" json:"actorName"`
+	// 请求方法
+	Method string `orm:"column(method)" json:"method"`
+	// 请求路径
+	Route string `orm:"column(route)" json:"route"`
+	// 操作类型 create/update/delete/open
+	Action string `orm:"column(action)" json:"action"`
+	// 实体类型
+	EntityType string `orm:"column(entity_type)" json:"entityType"`
+	// 实体ID
+	EntityId int `orm:"column(entity_id)" json:"entityId"`
+	// 修改前JSON
+	Before string `orm:"column(before_data);type(text)" json:"before"`
+	// 修改后JSON
+	After string `orm:"column(after_data);type(text)" json:"after"`
+	// 差异JSON {"field": [old, new]}
+	Diff string `orm:"column(diff);type(text)" json:"diff"`
+	// 上一条哈希
+	PrevHash string `orm:"column(prev_hash)" json:"prevHash"`
+	// 当前哈希
+	Hash string `orm:"column(hash);unique" json:"hash"`
+}
+
+func (t *Audit) TableName() string {
+	return "audit"
+}
+
+// 计算哈希,包含上一条哈希形成链
+func (t *Audit) Sum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%d|%s|%s|%s|%s|%s|%d|%s|%s|%s",
+		t.PrevHash,
+		t.Created,
+		t.ActorType,
+		t.ActorId,
+		t.ActorName,
+		t.Method,
+		t.Route,
+		t.Action,
+		t.EntityType,
+		t.EntityId,
+		t.Before,
+		t.After,
+		t.Diff,
+	)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 不记录的敏感字段
+var sensitiveFields = []string{"password", "token"}
+
+// 对象转JSON,nil为空字符串,去掉敏感字段
+func Marshal(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "", nil
+	}
+
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.As(err)
+	}
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		// 非对象直接保存
+		return string(bytes), nil
+	}
+
+	for _, k := range sensitiveFields {
+		delete(m, k)
+	}
+
+	bytes, err = json.Marshal(m)
+	if err != nil {
+		return "", errors.As(err)
+	}
+
+	return string(bytes), nil
+}
+
+// 比较前后JSON,返回变化字段
+func Diff(before, after string) (string, error) {
+	b := make(map[string]interface{})
+	a := make(map[string]interface{})
+
+	diff := make(map[string][2]interface{})
+
+	// 非对象整体比较
+	if json.Unmarshal([]byte(before), &b) != nil && len(before) > 0 ||
+		json.Unmarshal([]byte(after), &a) != nil && len(after) > 0 {
+		if before == after {
+			return "", nil
+		}
+
+		diff["value"] = [2]interface{}{before, after}
+
+		bytes, err := json.Marshal(diff)
+		if err != nil {
+			return "", errors.As(err)
+		}
+
+		return string(bytes), nil
+	}
+
+	for k, v := range a {
+		if old, ok := b[k]; !ok || !reflect.DeepEqual(old, v) {
+			diff[k] = [2]interface{}{b[k], v}
+		}
+	}
+
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			diff[k] = [2]interface{}{v, nil}
+		}
+	}
+
+	if len(diff) == 0 {
+		return "", nil
+	}
+
+	bytes, err := json.Marshal(diff)
+	if err != nil {
+		return "", errors.As(err)
+	}
+
+	return string(bytes), nil
+}
+
+// 添加,自动计算差异和哈希链
+func InsertAudit(obj *Audit) error {
+	diff, err := Diff(obj.Before, obj.After)
+	if err != nil {
+		return errors.As(err)
+	}
+
+	obj.Diff = diff
+
+	chainLock.Lock()
+	defer chainLock.Unlock()
+
+	o := orm.NewOrm()
+
+	// 上一条哈希
+	var prevHash string
+	if err := o.Raw(lastHashSql).QueryRow(&prevHash); err != nil {
+		if err != orm.ErrNoRows {
+			return errors.As(err)
+		}
+	}
+
+	obj.PrevHash = prevHash
+	obj.Hash = obj.Sum()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const lastHashSql = `
+SELECT
+    t1.hash
+FROM
+    audit AS t1
+ORDER BY t1.id DESC
+LIMIT 1
+`
+
+// 根据ID查询
+func AuditById(id int) (*Audit, error) {
+	o := orm.NewOrm()
+
+	obj := &Audit{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrAuditNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 校验哈希链,返回第一条被篡改的记录ID
+func VerifyAudit() (int64, int, error) {
+	o := orm.NewOrm()
+
+	var total int64
+	var prevHash string
+
+	pageSize := 500
+	for lastId := 0; ; {
+		list := []*Audit{}
+		if _, err := o.Raw(verifyAuditSql, lastId, pageSize).QueryRows(&list); err != nil {
+			return total, 0, errors.As(err)
+		}
+
+		for _, v := range list {
+			if v.PrevHash != prevHash || v.Sum() != v.Hash {
+				return total, v.Id, errors.As(ErrAuditTampered, v.Id)
+			}
+
+			prevHash = v.Hash
+			lastId = v.Id
+			total++
+		}
+
+		if len(list) < pageSize {
+			break
+		}
+	}
+
+	return total, 0, nil
+}
+
+const verifyAuditSql = `
+SELECT
+    *
+FROM
+    audit AS t1
+WHERE
+    t1.id > ?
+ORDER BY t1.id
+LIMIT ?
+`
+
+// 查询所有
+func AuditList(where map[string]interface{}, page, pageSize int) (int64, []*Audit, error) {
+	list := []*Audit{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Equal("t1.actor_type", where["actorType"]).
+		Id("t1.actor_id", where["actorId"]).
+		Equal("t1.action", where["action"]).
+		Equal("t1.entity_type", where["entityType"]).
+		Id("t1.entity_id", where["entityId"]).
+		Search(where["name"], "t1.actor_name", "t1.route").
+		Sort(where["sort"], auditSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(auditListCountSql, auditListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var auditSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"action":  "t1.action",
+}
+
+const auditListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    audit AS t1
+WHERE
+`
+
+const auditListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.actor_type,
+    t1.actor_id,
+    t1.actor_name,
+    t1.method,
+    t1.route,
+    t1.action,
+    t1.entity_type,
+    t1.entity_id,
+    t1.before_data,
+    t1.after_data,
+    t1.diff,
+    t1.prev_hash,
+    t1.hash
+FROM
+    audit AS t1
+WHERE
+`
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/astaxie/beego"
+	bk "github.com/beego/ms304w-client/basis/backup"
+	"github.com/beego/ms304w-client/basis/dialect"
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var (
+	ErrNotSupported = errors.New("backup only supports sqlite3")
+)
+
+// 备份目录
+func Dir() string {
+	return beego.AppConfig.DefaultString("backup_dir", "backup")
+}
+
+// 只支持sqlite,其他数据库使用自己的备份工具
+func dsn() (string, error) {
+	if driver := beego.AppConfig.String("db_driver"); driver != dialect.SQLITE {
+		return "", errors.As(ErrNotSupported, driver)
+	}
+
+	return beego.AppConfig.String("db_dsn"), nil
+}
+
+// 等待其他连接释放锁的时间
+func timeout() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("backup_timeout", 60)) * time.Second
+}
+
+// 备份当前数据库,超过backup_keep个时删除旧的
+func Create() (*bk.File, error) {
+	return create()
+}
+
+// exclude中的备份轮换时不删除
+func create(exclude ...string) (*bk.File, error) {
+	src, err := dsn()
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	dir := Dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.As(err, dir)
+	}
+
+	// 同一秒内多次备份时顺延
+	now := time.Now()
+	name := bk.Name(now)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			break
+		}
+
+		now = now.Add(time.Second)
+		name = bk.Name(now)
+	}
+
+	path, err := bk.Path(dir, name)
+	if err != nil {
+		return nil, errors.As(err, name)
+	}
+
+	if err := bk.Backup(src, path, timeout()); err != nil {
+		return nil, errors.As(err, path)
+	}
+
+	if _, err := bk.Rotate(dir, beego.AppConfig.DefaultInt("backup_keep", 7), exclude...); err != nil {
+		return nil, errors.As(err, dir)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.As(err, path)
+	}
+
+	return &bk.File{
+		Name:    name,
+		Size:    info.Size(),
+		Created: info.ModTime().Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+// 所有备份,新的在前
+func List() ([]*bk.File, error) {
+	list, err := bk.List(Dir())
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+// 从备份恢复,恢复前先备份当前数据库
+// 要恢复的备份可能是最旧的,备份当前数据库轮换时保留它
+// 返回恢复前的备份
+func Restore(name string) (*bk.File, error) {
+	dst, err := dsn()
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	path, err := bk.Path(Dir(), name)
+	if err != nil {
+		return nil, errors.As(err, name)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, errors.As(bk.ErrNotFound, name)
+	}
+
+	before, err := create(name)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	if err := bk.Restore(dst, path, timeout()); err != nil {
+		return before, errors.As(err, name)
+	}
+
+	return before, nil
+}
+
+// 检查当前数据库完整性,损坏时返回问题列表
+func Check() error {
+	src, err := dsn()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	if err := bk.CheckFile(src); err != nil {
+		return errors.As(err, src)
+	}
+
+	return nil
+}
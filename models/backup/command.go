@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+const usage = `usage: %s backup <command>
+
+commands:
+    create          backup the database
+    list            show all backups
+    restore <name>  restore a backup, stop the server first
+    check           check the database integrity
+`
+
+// 命令行第一个参数为backup
+func IsCommand() bool {
+	return len(os.Args) > 1 && os.Args[1] == "backup"
+}
+
+// 执行backup命令,args为backup之后的参数
+func RunCommand(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintf(w, usage, os.Args[0])
+		return nil
+	}
+
+	switch args[0] {
+	case "create":
+		file, err := Create()
+		if err != nil {
+			return errors.As(err)
+		}
+
+		fmt.Fprintf(w, "%s %d\n", file.Name, file.Size)
+
+	case "list":
+		list, err := List()
+		if err != nil {
+			return errors.As(err)
+		}
+
+		for _, v := range list {
+			fmt.Fprintf(w, "%s %12d %s\n", v.Name, v.Size, v.Created)
+		}
+
+	case "restore":
+		if len(args) < 2 {
+			fmt.Fprintf(w, usage, os.Args[0])
+			return errors.New("backup name is empty")
+		}
+
+		before, err := Restore(args[1])
+		if before != nil {
+			fmt.Fprintf(w, "before restore: %s\n", before.Name)
+		}
+		if err != nil {
+			return errors.As(err)
+		}
+
+		fmt.Fprintf(w, "restored: %s\n", args[1])
+
+	case "check":
+		if err := Check(); err != nil {
+			return errors.As(err)
+		}
+
+		fmt.Fprintln(w, "ok")
+
+	default:
+		fmt.Fprintf(w, usage, os.Args[0])
+		return errors.New("backup command is illegal").As(args[0])
+	}
+
+	return nil
+}
@@ -1,10 +1,9 @@
 package box
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -94,58 +93,43 @@ func AccountById(id int) (*Account, error) {
 
 // 查询所有
 func AccountList(where map[string]interface{}, page, pageSize int) (int64, []*Grid, error) {
-	o := orm.NewOrm()
-
 	list := []*Grid{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		accountIdStr := where["accountId"]
-		if accountIdStr.(int) > 0 {
-			accountId := fmt.Sprintf("%d", accountIdStr)
-			sql += " AND t2.account_id = " + accountId + "  OR (t1.type = 1 AND (t2.account_id = " + accountId + " OR t2.account_id = '' OR t2.account_id ISNULL)) "
-		}
-
-		boxId := where["boxId"]
-		if boxId.(int) > 0 {
-			sql += " AND t1.box_id = " + fmt.Sprintf("%d", boxId) + " "
-		}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.box_id", where["boxId"]).
+		Search(where["name"], "t1.name")
 
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
+	// 用户的私有格子和未分配的公有格子
+	if accountId := query.Int(where["accountId"], 0); accountId > 0 {
+		f.Where("(t2.account_id = ? OR (t1.type = 1 AND (t2.account_id = ? OR t2.account_id = '' OR t2.account_id IS NULL)))", accountId, accountId)
 	}
 
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(accountListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
+	f.Sort(where["sort"], accountSorts, "id:asc").Cursor(where["cursor"])
 
-	// 查询所有
-	if _, err := o.Raw(accountListSql+sql+" GROUP BY t3.grid_id ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(accountListCountSql, accountListSql, " GROUP BY t1.id", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var accountSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"updated":    "t1.updated",
+	"name":       "t1.name",
+	"code":       "t1.code",
+	"materialId": "t1.material_id",
+	"channel":    "t1.channel",
+	"status":     "t1.status",
+}
+
 const accountListCountSql = `
 SELECT
-    COUNT(*)
+    COUNT(DISTINCT t1.id)
 FROM
     rel_box_grid AS t1
 LEFT JOIN
@@ -171,8 +155,10 @@ SELECT
     t1.material_id,
     t1.type,
     t1.safe_qty,
-    t2.id AS account_grid_id,
-    t2.account_id,
+    t1.reorder_qty,
+    t1.mode,
+    MAX(t2.id) AS account_grid_id,
+    MAX(t2.account_id) AS account_id,
     COUNT(t3.id) AS total_qty
 FROM
     rel_box_grid AS t1
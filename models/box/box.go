@@ -1,10 +1,9 @@
 package box
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -18,8 +17,12 @@ type Box struct {
 	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
 	// 名称
 	Name string `orm:"column(name)" json:"name"`
-	// 柜子地址
+	// 柜子地址,同一实例内唯一
 	Addr int `orm:"column(addr)" json:"addr"`
+	// 串口服务地址,为空时使用api_server
+	Url string `orm:"column(url)" json:"url"`
+	// 串口,由串口服务打开
+	Port string `orm:"column(port)" json:"port"`
 	// 状态0停用1启用
 	Status int `orm:"column(status);default(1)" json:"status"`
 	// 更新时间
@@ -106,46 +109,65 @@ func BoxByName(name string) (*Box, error) {
 	return obj, nil
 }
 
-// 查询所有
-func BoxList(where map[string]interface{}, page, pageSize int) (int64, []*Box, error) {
+// 根据地址查询
+func BoxByAddr(addr int) (*Box, error) {
 	o := orm.NewOrm()
 
-	list := []*Box{}
-
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
+	obj := &Box{
+		Addr: addr,
+	}
 
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", endDate) + "' "
+	if err := o.Read(obj, "Addr"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrBoxNotFound)
 		}
 
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
+		return nil, errors.As(err)
 	}
 
-	sql += " AND 1 "
+	return obj, nil
+}
 
-	// 查询总数
-	var total int64
-	if err := o.Raw(boxListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
+// 所有启用的柜子
+func EnableBoxes() ([]*Box, error) {
+	o := orm.NewOrm()
+
+	list := []*Box{}
+
+	if _, err := o.Raw(boxListSql+" t1.status = ? ORDER BY t1.addr", 1).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
 	}
 
-	// 查询所有
-	if _, err := o.Raw(boxListSql+sql+" ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	return list, nil
+}
+
+// 查询所有
+func BoxList(where map[string]interface{}, page, pageSize int) (int64, []*Box, error) {
+	list := []*Box{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t1.name").
+		Sort(where["sort"], boxSorts, "id:asc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(boxListCountSql, boxListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var boxSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"name":    "t1.name",
+	"status":  "t1.status",
+}
+
 const boxListCountSql = `
 SELECT
     COUNT(*)
@@ -161,6 +183,8 @@ SELECT
     t1.created_by,
     t1.name,
     t1.addr,
+    t1.url,
+    t1.port,
     t1.status,
     t1.updated,
     t1.updated_by
@@ -1,10 +1,9 @@
 package box
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -25,6 +24,8 @@ type Channel struct {
 	// 高度
 	// TODO:自动触发测量高度
 	Height int `orm:"column(height)" json:"height"`
+	// 传感器类型 weight/ultrasonic/image/rfid
+	Kind string `orm:"column(kind);default(weight)" json:"kind"`
 	// 更新时间
 	Updated   string `orm:"column(updated)" json:"updated"`
 	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
@@ -115,54 +116,33 @@ func ChannelByGridId(gridId, sensorId int) (*Channel, error) {
 
 // 查询所有
 func ChannelList(where map[string]interface{}, page, pageSize int) (int64, []*Channel, error) {
-	o := orm.NewOrm()
-
 	list := []*Channel{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		gridId := where["gridId"]
-		if gridId.(int) > 0 {
-			sql += " AND t1.grid_id = " + fmt.Sprintf("%d", gridId) + " "
-		}
-
-		sensorId := where["sensorId"]
-		if sensorId.(int) > 0 {
-			sql += " AND t1.sensor_id = " + fmt.Sprintf("%d", sensorId) + " "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(channelListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.sensor_id", where["sensorId"]).
+		Search(where["name"], "t1.name").
+		Sort(where["sort"], channelSorts, "id:asc").
+		Cursor(where["cursor"])
 
-	// 查询所有
-	if _, err := o.Raw(channelListSql+sql+" ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(channelListCountSql, channelListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var channelSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"gridId":  "t1.grid_id",
+	"channel": "t1.channel",
+}
+
 const channelListCountSql = `
 SELECT
     COUNT(*)
@@ -180,6 +160,7 @@ SELECT
     t1.sensor_id,
     t1.channel,
     t1.height,
+    t1.kind,
     t1.updated,
     t1.updated_by
 FROM
@@ -210,6 +191,7 @@ SELECT
     t1.sensor_id,
     t1.channel,
     t1.height,
+    t1.kind,
     t1.updated,
     t1.updated_by,
     t2.name AS sensor_name
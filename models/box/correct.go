@@ -1,10 +1,9 @@
 package box
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -49,54 +48,34 @@ func InsertCorrect(obj *Correct) error {
 
 // 查询所有
 func CorrectList(where map[string]interface{}, page, pageSize int) (int64, []*Correct, error) {
-	o := orm.NewOrm()
-
 	list := []*Correct{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		accountId := where["accountId"]
-		if accountId.(int) > 0 {
-			sql += " AND t1.account_id = " + fmt.Sprintf("%d", accountId) + " "
-		}
-
-		gridId := where["gridId"]
-		if gridId.(int) > 0 {
-			sql += " AND t1.grid_id = " + fmt.Sprintf("%d", gridId) + " "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.account_id", where["accountId"]).
+		Id("t1.grid_id", where["gridId"]).
+		Search(where["name"], "t1.name").
+		Sort(where["sort"], correctSorts, "id:desc").
+		Cursor(where["cursor"])
 
-	// 查询总数
-	var total int64
-	if err := o.Raw(correctListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(correctListSql+sql+" ORDER BY t1.id DESC LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(correctListCountSql, correctListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var correctSorts = map[string]string{
+	"id":        "t1.id",
+	"created":   "t1.created",
+	"updated":   "t1.updated",
+	"gridId":    "t1.grid_id",
+	"accountId": "t1.account_id",
+	"status":    "t1.status",
+}
+
 const correctListCountSql = `
 SELECT
     COUNT(*)
@@ -1,15 +1,23 @@
 package box
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
 	ErrGridNotFound     = errors.New("grid not found")
 	ErrGridAlreadyExist = errors.New("grid already exist")
+	ErrGridNotRfid      = errors.New("grid is not rfid mode")
+	ErrGridRfid         = errors.New("grid is rfid mode")
+)
+
+const (
+	// 称重计数
+	MODE_WEIGHT = 0
+	// RFID计数
+	MODE_RFID = 1
 )
 
 type Grid struct {
@@ -37,6 +45,10 @@ type Grid struct {
 	Type int `orm:"column(type)" json:"type"`
 	// 安全库存
 	SafeQty int `orm:"column(safe_qty)" json:"safeQty"`
+	// 订货点
+	ReorderQty int `orm:"column(reorder_qty);default(0)" json:"reorderQty"`
+	// 计数方式(称重0,RFID1)
+	Mode int `orm:"column(mode);default(0)" json:"mode"`
 
 	// other
 	// box
@@ -94,6 +106,29 @@ func UpdateGrid(obj *Grid) error {
 	return nil
 }
 
+// 修改安全库存和订货点
+func UpdateGridQty(id, safeQty, reorderQty int, updated, updatedBy string) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Raw(updateGridQtySql, safeQty, reorderQty, updated, updatedBy, id).Exec(); err != nil {
+		return errors.As(err, id)
+	}
+
+	return nil
+}
+
+const updateGridQtySql = `
+UPDATE
+    rel_box_grid
+SET
+    safe_qty = ?,
+    reorder_qty = ?,
+    updated = ?,
+    updated_by = ?
+WHERE
+    id = ?
+`
+
 // 根据ID查询
 func GridById(id int) (*Grid, error) {
 	o := orm.NewOrm()
@@ -127,6 +162,8 @@ SELECT
     t1.material_id,
     t1.type,
     t1.safe_qty,
+    t1.reorder_qty,
+    t1.mode,
     t2.addr AS addr,
     t3.category_id AS category_id,
     t3.material_code,
@@ -147,6 +184,8 @@ ON
     t1.material_id = t4.material_id
 WHERE
     t1.id = ?
+GROUP BY
+    t1.id, t2.id, t3.id
 `
 
 // 根据名称查询
@@ -197,6 +236,8 @@ SELECT
     t1.material_id,
     t1.type,
     t1.safe_qty,
+    t1.reorder_qty,
+    t1.mode,
     t2.addr AS addr,
     t3.category_id AS category_id,
     t3.material_code,
@@ -217,6 +258,8 @@ ON
     t1.material_id = t4.material_id
 WHERE
     t1.material_id = ?
+GROUP BY
+    t1.id, t2.id, t3.id
 ORDER BY SUM(t4.qty) DESC
 `
 
@@ -253,6 +296,8 @@ SELECT
     t1.material_id,
     t1.type,
     t1.safe_qty,
+    t1.reorder_qty,
+    t1.mode,
     t2.addr AS addr,
     t3.category_id AS category_id,
     t3.material_code,
@@ -274,61 +319,46 @@ ON
     t1.material_id = t4.material_id
 WHERE
     t1.code = ?
+GROUP BY
+    t1.id, t2.id, t3.id
 `
 
 // 查询所有
 func GridList(where map[string]interface{}, page, pageSize int) (int64, []*Grid, error) {
-	o := orm.NewOrm()
-
 	list := []*Grid{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.box_id", where["boxId"]).
+		Id("t7.sensor_id", where["sensorId"]).
+		Search(where["name"], "t1.name").
+		Sort(where["sort"], gridSorts, "id:asc").
+		Cursor(where["cursor"])
 
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		boxId := where["boxId"]
-		if boxId.(int) > 0 {
-			sql += " AND t1.box_id = " + fmt.Sprintf("%d", boxId) + " "
-		}
-
-		sensorId := where["sensorId"]
-		if sensorId.(int) > 0 {
-			sql += " AND t6.sensor_id = " + fmt.Sprintf("%d", sensorId) + " "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(gridListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(gridListSql+sql+" GROUP BY t1.id ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(gridListCountSql, gridListSql, " GROUP BY t1.id, t2.id, t4.id", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var gridSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"updated":    "t1.updated",
+	"name":       "t1.name",
+	"code":       "t1.code",
+	"materialId": "t1.material_id",
+	"channel":    "t1.channel",
+	"qty":        "t1.qty",
+	"status":     "t1.status",
+}
+
 const gridListCountSql = `
 SELECT
-    COUNT(*)
+    COUNT(DISTINCT t1.id)
 FROM
     rel_box_grid AS t1
 LEFT JOIN
@@ -374,13 +404,15 @@ SELECT
     t1.material_id,
     t1.type,
     t1.safe_qty,
+    t1.reorder_qty,
+    t1.mode,
     t2.addr AS addr,
     SUM(t3.qty) AS total_qty,
     t4.category_id AS category_id,
     t4.material_code,
-    t5.id AS account_grid_id,
-    t6.id AS account_id,
-    t6.username AS account_name
+    MAX(t5.id) AS account_grid_id,
+    MAX(t6.id) AS account_id,
+    MAX(t6.username) AS account_name
 FROM
     rel_box_grid AS t1
 LEFT JOIN
@@ -0,0 +1,556 @@
+package cost
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrMethodIllegal            = errors.New("cost method is illegal")
+	ErrSupplierCostNotFound     = errors.New("supplier cost not found")
+	ErrSupplierCostAlreadyExist = errors.New("supplier cost already exist")
+	ErrLayerNotFound            = errors.New("cost layer not found")
+)
+
+// 计价方法
+const (
+	// 标准成本,物料单价
+	STANDARD = "standard"
+	// 移动加权平均
+	AVERAGE = "average"
+	// 先进先出
+	FIFO = "fifo"
+)
+
+func ValidMethod(method string) bool {
+	return method == STANDARD || method == AVERAGE || method == FIFO
+}
+
+// 供应商价格
+type SupplierCost struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id);index" json:"materialId"`
+	// 供应商ID
+	SupplierId int `orm:"column(supplier_id)" json:"supplierId"`
+	// 单价
+	Cost float64 `orm:"column(cost)" json:"cost"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+
+	// other
+	SupplierName string `json:"supplierName"`
+}
+
+func (t *SupplierCost) TableName() string {
+	return "material_supplier_cost"
+}
+
+// 移动加权平均成本
+type Average struct {
+	MaterialId int `orm:"column(material_id);pk" json:"materialId"`
+	// 参与计算的数量
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 平均单价
+	Cost    float64 `orm:"column(cost)" json:"cost"`
+	Updated string  `orm:"column(updated)" json:"updated"`
+}
+
+func (t *Average) TableName() string {
+	return "material_average_cost"
+}
+
+// 先进先出成本层,每次入库一个批次
+type Layer struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id);index" json:"materialId"`
+	// 供应商ID
+	SupplierId int `orm:"column(supplier_id)" json:"supplierId"`
+	// 批次号
+	Lot string `orm:"column(lot)" json:"lot"`
+	// 入库订单
+	OrderId int `orm:"column(order_id)" json:"orderId"`
+	// 入库数量
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 剩余数量
+	Remaining int `orm:"column(remaining)" json:"remaining"`
+	// 单价
+	Cost    float64 `orm:"column(cost)" json:"cost"`
+	Updated string  `orm:"column(updated)" json:"updated"`
+}
+
+func (t *Layer) TableName() string {
+	return "cost_layer"
+}
+
+// 订单成本,结算时记录
+type OrderCost struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 订单ID
+	OrderId int `orm:"column(order_id);index" json:"orderId"`
+	// 订单类型1上料2领料3回收
+	Type       int `orm:"column(type)" json:"type"`
+	AccountId  int `orm:"column(account_id)" json:"accountId"`
+	GridId     int `orm:"column(grid_id)" json:"gridId"`
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	Qty        int `orm:"column(qty)" json:"qty"`
+	// 计价方法
+	Method string `orm:"column(method)" json:"method"`
+	// 按计价方法的单价和金额
+	UnitCost float64 `orm:"column(unit_cost)" json:"unitCost"`
+	Amount   float64 `orm:"column(amount)" json:"amount"`
+	// 各方法金额,便于切换方法后对比
+	StandardAmount float64 `orm:"column(standard_amount)" json:"standardAmount"`
+	AverageAmount  float64 `orm:"column(average_amount)" json:"averageAmount"`
+	FifoAmount     float64 `orm:"column(fifo_amount)" json:"fifoAmount"`
+}
+
+func (t *OrderCost) TableName() string {
+	return "order_cost"
+}
+
+// 结算订单成本
+// 上料按入库单价增加成本层,回收按平均成本增加,领料按先进先出消耗
+func Settle(obj *OrderCost, standard, receipt float64, supplierId int, updated string) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := Record(o, obj, standard, receipt, supplierId, updated); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 在事务中结算订单成本,随订单结算一起提交
+func Record(o orm.Ormer, obj *OrderCost, standard, receipt float64, supplierId int, updated string) error {
+	if !ValidMethod(obj.Method) {
+		return errors.As(ErrMethodIllegal, obj.Method)
+	}
+
+	if err := settle(o, obj, standard, receipt, supplierId, updated); err != nil {
+		return errors.As(err, obj.OrderId)
+	}
+
+	return nil
+}
+
+func settle(o orm.Ormer, obj *OrderCost, standard, receipt float64, supplierId int, updated string) error {
+	avg, exist, err := average(o, obj.MaterialId, standard)
+	if err != nil {
+		return errors.As(err)
+	}
+
+	qty := obj.Qty
+	if qty < 0 {
+		qty = 0
+	}
+
+	var fifo float64
+	switch obj.Type {
+	case order.IN, order.RECYCLE:
+		// 回收没有入库单价,按平均成本
+		if obj.Type == order.RECYCLE {
+			receipt = avg.Cost
+		}
+
+		if qty > 0 {
+			if avg.Qty+qty > 0 {
+				avg.Cost = (float64(avg.Qty)*avg.Cost + float64(qty)*receipt) / float64(avg.Qty+qty)
+			}
+			avg.Qty += qty
+
+			if _, err := o.Insert(&Layer{
+				Created:    updated,
+				MaterialId: obj.MaterialId,
+				SupplierId: supplierId,
+				OrderId:    obj.OrderId,
+				Qty:        qty,
+				Remaining:  qty,
+				Cost:       receipt,
+				Updated:    updated,
+			}); err != nil {
+				return errors.As(err)
+			}
+		}
+
+		fifo = float64(qty) * receipt
+		obj.AverageAmount = float64(qty) * receipt
+
+	case order.OUT:
+		obj.AverageAmount = float64(qty) * avg.Cost
+
+		fifo, err = consume(o, obj.MaterialId, qty, avg.Cost, updated)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		avg.Qty -= qty
+		if avg.Qty < 0 {
+			avg.Qty = 0
+		}
+	}
+
+	avg.Updated = updated
+	if exist {
+		_, err = o.Update(avg)
+	} else {
+		_, err = o.Insert(avg)
+	}
+	if err != nil {
+		return errors.As(err)
+	}
+
+	obj.StandardAmount = float64(qty) * standard
+	obj.FifoAmount = fifo
+
+	switch obj.Method {
+	case STANDARD:
+		obj.Amount = obj.StandardAmount
+	case AVERAGE:
+		obj.Amount = obj.AverageAmount
+	case FIFO:
+		obj.Amount = obj.FifoAmount
+	}
+
+	if qty > 0 {
+		obj.UnitCost = obj.Amount / float64(qty)
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 当前平均成本,没有时按标准成本
+func average(o orm.Ormer, materialId int, standard float64) (*Average, bool, error) {
+	obj := &Average{
+		MaterialId: materialId,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err != orm.ErrNoRows {
+			return nil, false, errors.As(err)
+		}
+
+		obj.Cost = standard
+		return obj, false, nil
+	}
+
+	return obj, true, nil
+}
+
+// 按先进先出消耗成本层,成本层不足的部分按平均成本
+func consume(o orm.Ormer, materialId, qty int, cost float64, updated string) (float64, error) {
+	list := []*Layer{}
+	if _, err := o.Raw(remainingLayerSql, materialId).QueryRows(&list); err != nil {
+		return 0, errors.As(err)
+	}
+
+	var amount float64
+	for _, v := range list {
+		if qty <= 0 {
+			break
+		}
+
+		n := v.Remaining
+		if n > qty {
+			n = qty
+		}
+
+		amount += float64(n) * v.Cost
+		qty -= n
+
+		if _, err := o.Raw(consumeLayerSql, n, updated, v.Id).Exec(); err != nil {
+			return 0, errors.As(err)
+		}
+	}
+
+	amount += float64(qty) * cost
+
+	return amount, nil
+}
+
+const remainingLayerSql = `
+SELECT
+    *
+FROM
+    cost_layer AS t1
+WHERE
+    t1.material_id = ?
+AND
+    t1.remaining > 0
+ORDER BY t1.id
+`
+
+const consumeLayerSql = `
+UPDATE
+    cost_layer
+SET
+    remaining = remaining - ?,
+    updated = ?
+WHERE
+    id = ?
+`
+
+// -------------------------
+// 供应商价格
+
+// 添加
+func InsertSupplierCost(obj *SupplierCost) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除
+func DelSupplierCost(id int) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Delete(&SupplierCost{Id: id}); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateSupplierCost(obj *SupplierCost) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func SupplierCostById(id int) (*SupplierCost, error) {
+	o := orm.NewOrm()
+
+	obj := &SupplierCost{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSupplierCostNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 物料在供应商的价格
+func SupplierCostBy(materialId, supplierId int) (*SupplierCost, error) {
+	o := orm.NewOrm()
+
+	obj := &SupplierCost{}
+
+	if err := o.Raw(supplierCostBySql, materialId, supplierId).QueryRow(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSupplierCostNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+const supplierCostBySql = `
+SELECT
+    *
+FROM
+    material_supplier_cost AS t1
+WHERE
+    t1.material_id = ?
+AND
+    t1.supplier_id = ?
+LIMIT 1
+`
+
+// 物料所有供应商价格
+func SupplierCostList(materialId int) ([]*SupplierCost, error) {
+	o := orm.NewOrm()
+
+	list := []*SupplierCost{}
+
+	if _, err := o.Raw(supplierCostListSql, materialId).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const supplierCostListSql = `
+SELECT
+    t1.*,
+    t2.short_name AS supplier_name
+FROM
+    material_supplier_cost AS t1
+LEFT JOIN
+    supplier AS t2
+ON
+    t1.supplier_id = t2.id
+WHERE
+    t1.material_id = ?
+ORDER BY t1.id
+`
+
+// -------------------------
+// 成本层
+
+// 根据ID查询
+func LayerById(id int) (*Layer, error) {
+	o := orm.NewOrm()
+
+	obj := &Layer{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrLayerNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 修改批次号和单价
+func UpdateLayer(obj *Layer) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj, "Lot", "Cost", "Updated"); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 查询所有
+func LayerList(where map[string]interface{}, page, pageSize int) (int64, []*Layer, error) {
+	list := []*Layer{}
+
+	f := query.New().
+		Id("t1.material_id", where["materialId"]).
+		Equal("t1.lot", where["lot"])
+
+	// 只查有剩余的
+	if where["remaining"] == true {
+		f.Where("t1.remaining > 0")
+	}
+
+	f.Sort(where["sort"], layerSorts, "id:desc").Cursor(where["cursor"])
+
+	total, err := f.Page(layerListCountSql, layerListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var layerSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"materialId": "t1.material_id",
+	"lot":        "t1.lot",
+	"remaining":  "t1.remaining",
+	"cost":       "t1.cost",
+}
+
+const layerListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    cost_layer AS t1
+WHERE
+`
+
+const layerListSql = `
+SELECT
+    *
+FROM
+    cost_layer AS t1
+WHERE
+`
+
+// -------------------------
+// 订单成本
+
+// 查询所有
+func OrderCostList(where map[string]interface{}, page, pageSize int) (int64, []*OrderCost, error) {
+	list := []*OrderCost{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.order_id", where["orderId"]).
+		Id("t1.material_id", where["materialId"]).
+		Id("t1.account_id", where["accountId"]).
+		Id("t1.type", where["type"]).
+		Sort(where["sort"], orderCostSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(orderCostListCountSql, orderCostListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var orderCostSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"materialId": "t1.material_id",
+	"accountId":  "t1.account_id",
+	"qty":        "t1.qty",
+	"amount":     "t1.amount",
+}
+
+const orderCostListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    order_cost AS t1
+WHERE
+`
+
+const orderCostListSql = `
+SELECT
+    *
+FROM
+    order_cost AS t1
+WHERE
+`
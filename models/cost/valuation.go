@@ -0,0 +1,166 @@
+package cost
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+// 物料库存金额
+type Valuation struct {
+	MaterialId   int    `json:"materialId"`
+	MaterialCode string `json:"materialCode"`
+	MaterialName string `json:"materialName"`
+	CategoryId   int    `json:"categoryId"`
+	// 库存数量
+	Qty int `json:"qty"`
+	// 标准单价
+	StandardCost float64 `json:"standardCost"`
+	// 平均单价
+	AverageCost float64 `json:"averageCost"`
+	// 成本层剩余数量和金额
+	LayerQty   int     `json:"layerQty"`
+	LayerValue float64 `json:"layerValue"`
+
+	// 按计价方法
+	Method   string  `json:"method"`
+	UnitCost float64 `json:"unitCost"`
+	Value    float64 `json:"value"`
+}
+
+// 按计价方法计算单价和金额
+func (t *Valuation) Apply(method string) {
+	t.Method = method
+
+	switch method {
+	case STANDARD:
+		t.UnitCost = t.StandardCost
+	case AVERAGE:
+		t.UnitCost = t.AverageCost
+	case FIFO:
+		// 成本层和库存不一致时,差额按平均成本
+		value := t.LayerValue + float64(t.Qty-t.LayerQty)*t.AverageCost
+		if t.LayerQty > t.Qty && t.LayerQty > 0 {
+			value = t.LayerValue * float64(t.Qty) / float64(t.LayerQty)
+		}
+
+		if t.Qty > 0 {
+			t.UnitCost = value / float64(t.Qty)
+		}
+	}
+
+	t.Value = float64(t.Qty) * t.UnitCost
+}
+
+// 库存金额
+func ValuationList(method string, where map[string]interface{}, page, pageSize int) (int64, []*Valuation, error) {
+	if !ValidMethod(method) {
+		return -1, nil, errors.As(ErrMethodIllegal, method)
+	}
+
+	list := []*Valuation{}
+
+	f := query.New().
+		Id("t1.id", where["materialId"]).
+		Id("t1.category_id", where["categoryId"]).
+		Sort(where["sort"], valuationSorts, "id:asc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(valuationListCountSql, valuationListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	for _, v := range list {
+		v.Apply(method)
+	}
+
+	return total, list, nil
+}
+
+// 物料单价,用于库存列表
+func UnitCosts(method string, materialIds []int) (map[int]float64, error) {
+	m := make(map[int]float64)
+	if len(materialIds) == 0 {
+		return m, nil
+	}
+
+	seen := make(map[int]bool)
+	ids := make([]interface{}, 0, len(materialIds))
+	for _, id := range materialIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	o := orm.NewOrm()
+
+	list := []*Valuation{}
+	if _, err := o.Raw(valuationListSql+" t1.id IN "+inSql(len(ids)), ids...).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	for _, v := range list {
+		v.Apply(method)
+		m[v.MaterialId] = v.UnitCost
+	}
+
+	return m, nil
+}
+
+// (?,?,?)
+func inSql(n int) string {
+	sql := "("
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sql += ","
+		}
+		sql += "?"
+	}
+
+	return sql + ")"
+}
+
+// 可排序字段
+var valuationSorts = map[string]string{
+	"id":           "t1.id",
+	"name":         "t1.name",
+	"materialCode": "t1.material_code",
+}
+
+const valuationListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    material AS t1
+WHERE
+`
+
+const valuationListSql = `
+SELECT
+    t1.id AS material_id,
+    t1.material_code,
+    t1.name AS material_name,
+    t1.category_id,
+    COALESCE(t2.qty, 0) AS qty,
+    t1.price AS standard_cost,
+    COALESCE(t3.cost, t1.price) AS average_cost,
+    COALESCE(t4.qty, 0) AS layer_qty,
+    COALESCE(t4.value, 0) AS layer_value
+FROM
+    material AS t1
+LEFT JOIN
+    (SELECT material_id, SUM(qty) AS qty FROM stock GROUP BY material_id) AS t2
+ON
+    t2.material_id = t1.id
+LEFT JOIN
+    material_average_cost AS t3
+ON
+    t3.material_id = t1.id
+LEFT JOIN
+    (SELECT material_id, SUM(remaining) AS qty, SUM(remaining * cost) AS value FROM cost_layer WHERE remaining > 0 GROUP BY material_id) AS t4
+ON
+    t4.material_id = t1.id
+WHERE
+`
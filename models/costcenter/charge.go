@@ -0,0 +1,128 @@
+package costcenter
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrChargeNotFound = errors.New("charge not found")
+)
+
+// 领料记账,每个订单一条
+type Charge struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 订单ID
+	OrderId int `orm:"column(order_id);unique" json:"orderId"`
+	// 成本中心ID,0未指定
+	CostCenterId int `orm:"column(cost_center_id);default(0)" json:"costCenterId"`
+	// 工单号,可为空
+	WorkOrder string `orm:"column(work_order);null" json:"workOrder"`
+	// 列表查询时带出
+	AccountId      int    `orm:"-" json:"accountId"`
+	MaterialId     int    `orm:"-" json:"materialId"`
+	Qty            int    `orm:"-" json:"qty"`
+	CostCenterCode string `orm:"-" json:"costCenterCode"`
+	CostCenterName string `orm:"-" json:"costCenterName"`
+}
+
+func (t *Charge) TableName() string {
+	return "order_charge"
+}
+
+// 添加
+func InsertCharge(obj *Charge) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据订单查询
+func ChargeByOrderId(orderId int) (*Charge, error) {
+	o := orm.NewOrm()
+
+	obj := &Charge{
+		OrderId: orderId,
+	}
+
+	if err := o.Read(obj, "OrderId"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrChargeNotFound, orderId)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func ChargeList(where map[string]interface{}, page, pageSize int) (int64, []*Charge, error) {
+	list := []*Charge{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.order_id", where["orderId"]).
+		Id("t1.cost_center_id", where["costCenterId"]).
+		Id("t2.account_id", where["accountId"]).
+		Id("t2.material_id", where["materialId"]).
+		Equal("t1.work_order", where["workOrder"]).
+		Sort(where["sort"], chargeSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(chargeListCountSql, chargeListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var chargeSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+}
+
+const chargeListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    order_charge AS t1
+INNER JOIN
+    "order" AS t2
+ON
+    t2.id = t1.order_id
+WHERE
+`
+
+const chargeListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.order_id,
+    t1.cost_center_id,
+    t1.work_order,
+    t2.account_id,
+    t2.material_id,
+    t2.qty,
+    COALESCE(t3.code, '') AS cost_center_code,
+    COALESCE(t3.name, '') AS cost_center_name
+FROM
+    order_charge AS t1
+INNER JOIN
+    "order" AS t2
+ON
+    t2.id = t1.order_id
+LEFT JOIN
+    cost_center AS t3
+ON
+    t3.id = t1.cost_center_id
+WHERE
+`
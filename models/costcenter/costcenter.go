@@ -0,0 +1,322 @@
+package costcenter
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrCostCenterNotFound     = errors.New("cost center not found")
+	ErrCostCenterAlreadyExist = errors.New("cost center already exist")
+	ErrCostCenterDisabled     = errors.New("cost center disabled")
+	ErrAssignNotFound         = errors.New("cost center assign not found")
+	ErrAssignAlreadyExist     = errors.New("cost center assign already exist")
+)
+
+// 成本中心
+type CostCenter struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 编号,唯一
+	Code string `orm:"column(code);unique" json:"code"`
+	// 名称
+	Name string `orm:"column(name)" json:"name"`
+	// 备注
+	Remark string `orm:"column(remark);null" json:"remark"`
+	// 状态0停用1启用
+	Status int `orm:"column(status);default(1)" json:"status"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+}
+
+func (t *CostCenter) TableName() string {
+	return "cost_center"
+}
+
+// 默认成本中心,分配给组或用户,用户优先
+type Assign struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 成本中心ID
+	CostCenterId int `orm:"column(cost_center_id)" json:"costCenterId"`
+	// 组ID,0不分配给组
+	GroupId int `orm:"column(group_id);default(0)" json:"groupId"`
+	// 客户ID,0不分配给用户
+	AccountId int `orm:"column(account_id);default(0)" json:"accountId"`
+}
+
+func (t *Assign) TableName() string {
+	return "rel_cost_center"
+}
+
+// 添加
+func InsertCostCenter(obj *CostCenter) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除,同时删除分配
+func DelCostCenter(id int) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if _, err := o.Raw(delAssignByCostCenterSql, id).Exec(); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if _, err := o.Delete(&CostCenter{Id: id}); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const delAssignByCostCenterSql = `
+DELETE FROM rel_cost_center WHERE cost_center_id = ?
+`
+
+// 修改
+func UpdateCostCenter(obj *CostCenter) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func CostCenterById(id int) (*CostCenter, error) {
+	o := orm.NewOrm()
+
+	obj := &CostCenter{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrCostCenterNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 根据编号查询
+func CostCenterByCode(code string) (*CostCenter, error) {
+	o := orm.NewOrm()
+
+	obj := &CostCenter{
+		Code: code,
+	}
+
+	if err := o.Read(obj, "Code"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrCostCenterNotFound, code)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func CostCenterList(where map[string]interface{}, page, pageSize int) (int64, []*CostCenter, error) {
+	list := []*CostCenter{}
+
+	f := query.New().
+		Search(where["name"], "t1.code", "t1.name").
+		Status("t1.status", where["status"]).
+		Sort(where["sort"], costCenterSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(costCenterListCountSql, costCenterListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var costCenterSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"name":    "t1.name",
+	"code":    "t1.code",
+	"status":  "t1.status",
+}
+
+const costCenterListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    cost_center AS t1
+WHERE
+`
+
+const costCenterListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.code,
+    t1.name,
+    t1.remark,
+    t1.status,
+    t1.updated,
+    t1.updated_by
+FROM
+    cost_center AS t1
+WHERE
+`
+
+// 添加分配
+func InsertAssign(obj *Assign) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除分配
+func DelAssign(id int) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Delete(&Assign{Id: id}); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询分配
+func AssignById(id int) (*Assign, error) {
+	o := orm.NewOrm()
+
+	obj := &Assign{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrAssignNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 组或用户的分配,每个组或用户只有一个默认成本中心
+func AssignBy(groupId, accountId int) (*Assign, error) {
+	o := orm.NewOrm()
+
+	obj := &Assign{
+		GroupId:   groupId,
+		AccountId: accountId,
+	}
+
+	if err := o.Read(obj, "GroupId", "AccountId"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrAssignNotFound, groupId, accountId)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 成本中心的所有分配
+func AssignList(costCenterId int) ([]*Assign, error) {
+	o := orm.NewOrm()
+
+	list := []*Assign{}
+	if _, err := o.Raw(assignListSql, costCenterId).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const assignListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.cost_center_id,
+    t1.group_id,
+    t1.account_id
+FROM
+    rel_cost_center AS t1
+WHERE
+    t1.cost_center_id = ?
+ORDER BY
+    t1.id
+`
+
+// 用户默认成本中心,先查用户再查所在组,没有时返回0
+func DefaultCostCenterId(accountId int) (int, error) {
+	o := orm.NewOrm()
+
+	var id int
+	if err := o.Raw(defaultCostCenterSql, accountId, accountId).QueryRow(&id); err != nil {
+		if err == orm.ErrNoRows {
+			return 0, nil
+		}
+
+		return 0, errors.As(err)
+	}
+
+	return id, nil
+}
+
+const defaultCostCenterSql = `
+SELECT
+    t1.cost_center_id
+FROM
+    rel_cost_center AS t1
+INNER JOIN
+    cost_center AS t3
+ON
+    t3.id = t1.cost_center_id AND t3.status = 1
+LEFT JOIN
+    rel_account_group AS t2
+ON
+    t2.group_id = t1.group_id AND t1.group_id > 0 AND t2.status = 1
+WHERE
+    t1.account_id = ?
+OR
+    t2.account_id = ?
+ORDER BY
+    t1.account_id DESC, t1.id
+LIMIT 1
+`
@@ -0,0 +1,165 @@
+package costcenter
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrWorkOrderNotFound     = errors.New("work order not found")
+	ErrWorkOrderAlreadyExist = errors.New("work order already exist")
+	ErrWorkOrderClosed       = errors.New("work order closed")
+)
+
+// 工单状态
+const (
+	CLOSED = iota
+	OPEN
+)
+
+// 工单,领料时可选的工单号必须在列表中
+type WorkOrder struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 工单号,可输入或扫码
+	Code string `orm:"column(code);unique" json:"code"`
+	// 名称
+	Name string `orm:"column(name)" json:"name"`
+	// 成本中心ID,0不指定
+	CostCenterId int `orm:"column(cost_center_id);default(0)" json:"costCenterId"`
+	// 状态0关闭1打开
+	Status int `orm:"column(status);default(1)" json:"status"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+}
+
+func (t *WorkOrder) TableName() string {
+	return "work_order"
+}
+
+// 添加
+func InsertWorkOrder(obj *WorkOrder) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除
+func DelWorkOrder(id int) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Delete(&WorkOrder{Id: id}); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateWorkOrder(obj *WorkOrder) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func WorkOrderById(id int) (*WorkOrder, error) {
+	o := orm.NewOrm()
+
+	obj := &WorkOrder{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrWorkOrderNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 根据工单号查询
+func WorkOrderByCode(code string) (*WorkOrder, error) {
+	o := orm.NewOrm()
+
+	obj := &WorkOrder{
+		Code: code,
+	}
+
+	if err := o.Read(obj, "Code"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrWorkOrderNotFound, code)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func WorkOrderList(where map[string]interface{}, page, pageSize int) (int64, []*WorkOrder, error) {
+	list := []*WorkOrder{}
+
+	f := query.New().
+		Search(where["name"], "t1.code", "t1.name").
+		Id("t1.cost_center_id", where["costCenterId"]).
+		Status("t1.status", where["status"]).
+		Sort(where["sort"], workOrderSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(workOrderListCountSql, workOrderListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var workOrderSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"name":    "t1.name",
+	"code":    "t1.code",
+	"status":  "t1.status",
+}
+
+const workOrderListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    work_order AS t1
+WHERE
+`
+
+const workOrderListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.code,
+    t1.name,
+    t1.cost_center_id,
+    t1.status,
+    t1.updated,
+    t1.updated_by
+FROM
+    work_order AS t1
+WHERE
+`
@@ -0,0 +1,124 @@
+package forecast
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+// 格子物料和当前设置
+type GridMaterial struct {
+	GridId       int    `json:"gridId"`
+	GridName     string `json:"gridName"`
+	Addr         int    `json:"addr"`
+	MaterialId   int    `json:"materialId"`
+	MaterialCode string `json:"materialCode"`
+	MaterialName string `json:"materialName"`
+	// 格子容量,0不限
+	MaxQty     int `json:"maxQty"`
+	SafeQty    int `json:"safeQty"`
+	ReorderQty int `json:"reorderQty"`
+	// 供应商交货期,0未设置
+	LeadTime int `json:"leadTime"`
+}
+
+// 格子物料日用量
+type Daily struct {
+	GridId     int    `json:"gridId"`
+	MaterialId int    `json:"materialId"`
+	Day        string `json:"day"`
+	Qty        int    `json:"qty"`
+}
+
+// 绑定了物料的格子
+func GridMaterialList(where map[string]interface{}) ([]*GridMaterial, error) {
+	o := orm.NewOrm()
+
+	list := []*GridMaterial{}
+
+	sql, args := filter(where)
+	if _, err := o.Raw(gridMaterialListSql+sql+" ORDER BY t1.id", args...).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const gridMaterialListSql = `
+SELECT
+    t1.id AS grid_id,
+    t1.name AS grid_name,
+    COALESCE(t4.addr, 0) AS addr,
+    t1.material_id,
+    t2.material_code,
+    t2.name AS material_name,
+    t1.qty AS max_qty,
+    t1.safe_qty,
+    t1.reorder_qty,
+    COALESCE(t3.lead_time, 0) AS lead_time
+FROM
+    rel_box_grid AS t1
+INNER JOIN
+    material AS t2
+ON
+    t2.id = t1.material_id
+LEFT JOIN
+    supplier AS t3
+ON
+    t3.id = t2.supplier_id
+LEFT JOIN
+    box AS t4
+ON
+    t4.id = t1.box_id
+WHERE
+    t1.material_id > 0
+AND
+`
+
+// 每个格子物料每天的领料数量,只统计有领料的天
+func DailyList(where map[string]interface{}, startDate string) ([]*Daily, error) {
+	o := orm.NewOrm()
+
+	list := []*Daily{}
+
+	sql, args := filter(where)
+	args = append([]interface{}{order.OUT, startDate}, args...)
+	if _, err := o.Raw(dailyListSql+sql+" GROUP BY t5.grid_id, t5.material_id, SUBSTR(t5.created, 1, 10)", args...).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const dailyListSql = `
+SELECT
+    t5.grid_id,
+    t5.material_id,
+    SUBSTR(t5.created, 1, 10) AS day,
+    SUM(t5.qty) AS qty
+FROM
+    "order" AS t5
+INNER JOIN
+    rel_box_grid AS t1
+ON
+    t1.id = t5.grid_id AND t1.material_id = t5.material_id
+WHERE
+    t5.type = ?
+AND
+    t5.created >= ?
+AND
+`
+
+func filter(where map[string]interface{}) (string, []interface{}) {
+	f := query.New().
+		Id("t1.id", where["gridId"]).
+		Id("t1.material_id", where["materialId"]).
+		Id("t1.box_id", where["boxId"])
+
+	if ids, ok := where["gridIds"].([]int); ok {
+		f.In("t1.id", ids)
+	}
+
+	return f.Sql(), f.Args()
+}
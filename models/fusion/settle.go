@@ -0,0 +1,128 @@
+package fusion
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var ErrSettleNotFound = errors.New("fusion settle not found")
+
+// 关门结算,记录数量来源和不一致
+type Settle struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 订单
+	OrderId int `orm:"column(order_id)" json:"orderId"`
+	// 格子
+	GridId int `orm:"column(grid_id)" json:"gridId"`
+	// 物料
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 结算数量
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 确定数量的传感器,逗号分隔
+	Source string `orm:"column(source)" json:"source"`
+	// 主传感器和校验传感器不一致0否1是
+	Disagree int `orm:"column(disagree);default(0)" json:"disagree"`
+	// 各通道读数JSON
+	Readings string `orm:"column(readings);type(text)" json:"readings"`
+	// 规则JSON
+	Rule string `orm:"column(rule)" json:"rule"`
+}
+
+func (t *Settle) TableName() string {
+	return "fusion_settle"
+}
+
+// 添加
+func InsertSettle(obj *Settle) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据订单查询
+func SettleByOrderId(orderId int) (*Settle, error) {
+	o := orm.NewOrm()
+
+	obj := &Settle{}
+
+	if err := o.Raw(settleByOrderIdSql, orderId).QueryRow(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSettleNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+const settleByOrderIdSql = `
+SELECT
+    *
+FROM
+    fusion_settle AS t1
+WHERE
+    t1.order_id = ?
+ORDER BY t1.id DESC
+LIMIT 1
+`
+
+// 查询所有
+func SettleList(where map[string]interface{}, page, pageSize int) (int64, []*Settle, error) {
+	list := []*Settle{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.material_id", where["materialId"]).
+		Status("t1.disagree", where["disagree"]).
+		Sort(where["sort"], settleSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(settleListCountSql, settleListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var settleSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"materialId": "t1.material_id",
+	"gridId":     "t1.grid_id",
+	"qty":        "t1.qty",
+}
+
+const settleListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    fusion_settle AS t1
+WHERE
+`
+
+const settleListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.order_id,
+    t1.grid_id,
+    t1.material_id,
+    t1.qty,
+    t1.source,
+    t1.disagree,
+    t1.readings,
+    t1.rule
+FROM
+    fusion_settle AS t1
+WHERE
+`
@@ -1,14 +1,34 @@
 package models
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/astaxie/beego"
 	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/dialect"
+	"github.com/beego/ms304w-client/basis/errors"
 	"github.com/beego/ms304w-client/models/account"
+	"github.com/beego/ms304w-client/models/adjust"
+	"github.com/beego/ms304w-client/models/audit"
+	"github.com/beego/ms304w-client/models/backup"
 	"github.com/beego/ms304w-client/models/box"
+	"github.com/beego/ms304w-client/models/cost"
+	"github.com/beego/ms304w-client/models/costcenter"
+	"github.com/beego/ms304w-client/models/fusion"
+	"github.com/beego/ms304w-client/models/inspect"
+	"github.com/beego/ms304w-client/models/kit"
+	"github.com/beego/ms304w-client/models/ledger"
 	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/migrate"
 	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/outbox"
 	"github.com/beego/ms304w-client/models/permission"
+	"github.com/beego/ms304w-client/models/rfid"
 	"github.com/beego/ms304w-client/models/sensor"
+	"github.com/beego/ms304w-client/models/webhook"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"time"
 )
@@ -27,11 +47,16 @@ func init() {
 	// 强制用UTC时间
 	orm.DefaultTimeLoc = time.UTC
 
-	if err := orm.RegisterDriver(driver, orm.DRSqlite); err != nil {
+	driverType, err := driverType(driver)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := orm.RegisterDriver(driver, driverType); err != nil {
 		panic(err)
 	}
 
-	if err := orm.RegisterDataBase("default", driver, dsn); err != nil {
+	if err := orm.RegisterDataBase("default", driver, dialect.Dsn(driver, dsn)); err != nil {
 		panic(err)
 	}
 
@@ -41,12 +66,15 @@ func init() {
 		new(account.Account),
 		new(account.Group),
 		new(account.AccountGroup),
+		new(account.FingerEnroll),
+		new(account.AccountFinger),
 		// material
 		new(material.Material),
 		new(material.GroupMaterial),
 		new(material.Category),
 		new(material.Sensor),
 		new(material.MaterialRfid),
+		new(material.Fusion),
 		new(material.Supplier),
 		// box
 		new(box.Box),
@@ -69,16 +97,87 @@ func init() {
 		new(permission.Permission),
 		new(permission.UserRole),
 		new(permission.RolePermission),
+		// audit
+		new(audit.Audit),
+
+		new(rfid.Session),
+		new(rfid.Record),
+
+		new(fusion.Settle),
+		// webhook
+		new(webhook.Webhook),
+		new(webhook.Delivery),
+		new(webhook.Attempt),
+		// sync
+		new(outbox.Outbox),
+		new(outbox.Conflict),
+		new(outbox.State),
+		// cost
+		new(cost.SupplierCost),
+		new(cost.Average),
+		new(cost.Layer),
+		new(cost.OrderCost),
+		// cost center
+		new(costcenter.CostCenter),
+		new(costcenter.Assign),
+		new(costcenter.WorkOrder),
+		new(costcenter.Charge),
+		// ledger
+		new(ledger.Movement),
+		new(adjust.Adjustment),
+		new(adjust.Transfer),
+		new(inspect.Inspection),
+		// kit
+		new(kit.Kit),
+		new(kit.Item),
+		new(kit.Substitute),
+		new(kit.Pick),
+		new(kit.PickLine),
+		// substitute
+		new(material.Substitute),
+		new(material.Substitution),
 	)
 
-	// sync
-	if err := orm.RunSyncdb("default", false, true); err != nil {
-		panic(err)
+	// 数据库损坏时不启动,backup命令可以恢复损坏的库
+	if driver == dialect.SQLITE && !backup.IsCommand() && beego.AppConfig.DefaultBool("db_integrity_check", true) {
+		if err := backup.Check(); err != nil {
+			panic(fmt.Sprintf("%v\nrestore a backup with: %s backup list, %s backup restore <name>", err, os.Args[0], os.Args[0]))
+		}
 	}
 
-	orm.SetMaxIdleConns("default", 100)
-	// orm.SetMaxOpenConns("default", 50)
-	orm.SetMaxOpenConns("default", 1)
+	// 数据库迁移,migrate和backup命令时不执行
+	if !migrate.IsCommand() && !backup.IsCommand() && beego.AppConfig.DefaultBool("db_auto_migrate", true) {
+		if _, err := migrate.Migrate(); err != nil {
+			panic(err)
+		}
+	}
+
+	// 连接池
+	orm.SetMaxIdleConns("default", beego.AppConfig.DefaultInt("db_max_idle_conns", 100))
+	orm.SetMaxOpenConns("default", beego.AppConfig.DefaultInt("db_max_open_conns", dialect.MaxOpenConns(driver)))
+
+	if lifetime := beego.AppConfig.DefaultInt("db_conn_max_lifetime", 0); lifetime > 0 {
+		db, err := orm.GetDB("default")
+		if err != nil {
+			panic(err)
+		}
+
+		db.SetConnMaxLifetime(time.Duration(lifetime) * time.Second)
+	}
 
 	orm.Debug = debug
 }
+
+// 驱动类型
+func driverType(driver string) (orm.DriverType, error) {
+	switch driver {
+	case dialect.SQLITE:
+		return orm.DRSqlite, nil
+	case dialect.MYSQL:
+		return orm.DRMySQL, nil
+	case dialect.POSTGRES:
+		return orm.DRPostgres, nil
+	}
+
+	return 0, errors.As(dialect.ErrDriver, driver)
+}
@@ -0,0 +1,325 @@
+package inspect
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/adjust"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrInspectionNotFound = errors.New("inspection not found")
+	ErrInspected          = errors.New("return already inspected")
+	ErrQtyMismatch        = errors.New("accepted and scrapped qty must equal returned qty")
+	ErrReasonIllegal      = errors.New("scrap reason is illegal")
+)
+
+// 检验状态
+const (
+	// 待检验
+	PENDING = iota
+	// 全部入库
+	ACCEPTED
+	// 全部报废
+	SCRAPPED
+	// 部分入库部分报废
+	PARTIAL
+)
+
+// 报废原因
+const (
+	// 损坏
+	DAMAGED = "damaged"
+	// 已使用
+	USED = "used"
+	// 过期
+	EXPIRED = "expired"
+	// 污染
+	CONTAMINATED = "contaminated"
+	// 其他
+	OTHER = "other"
+)
+
+var reasons = map[string]bool{
+	DAMAGED:      true,
+	USED:         true,
+	EXPIRED:      true,
+	CONTAMINATED: true,
+	OTHER:        true,
+}
+
+// 是否为已定义报废原因
+func ValidReason(reason string) bool {
+	return reasons[reason]
+}
+
+// 回收检验,每个回收订单一条
+// 放入隔离格子的回收不计库存,入库时加到目标格子
+// 放回原格子的回收已计库存,报废时扣减
+type Inspection struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 回收订单
+	OrderId   int `orm:"column(order_id);unique" json:"orderId"`
+	AccountId int `orm:"column(account_id)" json:"accountId"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 回收放入的格子
+	GridId int `orm:"column(grid_id)" json:"gridId"`
+	// 是否在隔离格子0否1是
+	Quarantine int `orm:"column(quarantine);default(0)" json:"quarantine"`
+	// 回收数量
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 状态0待检验1入库2报废3部分报废
+	Status int `orm:"column(status);default(0)" json:"status"`
+	// 入库数量
+	AcceptedQty int `orm:"column(accepted_qty);default(0)" json:"acceptedQty"`
+	// 入库格子,隔离时为目标格子,否则为原格子
+	AcceptedGridId int `orm:"column(accepted_grid_id);default(0)" json:"acceptedGridId"`
+	// 报废数量
+	ScrappedQty int `orm:"column(scrapped_qty);default(0)" json:"scrappedQty"`
+	// 报废原因
+	Reason string `orm:"column(reason);null" json:"reason"`
+	// 备注
+	Note string `orm:"column(note);null" json:"note"`
+	// 检验人和时间
+	InspectedBy string `orm:"column(inspected_by);null" json:"inspectedBy"`
+	Inspected   string `orm:"column(inspected);null" json:"inspected"`
+}
+
+func (t *Inspection) TableName() string {
+	return "return_inspection"
+}
+
+// 添加
+func InsertInspection(obj *Inspection) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func InspectionById(id int) (*Inspection, error) {
+	o := orm.NewOrm()
+
+	obj := &Inspection{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrInspectionNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 检验结果
+type Result struct {
+	AcceptedQty int
+	// 隔离时入库的格子
+	GridId int
+	// 格子最大数量,0不限制
+	MaxQty      int
+	ScrappedQty int
+	Reason      string
+	Note        string
+	InspectedBy string
+	Inspected   string
+}
+
+// 检验并结算库存,src为台账的操作人
+// 返回库存变化,没有变化时为nil
+func Inspect(obj *Inspection, r *Result, src *ledger.Movement) (*order.Stock, *order.Stock, error) {
+	if obj.Status != PENDING {
+		return nil, nil, errors.As(ErrInspected, obj.Id)
+	}
+
+	if r.AcceptedQty < 0 || r.ScrappedQty < 0 || r.AcceptedQty+r.ScrappedQty != obj.Qty {
+		return nil, nil, errors.As(ErrQtyMismatch, r.AcceptedQty, r.ScrappedQty, obj.Qty)
+	}
+
+	if r.ScrappedQty > 0 && !ValidReason(r.Reason) {
+		return nil, nil, errors.As(ErrReasonIllegal, r.Reason)
+	}
+
+	switch {
+	case r.ScrappedQty == 0:
+		obj.Status = ACCEPTED
+	case r.AcceptedQty == 0:
+		obj.Status = SCRAPPED
+	default:
+		obj.Status = PARTIAL
+	}
+
+	obj.AcceptedQty = r.AcceptedQty
+	obj.ScrappedQty = r.ScrappedQty
+	obj.Reason = r.Reason
+	obj.Note = r.Note
+	obj.InspectedBy = r.InspectedBy
+	obj.Inspected = r.Inspected
+
+	// 隔离的入库到目标格子,未隔离的报废从原格子扣减
+	gridId, qty, maxQty := obj.GridId, -r.ScrappedQty, 0
+	if obj.Quarantine == 1 {
+		gridId, qty, maxQty = r.GridId, r.AcceptedQty, r.MaxQty
+	}
+
+	if r.AcceptedQty > 0 {
+		obj.AcceptedGridId = gridId
+	}
+
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	// 只更新待检验的,防止重复检验
+	res, err := o.Raw(inspectSql, obj.Status, obj.AcceptedQty, obj.AcceptedGridId, obj.ScrappedQty, obj.Reason, obj.Note, obj.InspectedBy, obj.Inspected, obj.Id, PENDING).Exec()
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		o.Rollback()
+		return nil, nil, errors.As(err)
+	}
+
+	if n == 0 {
+		o.Rollback()
+		return nil, nil, errors.As(ErrInspected, obj.Id)
+	}
+
+	var before, after *order.Stock
+	if qty != 0 {
+		before, after, err = adjust.ChangeStock(o, gridId, obj.MaterialId, qty, maxQty, obj.Inspected)
+		if err != nil {
+			o.Rollback()
+			return nil, nil, errors.As(err, gridId, obj.MaterialId)
+		}
+
+		src.Reason = ledger.INSPECT
+		src.RefType = "inspection"
+		src.RefId = obj.Id
+		src.Note = obj.Reason
+		if err := ledger.Record(o, src, before, after); err != nil {
+			o.Rollback()
+			return nil, nil, errors.As(err)
+		}
+	}
+
+	if err := o.Commit(); err != nil {
+		return nil, nil, errors.As(err)
+	}
+
+	return before, after, nil
+}
+
+const inspectSql = `
+UPDATE
+    return_inspection
+SET
+    status = ?,
+    accepted_qty = ?,
+    accepted_grid_id = ?,
+    scrapped_qty = ?,
+    reason = ?,
+    note = ?,
+    inspected_by = ?,
+    inspected = ?
+WHERE
+    id = ?
+AND
+    status = ?
+`
+
+// 物料放回原格子待检验的数量,已计库存但不能领出
+func FlaggedQtys(materialIds []int) (map[int]int, error) {
+	m := make(map[int]int)
+	if len(materialIds) == 0 {
+		return m, nil
+	}
+
+	f := query.New().
+		In("t1.material_id", materialIds).
+		Where("t1.quarantine = ?", 0).
+		Status("t1.status", PENDING)
+
+	list := []*Inspection{}
+	if err := f.All(flaggedQtySql, " GROUP BY t1.material_id ", &list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	for _, v := range list {
+		m[v.MaterialId] = v.Qty
+	}
+
+	return m, nil
+}
+
+const flaggedQtySql = `
+SELECT
+    t1.material_id,
+    SUM(t1.qty) AS qty
+FROM
+    return_inspection AS t1
+WHERE
+`
+
+// 查询所有
+func InspectionList(where map[string]interface{}, page, pageSize int) (int64, []*Inspection, error) {
+	list := []*Inspection{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.material_id", where["materialId"]).
+		Id("t1.account_id", where["accountId"]).
+		Status("t1.status", where["status"]).
+		Equal("t1.reason", where["reason"]).
+		Search(where["name"], "t1.note", "t1.inspected_by").
+		Sort(where["sort"], inspectionSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(inspectionListCountSql, inspectionListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var inspectionSorts = map[string]string{
+	"id":        "t1.id",
+	"created":   "t1.created",
+	"inspected": "t1.inspected",
+}
+
+const inspectionListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    return_inspection AS t1
+WHERE
+`
+
+const inspectionListSql = `
+SELECT
+    t1.*
+FROM
+    return_inspection AS t1
+WHERE
+`
@@ -0,0 +1,277 @@
+package inventory
+
+import (
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+// 订单、库存和自动盘点列表,格子关联柜子,可按柜子查询
+// 格子删除后的记录仍然返回,只是不能按柜子查到
+
+// 订单
+func OrderList(where map[string]interface{}, page, pageSize int) (int64, []*order.Order, error) {
+	list := []*order.Order{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t3.name", "t3.material_code").
+		Id("t2.box_id", where["boxId"]).
+		Id("t1.account_id", where["accountId"]).
+		Id("t1.type", where["type"]).
+		Sort(where["sort"], orderSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(orderListCountSql, orderListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var orderSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"qty":     "t1.qty",
+}
+
+const orderListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    "order" AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+const orderListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.account_id,
+    t1.type,
+    t1.grid_id,
+    t1.material_id,
+    t1.sensor_id,
+    t1.channel,
+    t1.before_qty,
+    t1.qty,
+    t1.after_qty,
+    t1.status,
+    t1.updated,
+    t3.img
+FROM
+    "order" AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+// 格子库存
+func StockList(where map[string]interface{}, page, pageSize int) (int64, []*order.Stock, error) {
+	list := []*order.Stock{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t3.name", "t3.material_code").
+		Id("t2.box_id", where["boxId"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t3.category_id", where["categoryId"]).
+		Id("t1.material_id", where["materialId"]).
+		Sort(where["sort"], stockSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(stockListCountSql, stockListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var stockSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"qty":     "t1.qty",
+}
+
+const stockListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    stock AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+const stockListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.grid_id,
+    t1.sensor_id,
+    t1.material_id,
+    t1.qty,
+    t1.updated,
+    t3.img
+FROM
+    stock AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+// 物料库存,按柜子查询时只合计该柜子的格子
+func MaterialStockList(where map[string]interface{}, page, pageSize int) (int64, []*order.MaterialStock, error) {
+	list := []*order.MaterialStock{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t3.name", "t3.material_code").
+		Id("t2.box_id", where["boxId"]).
+		Id("t3.category_id", where["categoryId"]).
+		Id("t1.material_id", where["materialId"]).
+		Sort(nil, materialStockSorts, "materialId:asc")
+
+	total, err := f.Page(materialStockListCountSql, materialStockListSql, " GROUP BY t1.material_id", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+var materialStockSorts = map[string]string{
+	"materialId": "t1.material_id",
+}
+
+const materialStockListCountSql = `
+SELECT
+    COUNT(DISTINCT t1.material_id)
+FROM
+    stock AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+const materialStockListSql = `
+SELECT
+    t1.material_id,
+    SUM(t1.qty) AS qty,
+    MAX(t3.img) AS img
+FROM
+    stock AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+// 自动盘点
+func AutoList(where map[string]interface{}, page, pageSize int) (int64, []*order.Auto, error) {
+	list := []*order.Auto{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t3.name", "t3.material_code").
+		Id("t2.box_id", where["boxId"]).
+		Id("t1.account_id", where["accountId"]).
+		Sort(where["sort"], autoSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(autoListCountSql, autoListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var autoSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+}
+
+const autoListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    auto AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+const autoListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.account_id,
+    t1.grid_id,
+    t1.sensor_id,
+    t1.material_id,
+    t1.before_qty,
+    t1.qty,
+    t1.updated,
+    t3.img
+FROM
+    auto AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
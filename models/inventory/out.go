@@ -0,0 +1,63 @@
+package inventory
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/costcenter"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 领料订单,记账和替代记录随订单一起添加
+type Out struct {
+	Order *order.Order
+	// 未指定成本中心和工单时为nil
+	Charge *costcenter.Charge
+	// 未使用替代物料时为nil
+	Substitution *material.Substitution
+}
+
+// 添加领料订单和记账、替代记录
+func InsertOut(v *Out) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := RecordOut(o, v); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 在事务中添加领料订单和记账、替代记录
+func RecordOut(o orm.Ormer, v *Out) error {
+	if _, err := o.Insert(v.Order); err != nil {
+		return errors.As(err, v.Order.GridId)
+	}
+
+	if c := v.Charge; c != nil && (c.CostCenterId > 0 || c.WorkOrder != "") {
+		c.Created = v.Order.Created
+		c.OrderId = v.Order.Id
+		if _, err := o.Insert(c); err != nil {
+			return errors.As(err, v.Order.Id)
+		}
+	}
+
+	if s := v.Substitution; s != nil {
+		s.Created = v.Order.Created
+		s.OrderId = v.Order.Id
+		if _, err := o.Insert(s); err != nil {
+			return errors.As(err, v.Order.Id)
+		}
+	}
+
+	return nil
+}
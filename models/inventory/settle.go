@@ -0,0 +1,76 @@
+package inventory
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/cost"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 订单结算,订单、库存、台账和成本一起提交
+type Settlement struct {
+	Order *order.Order
+	// 结算前的库存,新上料为nil
+	Before *order.Stock
+	// 结算后的库存,领空删除格子库存时为nil
+	Stock *order.Stock
+	// 台账的原因、来源和操作人
+	Source *ledger.Movement
+	// 订单成本和标准成本、入库单价、供应商
+	Cost       *cost.OrderCost
+	Standard   float64
+	Receipt    float64
+	SupplierId int
+}
+
+// 结算订单
+func Settle(v *Settlement) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := settle(o, v); err != nil {
+		o.Rollback()
+		return errors.As(err, v.Order.Id)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func settle(o orm.Ormer, v *Settlement) error {
+	if _, err := o.Update(v.Order, "Updated", "BeforeQty", "Qty", "AfterQty"); err != nil {
+		return errors.As(err)
+	}
+
+	switch {
+	case v.Before == nil:
+		if err := ledger.AddStock(o, v.Stock, v.Source); err != nil {
+			return errors.As(err)
+		}
+
+	case v.Stock == nil:
+		if err := ledger.ClearGrid(o, v.Order.GridId, v.Source); err != nil {
+			return errors.As(err)
+		}
+
+	default:
+		if err := ledger.SetStock(o, v.Before, v.Stock, v.Source); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	if v.Cost != nil {
+		if err := cost.Record(o, v.Cost, v.Standard, v.Receipt, v.SupplierId, v.Order.Updated); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
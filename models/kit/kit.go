@@ -0,0 +1,440 @@
+package kit
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrKitNotFound     = errors.New("kit not found")
+	ErrKitAlreadyExist = errors.New("kit already exist")
+	ErrKitDisabled     = errors.New("kit disabled")
+	ErrItemIllegal     = errors.New("kit item is illegal")
+)
+
+// 套件,按物料清单一次领取多种物料
+type Kit struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 编号,唯一
+	Code string `orm:"column(code);unique" json:"code"`
+	// 名称
+	Name string `orm:"column(name)" json:"name"`
+	// 组ID,0所有组可领
+	GroupId int `orm:"column(group_id);default(0)" json:"groupId"`
+	// 备注
+	Remark string `orm:"column(remark);null" json:"remark"`
+	// 状态0停用1启用
+	Status int `orm:"column(status);default(1)" json:"status"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+
+	// 物料清单
+	Items []*Item `orm:"-" json:"items"`
+}
+
+func (t *Kit) TableName() string {
+	return "kit"
+}
+
+// 物料清单的一行
+type Item struct {
+	Id    int `orm:"column(id);auto;pk" json:"id"`
+	KitId int `orm:"column(kit_id)" json:"kitId"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 每套数量
+	Qty int `orm:"column(qty)" json:"qty"`
+
+	// 可替代的物料,按优先级排序
+	Substitutes []int `orm:"-" json:"substitutes"`
+}
+
+func (t *Item) TableName() string {
+	return "rel_kit_material"
+}
+
+// 清单行可替代的物料
+type Substitute struct {
+	Id     int `orm:"column(id);auto;pk" json:"id"`
+	KitId  int `orm:"column(kit_id)" json:"kitId"`
+	ItemId int `orm:"column(item_id)" json:"itemId"`
+	// 替代物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 优先级,小的优先
+	Sort int `orm:"column(sort);default(0)" json:"sort"`
+}
+
+func (t *Substitute) TableName() string {
+	return "rel_kit_substitute"
+}
+
+// 校验清单,物料不能重复,替代物料不能是清单行自身
+func CheckItems(items []*Item) error {
+	if len(items) == 0 {
+		return errors.As(ErrItemIllegal, "items is empty")
+	}
+
+	materials := make(map[int]bool)
+	for _, v := range items {
+		if v.MaterialId <= 0 || v.Qty <= 0 {
+			return errors.As(ErrItemIllegal, v.MaterialId, v.Qty)
+		}
+
+		if materials[v.MaterialId] {
+			return errors.As(ErrItemIllegal, "duplicate material", v.MaterialId)
+		}
+		materials[v.MaterialId] = true
+
+		subs := make(map[int]bool)
+		for _, id := range v.Substitutes {
+			if id <= 0 || id == v.MaterialId || subs[id] {
+				return errors.As(ErrItemIllegal, "substitute", v.MaterialId, id)
+			}
+			subs[id] = true
+		}
+	}
+
+	return nil
+}
+
+// 添加套件和清单
+func InsertKit(obj *Kit) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := insertItems(o, obj); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改套件,清单整体替换
+func UpdateKit(obj *Kit) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if _, err := o.Update(obj); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := delItems(o, obj.Id); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := insertItems(o, obj); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除套件和清单,领取记录保留
+func DelKit(id int) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := delItems(o, id); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if _, err := o.Delete(&Kit{Id: id}); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 在事务中添加清单和替代物料
+func insertItems(o orm.Ormer, obj *Kit) error {
+	for _, v := range obj.Items {
+		v.Id = 0
+		v.KitId = obj.Id
+		if _, err := o.Insert(v); err != nil {
+			return errors.As(err)
+		}
+
+		for i, id := range v.Substitutes {
+			if _, err := o.Insert(&Substitute{
+				KitId:      obj.Id,
+				ItemId:     v.Id,
+				MaterialId: id,
+				Sort:       i,
+			}); err != nil {
+				return errors.As(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 在事务中删除清单和替代物料
+func delItems(o orm.Ormer, kitId int) error {
+	if _, err := o.Raw(delSubstituteByKitSql, kitId).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	if _, err := o.Raw(delItemByKitSql, kitId).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const delSubstituteByKitSql = `
+DELETE FROM rel_kit_substitute WHERE kit_id = ?
+`
+
+const delItemByKitSql = `
+DELETE FROM rel_kit_material WHERE kit_id = ?
+`
+
+// 根据ID查询,包括清单
+func KitById(id int) (*Kit, error) {
+	o := orm.NewOrm()
+
+	obj := &Kit{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrKitNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	items, err := ItemList(id)
+	if err != nil {
+		return nil, errors.As(err, id)
+	}
+	obj.Items = items
+
+	return obj, nil
+}
+
+// 根据编号查询
+func KitByCode(code string) (*Kit, error) {
+	o := orm.NewOrm()
+
+	obj := &Kit{
+		Code: code,
+	}
+
+	if err := o.Read(obj, "Code"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrKitNotFound, code)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 套件的清单,包括替代物料
+func ItemList(kitId int) ([]*Item, error) {
+	o := orm.NewOrm()
+
+	items := []*Item{}
+	if _, err := o.Raw(itemListSql, kitId).QueryRows(&items); err != nil {
+		return nil, errors.As(err)
+	}
+
+	subs := []*Substitute{}
+	if _, err := o.Raw(substituteListSql, kitId).QueryRows(&subs); err != nil {
+		return nil, errors.As(err)
+	}
+
+	m := make(map[int]*Item)
+	for _, v := range items {
+		v.Substitutes = []int{}
+		m[v.Id] = v
+	}
+
+	for _, v := range subs {
+		if item, ok := m[v.ItemId]; ok {
+			item.Substitutes = append(item.Substitutes, v.MaterialId)
+		}
+	}
+
+	return items, nil
+}
+
+const itemListSql = `
+SELECT
+    t1.id,
+    t1.kit_id,
+    t1.material_id,
+    t1.qty
+FROM
+    rel_kit_material AS t1
+WHERE
+    t1.kit_id = ?
+ORDER BY
+    t1.id
+`
+
+const substituteListSql = `
+SELECT
+    t1.id,
+    t1.kit_id,
+    t1.item_id,
+    t1.material_id,
+    t1.sort
+FROM
+    rel_kit_substitute AS t1
+WHERE
+    t1.kit_id = ?
+ORDER BY
+    t1.item_id, t1.sort
+`
+
+// 查询所有,不包括清单
+func KitList(where map[string]interface{}, page, pageSize int) (int64, []*Kit, error) {
+	list := []*Kit{}
+
+	f := query.New().
+		Search(where["name"], "t1.code", "t1.name").
+		Id("t1.group_id", where["groupId"]).
+		Status("t1.status", where["status"]).
+		Sort(where["sort"], kitSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	// 包含某物料的套件
+	if materialId := query.Int(where["materialId"], 0); materialId > 0 {
+		f.Where("t1.id IN (SELECT kit_id FROM rel_kit_material WHERE material_id = ?)", materialId)
+	}
+
+	total, err := f.Page(kitListCountSql, kitListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var kitSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"name":    "t1.name",
+	"code":    "t1.code",
+	"status":  "t1.status",
+}
+
+const kitListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    kit AS t1
+WHERE
+`
+
+const kitListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.code,
+    t1.name,
+    t1.group_id,
+    t1.remark,
+    t1.status,
+    t1.updated,
+    t1.updated_by
+FROM
+    kit AS t1
+WHERE
+`
+
+// 可领取的格子库存
+type Source struct {
+	GridId     int `json:"gridId"`
+	MaterialId int `json:"materialId"`
+	Qty        int `json:"qty"`
+	// 柜子地址
+	Addr    int `json:"addr"`
+	Channel int `json:"channel"`
+}
+
+// 物料在启用的称重格子中的可领库存,多的优先
+// 放回格子待检验的回收不能领出
+func SourceList(materialId int) ([]*Source, error) {
+	o := orm.NewOrm()
+
+	list := []*Source{}
+	if _, err := o.Raw(sourceListSql, materialId).QueryRows(&list); err != nil {
+		return nil, errors.As(err, materialId)
+	}
+
+	return list, nil
+}
+
+const sourceListSql = `
+SELECT
+    t1.grid_id,
+    t1.material_id,
+    t1.qty - COALESCE(t4.qty, 0) AS qty,
+    t3.addr,
+    t2.channel
+FROM
+    stock AS t1
+INNER JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id AND t2.status = 1 AND t2.mode = 0
+INNER JOIN
+    box AS t3
+ON
+    t3.id = t2.box_id
+LEFT JOIN
+    (SELECT grid_id, material_id, SUM(qty) AS qty FROM return_inspection WHERE quarantine = 0 AND status = 0 GROUP BY grid_id, material_id) AS t4
+ON
+    t4.grid_id = t1.grid_id AND t4.material_id = t1.material_id
+WHERE
+    t1.material_id = ?
+AND
+    t1.qty - COALESCE(t4.qty, 0) > 0
+ORDER BY
+    t1.qty - COALESCE(t4.qty, 0) DESC, t1.grid_id
+`
@@ -0,0 +1,331 @@
+package kit
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/inventory"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrPickNotFound     = errors.New("kit pick not found")
+	ErrPickLineNotFound = errors.New("kit pick line not found")
+	ErrShortfall        = errors.New("kit stock is not enough")
+)
+
+// 领取状态
+const (
+	// 领取中,还有格子未结算
+	PICKING = iota
+	// 全部领取
+	DONE
+	// 领取完成但有缺料
+	SHORT
+)
+
+// 领取套件,每个格子一个领料订单
+type Pick struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 套件
+	KitId int `orm:"column(kit_id)" json:"kitId"`
+	// 领料人
+	AccountId int `orm:"column(account_id)" json:"accountId"`
+	// 套数
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 状态0领取中1完成2缺料
+	Status int `orm:"column(status);default(0)" json:"status"`
+	// 更新时间
+	Updated string `orm:"column(updated)" json:"updated"`
+
+	// 明细
+	Lines []*PickLine `orm:"-" json:"lines"`
+}
+
+func (t *Pick) TableName() string {
+	return "kit_pick"
+}
+
+// 领取明细,清单行在一个格子领取一行,同一格子的行共用订单,缺料单独一行
+type PickLine struct {
+	Id     int `orm:"column(id);auto;pk" json:"id"`
+	PickId int `orm:"column(pick_id)" json:"pickId"`
+	// 清单上的物料
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 实际领取的物料,替代时与清单不同
+	PickMaterialId int `orm:"column(pick_material_id);default(0)" json:"pickMaterialId"`
+	// 是否为替代物料0否1是
+	Substitute int `orm:"column(substitute);default(0)" json:"substitute"`
+	// 格子和领料订单,缺料行为0
+	GridId  int `orm:"column(grid_id);default(0)" json:"gridId"`
+	OrderId int `orm:"column(order_id);default(0)" json:"orderId"`
+	// 计划领取数量,为领取物料的数量
+	Qty int `orm:"column(qty);default(0)" json:"qty"`
+	// 折合清单物料的数量
+	LineQty int `orm:"column(line_qty);default(0)" json:"lineQty"`
+	// 称重结算的数量
+	PickedQty int `orm:"column(picked_qty);default(0)" json:"pickedQty"`
+	// 缺料数量,按清单物料计,包括库存不足和结算少于计划的
+	ShortfallQty int `orm:"column(shortfall_qty);default(0)" json:"shortfallQty"`
+	// 状态0待结算1已结算
+	Status int `orm:"column(status);default(0)" json:"status"`
+}
+
+func (t *PickLine) TableName() string {
+	return "kit_pick_line"
+}
+
+// 在一个事务中添加领料订单、记账、替代记录和领取记录
+// 每个格子一个订单,明细按格子关联订单,没有待结算的明细时直接完成
+func InsertPick(obj *Pick, outs []*inventory.Out) error {
+	obj.Status = pickStatus(obj.Lines)
+
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	orders := make(map[int]int)
+	for _, v := range outs {
+		if err := inventory.RecordOut(o, v); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+		orders[v.Order.GridId] = v.Order.Id
+	}
+
+	if _, err := o.Insert(obj); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	for _, v := range obj.Lines {
+		v.PickId = obj.Id
+		v.OrderId = orders[v.GridId]
+		if _, err := o.Insert(v); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据明细计算领取状态
+func pickStatus(lines []*PickLine) int {
+	status := DONE
+	for _, v := range lines {
+		if v.Status == 0 {
+			return PICKING
+		}
+
+		if v.ShortfallQty > 0 {
+			status = SHORT
+		}
+	}
+
+	return status
+}
+
+// 领料订单结算后更新明细,全部结算时更新领取状态
+// 共用订单的明细按顺序分摊结算数量,多领的记到最后一行
+// 订单不属于套件时返回ErrPickLineNotFound
+func SettleLine(orderId, qty int, updated string) (*Pick, error) {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	lines := []*PickLine{}
+	if _, err := o.Raw(pickLineByOrderSql, orderId).QueryRows(&lines); err != nil {
+		o.Rollback()
+		return nil, errors.As(err)
+	}
+
+	if len(lines) == 0 {
+		o.Rollback()
+		return nil, errors.As(ErrPickLineNotFound, orderId)
+	}
+
+	remain := qty
+	for i, line := range lines {
+		picked := remain
+		if picked > line.Qty && i < len(lines)-1 {
+			picked = line.Qty
+		}
+		remain -= picked
+
+		// 替代物料按比例折合,旧记录没有折合数量
+		shortfall := line.Qty - picked
+		if line.LineQty > 0 && line.Qty > 0 {
+			shortfall = line.LineQty - picked*line.LineQty/line.Qty
+		}
+
+		if shortfall < 0 {
+			shortfall = 0
+		}
+
+		// 只更新待结算的,防止重复结算
+		res, err := o.Raw(settleLineSql, picked, shortfall, line.Id).Exec()
+		if err != nil {
+			o.Rollback()
+			return nil, errors.As(err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			o.Rollback()
+			return nil, errors.As(err)
+		}
+
+		if n == 0 {
+			o.Rollback()
+			return nil, errors.As(ErrPickLineNotFound, orderId)
+		}
+	}
+
+	pickId := lines[0].PickId
+
+	lines = []*PickLine{}
+	if _, err := o.Raw(pickLineListSql, pickId).QueryRows(&lines); err != nil {
+		o.Rollback()
+		return nil, errors.As(err)
+	}
+
+	obj := &Pick{
+		Id: pickId,
+	}
+	if err := o.Read(obj); err != nil {
+		o.Rollback()
+		return nil, errors.As(err, pickId)
+	}
+
+	obj.Status = pickStatus(lines)
+	obj.Updated = updated
+	if _, err := o.Update(obj, "Status", "Updated"); err != nil {
+		o.Rollback()
+		return nil, errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	obj.Lines = lines
+	return obj, nil
+}
+
+const pickLineByOrderSql = `
+SELECT
+    t1.*
+FROM
+    kit_pick_line AS t1
+WHERE
+    t1.order_id = ?
+AND
+    t1.order_id > 0
+AND
+    t1.status = 0
+ORDER BY
+    t1.id
+`
+
+const settleLineSql = `
+UPDATE
+    kit_pick_line
+SET
+    picked_qty = ?,
+    shortfall_qty = ?,
+    status = 1
+WHERE
+    id = ?
+AND
+    status = 0
+`
+
+const pickLineListSql = `
+SELECT
+    t1.*
+FROM
+    kit_pick_line AS t1
+WHERE
+    t1.pick_id = ?
+ORDER BY
+    t1.id
+`
+
+// 根据ID查询,包括明细
+func PickById(id int) (*Pick, error) {
+	o := orm.NewOrm()
+
+	obj := &Pick{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrPickNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	lines := []*PickLine{}
+	if _, err := o.Raw(pickLineListSql, id).QueryRows(&lines); err != nil {
+		return nil, errors.As(err)
+	}
+	obj.Lines = lines
+
+	return obj, nil
+}
+
+// 查询所有,不包括明细
+func PickList(where map[string]interface{}, page, pageSize int) (int64, []*Pick, error) {
+	list := []*Pick{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.kit_id", where["kitId"]).
+		Id("t1.account_id", where["accountId"]).
+		Status("t1.status", where["status"]).
+		Search(where["name"], "t1.created_by").
+		Sort(where["sort"], pickSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(pickListCountSql, pickListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var pickSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+}
+
+const pickListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    kit_pick AS t1
+WHERE
+`
+
+const pickListSql = `
+SELECT
+    t1.*
+FROM
+    kit_pick AS t1
+WHERE
+`
@@ -0,0 +1,382 @@
+package ledger
+
+import (
+	"sort"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrMovementNotFound = errors.New("movement not found")
+	ErrReasonIllegal    = errors.New("movement reason is illegal")
+)
+
+// 变动原因
+const (
+	// 启用台账时的期初库存
+	OPENING = "opening"
+	// 订单结算
+	SETTLE = "settle"
+	// 盘点
+	STOCKTAKE = "stocktake"
+	// 手工调整
+	ADJUST = "adjust"
+	// 格子间调拨
+	TRANSFER = "transfer"
+	// 回收检验
+	INSPECT = "inspect"
+)
+
+var reasons = map[string]bool{
+	OPENING:   true,
+	SETTLE:    true,
+	STOCKTAKE: true,
+	ADJUST:    true,
+	TRANSFER:  true,
+	INSPECT:   true,
+}
+
+// 是否为已定义原因
+func ValidReason(reason string) bool {
+	return reasons[reason]
+}
+
+// 库存台账,只追加不修改
+// 格子物料的数量为所有变动之和
+type Movement struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	GridId  int    `orm:"column(grid_id)" json:"gridId"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 变动数量,增加为正,减少为负
+	Qty int `orm:"column(qty)" json:"qty"`
+	// 变动后数量
+	BalanceQty int `orm:"column(balance_qty)" json:"balanceQty"`
+	// 原因
+	Reason string `orm:"column(reason)" json:"reason"`
+	// 来源单据类型 order/auto/rfid_session/...
+	RefType string `orm:"column(ref_type)" json:"refType"`
+	// 来源单据ID
+	RefId int `orm:"column(ref_id)" json:"refId"`
+	// 操作人类型 account/user/system
+	ActorType string `orm:"column(actor_type)" json:"actorType"`
+	// 操作人ID
+	ActorId int `orm:"column(actor_id)" json:"actorId"`
+	// 备注
+	Note string `orm:"column(note);null" json:"note"`
+}
+
+func (t *Movement) TableName() string {
+	return "stock_movement"
+}
+
+// 在事务中按库存变化记台账,src为原因、来源和操作人
+// 物料变化时按先出后入记录,数量没有变化时不记录
+func Record(o orm.Ormer, src *Movement, before, after *order.Stock) error {
+	if !ValidReason(src.Reason) {
+		return errors.As(ErrReasonIllegal, src.Reason)
+	}
+
+	if before != nil && after != nil && before.MaterialId != after.MaterialId {
+		if err := record(o, src, before, nil); err != nil {
+			return errors.As(err)
+		}
+
+		return record(o, src, nil, after)
+	}
+
+	return record(o, src, before, after)
+}
+
+// 变动后数量为格子物料上一条台账加上变动数量
+func record(o orm.Ormer, src *Movement, before, after *order.Stock) error {
+	var beforeQty, afterQty int
+	var stock *order.Stock
+	if before != nil {
+		beforeQty = before.Qty
+		stock = before
+	}
+	if after != nil {
+		afterQty = after.Qty
+		stock = after
+	}
+
+	if stock == nil || beforeQty == afterQty {
+		return nil
+	}
+
+	var balance int
+	if err := o.Raw(lastBalanceSql, stock.GridId, stock.MaterialId).QueryRow(&balance); err != nil && err != orm.ErrNoRows {
+		return errors.As(err, stock.GridId, stock.MaterialId)
+	}
+
+	obj := *src
+	obj.Id = 0
+	if len(obj.Created) == 0 {
+		obj.Created = timex.String()
+	}
+	obj.GridId = stock.GridId
+	obj.MaterialId = stock.MaterialId
+	obj.Qty = afterQty - beforeQty
+	obj.BalanceQty = balance + obj.Qty
+
+	if _, err := o.Insert(&obj); err != nil {
+		return errors.As(err, stock.GridId, stock.MaterialId)
+	}
+
+	return nil
+}
+
+const lastBalanceSql = `
+SELECT
+    t1.balance_qty
+FROM
+    stock_movement AS t1
+WHERE
+    t1.grid_id = ?
+AND
+    t1.material_id = ?
+ORDER BY t1.id DESC
+LIMIT 1
+`
+
+// 根据ID查询
+func MovementById(id int) (*Movement, error) {
+	o := orm.NewOrm()
+
+	obj := &Movement{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrMovementNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func MovementList(where map[string]interface{}, page, pageSize int) (int64, []*Movement, error) {
+	list := []*Movement{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t2.box_id", where["boxId"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.material_id", where["materialId"]).
+		Equal("t1.reason", where["reason"]).
+		Equal("t1.ref_type", where["refType"]).
+		Id("t1.ref_id", where["refId"]).
+		Sort(where["sort"], movementSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(movementListCountSql, movementListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var movementSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"qty":     "t1.qty",
+}
+
+const movementListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    stock_movement AS t1
+INNER JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+WHERE
+`
+
+const movementListSql = `
+SELECT
+    t1.*
+FROM
+    stock_movement AS t1
+INNER JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+WHERE
+`
+
+// 格子物料在某一时刻的数量
+type Balance struct {
+	BoxId        int    `json:"boxId"`
+	GridId       int    `json:"gridId"`
+	MaterialId   int    `json:"materialId"`
+	MaterialCode string `json:"materialCode"`
+	Name         string `json:"name"`
+	Qty          int    `json:"qty"`
+	// 最后一次变动
+	LastMovementId int    `json:"lastMovementId"`
+	LastMoved      string `json:"lastMoved"`
+}
+
+// 按台账计算at时刻(含)每个格子物料的数量,at为空时为当前数量
+// 不返回数量为0的格子物料
+func BalanceList(where map[string]interface{}, at string) ([]*Balance, error) {
+	list := []*Balance{}
+
+	f := query.New().
+		Id("t2.box_id", where["boxId"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.material_id", where["materialId"])
+
+	if len(at) > 0 {
+		f.Where("t1.created <= ?", at)
+	}
+
+	if err := f.All(balanceListSql, balanceGroupBy, &list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const balanceListSql = `
+SELECT
+    t2.box_id,
+    t1.grid_id,
+    t1.material_id,
+    COALESCE(t3.material_code, '') AS material_code,
+    COALESCE(t3.name, '') AS name,
+    SUM(t1.qty) AS qty,
+    MAX(t1.id) AS last_movement_id,
+    MAX(t1.created) AS last_moved
+FROM
+    stock_movement AS t1
+INNER JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t3
+ON
+    t3.id = t1.material_id
+WHERE
+`
+
+const balanceGroupBy = `
+GROUP BY t2.box_id, t1.grid_id, t1.material_id, t3.material_code, t3.name
+HAVING SUM(t1.qty) <> 0
+ORDER BY t1.grid_id, t1.material_id
+`
+
+// 格子物料的当前台账数量
+func BalanceQty(gridId, materialId int) (int, error) {
+	o := orm.NewOrm()
+
+	var qty int
+	if err := o.Raw(balanceQtySql, gridId, materialId).QueryRow(&qty); err != nil {
+		return 0, errors.As(err, gridId, materialId)
+	}
+
+	return qty, nil
+}
+
+const balanceQtySql = `
+SELECT
+    COALESCE(SUM(t1.qty), 0)
+FROM
+    stock_movement AS t1
+WHERE
+    t1.grid_id = ?
+AND
+    t1.material_id = ?
+`
+
+// 库存和台账不一致的格子物料
+type Mismatch struct {
+	GridId     int `json:"gridId"`
+	MaterialId int `json:"materialId"`
+	// 库存表数量
+	StockQty int `json:"stockQty"`
+	// 台账数量
+	LedgerQty int `json:"ledgerQty"`
+}
+
+// 用台账校验当前库存
+func Verify() ([]*Mismatch, error) {
+	o := orm.NewOrm()
+
+	stocks := []*Mismatch{}
+	if _, err := o.Raw(verifyStockSql).QueryRows(&stocks); err != nil {
+		return nil, errors.As(err)
+	}
+
+	ledgers := []*Mismatch{}
+	if _, err := o.Raw(verifyLedgerSql).QueryRows(&ledgers); err != nil {
+		return nil, errors.As(err)
+	}
+
+	m := make(map[[2]int]*Mismatch)
+	for _, v := range stocks {
+		m[[2]int{v.GridId, v.MaterialId}] = v
+	}
+
+	// 台账有数量但库存表已删除的也返回
+	for _, v := range ledgers {
+		key := [2]int{v.GridId, v.MaterialId}
+		if s, ok := m[key]; ok {
+			s.LedgerQty = v.LedgerQty
+		} else {
+			m[key] = v
+		}
+	}
+
+	list := make([]*Mismatch, 0)
+	for _, v := range m {
+		if v.StockQty != v.LedgerQty {
+			list = append(list, v)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].GridId != list[j].GridId {
+			return list[i].GridId < list[j].GridId
+		}
+
+		return list[i].MaterialId < list[j].MaterialId
+	})
+
+	return list, nil
+}
+
+const verifyStockSql = `
+SELECT
+    t1.grid_id,
+    t1.material_id,
+    SUM(t1.qty) AS stock_qty
+FROM
+    stock AS t1
+GROUP BY t1.grid_id, t1.material_id
+`
+
+const verifyLedgerSql = `
+SELECT
+    t1.grid_id,
+    t1.material_id,
+    SUM(t1.qty) AS ledger_qty
+FROM
+    stock_movement AS t1
+GROUP BY t1.grid_id, t1.material_id
+`
@@ -0,0 +1,129 @@
+package ledger
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 添加库存,在同一事务中记台账
+func InsertStock(stock *order.Stock, src *Movement) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := AddStock(o, stock, src); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 更新库存数量,在同一事务中记台账
+func UpdateStock(before, stock *order.Stock, src *Movement) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := SetStock(o, before, stock, src); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除格子的所有库存,在同一事务中记台账
+func DelStockByGridId(gridId int, src *Movement) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := ClearGrid(o, gridId, src); err != nil {
+		o.Rollback()
+		return errors.As(err)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 在事务中添加库存并记台账
+func AddStock(o orm.Ormer, stock *order.Stock, src *Movement) error {
+	if _, err := o.Insert(stock); err != nil {
+		return errors.As(err, stock.GridId)
+	}
+
+	return Record(o, src, nil, stock)
+}
+
+// 在事务中更新库存数量并记台账
+func SetStock(o orm.Ormer, before, stock *order.Stock, src *Movement) error {
+	if _, err := o.Raw(updateStockSql, stock.Qty, stock.Updated, stock.Id).Exec(); err != nil {
+		return errors.As(err, stock.Id)
+	}
+
+	return Record(o, src, before, stock)
+}
+
+// 在事务中删除格子的所有库存并记台账
+func ClearGrid(o orm.Ormer, gridId int, src *Movement) error {
+	list := []*order.Stock{}
+	if _, err := o.Raw(gridStockSql, gridId).QueryRows(&list); err != nil {
+		return errors.As(err, gridId)
+	}
+
+	if _, err := o.Raw(delGridStockSql, gridId).Exec(); err != nil {
+		return errors.As(err, gridId)
+	}
+
+	for _, v := range list {
+		if err := Record(o, src, v, nil); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
+
+const updateStockSql = `
+UPDATE stock SET qty = ?, updated = ? WHERE id = ?
+`
+
+const gridStockSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.grid_id,
+    t1.sensor_id,
+    t1.material_id,
+    t1.qty,
+    t1.updated
+FROM
+    stock AS t1
+WHERE
+    t1.grid_id = ?
+ORDER BY t1.id
+`
+
+const delGridStockSql = `
+DELETE FROM stock WHERE grid_id = ?
+`
@@ -1,10 +1,9 @@
 package material
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -35,6 +34,8 @@ type Material struct {
 	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
 	// 图片地址
 	Img string `orm:"column(img)" json:"img"`
+	// 单价,用于库存金额
+	Price float64 `orm:"column(price);default(0)" json:"price"`
 
 	// other
 	SupplierName string `json:"supplierName"`
@@ -123,51 +124,33 @@ func MaterialByName(name string) (*Material, error) {
 
 // 查询所有
 func MaterialList(where map[string]interface{}, page, pageSize int) (int64, []*Material, error) {
-	o := orm.NewOrm()
-
 	list := []*Material{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.category_id", where["categoryId"]).
+		Search(where["name"], "t1.name", "t1.material_code", "t1.material_spec").
+		Sort(where["sort"], materialSorts, "id:asc").
+		Cursor(where["cursor"])
 
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		categoryId := where["categoryId"]
-		if categoryId.(int) > 0 {
-			sql += " AND t1.category_id = " + fmt.Sprintf("%d", categoryId) + " "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%'"
-			sql += " OR t1.material_code LIKE '%" + fmt.Sprintf("%s", name) + "%'"
-			sql += " OR t1.material_spec LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(materialListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(materialListSql+sql+" GROUP BY t1.id ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(materialListCountSql, materialListSql, " GROUP BY t1.id, t2.id, t3.id", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var materialSorts = map[string]string{
+	"id":           "t1.id",
+	"created":      "t1.created",
+	"updated":      "t1.updated",
+	"name":         "t1.name",
+	"materialCode": "t1.material_code",
+	"status":       "t1.status",
+}
+
 const materialListCountSql = `
 SELECT
     COUNT(*)
@@ -191,6 +174,7 @@ SELECT
     t1.updated,
     t1.updated_by,
     t1.img,
+    t1.price,
     t2.short_name AS supplier_name,
     t3.name AS category_name,
     SUM(t4.qty) AS qty
@@ -213,51 +197,33 @@ WHERE
 
 // 查询所有
 func SupplierMaterialList(where map[string]interface{}, page, pageSize int) (int64, []*Material, error) {
-	o := orm.NewOrm()
-
 	list := []*Material{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		categoryId := where["categoryId"]
-		if categoryId.(int) > 0 {
-			sql += " AND t1.category_id = " + fmt.Sprintf("%d", categoryId) + " "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%'"
-			sql += " OR t1.material_code LIKE '%" + fmt.Sprintf("%s", name) + "%'"
-			sql += " OR t1.material_spec LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(supplierMaterialListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.category_id", where["categoryId"]).
+		Search(where["name"], "t1.name", "t1.material_code", "t1.material_spec").
+		Sort(where["sort"], supplierMaterialSorts, "id:asc").
+		Cursor(where["cursor"])
 
-	// 查询所有
-	if _, err := o.Raw(supplierMaterialListSql+sql+" GROUP BY t1.id ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(supplierMaterialListCountSql, supplierMaterialListSql, " GROUP BY t1.id, t2.id", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var supplierMaterialSorts = map[string]string{
+	"id":           "t1.id",
+	"created":      "t1.created",
+	"updated":      "t1.updated",
+	"name":         "t1.name",
+	"materialCode": "t1.material_code",
+	"status":       "t1.status",
+}
+
 const supplierMaterialListCountSql = `
 SELECT
     COUNT(*)
@@ -281,6 +247,7 @@ SELECT
     t1.updated,
     t1.updated_by,
     t1.img,
+    t1.price,
     t2.short_name AS supplier_name
 FROM
     material AS t1
@@ -0,0 +1,127 @@
+package material
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/fusion"
+)
+
+var (
+	ErrFusionNotFound = errors.New("material fusion not found")
+	ErrFusionIllegal  = errors.New("material fusion illegal")
+)
+
+// 物料多传感器融合规则
+type Fusion struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id);unique" json:"materialId"`
+	// 主传感器类型
+	Primary string `orm:"column(primary_kind)" json:"primary"`
+	// 校验传感器类型,为空不校验
+	Check string `orm:"column(check_kind)" json:"check"`
+	// 允许相差数量
+	Tolerance int `orm:"column(tolerance)" json:"tolerance"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+}
+
+func (t *Fusion) TableName() string {
+	return "rel_material_fusion"
+}
+
+// 默认只用称重
+var DefaultFusion = &Fusion{
+	Primary: fusion.WEIGHT,
+}
+
+func (t *Fusion) Rule() *fusion.Rule {
+	return &fusion.Rule{
+		Primary:   t.Primary,
+		Check:     t.Check,
+		Tolerance: t.Tolerance,
+	}
+}
+
+// 校验传感器类型
+func (t *Fusion) Valid() error {
+	kinds := map[string]bool{
+		fusion.WEIGHT:     true,
+		fusion.ULTRASONIC: true,
+		fusion.IMAGE:      true,
+		fusion.RFID:       true,
+	}
+
+	if !kinds[t.Primary] {
+		return errors.As(ErrFusionIllegal, t.Primary)
+	}
+
+	if len(t.Check) > 0 && (!kinds[t.Check] || t.Check == t.Primary) {
+		return errors.As(ErrFusionIllegal, t.Check)
+	}
+
+	if t.Tolerance < 0 {
+		return errors.As(ErrFusionIllegal, t.Tolerance)
+	}
+
+	return nil
+}
+
+// 添加
+func InsertFusion(obj *Fusion) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateFusion(obj *Fusion) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除
+func DelFusion(id int) error {
+	o := orm.NewOrm()
+
+	obj := &Fusion{
+		Id: id,
+	}
+
+	if _, err := o.Delete(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据物料查询
+func FusionByMaterialId(materialId int) (*Fusion, error) {
+	o := orm.NewOrm()
+
+	obj := &Fusion{
+		MaterialId: materialId,
+	}
+
+	if err := o.Read(obj, "MaterialId"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrFusionNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
@@ -1,10 +1,9 @@
 package material
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -12,6 +11,15 @@ var (
 	ErrMaterialRfidAlreadyExist = errors.New("material rfid already exist")
 )
 
+const (
+	// 未入库
+	RFID_NEW = iota
+	// 在柜
+	RFID_IN
+	// 已取出
+	RFID_OUT
+)
+
 type MaterialRfidObj struct {
 	*MaterialRfid
 	Rfids []string `json:"rfids"`
@@ -30,6 +38,12 @@ type MaterialRfid struct {
 	// 更新时间
 	Updated   string `orm:"column(updated)" json:"updated"`
 	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+	// 标签位置0未入库1在柜2已取出
+	State int `orm:"column(state);default(0)" json:"state"`
+	// 所在格子
+	GridId int `orm:"column(grid_id);default(0)" json:"gridId"`
+	// 最后操作用户
+	AccountId int `orm:"column(account_id);default(0)" json:"accountId"`
 }
 
 func (t *MaterialRfid) TableName() string {
@@ -149,44 +163,36 @@ WHERE
 
 // 查询所有
 func MaterialRfidList(where map[string]interface{}, page, pageSize int) (int64, []*MaterialRfid, error) {
-	o := orm.NewOrm()
-
 	list := []*MaterialRfid{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		materialId := where["materialId"]
-		if materialId.(int) > 0 {
-			sql += " AND t1.material_id = " + fmt.Sprintf("%d", materialId) + " "
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(materialRfidListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(materialRfidListSql+sql+" GROUP BY t1.id ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.material_id", where["materialId"]).
+		Id("t1.grid_id", where["gridId"]).
+		Status("t1.state", where["state"]).
+		Search(where["rfid"], "t1.rfid").
+		Sort(where["sort"], materialRfidSorts, "id:asc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(materialRfidListCountSql, materialRfidListSql, " GROUP BY t1.id", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var materialRfidSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"updated":    "t1.updated",
+	"materialId": "t1.material_id",
+	"gridId":     "t1.grid_id",
+	"accountId":  "t1.account_id",
+	"status":     "t1.status",
+}
+
 const materialRfidListCountSql = `
 SELECT
     COUNT(*)
@@ -204,8 +210,150 @@ SELECT
     t1.rfid,
     t1.status,
     t1.updated,
-    t1.updated_by
+    t1.updated_by,
+    t1.state,
+    t1.grid_id,
+    t1.account_id
+FROM
+    rel_material_rfid AS t1
+WHERE
+`
+
+// 根据Rfid查询绑定关系
+func MaterialRfidByRfid(rfid string) (*MaterialRfid, error) {
+	o := orm.NewOrm()
+
+	obj := &MaterialRfid{
+		Rfid: rfid,
+	}
+
+	if err := o.Read(obj, "Rfid"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrMaterialRfidNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 批量绑定,已绑定的标签返回错误
+func InsertMaterialRfids(list []*MaterialRfid) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	for _, v := range list {
+		exist := &MaterialRfid{
+			Rfid: v.Rfid,
+		}
+
+		if err := o.Read(exist, "Rfid"); err == nil {
+			o.Rollback()
+			return errors.As(ErrMaterialRfidAlreadyExist, v.Rfid)
+		} else if err != orm.ErrNoRows {
+			o.Rollback()
+			return errors.As(err)
+		}
+
+		if _, err := o.Insert(v); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 格子内的标签
+func RfidByGridId(gridId int) ([]*MaterialRfid, error) {
+	o := orm.NewOrm()
+
+	list := []*MaterialRfid{}
+
+	if _, err := o.Raw(rfidByGridIdSql, gridId, RFID_IN).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const rfidByGridIdSql = `
+SELECT
+    *
+FROM
+    rel_material_rfid AS t1
+WHERE
+    t1.grid_id = ?
+AND
+    t1.state = ?
+`
+
+// 修改标签位置
+func UpdateRfidState(obj *MaterialRfid) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj, "State", "GridId", "AccountId", "Updated", "UpdatedBy"); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 标签库存
+type RfidStock struct {
+	GridId       int    `json:"gridId"`
+	MaterialId   int    `json:"materialId"`
+	MaterialCode string `json:"materialCode"`
+	MaterialName string `json:"materialName"`
+	Qty          int    `json:"qty"`
+}
+
+// 按格子和物料统计在柜标签数量
+func RfidStockList(gridId, materialId int) ([]*RfidStock, error) {
+	o := orm.NewOrm()
+
+	list := []*RfidStock{}
+
+	sql := " t1.state = ? "
+	args := []interface{}{RFID_IN}
+
+	if gridId > 0 {
+		sql += " AND t1.grid_id = ? "
+		args = append(args, gridId)
+	}
+
+	if materialId > 0 {
+		sql += " AND t1.material_id = ? "
+		args = append(args, materialId)
+	}
+
+	if _, err := o.Raw(rfidStockListSql+sql+" GROUP BY t1.grid_id, t1.material_id, t2.material_code, t2.name ORDER BY t1.grid_id, t1.material_id", args...).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const rfidStockListSql = `
+SELECT
+    t1.grid_id,
+    t1.material_id,
+    t2.material_code,
+    t2.name AS material_name,
+    COUNT(t1.id) AS qty
 FROM
     rel_material_rfid AS t1
+LEFT JOIN
+    material AS t2
+ON
+    t1.material_id = t2.id
 WHERE
 `
@@ -2,10 +2,10 @@ package material
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -146,54 +146,41 @@ func SensorByMaterialId(materialId, sensorId int) (*Sensor, error) {
 
 // 查询所有
 func SensorList(where map[string]interface{}, page, pageSize int) (int64, []*Sensor, error) {
-	o := orm.NewOrm()
-
 	list := []*Sensor{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
-
-		materialId := where["materialId"]
-		if materialId.(int) > 0 {
-			sql += " AND t1.material_id = " + fmt.Sprintf("%d", materialId) + " "
-		}
-
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t2.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.material_id", where["materialId"]).
+		Search(where["name"], "t2.name").
+		Sort(where["sort"], sensorSorts, "id:asc").
+		Cursor(where["cursor"])
 
-	// 查询总数
-	var total int64
-	if err := o.Raw(sensorListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(sensorListSql+sql+" ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(sensorListCountSql, sensorListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var sensorSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"updated":    "t1.updated",
+	"materialId": "t1.material_id",
+	"status":     "t1.status",
+}
+
 const sensorListCountSql = `
 SELECT
     COUNT(*)
 FROM
     rel_material_sensor AS t1
+INNER JOIN
+    sensor AS t2
+ON
+    t1.sensor_id = t2.id
 WHERE
 `
 
@@ -0,0 +1,316 @@
+package material
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/bom"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrSubstituteNotFound     = errors.New("material substitute not found")
+	ErrSubstituteAlreadyExist = errors.New("material substitute already exist")
+	ErrSubstituteIllegal      = errors.New("material substitute is illegal")
+)
+
+// 替代物料,物料库存不足时可领取替代物料
+// 互为替代的等价物料为两条记录
+type Substitute struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 物料ID
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 替代物料ID
+	SubstituteId int `orm:"column(substitute_id)" json:"substituteId"`
+	// 优先级,小的优先
+	Priority int `orm:"column(priority);default(0)" json:"priority"`
+	// 替代1个物料需要的替代物料数量
+	Ratio float64 `orm:"column(ratio);default(1)" json:"ratio"`
+	// 库存不足时是否自动使用0否1是
+	Auto int `orm:"column(auto);default(0)" json:"auto"`
+	// 状态0停用1启用
+	Status int `orm:"column(status);default(1)" json:"status"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+
+	// other
+	SubstituteName string `json:"substituteName"`
+	// 替代物料库存
+	Qty int `json:"qty"`
+	// 折合物料的数量
+	EquivalentQty int `orm:"-" json:"equivalentQty"`
+}
+
+func (t *Substitute) TableName() string {
+	return "rel_material_substitute"
+}
+
+// 校验替代关系
+func CheckSubstitute(obj *Substitute) error {
+	if obj.MaterialId <= 0 || obj.SubstituteId <= 0 || obj.MaterialId == obj.SubstituteId {
+		return errors.As(ErrSubstituteIllegal, obj.MaterialId, obj.SubstituteId)
+	}
+
+	if obj.Ratio < 0 {
+		return errors.As(ErrSubstituteIllegal, "ratio", obj.Ratio)
+	}
+
+	if obj.Ratio == 0 {
+		obj.Ratio = 1
+	}
+
+	return nil
+}
+
+// 添加,多条时在一个事务中
+func InsertSubstitute(list ...*Substitute) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	for _, v := range list {
+		if _, err := o.Insert(v); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateSubstitute(obj *Substitute) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除
+func DelSubstitute(id int) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Delete(&Substitute{Id: id}); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func SubstituteById(id int) (*Substitute, error) {
+	o := orm.NewOrm()
+
+	obj := &Substitute{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSubstituteNotFound, id)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 根据物料和替代物料查询
+func SubstituteBy(materialId, substituteId int) (*Substitute, error) {
+	o := orm.NewOrm()
+
+	obj := &Substitute{
+		MaterialId:   materialId,
+		SubstituteId: substituteId,
+	}
+
+	if err := o.Read(obj, "MaterialId", "SubstituteId"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSubstituteNotFound, materialId, substituteId)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func SubstituteList(where map[string]interface{}, page, pageSize int) (int64, []*Substitute, error) {
+	list := []*Substitute{}
+
+	f := query.New().
+		Id("t1.material_id", where["materialId"]).
+		Id("t1.substitute_id", where["substituteId"]).
+		Status("t1.status", where["status"]).
+		Search(where["name"], "t2.name").
+		Sort(where["sort"], substituteSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(substituteListCountSql, substituteListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var substituteSorts = map[string]string{
+	"id":       "t1.id",
+	"created":  "t1.created",
+	"priority": "t1.priority",
+}
+
+const substituteListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    rel_material_substitute AS t1
+LEFT JOIN
+    material AS t2
+ON
+    t2.id = t1.substitute_id
+WHERE
+`
+
+const substituteListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.material_id,
+    t1.substitute_id,
+    t1.priority,
+    t1.ratio,
+    t1.auto,
+    t1.status,
+    t1.updated,
+    t1.updated_by,
+    t2.name AS substitute_name
+FROM
+    rel_material_substitute AS t1
+LEFT JOIN
+    material AS t2
+ON
+    t2.id = t1.substitute_id
+WHERE
+`
+
+// 物料启用的替代物料和库存,按优先级排序
+func Substitutes(materialId int) ([]*Substitute, error) {
+	o := orm.NewOrm()
+
+	list := []*Substitute{}
+	if _, err := o.Raw(substitutesSql, materialId).QueryRows(&list); err != nil {
+		return nil, errors.As(err, materialId)
+	}
+
+	for _, v := range list {
+		v.EquivalentQty = bom.Equivalent(v.Qty, v.Ratio)
+	}
+
+	return list, nil
+}
+
+const substitutesSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.created_by,
+    t1.material_id,
+    t1.substitute_id,
+    t1.priority,
+    t1.ratio,
+    t1.auto,
+    t1.status,
+    t1.updated,
+    t1.updated_by,
+    t2.name AS substitute_name,
+    (SELECT COALESCE(SUM(t3.qty), 0) FROM stock AS t3 WHERE t3.material_id = t1.substitute_id)
+    - (SELECT COALESCE(SUM(t4.qty), 0) FROM return_inspection AS t4 WHERE t4.material_id = t1.substitute_id AND t4.quarantine = 0 AND t4.status = 0) AS qty
+FROM
+    rel_material_substitute AS t1
+LEFT JOIN
+    material AS t2
+ON
+    t2.id = t1.substitute_id
+WHERE
+    t1.material_id = ?
+AND
+    t1.status = 1
+ORDER BY
+    t1.priority, t1.id
+`
+
+// 多个物料的替代物料折合数量
+func SubstituteQtys(materialIds []int) (map[int]int, error) {
+	m := make(map[int]int)
+	if len(materialIds) == 0 {
+		return m, nil
+	}
+
+	f := query.New().
+		In("t1.material_id", materialIds)
+
+	list := []*Substitute{}
+	if err := f.All(substitutesQtySql, "", &list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	for _, v := range list {
+		m[v.MaterialId] += bom.Equivalent(v.Qty, v.Ratio)
+	}
+
+	return m, nil
+}
+
+const substitutesQtySql = `
+SELECT
+    t1.id,
+    t1.material_id,
+    t1.substitute_id,
+    t1.ratio,
+    (SELECT COALESCE(SUM(t3.qty), 0) FROM stock AS t3 WHERE t3.material_id = t1.substitute_id)
+    - (SELECT COALESCE(SUM(t4.qty), 0) FROM return_inspection AS t4 WHERE t4.material_id = t1.substitute_id AND t4.quarantine = 0 AND t4.status = 0) AS qty
+FROM
+    rel_material_substitute AS t1
+WHERE
+    t1.status = 1
+AND
+`
+
+// 物料在所有格子的可领库存
+// 放回物料格子待检验的回收已计库存,不能领出
+func StockQty(materialId int) (int, error) {
+	o := orm.NewOrm()
+
+	var qty int
+	if err := o.Raw(stockQtySql, materialId, materialId).QueryRow(&qty); err != nil {
+		return 0, errors.As(err, materialId)
+	}
+
+	return qty, nil
+}
+
+const stockQtySql = `
+SELECT
+    COALESCE(SUM(t1.qty), 0)
+    - (SELECT COALESCE(SUM(t2.qty), 0) FROM return_inspection AS t2 WHERE t2.material_id = ? AND t2.quarantine = 0 AND t2.status = 0)
+FROM
+    stock AS t1
+WHERE
+    t1.material_id = ?
+`
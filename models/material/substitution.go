@@ -0,0 +1,108 @@
+package material
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrSubstitutionNotFound = errors.New("order substitution not found")
+)
+
+// 领料订单使用了替代物料,订单上为替代物料和数量
+type Substitution struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 领料订单
+	OrderId   int `orm:"column(order_id);unique" json:"orderId"`
+	AccountId int `orm:"column(account_id)" json:"accountId"`
+	// 申请的物料和数量
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	Qty        int `orm:"column(qty)" json:"qty"`
+	// 领取的替代物料和数量
+	SubstituteId  int     `orm:"column(substitute_id)" json:"substituteId"`
+	SubstituteQty int     `orm:"column(substitute_qty)" json:"substituteQty"`
+	Ratio         float64 `orm:"column(ratio);default(1)" json:"ratio"`
+	// 是否自动替代0用户选择1自动
+	Auto int `orm:"column(auto);default(0)" json:"auto"`
+	// 来源,stock领料,kit套件
+	Source string `orm:"column(source)" json:"source"`
+}
+
+func (t *Substitution) TableName() string {
+	return "order_substitution"
+}
+
+// 添加
+func InsertSubstitution(obj *Substitution) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据订单查询
+func SubstitutionByOrderId(orderId int) (*Substitution, error) {
+	o := orm.NewOrm()
+
+	obj := &Substitution{
+		OrderId: orderId,
+	}
+
+	if err := o.Read(obj, "OrderId"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSubstitutionNotFound, orderId)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 查询所有
+func SubstitutionList(where map[string]interface{}, page, pageSize int) (int64, []*Substitution, error) {
+	list := []*Substitution{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.material_id", where["materialId"]).
+		Id("t1.substitute_id", where["substituteId"]).
+		Id("t1.account_id", where["accountId"]).
+		Equal("t1.source", where["source"]).
+		Sort(where["sort"], substitutionSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(substitutionListCountSql, substitutionListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var substitutionSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+}
+
+const substitutionListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    order_substitution AS t1
+WHERE
+`
+
+const substitutionListSql = `
+SELECT
+    t1.*
+FROM
+    order_substitution AS t1
+WHERE
+`
@@ -1,10 +1,9 @@
 package material
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -48,6 +47,8 @@ type Supplier struct {
 	District string `orm:"column(district)" json:"district"`
 	// 详细地址
 	Address string `orm:"column(address)" json:"address"`
+	// 交货期(天)
+	LeadTime int `orm:"column(lead_time);default(0)" json:"leadTime"`
 	// 状态0停用1启用
 	Status int `orm:"column(status);default(1)" json:"status"`
 	// 更新时间
@@ -136,45 +137,31 @@ func SupplierByName(name string) (*Supplier, error) {
 
 // 查询所有
 func SupplierList(where map[string]interface{}, page, pageSize int) (int64, []*Supplier, error) {
-	o := orm.NewOrm()
-
 	list := []*Supplier{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t1.short_name", "t1.long_name").
+		Sort(where["sort"], supplierSorts, "id:asc").
+		Cursor(where["cursor"])
 
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.short_name LIKE '%" + fmt.Sprintf("%s", name) + "%'"
-			sql += " OR t1.long_name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(supplierListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(supplierListSql+sql+" GROUP BY t1.id ORDER BY t1.id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(supplierListCountSql, supplierListSql, " GROUP BY t1.id", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var supplierSorts = map[string]string{
+	"id":        "t1.id",
+	"created":   "t1.created",
+	"updated":   "t1.updated",
+	"shortName": "t1.short_name",
+	"status":    "t1.status",
+}
+
 const supplierListCountSql = `
 SELECT
     COUNT(*)
@@ -204,6 +191,7 @@ SELECT
     t1.city,
     t1.district,
     t1.address,
+    t1.lead_time,
     t1.status,
     t1.updated,
     t1.updated_by
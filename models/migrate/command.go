@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+const usage = `usage: %s migrate <command>
+
+commands:
+    up [version]    migrate to version, default latest
+    down [steps]    rollback steps, default 1
+    status          show all migrations
+`
+
+// 命令行第一个参数为migrate
+func IsCommand() bool {
+	return len(os.Args) > 1 && os.Args[1] == "migrate"
+}
+
+// 执行migrate命令,args为migrate之后的参数
+func RunCommand(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintf(w, usage, os.Args[0])
+		return nil
+	}
+
+	m, err := New()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	// 可选的数字参数
+	n := 0
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			return errors.New("migrate argument is illegal").As(args[1])
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up(n)
+		for _, v := range done {
+			fmt.Fprintf(w, "up   %4d %s\n", v.Version, v.Name)
+		}
+		if err != nil {
+			return errors.As(err)
+		}
+
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+
+		done, err := m.Down(n)
+		for _, v := range done {
+			fmt.Fprintf(w, "down %4d %s\n", v.Version, v.Name)
+		}
+		if err != nil {
+			return errors.As(err)
+		}
+
+	case "status":
+		list, err := m.Status()
+		if err != nil {
+			return errors.As(err)
+		}
+
+		for _, v := range list {
+			status := "pending"
+			if v.Applied {
+				status = v.AppliedAt
+			}
+			fmt.Fprintf(w, "%4d %-32s %s\n", v.Version, v.Name, status)
+		}
+
+	default:
+		fmt.Fprintf(w, usage, os.Args[0])
+		return errors.New("migrate command is illegal").As(args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beego/ms304w-client/basis/dialect"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/migrate"
+)
+
+// 表,sql中的%s为自增主键类型
+type table struct {
+	name string
+	sql  string
+}
+
+// 已有表上添加的列
+type column struct {
+	table string
+	name  string
+	def   string
+}
+
+// 索引
+type index struct {
+	name    string
+	table   string
+	columns []string
+}
+
+// 建表,已存在时跳过
+func createTables(ex migrate.Execer, list []*table) error {
+	pk := dialect.AutoPk(ex.Driver())
+
+	for _, v := range list {
+		sql := v.sql
+		if strings.Contains(sql, "%s") {
+			sql = fmt.Sprintf(sql, pk)
+		}
+
+		if err := ex.Exec(sql); err != nil {
+			return errors.As(err, v.name)
+		}
+	}
+
+	return nil
+}
+
+// 按建表的相反顺序删表
+func dropTables(ex migrate.Execer, list []*table) error {
+	for i := len(list) - 1; i >= 0; i-- {
+		if err := ex.Exec(dialect.DropTable(list[i].name)); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
+
+// 查询列是否存在
+func columnExists(ex migrate.Execer, v *column) (bool, error) {
+	count, err := ex.Count(dialect.ColumnExistsSql(ex.Driver()), v.table, v.name)
+	if err != nil {
+		return false, errors.As(err, v.table, v.name)
+	}
+
+	return count > 0, nil
+}
+
+// 添加列,已存在时跳过
+func addColumns(ex migrate.Execer, list []*column) error {
+	for _, v := range list {
+		exists, err := columnExists(ex, v)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		if exists {
+			continue
+		}
+
+		if err := ex.Exec(dialect.AddColumn(v.table, v.name, v.def)); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
+
+// 删除列,不存在时跳过
+// sqlite低于3.35时不能删除列,直接返回错误,不改动表
+func dropColumns(ex migrate.Execer, list []*column) error {
+	checked := false
+	for i := len(list) - 1; i >= 0; i-- {
+		v := list[i]
+
+		exists, err := columnExists(ex, v)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		if !exists {
+			continue
+		}
+
+		if !checked {
+			if err := checkDropColumn(ex); err != nil {
+				return errors.As(err, v.table, v.name)
+			}
+			checked = true
+		}
+
+		if err := ex.Exec(dialect.DropColumn(v.table, v.name)); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
+
+// 检查数据库是否支持删除列
+func checkDropColumn(ex migrate.Execer) error {
+	if ex.Driver() != dialect.SQLITE {
+		return nil
+	}
+
+	version, err := ex.Count(dialect.SqliteVersionSql)
+	if err != nil {
+		return errors.As(err)
+	}
+
+	if err := dialect.CheckDropColumn(ex.Driver(), version); err != nil {
+		return errors.As(err, version)
+	}
+
+	return nil
+}
+
+// mysql查询索引是否存在,其他数据库用IF EXISTS
+func indexExists(ex migrate.Execer, v *index) (bool, error) {
+	if ex.Driver() != dialect.MYSQL {
+		return false, nil
+	}
+
+	count, err := ex.Count(dialect.IndexExistsSql, v.table, v.name)
+	if err != nil {
+		return false, errors.As(err, v.name)
+	}
+
+	return count > 0, nil
+}
+
+// 添加索引,已存在时跳过
+func createIndexes(ex migrate.Execer, list []*index) error {
+	d := ex.Driver()
+
+	for _, v := range list {
+		exists, err := indexExists(ex, v)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		if exists {
+			continue
+		}
+
+		if err := ex.Exec(dialect.CreateIndex(d, v.name, v.table, v.columns...)); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
+
+// 删除索引,不存在时跳过
+func dropIndexes(ex migrate.Execer, list []*index) error {
+	d := ex.Driver()
+
+	for _, v := range list {
+		if d == dialect.MYSQL {
+			exists, err := indexExists(ex, v)
+			if err != nil {
+				return errors.As(err)
+			}
+
+			if !exists {
+				continue
+			}
+		}
+
+		if err := ex.Exec(dialect.DropIndex(d, v.name, v.table)); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
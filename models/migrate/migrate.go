@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/dialect"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/migrate"
+	"github.com/beego/ms304w-client/basis/timex"
+)
+
+// 已执行的版本
+type Version struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied string `json:"applied"`
+}
+
+// 版本记录在schema_version表
+type store struct{}
+
+func (s *store) Init() error {
+	o := orm.NewOrm()
+
+	if _, err := o.Raw(versionTableSql).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func (s *store) Applied() (map[int]string, error) {
+	o := orm.NewOrm()
+
+	list := []*Version{}
+	if _, err := o.Raw(versionListSql).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	applied := make(map[int]string, len(list))
+	for _, v := range list {
+		applied[v.Version] = v.Applied
+	}
+
+	return applied, nil
+}
+
+func (s *store) Apply(m *migrate.Migration, up bool) error {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	ex := &execer{o: o}
+
+	if up {
+		if err := m.Up(ex); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+
+		if _, err := o.Raw(insertVersionSql, m.Version, m.Name, timex.String()).Exec(); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+	} else {
+		if err := m.Down(ex); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+
+		if _, err := o.Raw(deleteVersionSql, m.Version).Exec(); err != nil {
+			o.Rollback()
+			return errors.As(err)
+		}
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 在迁移的事务中执行
+type execer struct {
+	o orm.Ormer
+}
+
+func (e *execer) Driver() string {
+	switch e.o.Driver().Type() {
+	case orm.DRMySQL:
+		return dialect.MYSQL
+	case orm.DRPostgres:
+		return dialect.POSTGRES
+	}
+
+	return dialect.SQLITE
+}
+
+func (e *execer) Exec(sql string, args ...interface{}) error {
+	if _, err := e.o.Raw(sql, args...).Exec(); err != nil {
+		return errors.As(err, sql)
+	}
+
+	return nil
+}
+
+func (e *execer) Count(sql string, args ...interface{}) (int, error) {
+	var count int
+	if err := e.o.Raw(sql, args...).QueryRow(&count); err != nil {
+		return 0, errors.As(err, sql)
+	}
+
+	return count, nil
+}
+
+func New() (*migrate.Migrator, error) {
+	m, err := migrate.New(&store{}, migrations...)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	return m, nil
+}
+
+// 执行到最新版本
+func Migrate() ([]*migrate.Migration, error) {
+	m, err := New()
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	done, err := m.Up(0)
+	if err != nil {
+		return done, errors.As(err)
+	}
+
+	return done, nil
+}
+
+const versionTableSql = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    applied VARCHAR(32) NOT NULL DEFAULT ''
+)
+`
+
+const versionListSql = `
+SELECT
+    version,
+    name,
+    applied
+FROM
+    schema_version
+ORDER BY
+    version
+`
+
+const insertVersionSql = `
+INSERT INTO schema_version (version, name, applied) VALUES (?, ?, ?)
+`
+
+const deleteVersionSql = `
+DELETE FROM schema_version WHERE version = ?
+`
@@ -0,0 +1,534 @@
+package migrate
+
+import (
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/basis/migrate"
+	"github.com/beego/ms304w-client/basis/timex"
+	"github.com/beego/ms304w-client/models/adjust"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 所有迁移,版本号递增,已发布的迁移不能修改
+// 表结构的修正也要添加新版本,不能改之前的版本
+// 每个版本只执行固定的DDL,结构体的修改都要添加迁移
+// 已有的库可能由beego建过表,迁移要能重复执行
+// mysql的DDL会隐式提交,失败后修复再执行即可
+var migrations = []*migrate.Migration{
+	{
+		Version: 1,
+		Name:    "init",
+		Up:      initUp,
+		Down:    initDown,
+	},
+	{
+		Version: 2,
+		Name:    "stock_ledger",
+		Up:      ledgerUp,
+		Down:    ledgerDown,
+	},
+	{
+		Version: 3,
+		Name:    "stock_adjust",
+		Up:      adjustUp,
+		Down:    adjustDown,
+	},
+	{
+		Version: 4,
+		Name:    "return_inspection",
+		Up:      inspectionUp,
+		Down:    inspectionDown,
+	},
+	{
+		Version: 5,
+		Name:    "kit",
+		Up:      kitUp,
+		Down:    kitDown,
+	},
+	{
+		Version: 6,
+		Name:    "material_substitute",
+		Up:      substituteUp,
+		Down:    substituteDown,
+	},
+	{
+		Version: 7,
+		Name:    "adjust_order",
+		Up:      adjustOrderUp,
+		Down:    adjustOrderDown,
+	},
+	{
+		Version: 8,
+		Name:    "card_upper",
+		Up:      cardUpperUp,
+		Down:    cardUpperDown,
+	},
+	{
+		Version: 9,
+		Name:    "adjust_order_type",
+		Up:      adjustOrderTypeUp,
+		Down:    adjustOrderTypeDown,
+	},
+	{
+		Version: 10,
+		Name:    "account_finger",
+		Up:      accountFingerUp,
+		Down:    accountFingerDown,
+	},
+	{
+		Version: 11,
+		Name:    "order_rfid_detail",
+		Up:      orderTablesUp,
+		Down:    orderTablesDown,
+	},
+}
+
+// 建表并添加列表查询用的索引
+// 已有的库只补充缺少的表和列
+func initUp(ex migrate.Execer) error {
+	if err := createTables(ex, baseTables); err != nil {
+		return errors.As(err)
+	}
+
+	if err := addColumns(ex, initColumns); err != nil {
+		return errors.As(err)
+	}
+
+	if err := createTables(ex, initTables); err != nil {
+		return errors.As(err)
+	}
+
+	if err := createIndexes(ex, initIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func initDown(ex migrate.Execer) error {
+	if err := dropIndexes(ex, initIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := dropTables(ex, initTables); err != nil {
+		return errors.As(err)
+	}
+
+	if err := dropTables(ex, baseTables); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 初始版本之前已发布的表
+var baseTables = []*table{
+	{"account", accountTableSql},
+	{"group", groupTableSql},
+	{"rel_account_group", relAccountGroupTableSql},
+	{"material", materialTableSql},
+	{"rel_group_material", relGroupMaterialTableSql},
+	{"rel_material_category", relMaterialCategoryTableSql},
+	{"rel_material_sensor", relMaterialSensorTableSql},
+	{"rel_material_rfid", relMaterialRfidTableSql},
+	{"supplier", supplierTableSql},
+	{"box", boxTableSql},
+	{"rel_box_grid", relBoxGridTableSql},
+	{"rel_grid_channel", relGridChannelTableSql},
+	{"rel_account_grid", relAccountGridTableSql},
+	{"rel_grid_correct", relGridCorrectTableSql},
+	{"sensor", sensorTableSql},
+	{"order", orderTableSql},
+	{"stock", stockTableSql},
+	{"auto", autoTableSql},
+	{"auto_conf", autoConfTableSql},
+	{"user", userTableSql},
+	{"role", roleTableSql},
+	{"permission", permissionTableSql},
+	{"rel_user_role", relUserRoleTableSql},
+	{"rel_role_permission", relRolePermissionTableSql},
+}
+
+// 之前的表上后来添加的列
+var initColumns = []*column{
+	{"material", "price", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"rel_material_rfid", "state", "INTEGER NOT NULL DEFAULT 0"},
+	{"rel_material_rfid", "grid_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"rel_material_rfid", "account_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"supplier", "lead_time", "INTEGER NOT NULL DEFAULT 0"},
+	{"box", "url", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{"box", "port", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{"rel_box_grid", "reorder_qty", "INTEGER NOT NULL DEFAULT 0"},
+	{"rel_box_grid", "mode", "INTEGER NOT NULL DEFAULT 0"},
+	{"rel_grid_channel", "kind", "VARCHAR(255) NOT NULL DEFAULT 'weight'"},
+}
+
+var initTables = []*table{
+	{"finger_enroll", fingerEnrollTableSql},
+	{"rel_material_fusion", relMaterialFusionTableSql},
+	{"audit", auditTableSql},
+	{"rfid_session", rfidSessionTableSql},
+	{"rfid_record", rfidRecordTableSql},
+	{"fusion_settle", fusionSettleTableSql},
+	{"webhook", webhookTableSql},
+	{"webhook_delivery", webhookDeliveryTableSql},
+	{"webhook_attempt", webhookAttemptTableSql},
+	{"sync_outbox", syncOutboxTableSql},
+	{"sync_conflict", syncConflictTableSql},
+	{"sync_state", syncStateTableSql},
+	{"material_supplier_cost", materialSupplierCostTableSql},
+	{"material_average_cost", materialAverageCostTableSql},
+	{"cost_layer", costLayerTableSql},
+	{"order_cost", orderCostTableSql},
+	{"cost_center", costCenterTableSql},
+	{"rel_cost_center", relCostCenterTableSql},
+	{"work_order", workOrderTableSql},
+	{"order_charge", orderChargeTableSql},
+}
+
+// 前面的同beego的index标签,名称为表名_列名
+var initIndexes = []*index{
+	{"webhook_delivery_webhook_id", "webhook_delivery", []string{"webhook_id"}},
+	{"webhook_delivery_status", "webhook_delivery", []string{"status"}},
+	{"webhook_delivery_next_attempt", "webhook_delivery", []string{"next_attempt"}},
+	{"webhook_attempt_delivery_id", "webhook_attempt", []string{"delivery_id"}},
+	{"sync_outbox_entity", "sync_outbox", []string{"entity"}},
+	{"sync_outbox_status", "sync_outbox", []string{"status"}},
+	{"material_supplier_cost_material_id", "material_supplier_cost", []string{"material_id"}},
+	{"cost_layer_material_id", "cost_layer", []string{"material_id"}},
+	{"order_cost_order_id", "order_cost", []string{"order_id"}},
+	{"idx_stock_grid_material", "stock", []string{"grid_id", "material_id"}},
+	{"idx_stock_material", "stock", []string{"material_id"}},
+	{"idx_order_account_created", "order", []string{"account_id", "created"}},
+	{"idx_order_created", "order", []string{"created"}},
+}
+
+// 建台账表,当前库存记为期初
+// 已有变动的格子物料不再记期初
+func ledgerUp(ex migrate.Execer) error {
+	if err := createTables(ex, ledgerTables); err != nil {
+		return errors.As(err)
+	}
+
+	if err := createIndexes(ex, ledgerIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := ex.Exec(openingSql, timex.String(), ledger.OPENING); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func ledgerDown(ex migrate.Execer) error {
+	if err := dropIndexes(ex, ledgerIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := dropTables(ex, ledgerTables); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+var ledgerTables = []*table{
+	{"stock_movement", stockMovementTableSql},
+}
+
+var ledgerIndexes = []*index{
+	{"idx_stock_movement_grid_material", "stock_movement", []string{"grid_id", "material_id", "created"}},
+	{"idx_stock_movement_material", "stock_movement", []string{"material_id", "created"}},
+	{"idx_stock_movement_ref", "stock_movement", []string{"ref_type", "ref_id"}},
+}
+
+const openingSql = `
+INSERT INTO stock_movement (created, grid_id, material_id, qty, balance_qty, reason, ref_type, ref_id, actor_type, actor_id, note)
+SELECT
+    ?,
+    t1.grid_id,
+    t1.material_id,
+    t1.qty,
+    t1.qty,
+    ?,
+    'stock',
+    t1.id,
+    'system',
+    0,
+    ''
+FROM
+    stock AS t1
+WHERE
+    t1.qty <> 0
+AND NOT EXISTS (
+    SELECT
+        1
+    FROM
+        stock_movement AS t2
+    WHERE
+        t2.grid_id = t1.grid_id
+    AND
+        t2.material_id = t1.material_id
+)
+`
+
+// 建手工调整和调拨表
+func adjustUp(ex migrate.Execer) error {
+	return upTables(ex, adjustTables, adjustIndexes)
+}
+
+func adjustDown(ex migrate.Execer) error {
+	return downTables(ex, adjustTables, adjustIndexes)
+}
+
+var adjustTables = []*table{
+	{"stock_adjustment", stockAdjustmentTableSql},
+	{"stock_transfer", stockTransferTableSql},
+}
+
+var adjustIndexes = []*index{
+	{"idx_stock_adjustment_grid", "stock_adjustment", []string{"grid_id", "created"}},
+	{"idx_stock_transfer_from", "stock_transfer", []string{"from_grid_id", "created"}},
+	{"idx_stock_transfer_to", "stock_transfer", []string{"to_grid_id", "created"}},
+}
+
+// 建回收检验表
+func inspectionUp(ex migrate.Execer) error {
+	return upTables(ex, inspectionTables, inspectionIndexes)
+}
+
+func inspectionDown(ex migrate.Execer) error {
+	return downTables(ex, inspectionTables, inspectionIndexes)
+}
+
+var inspectionTables = []*table{
+	{"return_inspection", returnInspectionTableSql},
+}
+
+var inspectionIndexes = []*index{
+	{"idx_return_inspection_status", "return_inspection", []string{"status", "created"}},
+}
+
+// 建套件和领取表
+func kitUp(ex migrate.Execer) error {
+	return upTables(ex, kitTables, kitIndexes)
+}
+
+func kitDown(ex migrate.Execer) error {
+	return downTables(ex, kitTables, kitIndexes)
+}
+
+var kitTables = []*table{
+	{"kit", kitTableSql},
+	{"rel_kit_material", relKitMaterialTableSql},
+	{"rel_kit_substitute", relKitSubstituteTableSql},
+	{"kit_pick", kitPickTableSql},
+	{"kit_pick_line", kitPickLineTableSql},
+}
+
+var kitIndexes = []*index{
+	{"idx_rel_kit_material_kit", "rel_kit_material", []string{"kit_id"}},
+	{"idx_rel_kit_substitute_kit", "rel_kit_substitute", []string{"kit_id"}},
+	{"idx_kit_pick_line_pick", "kit_pick_line", []string{"pick_id"}},
+	{"idx_kit_pick_line_order", "kit_pick_line", []string{"order_id"}},
+}
+
+// 建替代物料表,领取明细补充折合数量
+func substituteUp(ex migrate.Execer) error {
+	if err := addColumns(ex, substituteColumns); err != nil {
+		return errors.As(err)
+	}
+
+	return upTables(ex, substituteTables, substituteIndexes)
+}
+
+func substituteDown(ex migrate.Execer) error {
+	if err := downTables(ex, substituteTables, substituteIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := dropColumns(ex, substituteColumns); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+var substituteTables = []*table{
+	{"rel_material_substitute", relMaterialSubstituteTableSql},
+	{"order_substitution", orderSubstitutionTableSql},
+}
+
+var substituteColumns = []*column{
+	{"kit_pick_line", "line_qty", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+var substituteIndexes = []*index{
+	{"idx_rel_material_substitute_material", "rel_material_substitute", []string{"material_id", "priority"}},
+	{"idx_order_substitution_created", "order_substitution", []string{"created"}},
+}
+
+// 调整和调拨记入订单历史,记录对应的订单
+func adjustOrderUp(ex migrate.Execer) error {
+	return addColumns(ex, adjustOrderColumns)
+}
+
+func adjustOrderDown(ex migrate.Execer) error {
+	return dropColumns(ex, adjustOrderColumns)
+}
+
+var adjustOrderColumns = []*column{
+	{"stock_adjustment", "order_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"stock_transfer", "from_order_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"stock_transfer", "to_order_id", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// 已绑定的卡号改为大写,同account.CardNo
+func cardUpperUp(ex migrate.Execer) error {
+	if err := ex.Exec(cardUpperSql); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 原来的大小写无法还原,保持大写
+func cardUpperDown(ex migrate.Execer) error {
+	return nil
+}
+
+const cardUpperSql = `
+UPDATE "account" SET "card" = UPPER(TRIM("card")) WHERE "card" <> UPPER(TRIM("card"))
+`
+
+// 调整和调拨的订单改为单独的类型,数量为变化数量
+func adjustOrderTypeUp(ex migrate.Execer) error {
+	if err := ex.Exec(adjustOrderTypeSql, adjust.ORDER_ADJUST); err != nil {
+		return errors.As(err)
+	}
+
+	if err := ex.Exec(transferOrderTypeSql, adjust.ORDER_TRANSFER); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func adjustOrderTypeDown(ex migrate.Execer) error {
+	if err := ex.Exec(orderTypeDownSql, order.IN, order.OUT, adjust.ORDER_ADJUST, adjust.ORDER_TRANSFER); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const adjustOrderTypeSql = `
+UPDATE "order" SET "type" = ?, "qty" = "after_qty" - "before_qty"
+WHERE "id" IN (SELECT "order_id" FROM "stock_adjustment")
+`
+
+const transferOrderTypeSql = `
+UPDATE "order" SET "type" = ?, "qty" = "after_qty" - "before_qty"
+WHERE "id" IN (SELECT "from_order_id" FROM "stock_transfer") OR "id" IN (SELECT "to_order_id" FROM "stock_transfer")
+`
+
+const orderTypeDownSql = `
+UPDATE "order" SET "type" = CASE WHEN "qty" >= 0 THEN ? ELSE ? END, "qty" = ABS("qty")
+WHERE "type" IN (?, ?)
+`
+
+// 指纹按柜子记录
+// 旧版本的模板ID不知道在哪个柜子录入,记到默认服务和每个柜子,同之前的查询结果
+func accountFingerUp(ex migrate.Execer) error {
+	if err := addColumns(ex, accountFingerColumns); err != nil {
+		return errors.As(err)
+	}
+
+	if err := upTables(ex, accountFingerTables, accountFingerIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := ex.Exec(accountFingerSql); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func accountFingerDown(ex migrate.Execer) error {
+	if err := downTables(ex, accountFingerTables, accountFingerIndexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := dropColumns(ex, accountFingerColumns); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+var accountFingerTables = []*table{
+	{"account_finger", accountFingerTableSql},
+}
+
+var accountFingerColumns = []*column{
+	{"finger_enroll", "box_id", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+var accountFingerIndexes = []*index{
+	{"idx_account_finger_account", "account_finger", []string{"account_id"}},
+}
+
+const accountFingerSql = `
+INSERT INTO "account_finger" ("created", "account_id", "box_id", "finger")
+SELECT t1."updated", t1."id", t2."addr", t1."finger"
+FROM "account" AS t1, (SELECT 0 AS "addr" UNION SELECT "addr" FROM "box") AS t2
+WHERE t1."finger" > 0 AND t1."id" NOT IN (SELECT "account_id" FROM "account_finger")
+`
+
+// 补充已注册但初始版本没有建的订单标签和明细表
+// 之前由beego建过表的库跳过
+func orderTablesUp(ex migrate.Execer) error {
+	return upTables(ex, orderTables, orderIndexes)
+}
+
+func orderTablesDown(ex migrate.Execer) error {
+	return downTables(ex, orderTables, orderIndexes)
+}
+
+var orderTables = []*table{
+	{"order_rfid", orderRfidTableSql},
+	{"detail", detailTableSql},
+}
+
+var orderIndexes = []*index{
+	{"idx_order_rfid_order", "order_rfid", []string{"order_id"}},
+	{"idx_detail_order", "detail", []string{"order_id"}},
+}
+
+// 建表和索引
+func upTables(ex migrate.Execer, tables []*table, indexes []*index) error {
+	if err := createTables(ex, tables); err != nil {
+		return errors.As(err)
+	}
+
+	if err := createIndexes(ex, indexes); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除索引和表
+func downTables(ex migrate.Execer, tables []*table, indexes []*index) error {
+	if err := dropIndexes(ex, indexes); err != nil {
+		return errors.As(err)
+	}
+
+	if err := dropTables(ex, tables); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
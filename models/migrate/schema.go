@@ -0,0 +1,872 @@
+package migrate
+
+// 各版本建表语句,已发布后不能修改,结构变化要添加新的迁移
+// 列和约束同beego orm的RunSyncdb,%s为自增主键类型
+// 表名和列名都用双引号,mysql连接开启了ANSI_QUOTES
+
+// 初始版本之前已发布的表,按当时的结构
+// 已有库中这些表由beego建立,只补充后来添加的列
+
+const accountTableSql = `
+CREATE TABLE IF NOT EXISTS "account" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "username" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "role" VARCHAR(255) NOT NULL DEFAULT '',
+    "card" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "password" VARCHAR(255) NOT NULL DEFAULT '',
+    "finger" INTEGER NOT NULL DEFAULT 0 UNIQUE,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "token" VARCHAR(255) NOT NULL DEFAULT '',
+    "group_id" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const groupTableSql = `
+CREATE TABLE IF NOT EXISTS "group" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relAccountGroupTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_account_group" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "group_id" INTEGER NOT NULL DEFAULT 0,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const materialTableSql = `
+CREATE TABLE IF NOT EXISTS "material" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "category_id" INTEGER NOT NULL DEFAULT 0,
+    "material_code" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_spec" VARCHAR(255) NOT NULL DEFAULT '',
+    "supplier_id" INTEGER NOT NULL DEFAULT 0,
+    "supplier_qty" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "img" VARCHAR(255) NOT NULL DEFAULT '',
+    "supplier_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "category_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "qty" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const relGroupMaterialTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_group_material" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "group_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relMaterialCategoryTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_material_category" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "parent_id" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relMaterialSensorTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_material_sensor" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "sensor_id" INTEGER NOT NULL DEFAULT 0,
+    "params" VARCHAR(255) NOT NULL DEFAULT '',
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "sensor_name" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relMaterialRfidTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_material_rfid" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "rfid" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const supplierTableSql = `
+CREATE TABLE IF NOT EXISTS "supplier" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "short_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "long_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "english_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "legal_person" VARCHAR(255) NOT NULL DEFAULT '',
+    "enterprise_code" VARCHAR(255) NOT NULL DEFAULT '',
+    "contactor" VARCHAR(255) NOT NULL DEFAULT '',
+    "mobile" VARCHAR(255) NOT NULL DEFAULT '',
+    "telephone" VARCHAR(255) NOT NULL DEFAULT '',
+    "postcode" VARCHAR(255) NOT NULL DEFAULT '',
+    "fax" VARCHAR(255) NOT NULL DEFAULT '',
+    "email" VARCHAR(255) NOT NULL DEFAULT '',
+    "website" VARCHAR(255) NOT NULL DEFAULT '',
+    "province" VARCHAR(255) NOT NULL DEFAULT '',
+    "city" VARCHAR(255) NOT NULL DEFAULT '',
+    "district" VARCHAR(255) NOT NULL DEFAULT '',
+    "address" VARCHAR(255) NOT NULL DEFAULT '',
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const boxTableSql = `
+CREATE TABLE IF NOT EXISTS "box" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "addr" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relBoxGridTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_box_grid" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "box_id" INTEGER NOT NULL DEFAULT 0,
+    "channel" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "code" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "type" INTEGER NOT NULL DEFAULT 0,
+    "safe_qty" INTEGER NOT NULL DEFAULT 0,
+    "addr" INTEGER NOT NULL DEFAULT 0,
+    "sensor_name_list" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_grid_id" INTEGER NOT NULL DEFAULT 0,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "account_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "category_id" INTEGER NOT NULL DEFAULT 0,
+    "material_code" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "total_qty" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const relGridChannelTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_grid_channel" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "sensor_id" INTEGER NOT NULL DEFAULT 0,
+    "channel" INTEGER NOT NULL DEFAULT 0,
+    "height" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "sensor_name" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relAccountGridTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_account_grid" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "box_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "grid_name" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relGridCorrectTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_grid_correct" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "weight" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "grid_name" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+// sensor和order包的表按树中查询用到的列
+// 订单RFID和明细的表没有查询,不在这里建
+const sensorTableSql = `
+CREATE TABLE IF NOT EXISTS "sensor" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "type" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const orderTableSql = `
+CREATE TABLE IF NOT EXISTS "order" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "type" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "sensor_id" INTEGER NOT NULL DEFAULT 0,
+    "channel" INTEGER NOT NULL DEFAULT 0,
+    "before_qty" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "after_qty" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const stockTableSql = `
+CREATE TABLE IF NOT EXISTS "stock" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "sensor_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const autoTableSql = `
+CREATE TABLE IF NOT EXISTS "auto" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "sensor_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "before_qty" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const autoConfTableSql = `
+CREATE TABLE IF NOT EXISTS "auto_conf" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "hour" INTEGER NOT NULL DEFAULT 0,
+    "minute" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const userTableSql = `
+CREATE TABLE IF NOT EXISTS "user" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "username" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "password" VARCHAR(255) NOT NULL DEFAULT '',
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "token" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const roleTableSql = `
+CREATE TABLE IF NOT EXISTS "role" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const permissionTableSql = `
+CREATE TABLE IF NOT EXISTS "permission" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "parent_id" INTEGER NOT NULL DEFAULT 0,
+    "tag" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "label" VARCHAR(255) NOT NULL DEFAULT '',
+    "path" VARCHAR(255) NOT NULL DEFAULT '',
+    "icon" VARCHAR(255) NOT NULL DEFAULT '',
+    "level" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relUserRoleTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_user_role" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "user_id" INTEGER NOT NULL DEFAULT 0,
+    "role_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relRolePermissionTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_role_permission" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "role_id" INTEGER NOT NULL DEFAULT 0,
+    "permission_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+// 初始版本新增的表
+
+const fingerEnrollTableSql = `
+CREATE TABLE IF NOT EXISTS "finger_enroll" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "finger" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relMaterialFusionTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_material_fusion" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0 UNIQUE,
+    "primary_kind" VARCHAR(255) NOT NULL DEFAULT '',
+    "check_kind" VARCHAR(255) NOT NULL DEFAULT '',
+    "tolerance" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const auditTableSql = `
+CREATE TABLE IF NOT EXISTS "audit" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "actor_type" VARCHAR(255) NOT NULL DEFAULT '',
+    "actor_id" INTEGER NOT NULL DEFAULT 0,
+    "actor_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "method" VARCHAR(255) NOT NULL DEFAULT '',
+    "route" VARCHAR(255) NOT NULL DEFAULT '',
+    "action" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity_type" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity_id" INTEGER NOT NULL DEFAULT 0,
+    "before_data" TEXT NOT NULL,
+    "after_data" TEXT NOT NULL,
+    "diff" TEXT NOT NULL,
+    "prev_hash" VARCHAR(255) NOT NULL DEFAULT '',
+    "hash" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE
+)
+`
+
+const rfidSessionTableSql = `
+CREATE TABLE IF NOT EXISTS "rfid_session" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "before_tags" TEXT NOT NULL,
+    "after_tags" TEXT NOT NULL,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const rfidRecordTableSql = `
+CREATE TABLE IF NOT EXISTS "rfid_record" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "session_id" INTEGER NOT NULL DEFAULT 0,
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "rfid" VARCHAR(255) NOT NULL DEFAULT '',
+    "type" INTEGER NOT NULL DEFAULT 0,
+    "account_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_name" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const fusionSettleTableSql = `
+CREATE TABLE IF NOT EXISTS "fusion_settle" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "source" VARCHAR(255) NOT NULL DEFAULT '',
+    "disagree" INTEGER NOT NULL DEFAULT 0,
+    "readings" TEXT NOT NULL,
+    "rule" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const webhookTableSql = `
+CREATE TABLE IF NOT EXISTS "webhook" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "url" VARCHAR(255) NOT NULL DEFAULT '',
+    "events" VARCHAR(255) NOT NULL DEFAULT '',
+    "secret" VARCHAR(255) NOT NULL DEFAULT '',
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const webhookDeliveryTableSql = `
+CREATE TABLE IF NOT EXISTS "webhook_delivery" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "webhook_id" INTEGER NOT NULL DEFAULT 0,
+    "topic" VARCHAR(255) NOT NULL DEFAULT '',
+    "payload" TEXT NOT NULL,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "next_attempt" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const webhookAttemptTableSql = `
+CREATE TABLE IF NOT EXISTS "webhook_attempt" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "delivery_id" INTEGER NOT NULL DEFAULT 0,
+    "webhook_id" INTEGER NOT NULL DEFAULT 0,
+    "attempt" INTEGER NOT NULL DEFAULT 0,
+    "status_code" INTEGER NOT NULL DEFAULT 0,
+    "response" TEXT NOT NULL,
+    "err" VARCHAR(255) NOT NULL DEFAULT '',
+    "duration" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const syncOutboxTableSql = `
+CREATE TABLE IF NOT EXISTS "sync_outbox" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity_id" INTEGER NOT NULL DEFAULT 0,
+    "action" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity_updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "payload" TEXT NOT NULL,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "err" VARCHAR(255) NOT NULL DEFAULT '',
+    "sent" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const syncConflictTableSql = `
+CREATE TABLE IF NOT EXISTS "sync_conflict" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity" VARCHAR(255) NOT NULL DEFAULT '',
+    "entity_id" INTEGER NOT NULL DEFAULT 0,
+    "local" TEXT NOT NULL,
+    "remote" TEXT NOT NULL,
+    "resolution" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const syncStateTableSql = `
+CREATE TABLE IF NOT EXISTS "sync_state" (
+    "name" VARCHAR(255) NOT NULL PRIMARY KEY,
+    "value" TEXT NOT NULL,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const materialSupplierCostTableSql = `
+CREATE TABLE IF NOT EXISTS "material_supplier_cost" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "supplier_id" INTEGER NOT NULL DEFAULT 0,
+    "cost" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "supplier_name" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const materialAverageCostTableSql = `
+CREATE TABLE IF NOT EXISTS "material_average_cost" (
+    "material_id" INTEGER NOT NULL PRIMARY KEY,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "cost" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const costLayerTableSql = `
+CREATE TABLE IF NOT EXISTS "cost_layer" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "supplier_id" INTEGER NOT NULL DEFAULT 0,
+    "lot" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "remaining" INTEGER NOT NULL DEFAULT 0,
+    "cost" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const orderCostTableSql = `
+CREATE TABLE IF NOT EXISTS "order_cost" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "type" INTEGER NOT NULL DEFAULT 0,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "method" VARCHAR(255) NOT NULL DEFAULT '',
+    "unit_cost" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "amount" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "standard_amount" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "average_amount" DOUBLE PRECISION NOT NULL DEFAULT 0,
+    "fifo_amount" DOUBLE PRECISION NOT NULL DEFAULT 0
+)
+`
+
+const costCenterTableSql = `
+CREATE TABLE IF NOT EXISTS "cost_center" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "code" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "remark" VARCHAR(255) NULL,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relCostCenterTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_cost_center" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "cost_center_id" INTEGER NOT NULL DEFAULT 0,
+    "group_id" INTEGER NOT NULL DEFAULT 0,
+    "account_id" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const workOrderTableSql = `
+CREATE TABLE IF NOT EXISTS "work_order" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "code" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "cost_center_id" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const orderChargeTableSql = `
+CREATE TABLE IF NOT EXISTS "order_charge" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0 UNIQUE,
+    "cost_center_id" INTEGER NOT NULL DEFAULT 0,
+    "work_order" VARCHAR(255) NULL
+)
+`
+
+// 版本2 库存台账
+
+const stockMovementTableSql = `
+CREATE TABLE IF NOT EXISTS "stock_movement" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "balance_qty" INTEGER NOT NULL DEFAULT 0,
+    "reason" VARCHAR(255) NOT NULL DEFAULT '',
+    "ref_type" VARCHAR(255) NOT NULL DEFAULT '',
+    "ref_id" INTEGER NOT NULL DEFAULT 0,
+    "actor_type" VARCHAR(255) NOT NULL DEFAULT '',
+    "actor_id" INTEGER NOT NULL DEFAULT 0,
+    "note" VARCHAR(255) NULL
+)
+`
+
+// 版本3 手工调整和调拨
+
+const stockAdjustmentTableSql = `
+CREATE TABLE IF NOT EXISTS "stock_adjustment" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "reason" VARCHAR(255) NOT NULL DEFAULT '',
+    "before_qty" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "after_qty" INTEGER NOT NULL DEFAULT 0,
+    "note" VARCHAR(255) NULL
+)
+`
+
+const stockTransferTableSql = `
+CREATE TABLE IF NOT EXISTS "stock_transfer" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "from_grid_id" INTEGER NOT NULL DEFAULT 0,
+    "from_before_qty" INTEGER NOT NULL DEFAULT 0,
+    "from_after_qty" INTEGER NOT NULL DEFAULT 0,
+    "to_grid_id" INTEGER NOT NULL DEFAULT 0,
+    "to_before_qty" INTEGER NOT NULL DEFAULT 0,
+    "to_after_qty" INTEGER NOT NULL DEFAULT 0,
+    "note" VARCHAR(255) NULL
+)
+`
+
+// 版本4 回收检验
+
+const returnInspectionTableSql = `
+CREATE TABLE IF NOT EXISTS "return_inspection" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0 UNIQUE,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "quarantine" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "accepted_qty" INTEGER NOT NULL DEFAULT 0,
+    "accepted_grid_id" INTEGER NOT NULL DEFAULT 0,
+    "scrapped_qty" INTEGER NOT NULL DEFAULT 0,
+    "reason" VARCHAR(255) NULL,
+    "note" VARCHAR(255) NULL,
+    "inspected_by" VARCHAR(255) NULL,
+    "inspected" VARCHAR(255) NULL
+)
+`
+
+// 版本5 套件和领取
+// 领取明细的折合数量在版本6添加
+
+const kitTableSql = `
+CREATE TABLE IF NOT EXISTS "kit" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "code" VARCHAR(255) NOT NULL DEFAULT '' UNIQUE,
+    "name" VARCHAR(255) NOT NULL DEFAULT '',
+    "group_id" INTEGER NOT NULL DEFAULT 0,
+    "remark" VARCHAR(255) NULL,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const relKitMaterialTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_kit_material" (
+    "id" %s,
+    "kit_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const relKitSubstituteTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_kit_substitute" (
+    "id" %s,
+    "kit_id" INTEGER NOT NULL DEFAULT 0,
+    "item_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "sort" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const kitPickTableSql = `
+CREATE TABLE IF NOT EXISTS "kit_pick" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "kit_id" INTEGER NOT NULL DEFAULT 0,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const kitPickLineTableSql = `
+CREATE TABLE IF NOT EXISTS "kit_pick_line" (
+    "id" %s,
+    "pick_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "pick_material_id" INTEGER NOT NULL DEFAULT 0,
+    "substitute" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "picked_qty" INTEGER NOT NULL DEFAULT 0,
+    "shortfall_qty" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+// 版本6 替代物料
+
+const relMaterialSubstituteTableSql = `
+CREATE TABLE IF NOT EXISTS "rel_material_substitute" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "substitute_id" INTEGER NOT NULL DEFAULT 0,
+    "priority" INTEGER NOT NULL DEFAULT 0,
+    "ratio" DOUBLE PRECISION NOT NULL DEFAULT 1,
+    "auto" INTEGER NOT NULL DEFAULT 0,
+    "status" INTEGER NOT NULL DEFAULT 1,
+    "updated" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_by" VARCHAR(255) NOT NULL DEFAULT '',
+    "substitute_name" VARCHAR(255) NOT NULL DEFAULT '',
+    "qty" INTEGER NOT NULL DEFAULT 0
+)
+`
+
+const orderSubstitutionTableSql = `
+CREATE TABLE IF NOT EXISTS "order_substitution" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0 UNIQUE,
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "substitute_id" INTEGER NOT NULL DEFAULT 0,
+    "substitute_qty" INTEGER NOT NULL DEFAULT 0,
+    "ratio" DOUBLE PRECISION NOT NULL DEFAULT 1,
+    "auto" INTEGER NOT NULL DEFAULT 0,
+    "source" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+const accountFingerTableSql = `
+CREATE TABLE IF NOT EXISTS "account_finger" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "account_id" INTEGER NOT NULL DEFAULT 0,
+    "box_id" INTEGER NOT NULL DEFAULT 0,
+    "finger" INTEGER NOT NULL DEFAULT 0,
+    UNIQUE ("box_id", "finger")
+)
+`
+
+// 订单的标签
+const orderRfidTableSql = `
+CREATE TABLE IF NOT EXISTS "order_rfid" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "rfid" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
+
+// 订单的称重明细
+const detailTableSql = `
+CREATE TABLE IF NOT EXISTS "detail" (
+    "id" %s,
+    "created" VARCHAR(255) NOT NULL DEFAULT '',
+    "order_id" INTEGER NOT NULL DEFAULT 0,
+    "grid_id" INTEGER NOT NULL DEFAULT 0,
+    "material_id" INTEGER NOT NULL DEFAULT 0,
+    "sensor_id" INTEGER NOT NULL DEFAULT 0,
+    "channel" INTEGER NOT NULL DEFAULT 0,
+    "before_qty" INTEGER NOT NULL DEFAULT 0,
+    "qty" INTEGER NOT NULL DEFAULT 0,
+    "after_qty" INTEGER NOT NULL DEFAULT 0,
+    "updated" VARCHAR(255) NOT NULL DEFAULT ''
+)
+`
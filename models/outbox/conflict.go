@@ -0,0 +1,259 @@
+package outbox
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/dialect"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+// 本地未推送修改和服务器数据冲突记录
+type Conflict struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 实体
+	Entity   string `orm:"column(entity)" json:"entity"`
+	EntityId int    `orm:"column(entity_id)" json:"entityId"`
+	// 本地JSON
+	Local string `orm:"column(local);type(text)" json:"local"`
+	// 服务器JSON
+	Remote string `orm:"column(remote);type(text)" json:"remote"`
+	// 保留local或remote
+	Resolution string `orm:"column(resolution)" json:"resolution"`
+}
+
+func (t *Conflict) TableName() string {
+	return "sync_conflict"
+}
+
+// 添加
+func InsertConflict(obj *Conflict) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 查询所有
+func ConflictList(where map[string]interface{}, page, pageSize int) (int64, []*Conflict, error) {
+	list := []*Conflict{}
+
+	f := query.New().
+		Equal("t1.entity", where["entity"]).
+		Equal("t1.resolution", where["resolution"]).
+		Sort(where["sort"], conflictSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(conflictListCountSql, conflictListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var conflictSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"entity":     "t1.entity",
+	"resolution": "t1.resolution",
+}
+
+const conflictListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    sync_conflict AS t1
+WHERE
+`
+
+const conflictListSql = `
+SELECT
+    *
+FROM
+    sync_conflict AS t1
+WHERE
+`
+
+// 同步状态,name-value
+type State struct {
+	Name    string `orm:"column(name);pk" json:"name"`
+	Value   string `orm:"column(value);type(text)" json:"value"`
+	Updated string `orm:"column(updated)" json:"updated"`
+}
+
+func (t *State) TableName() string {
+	return "sync_state"
+}
+
+// 查询,不存在返回空
+func StateValue(name string) (string, error) {
+	o := orm.NewOrm()
+
+	obj := &State{
+		Name: name,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return "", nil
+		}
+
+		return "", errors.As(err)
+	}
+
+	return obj.Value, nil
+}
+
+// 保存
+func SetState(name, value, updated string) error {
+	o := orm.NewOrm()
+
+	obj := &State{
+		Name:    name,
+		Value:   value,
+		Updated: updated,
+	}
+
+	if err := o.Read(&State{Name: name}); err != nil {
+		if err != orm.ErrNoRows {
+			return errors.As(err)
+		}
+
+		if _, err := o.Insert(obj); err != nil {
+			return errors.As(err)
+		}
+
+		return nil
+	}
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 按服务器数据写入本地,保持ID一致
+// payload为服务器JSON,已有的数据只更新其中带有的字段
+func ApplyRemote(obj interface{}, payload []byte, id int, del bool) error {
+	table, ok := obj.(interface {
+		TableName() string
+	})
+	if !ok {
+		return errors.New("model has no table name").As(reflect.TypeOf(obj).String())
+	}
+
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return errors.As(err)
+	}
+
+	if err := applyRemote(o, obj, payload, table.TableName(), id, del); err != nil {
+		o.Rollback()
+		return errors.As(err, table.TableName(), id)
+	}
+
+	if err := o.Commit(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+func applyRemote(o orm.Ormer, obj interface{}, payload []byte, table string, id int, del bool) error {
+	if del {
+		if _, err := o.Raw("DELETE FROM "+dialect.Quote(table)+" WHERE id = ?", id).Exec(); err != nil {
+			return errors.As(err)
+		}
+
+		return nil
+	}
+
+	var count int64
+	if err := o.Raw("SELECT COUNT(*) FROM "+dialect.Quote(table)+" WHERE id = ?", id).QueryRow(&count); err != nil {
+		return errors.As(err)
+	}
+
+	if count > 0 {
+		fields, err := payloadFields(obj, payload)
+		if err != nil {
+			return errors.As(err)
+		}
+
+		// 不指定字段时会更新所有列
+		if len(fields) == 0 {
+			return nil
+		}
+
+		if _, err := o.Update(obj, fields...); err != nil {
+			return errors.As(err)
+		}
+
+		return nil
+	}
+
+	newId, err := o.Insert(obj)
+	if err != nil {
+		return errors.As(err)
+	}
+
+	// 自增ID和服务器不一致时改为服务器ID
+	if int(newId) != id {
+		if _, err := o.Raw("UPDATE "+dialect.Quote(table)+" SET id = ? WHERE id = ?", id, newId).Exec(); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	return nil
+}
+
+// JSON中带有的字段,密码和token推送时已去掉,不能用空值覆盖本地
+func payloadFields(obj interface{}, payload []byte) ([]string, error) {
+	m := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return nil, errors.As(err)
+	}
+
+	t := reflect.TypeOf(obj)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("orm")
+		if tag == "-" || strings.Contains(";"+tag+";", ";pk;") {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if _, ok := m[name]; ok {
+			fields = append(fields, f.Name)
+		}
+	}
+
+	return fields, nil
+}
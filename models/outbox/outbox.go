@@ -0,0 +1,258 @@
+package outbox
+
+import (
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var ErrOutboxNotFound = errors.New("outbox not found")
+
+const (
+	// 待推送
+	OUTBOX_PENDING = 0
+	// 已推送
+	OUTBOX_SENT = 1
+	// 冲突时被服务器数据覆盖,不再推送
+	OUTBOX_SUPERSEDED = 2
+)
+
+// 待推送到中心服务器的变更
+type Outbox struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 实体类型
+	Entity   string `orm:"column(entity);index" json:"entity"`
+	EntityId int    `orm:"column(entity_id)" json:"entityId"`
+	// create/update/delete
+	Action string `orm:"column(action)" json:"action"`
+	// 实体更新时间,用于冲突处理
+	EntityUpdated string `orm:"column(entity_updated)" json:"entityUpdated"`
+	// 实体JSON
+	Payload string `orm:"column(payload);type(text)" json:"payload"`
+	// 状态0待推送1已推送2被覆盖
+	Status int `orm:"column(status);default(0);index" json:"status"`
+	// 推送次数
+	Attempts int `orm:"column(attempts);default(0)" json:"attempts"`
+	// 最后一次错误
+	Err string `orm:"column(err)" json:"err"`
+	// 推送时间
+	Sent string `orm:"column(sent)" json:"sent"`
+}
+
+func (t *Outbox) TableName() string {
+	return "sync_outbox"
+}
+
+// 添加
+func InsertOutbox(obj *Outbox) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 按顺序取出待推送
+func PendingOutbox(limit int) ([]*Outbox, error) {
+	o := orm.NewOrm()
+
+	list := []*Outbox{}
+
+	if _, err := o.Raw(pendingOutboxSql, OUTBOX_PENDING, limit).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const pendingOutboxSql = `
+SELECT
+    *
+FROM
+    sync_outbox AS t1
+WHERE
+    t1.status = ?
+ORDER BY t1.id
+LIMIT ?
+`
+
+// 实体最后一条待推送
+func PendingByEntity(entity string, entityId int) (*Outbox, error) {
+	o := orm.NewOrm()
+
+	obj := &Outbox{}
+
+	if err := o.Raw(pendingByEntitySql, OUTBOX_PENDING, entity, entityId).QueryRow(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrOutboxNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+const pendingByEntitySql = `
+SELECT
+    *
+FROM
+    sync_outbox AS t1
+WHERE
+    t1.status = ?
+AND
+    t1.entity = ?
+AND
+    t1.entity_id = ?
+ORDER BY t1.id DESC
+LIMIT 1
+`
+
+// 标记已推送
+func MarkSent(ids []int, sent string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	o := orm.NewOrm()
+
+	args := []interface{}{OUTBOX_SENT, sent}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	if _, err := o.Raw(markSentSql+inSql(len(ids)), args...).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const markSentSql = `
+UPDATE
+    sync_outbox
+SET
+    status = ?,
+    sent = ?
+WHERE
+    id IN
+`
+
+// 记录推送失败
+func MarkFailed(ids []int, errMsg string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	o := orm.NewOrm()
+
+	args := []interface{}{errMsg}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	if _, err := o.Raw(markFailedSql+inSql(len(ids)), args...).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const markFailedSql = `
+UPDATE
+    sync_outbox
+SET
+    attempts = attempts + 1,
+    err = ?
+WHERE
+    id IN
+`
+
+// (?,?,?)
+func inSql(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?,", n), ",") + ")"
+}
+
+// 服务器数据覆盖本地未推送修改
+func Supersede(entity string, entityId int) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Raw(supersedeSql, OUTBOX_SUPERSEDED, OUTBOX_PENDING, entity, entityId).Exec(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+const supersedeSql = `
+UPDATE
+    sync_outbox
+SET
+    status = ?
+WHERE
+    status = ?
+AND
+    entity = ?
+AND
+    entity_id = ?
+`
+
+// 各状态数量
+func OutboxCount(status int) (int64, error) {
+	o := orm.NewOrm()
+
+	var total int64
+	if err := o.Raw(outboxListCountSql+" t1.status = ? ", status).QueryRow(&total); err != nil {
+		return -1, errors.As(err)
+	}
+
+	return total, nil
+}
+
+// 查询所有
+func OutboxList(where map[string]interface{}, page, pageSize int) (int64, []*Outbox, error) {
+	list := []*Outbox{}
+
+	f := query.New().
+		Equal("t1.entity", where["entity"]).
+		Status("t1.status", where["status"]).
+		Sort(where["sort"], outboxSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(outboxListCountSql, outboxListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var outboxSorts = map[string]string{
+	"id":       "t1.id",
+	"created":  "t1.created",
+	"entity":   "t1.entity",
+	"status":   "t1.status",
+	"attempts": "t1.attempts",
+}
+
+const outboxListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    sync_outbox AS t1
+WHERE
+`
+
+const outboxListSql = `
+SELECT
+    *
+FROM
+    sync_outbox AS t1
+WHERE
+`
@@ -113,6 +113,55 @@ func PermissionByTag(tag string) (*Permission, error) {
 	return obj, nil
 }
 
+// 后台用户是否有权限,用户、角色、权限都要启用
+func UserHasPermission(userId int, tag string) (bool, error) {
+	o := orm.NewOrm()
+
+	var count int
+	if err := o.Raw(userHasPermissionSql, userId, tag).QueryRow(&count); err != nil {
+		return false, errors.As(err, userId, tag)
+	}
+
+	return count > 0, nil
+}
+
+const userHasPermissionSql = `
+SELECT
+    COUNT(*)
+FROM
+    "user" AS t1
+INNER JOIN
+    rel_user_role AS t2
+ON
+    t2.user_id = t1.id
+INNER JOIN
+    role AS t3
+ON
+    t3.id = t2.role_id
+INNER JOIN
+    rel_role_permission AS t4
+ON
+    t4.role_id = t3.id
+INNER JOIN
+    permission AS t5
+ON
+    t5.id = t4.permission_id
+WHERE
+    t1.id = ?
+AND
+    t5.tag = ?
+AND
+    t1.status = 1
+AND
+    t2.status = 1
+AND
+    t3.status = 1
+AND
+    t4.status = 1
+AND
+    t5.status = 1
+`
+
 // 查询分类
 func PermissionList() ([]*Permission, error) {
 	o := orm.NewOrm()
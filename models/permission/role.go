@@ -1,10 +1,9 @@
 package permission
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -106,44 +105,31 @@ func RoleByName(name string) (*Role, error) {
 
 // 查询所有
 func RoleList(where map[string]interface{}, page, pageSize int) (int64, []*Role, error) {
-	o := orm.NewOrm()
-
 	list := []*Role{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t1.name").
+		Sort(where["sort"], roleSorts, "id:asc").
+		Cursor(where["cursor"])
 
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.name LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(roleListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(roleListSql+sql+" ORDER BY id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(roleListCountSql, roleListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var roleSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"updated": "t1.updated",
+	"name":    "t1.name",
+	"status":  "t1.status",
+}
+
 const roleListCountSql = `
 SELECT
     COUNT(*)
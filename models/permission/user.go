@@ -1,10 +1,9 @@
 package permission
 
 import (
-	"fmt"
-
 	"github.com/astaxie/beego/orm"
 	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
 )
 
 var (
@@ -131,49 +130,36 @@ func LoginByUsername(username, password string) (*User, error) {
 
 // 查询所有
 func UserList(where map[string]interface{}, page, pageSize int) (int64, []*User, error) {
-	o := orm.NewOrm()
-
 	list := []*User{}
 
-	sql := " 1 "
-	if len(where) > 0 {
-		startDate := where["startDate"]
-		if startDate != "" {
-			sql += " AND t1.created >= '" + fmt.Sprintf("%s", startDate) + "' "
-		}
-
-		endDate := where["endDate"]
-		if endDate != "" {
-			sql += " AND t1.created <= '" + fmt.Sprintf("%s", endDate) + "' "
-		}
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Search(where["name"], "t1.username").
+		Sort(where["sort"], userSorts, "id:asc").
+		Cursor(where["cursor"])
 
-		name := where["name"]
-		if name != "" {
-			sql += " AND (t1.username LIKE '%" + fmt.Sprintf("%s", name) + "%')"
-		}
-	}
-
-	sql += " AND 1 "
-
-	// 查询总数
-	var total int64
-	if err := o.Raw(userListCountSql + sql).QueryRow(&total); err != nil {
-		return -1, nil, errors.As(err)
-	}
-
-	// 查询所有
-	if _, err := o.Raw(userListSql+sql+" ORDER BY id LIMIT ? OFFSET ?", pageSize, (page-1)*pageSize).QueryRows(&list); err != nil {
+	total, err := f.Page(userListCountSql, userListSql, "", page, pageSize, &list)
+	if err != nil {
 		return -1, nil, errors.As(err)
 	}
 
 	return total, list, nil
 }
 
+// 可排序字段
+var userSorts = map[string]string{
+	"id":       "t1.id",
+	"created":  "t1.created",
+	"updated":  "t1.updated",
+	"username": "t1.username",
+	"status":   "t1.status",
+}
+
 const userListCountSql = `
 SELECT
     COUNT(*)
 FROM
-    user AS t1
+    "user" AS t1
 WHERE
 `
 
@@ -187,6 +173,6 @@ SELECT
     t1.updated,
     t1.updated_by
 FROM
-    user AS t1
+    "user" AS t1
 WHERE
 `
@@ -107,7 +107,7 @@ SELECT
     t1.updated,
     t1.updated_by
 FROM
-    user t1
+    "user" t1
 INNER JOIN
     rel_user_role t2
 ON
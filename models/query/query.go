@@ -0,0 +1,401 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var (
+	ErrSortIllegal   = errors.New("sort is illegal")
+	ErrCursorIllegal = errors.New("cursor is illegal")
+)
+
+// 列表查询条件,所有值都使用绑定参数
+type Filter struct {
+	conds []string
+	args  []interface{}
+
+	// 排序列和方向
+	sortColumn string
+	idColumn   string
+	desc       bool
+	// 上一页最后一行的排序值和ID
+	cursor []interface{}
+
+	err error
+}
+
+func New() *Filter {
+	return &Filter{
+		conds: make([]string, 0),
+		args:  make([]interface{}, 0),
+	}
+}
+
+// 自定义条件,cond中用?占位
+func (f *Filter) Where(cond string, args ...interface{}) *Filter {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+	return f
+}
+
+// 时间范围,为空不限制
+// 结束时间只有日期时包含当天
+func (f *Filter) DateRange(column string, startDate, endDate interface{}) *Filter {
+	if v := String(startDate); v != "" {
+		f.Where(column+" >= ?", v)
+	}
+
+	if v := String(endDate); v != "" {
+		if len(v) == 10 {
+			v += " 23:59:59"
+		}
+		f.Where(column+" <= ?", v)
+	}
+
+	return f
+}
+
+// 在多个列中模糊查询,为空不限制
+func (f *Filter) Search(text interface{}, columns ...string) *Filter {
+	v := String(text)
+	if v == "" || len(columns) == 0 {
+		return f
+	}
+
+	conds := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns))
+	for _, c := range columns {
+		conds = append(conds, c+" LIKE ?")
+		args = append(args, "%"+v+"%")
+	}
+
+	return f.Where("("+strings.Join(conds, " OR ")+")", args...)
+}
+
+// ID相等,小于等于0不限制
+func (f *Filter) Id(column string, id interface{}) *Filter {
+	if v := Int(id, 0); v > 0 {
+		f.Where(column+" = ?", v)
+	}
+
+	return f
+}
+
+// 状态相等,小于0不限制
+func (f *Filter) Status(column string, status interface{}) *Filter {
+	if v := Int(status, -1); v >= 0 {
+		f.Where(column+" = ?", v)
+	}
+
+	return f
+}
+
+// 字符串相等,为空不限制
+func (f *Filter) Equal(column string, value interface{}) *Filter {
+	if v := String(value); v != "" {
+		f.Where(column+" = ?", v)
+	}
+
+	return f
+}
+
+// ID在列表中,为空不限制
+func (f *Filter) In(column string, ids []int) *Filter {
+	if len(ids) == 0 {
+		return f
+	}
+
+	args := make([]interface{}, 0, len(ids))
+	for _, v := range ids {
+		args = append(args, v)
+	}
+
+	return f.Where(column+" IN (?"+strings.Repeat(", ?", len(ids)-1)+")", args...)
+}
+
+// 排序,sort为"字段:asc|desc",字段为json名,只能使用columns中的字段
+// sort为空时使用def,columns必须包含id
+func (f *Filter) Sort(sort interface{}, columns map[string]string, def string) *Filter {
+	v := String(sort)
+	if v == "" {
+		v = def
+	}
+
+	field, desc, ok := ParseSort(v)
+	column, found := columns[field]
+	if !ok || !found {
+		f.err = errors.As(ErrSortIllegal, v)
+		return f
+	}
+
+	f.sortColumn = column
+	f.idColumn = columns["id"]
+	f.desc = desc
+
+	return f
+}
+
+// 游标分页,cursor为上一页返回的next,为空时按页码分页
+func (f *Filter) Cursor(cursor interface{}) *Filter {
+	v := String(cursor)
+	if v == "" {
+		return f
+	}
+
+	values, err := DecodeCursor(v)
+	if err != nil {
+		f.err = errors.As(err)
+		return f
+	}
+
+	f.cursor = values
+
+	return f
+}
+
+// 排序语句
+func (f *Filter) orderBy() string {
+	if f.sortColumn == "" {
+		return ""
+	}
+
+	dir := " ASC"
+	if f.desc {
+		dir = " DESC"
+	}
+
+	sql := " ORDER BY " + f.sortColumn + dir
+	if f.idColumn != "" && f.idColumn != f.sortColumn {
+		sql += ", " + f.idColumn + dir
+	}
+
+	return sql
+}
+
+// 游标条件,排序值相同时按ID
+func (f *Filter) cursorWhere() (string, []interface{}) {
+	if f.cursor == nil || f.sortColumn == "" {
+		return "", nil
+	}
+
+	op := " > "
+	if f.desc {
+		op = " < "
+	}
+
+	if f.idColumn == "" || f.idColumn == f.sortColumn {
+		return " AND " + f.sortColumn + op + "? ", []interface{}{f.cursor[1]}
+	}
+
+	return " AND (" + f.sortColumn + op + "? OR (" + f.sortColumn + " = ? AND " + f.idColumn + op + "?)) ",
+		[]interface{}{f.cursor[0], f.cursor[0], f.cursor[1]}
+}
+
+// 条件语句,拼接在以WHERE结尾的SQL后
+func (f *Filter) Sql() string {
+	sql := " 1 = 1 "
+	for _, v := range f.conds {
+		sql += " AND " + v + " "
+	}
+
+	return sql
+}
+
+// 绑定参数,返回副本
+func (f *Filter) Args() []interface{} {
+	return append(make([]interface{}, 0, len(f.args)+2), f.args...)
+}
+
+// 查询总数和一页数据
+// countSql和listSql以WHERE结尾,groupBy可为空,排序由Sort指定
+// 有游标时从游标之后开始,忽略page
+func (f *Filter) Page(countSql, listSql, groupBy string, page, pageSize int, list interface{}) (int64, error) {
+	if f.err != nil {
+		return -1, f.err
+	}
+
+	o := orm.NewOrm()
+
+	// 查询总数
+	var total int64
+	if err := o.Raw(f.CountSql(countSql), f.args...).QueryRow(&total); err != nil {
+		return -1, errors.As(err)
+	}
+
+	// 查询所有
+	sql, args := f.PageSql(listSql, groupBy, page, pageSize)
+	if _, err := o.Raw(sql, args...).QueryRows(list); err != nil {
+		return -1, errors.As(err)
+	}
+
+	return total, nil
+}
+
+// 查询所有,不分页
+func (f *Filter) All(listSql, groupBy string, list interface{}) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	o := orm.NewOrm()
+
+	if _, err := o.Raw(f.AllSql(listSql, groupBy), f.args...).QueryRows(list); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 排序或游标错误
+func (f *Filter) Err() error {
+	return f.err
+}
+
+// 总数语句,参数为Args
+func (f *Filter) CountSql(countSql string) string {
+	return countSql + f.Sql()
+}
+
+// 一页数据的语句和参数,有游标时忽略page
+func (f *Filter) PageSql(listSql, groupBy string, page, pageSize int) (string, []interface{}) {
+	if page < 1 || f.cursor != nil {
+		page = 1
+	}
+
+	args := f.Args()
+
+	cursor, cursorArgs := f.cursorWhere()
+	args = append(args, cursorArgs...)
+
+	return listSql + f.Sql() + cursor + groupBy + f.orderBy() + " LIMIT ? OFFSET ?", append(args, pageSize, (page-1)*pageSize)
+}
+
+// 所有数据的语句,参数为Args
+func (f *Filter) AllSql(listSql, groupBy string) string {
+	return listSql + f.Sql() + groupBy + f.orderBy()
+}
+
+// where中的字符串,其他类型返回空
+func String(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case []byte:
+		return strings.TrimSpace(string(t))
+	}
+
+	return ""
+}
+
+// where中的整数,不是整数时返回def
+func Int(v interface{}, def int) int {
+	switch t := v.(type) {
+	case int:
+		return t
+	case int64:
+		return int(t)
+	case int32:
+		return int(t)
+	case string:
+		if i, err := strconv.Atoi(t); err == nil {
+			return i
+		}
+	}
+
+	return def
+}
+
+// 解析"字段:asc|desc",没有方向时为asc
+func ParseSort(sort string) (string, bool, bool) {
+	field, dir := sort, "asc"
+	if i := strings.Index(sort, ":"); i >= 0 {
+		field, dir = sort[:i], strings.ToLower(sort[i+1:])
+	}
+
+	if field == "" || (dir != "asc" && dir != "desc") {
+		return "", false, false
+	}
+
+	return field, dir == "desc", true
+}
+
+// 游标为排序值和ID的json,base64编码
+func EncodeCursor(value, id interface{}) string {
+	data, err := json.Marshal([]interface{}{value, id})
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.As(ErrCursorIllegal, cursor)
+	}
+
+	// 数字保持整数,避免大ID变成科学计数法
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	values := make([]interface{}, 0, 2)
+	if err := d.Decode(&values); err != nil || len(values) != 2 {
+		return nil, errors.As(ErrCursorIllegal, cursor)
+	}
+
+	for i, v := range values {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+
+		if i64, err := n.Int64(); err == nil {
+			values[i] = i64
+		} else if f64, err := n.Float64(); err == nil {
+			values[i] = f64
+		}
+	}
+
+	return values, nil
+}
+
+// 下一页游标,list不满一页时为空
+// sort为查询实际使用的排序,为空时不支持游标
+// 从最后一行的json中取排序字段和id
+func NextCursor(list interface{}, sort string, pageSize int) string {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice || v.Len() == 0 || v.Len() < pageSize {
+		return ""
+	}
+
+	field, _, ok := ParseSort(sort)
+	if !ok {
+		return ""
+	}
+
+	data, err := json.Marshal(v.Index(v.Len() - 1).Interface())
+	if err != nil {
+		return ""
+	}
+
+	row := make(map[string]interface{})
+	if err := json.Unmarshal(data, &row); err != nil {
+		return ""
+	}
+
+	id, ok := row["id"]
+	if !ok {
+		return ""
+	}
+
+	return EncodeCursor(row[field], id)
+}
@@ -0,0 +1,203 @@
+package query
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/beego/ms304w-client/basis/dialect"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 每种数据库执行一遍生成的列表语句,sqlite使用临时文件
+// postgres和mysql需要本地实例,设置TEST_POSTGRES_DSN和TEST_MYSQL_DSN后执行
+func TestMatrix(t *testing.T) {
+	dsns := map[string]string{
+		dialect.SQLITE:   filepath.Join(t.TempDir(), "test.db"),
+		dialect.POSTGRES: os.Getenv("TEST_POSTGRES_DSN"),
+		dialect.MYSQL:    os.Getenv("TEST_MYSQL_DSN"),
+	}
+
+	for driver, dsn := range dsns {
+		driver, dsn := driver, dsn
+
+		t.Run(driver, func(t *testing.T) {
+			if dsn == "" {
+				t.Skip("dsn is empty")
+			}
+
+			db, err := sql.Open(driver, dialect.Dsn(driver, dsn))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			testMatrix(t, driver, db)
+		})
+	}
+}
+
+func testMatrix(t *testing.T, driver string, db *sql.DB) {
+	exec := func(s string) {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(s, err)
+		}
+	}
+
+	// 保留字表名
+	exec(`DROP TABLE IF EXISTS "order"`)
+	exec(`CREATE TABLE "order" (id INTEGER NOT NULL PRIMARY KEY, account_id INTEGER NOT NULL DEFAULT 0, created VARCHAR(32) NOT NULL DEFAULT '')`)
+	exec(`INSERT INTO "order" (id, account_id, created) VALUES (1, 7, '2020-01-01 00:00:00'), (2, 7, '2020-01-02 00:00:00')`)
+
+	// 列表查询使用query生成的语句
+	f := New().
+		Id("t1.account_id", 7).
+		Status("t1.account_id", -1).
+		In("t1.id", []int{1, 2}).
+		DateRange("t1.created", "2020-01-01", "2020-01-02").
+		Search("2020", "t1.created").
+		Sort(nil, orderSorts, "id:desc")
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.QueryRow(marks(driver, f.CountSql(orderCountSql)), f.Args()...).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Fatal("count err: ", count)
+	}
+
+	s, args := f.PageSql(orderListSql, "", 1, 1)
+	if ids := queryIds(t, db, marks(driver, s), args...); len(ids) != 1 || ids[0] != 2 {
+		t.Fatal("page err: ", ids)
+	}
+
+	if ids := queryIds(t, db, marks(driver, f.AllSql(orderListSql, "")), f.Args()...); len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Fatal("all err: ", ids)
+	}
+
+	// 默认id:desc时用游标逐页查询
+	type row struct {
+		Id int `json:"id"`
+	}
+
+	pages := [][]int{}
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		f := New().
+			Id("t1.account_id", 7).
+			Sort("id:desc", orderSorts, "id:desc").
+			Cursor(cursor)
+		if err := f.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		s, args := f.PageSql(orderListSql, "", 1, 1)
+		ids := queryIds(t, db, marks(driver, s), args...)
+		pages = append(pages, ids)
+
+		list := make([]*row, 0, len(ids))
+		for _, id := range ids {
+			list = append(list, &row{id})
+		}
+
+		if cursor = NextCursor(list, "id:desc", 1); cursor == "" {
+			break
+		}
+	}
+
+	if len(pages) != 3 || len(pages[0]) != 1 || pages[0][0] != 2 || len(pages[1]) != 1 || pages[1][0] != 1 || len(pages[2]) != 0 {
+		t.Fatal("cursor err: ", pages)
+	}
+
+	// 不支持游标的列表
+	if cursor := NextCursor([]*row{{2}}, "", 1); cursor != "" {
+		t.Fatal("cursor err: ", cursor)
+	}
+
+	// 没有条件
+	f = New()
+	if err := db.QueryRow(marks(driver, f.CountSql(orderCountSql)), f.Args()...).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Fatal("count err: ", count)
+	}
+
+	exec(`DROP TABLE "order"`)
+}
+
+var orderSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+}
+
+const orderCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    "order" AS t1
+WHERE
+`
+
+const orderListSql = `
+SELECT
+    t1.id
+FROM
+    "order" AS t1
+WHERE
+`
+
+// 同beego orm,postgres的参数为$1,$2...
+func marks(driver, s string) string {
+	if driver != dialect.POSTGRES {
+		return s
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range s {
+		if c != '?' {
+			b.WriteRune(c)
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+func queryIds(t *testing.T, db *sql.DB, s string, args ...interface{}) []int {
+	rows, err := db.Query(s, args...)
+	if err != nil {
+		t.Fatal(s, err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ids
+}
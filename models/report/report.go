@@ -0,0 +1,665 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/adjust"
+	"github.com/beego/ms304w-client/models/cost"
+	"github.com/beego/ms304w-client/models/inspect"
+	"github.com/beego/ms304w-client/models/order"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var (
+	ErrReportNotFound = errors.New("report not found")
+	ErrByIllegal      = errors.New("report by is illegal")
+)
+
+// 报表
+const (
+	// 消耗统计
+	CONSUMPTION = "consumption"
+	// 库存金额
+	STOCK = "stock"
+	// 盘点差异
+	VARIANCE = "variance"
+	// 格子出入库明细
+	MOVEMENT = "movement"
+	// 库存计价
+	VALUATION = "valuation"
+	// 成本中心领料
+	COST_CENTER = "costCenter"
+	// 回收检验
+	INSPECTION = "inspection"
+	// 套件缺料
+	KIT_SHORTFALL = "kitShortfall"
+)
+
+// 消耗统计维度
+const (
+	BY_ACCOUNT  = "account"
+	BY_GROUP    = "group"
+	BY_MATERIAL = "material"
+	BY_CATEGORY = "category"
+	// 成本中心领料按工单
+	BY_WORK_ORDER = "workOrder"
+)
+
+// 报表定义
+type Report struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// 列名,导出时为表头
+	Columns []string `json:"columns"`
+	// 支持的查询参数
+	Params []string `json:"params"`
+}
+
+var reports = []*Report{
+	{
+		Name:    CONSUMPTION,
+		Title:   "Consumption",
+		Columns: []string{"Id", "Name", "Out Qty", "Returned Qty", "Net Qty", "Net Value", "Orders"},
+		Params:  []string{"by", "startDate", "endDate", "boxId", "materialId", "categoryId", "accountId"},
+	},
+	{
+		Name:    STOCK,
+		Title:   "Stock On Hand",
+		Columns: []string{"Box", "Grid", "Material Code", "Material", "Category", "Qty", "Price", "Value", "Updated"},
+		Params:  []string{"boxId", "gridId", "materialId", "categoryId"},
+	},
+	{
+		Name:    VARIANCE,
+		Title:   "Stocktake Variance",
+		Columns: []string{"Created", "Box", "Grid", "Material Code", "Material", "Account", "Book Qty", "Counted Qty", "Variance", "Variance Value"},
+		Params:  []string{"startDate", "endDate", "boxId", "gridId", "materialId"},
+	},
+	{
+		Name:    MOVEMENT,
+		Title:   "Grid Movements",
+		Columns: []string{"Created", "Box", "Grid", "Material Code", "Material", "Account", "Type", "Before Qty", "Qty", "After Qty"},
+		Params:  []string{"startDate", "endDate", "boxId", "gridId", "materialId", "accountId"},
+	},
+	{
+		Name:    VALUATION,
+		Title:   "Inventory Valuation",
+		Columns: []string{"Material Code", "Material", "Category", "Qty", "Method", "Unit Cost", "Value"},
+		Params:  []string{"method", "materialId", "categoryId"},
+	},
+	{
+		Name:    COST_CENTER,
+		Title:   "Cost Center Charges",
+		Columns: []string{"Cost Center Code", "Cost Center", "Work Order", "Out Qty", "Value", "Orders"},
+		Params:  []string{"by", "startDate", "endDate", "materialId", "categoryId", "accountId", "costCenterId"},
+	},
+	{
+		Name:    INSPECTION,
+		Title:   "Return Inspections",
+		Columns: []string{"Created", "Box", "Grid", "Material Code", "Material", "Account", "Status", "Qty", "Accepted Qty", "Scrapped Qty", "Reason", "Scrapped Value", "Inspected By", "Inspected"},
+		Params:  []string{"startDate", "endDate", "boxId", "gridId", "materialId", "accountId"},
+	},
+	{
+		Name:    KIT_SHORTFALL,
+		Title:   "Kit Shortfalls",
+		Columns: []string{"Created", "Kit Code", "Kit", "Account", "Material Code", "Material", "Sets", "Planned Qty", "Picked Qty", "Shortfall Qty"},
+		Params:  []string{"startDate", "endDate", "materialId", "accountId"},
+	},
+}
+
+// 所有报表
+func Reports() []*Report {
+	return reports
+}
+
+// 根据名称查询
+func ReportByName(name string) (*Report, error) {
+	for _, v := range reports {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+
+	return nil, errors.As(ErrReportNotFound, name)
+}
+
+// 报表查询
+type Query struct {
+	Report *Report
+	Sql    string
+	Args   []interface{}
+	// 输出前转换
+	transform func(row []interface{}) []interface{}
+}
+
+// 按参数生成查询
+func NewQuery(name string, where map[string]interface{}) (*Query, error) {
+	obj, err := ReportByName(name)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+
+	q := &Query{
+		Report: obj,
+	}
+
+	switch name {
+	case CONSUMPTION:
+		err = q.consumption(where)
+	case STOCK:
+		q.stock(where)
+	case VARIANCE:
+		q.variance(where)
+	case MOVEMENT:
+		q.movement(where)
+	case VALUATION:
+		err = q.valuation(where)
+	case COST_CENTER:
+		err = q.costCenter(where)
+	case INSPECTION:
+		q.inspection(where)
+	case KIT_SHORTFALL:
+		q.kitShortfall(where)
+	}
+
+	if err != nil {
+		return nil, errors.As(err, name)
+	}
+
+	return q, nil
+}
+
+// 逐行读取,不一次加载全部数据
+func (q *Query) Each(fn func(row []interface{}) error) error {
+	db, err := orm.GetDB("default")
+	if err != nil {
+		return errors.As(err)
+	}
+
+	rows, err := db.Query(q.Sql, q.Args...)
+	if err != nil {
+		return errors.As(err, q.Report.Name)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return errors.As(err)
+	}
+
+	values := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return errors.As(err)
+		}
+
+		row := make([]interface{}, len(values))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				row[i] = string(b)
+				continue
+			}
+
+			row[i] = v
+		}
+
+		if q.transform != nil {
+			row = q.transform(row)
+		}
+
+		if err := fn(row); err != nil {
+			return errors.As(err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 公共条件
+func (q *Query) filter(where map[string]interface{}, created string) string {
+	f := query.New()
+
+	if len(created) > 0 {
+		f.DateRange(created, where["startDate"], where["endDate"])
+	}
+
+	for _, v := range []struct {
+		key    string
+		column string
+	}{
+		{"boxId", "t2.box_id"},
+		{"gridId", "t2.id"},
+		{"materialId", "t4.id"},
+		{"categoryId", "t4.category_id"},
+		{"accountId", "t1.account_id"},
+		{"costCenterId", "t8.cost_center_id"},
+	} {
+		if q.param(v.key) {
+			f.Id(v.column, where[v.key])
+		}
+	}
+
+	q.Args = append(q.Args, f.Args()...)
+
+	return f.Sql()
+}
+
+// 报表是否支持参数
+func (q *Query) param(name string) bool {
+	for _, v := range q.Report.Params {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 消耗统计,出库减去退回
+func (q *Query) consumption(where map[string]interface{}) error {
+	var key, name, join string
+
+	by, _ := where["by"].(string)
+	switch by {
+	case BY_MATERIAL, "":
+		key, name = "t4.id", "t4.name"
+	case BY_CATEGORY:
+		key, name = "t4.category_id", "t5.name"
+		join = " LEFT JOIN rel_material_category AS t5 ON t5.id = t4.category_id "
+	case BY_ACCOUNT:
+		key, name = "t1.account_id", "t5.username"
+		join = " LEFT JOIN account AS t5 ON t5.id = t1.account_id "
+	case BY_GROUP:
+		// 用户在多个组时每个组都统计
+		key, name = "t6.group_id", "t5.name"
+		join = " INNER JOIN rel_account_group AS t6 ON t6.account_id = t1.account_id LEFT JOIN \"group\" AS t5 ON t5.id = t6.group_id "
+	default:
+		return errors.As(ErrByIllegal, by)
+	}
+
+	q.Args = append(q.Args, order.OUT, order.RECYCLE, order.OUT, order.RECYCLE, order.OUT, order.RECYCLE, order.OUT, order.RECYCLE)
+	sql := q.filter(where, "t1.created")
+
+	q.Sql = fmt.Sprintf(consumptionSql, key, name, join) + sql + " GROUP BY " + key + ", " + name + " ORDER BY out_qty DESC"
+
+	return nil
+}
+
+const consumptionSql = `
+SELECT
+    %[1]s AS id,
+    %[2]s AS name,
+    SUM(CASE WHEN t1.type = ? THEN t1.qty ELSE 0 END) AS out_qty,
+    SUM(CASE WHEN t1.type = ? THEN t1.qty ELSE 0 END) AS returned_qty,
+    SUM(CASE WHEN t1.type = ? THEN t1.qty WHEN t1.type = ? THEN -t1.qty ELSE 0 END) AS net_qty,
+    SUM(CASE WHEN t1.type = ? THEN COALESCE(t7.amount, t1.qty * t4.price) WHEN t1.type = ? THEN -COALESCE(t7.amount, t1.qty * t4.price) ELSE 0 END) AS net_value,
+    COUNT(*) AS orders
+FROM
+    "order" AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t1.material_id
+LEFT JOIN
+    order_cost AS t7
+ON
+    t7.order_id = t1.id
+%[3]s
+WHERE
+    t1.type IN (?, ?)
+AND
+`
+
+// 按成本中心统计领料,未记账的领料成本中心为空
+func (q *Query) costCenter(where map[string]interface{}) error {
+	var workOrder, group string
+
+	by, _ := where["by"].(string)
+	switch by {
+	case "":
+		workOrder, group = "''", "COALESCE(t8.cost_center_id, 0)"
+	case BY_WORK_ORDER:
+		workOrder, group = "COALESCE(t8.work_order, '')", "COALESCE(t8.cost_center_id, 0), COALESCE(t8.work_order, '')"
+	default:
+		return errors.As(ErrByIllegal, by)
+	}
+
+	q.Args = append(q.Args, order.OUT)
+	sql := q.filter(where, "t1.created")
+
+	q.Sql = fmt.Sprintf(costCenterSql, workOrder) + sql + " GROUP BY " + group + " ORDER BY value DESC"
+
+	return nil
+}
+
+const costCenterSql = `
+SELECT
+    MAX(COALESCE(t9.code, '')) AS cost_center_code,
+    MAX(COALESCE(t9.name, '')) AS cost_center_name,
+    MAX(%[1]s) AS work_order,
+    SUM(t1.qty) AS out_qty,
+    SUM(COALESCE(t7.amount, t1.qty * t4.price)) AS value,
+    COUNT(*) AS orders
+FROM
+    "order" AS t1
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t1.material_id
+LEFT JOIN
+    order_cost AS t7
+ON
+    t7.order_id = t1.id
+LEFT JOIN
+    order_charge AS t8
+ON
+    t8.order_id = t1.id
+LEFT JOIN
+    cost_center AS t9
+ON
+    t9.id = t8.cost_center_id
+WHERE
+    t1.type = ?
+AND
+`
+
+// 当前库存和金额
+func (q *Query) stock(where map[string]interface{}) {
+	q.Sql = stockReportSql + q.filter(where, "") + " ORDER BY t3.addr, t2.id"
+}
+
+const stockReportSql = `
+SELECT
+    t3.name AS box_name,
+    t2.name AS grid_name,
+    t4.material_code,
+    t4.name AS material_name,
+    t5.name AS category_name,
+    t1.qty,
+    t4.price,
+    t1.qty * t4.price AS value,
+    t1.updated
+FROM
+    stock AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    box AS t3
+ON
+    t3.id = t2.box_id
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t1.material_id
+LEFT JOIN
+    rel_material_category AS t5
+ON
+    t5.id = t4.category_id
+WHERE
+`
+
+// 盘点差异,盘点数量减去账面数量
+func (q *Query) variance(where map[string]interface{}) {
+	q.Sql = varianceSql + q.filter(where, "t1.created") + " ORDER BY t1.id"
+}
+
+const varianceSql = `
+SELECT
+    t1.created,
+    t3.name AS box_name,
+    t2.name AS grid_name,
+    t4.material_code,
+    t4.name AS material_name,
+    t5.username,
+    t1.before_qty,
+    t1.qty,
+    t1.qty - t1.before_qty AS variance,
+    (t1.qty - t1.before_qty) * t4.price AS variance_value
+FROM
+    auto AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    box AS t3
+ON
+    t3.id = t2.box_id
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t1.material_id
+LEFT JOIN
+    account AS t5
+ON
+    t5.id = t1.account_id
+WHERE
+`
+
+// 格子出入库明细
+func (q *Query) movement(where map[string]interface{}) {
+	q.Args = append(q.Args, order.IN, order.OUT, order.RECYCLE, adjust.ORDER_ADJUST, adjust.ORDER_TRANSFER)
+	q.Sql = movementSql + q.filter(where, "t1.created") + " ORDER BY t1.grid_id, t1.id"
+}
+
+const movementSql = `
+SELECT
+    t1.created,
+    t3.name AS box_name,
+    t2.name AS grid_name,
+    t4.material_code,
+    t4.name AS material_name,
+    t5.username,
+    CASE t1.type WHEN ? THEN 'in' WHEN ? THEN 'out' WHEN ? THEN 'recycle' WHEN ? THEN 'adjust' WHEN ? THEN 'transfer' ELSE '' END AS type,
+    t1.before_qty,
+    t1.qty,
+    t1.after_qty
+FROM
+    "order" AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    box AS t3
+ON
+    t3.id = t2.box_id
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t1.material_id
+LEFT JOIN
+    account AS t5
+ON
+    t5.id = t1.account_id
+WHERE
+`
+
+// 回收检验结果和报废原因
+func (q *Query) inspection(where map[string]interface{}) {
+	q.Args = append(q.Args, inspect.PENDING, inspect.ACCEPTED, inspect.SCRAPPED, inspect.PARTIAL)
+	q.Sql = inspectionSql + q.filter(where, "t1.created") + " ORDER BY t1.id"
+}
+
+const inspectionSql = `
+SELECT
+    t1.created,
+    t3.name AS box_name,
+    t2.name AS grid_name,
+    t4.material_code,
+    t4.name AS material_name,
+    t5.username,
+    CASE t1.status WHEN ? THEN 'pending' WHEN ? THEN 'accepted' WHEN ? THEN 'scrapped' WHEN ? THEN 'partial' ELSE '' END AS status,
+    t1.qty,
+    t1.accepted_qty,
+    t1.scrapped_qty,
+    COALESCE(t1.reason, '') AS reason,
+    t1.scrapped_qty * t4.price AS scrapped_value,
+    COALESCE(t1.inspected_by, '') AS inspected_by,
+    COALESCE(t1.inspected, '') AS inspected
+FROM
+    return_inspection AS t1
+LEFT JOIN
+    rel_box_grid AS t2
+ON
+    t2.id = t1.grid_id
+LEFT JOIN
+    box AS t3
+ON
+    t3.id = t2.box_id
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t1.material_id
+LEFT JOIN
+    account AS t5
+ON
+    t5.id = t1.account_id
+WHERE
+`
+
+// 套件领取的缺料,包括库存不足和少领的
+func (q *Query) kitShortfall(where map[string]interface{}) {
+	q.Sql = kitShortfallSql + q.filter(where, "t1.created") + " ORDER BY t1.id, t6.id"
+}
+
+const kitShortfallSql = `
+SELECT
+    t1.created,
+    t2.code AS kit_code,
+    t2.name AS kit_name,
+    t5.username,
+    t4.material_code,
+    t4.name AS material_name,
+    t1.qty AS sets,
+    t6.qty,
+    t6.picked_qty,
+    t6.shortfall_qty
+FROM
+    kit_pick AS t1
+INNER JOIN
+    kit_pick_line AS t6
+ON
+    t6.pick_id = t1.id
+LEFT JOIN
+    kit AS t2
+ON
+    t2.id = t1.kit_id
+LEFT JOIN
+    material AS t4
+ON
+    t4.id = t6.material_id
+LEFT JOIN
+    account AS t5
+ON
+    t5.id = t1.account_id
+WHERE
+    t6.shortfall_qty > 0
+AND
+`
+
+// 库存计价,金额按计价方法
+func (q *Query) valuation(where map[string]interface{}) error {
+	method, _ := where["method"].(string)
+	if method == "" {
+		method = cost.STANDARD
+	}
+
+	if !cost.ValidMethod(method) {
+		return errors.As(cost.ErrMethodIllegal, method)
+	}
+
+	q.Sql = valuationSql + q.filter(where, "") + " ORDER BY t4.id"
+	q.transform = func(row []interface{}) []interface{} {
+		v := &cost.Valuation{
+			Qty:          toInt(row[3]),
+			StandardCost: toFloat(row[4]),
+			AverageCost:  toFloat(row[5]),
+			LayerQty:     toInt(row[6]),
+			LayerValue:   toFloat(row[7]),
+		}
+		v.Apply(method)
+
+		return []interface{}{row[0], row[1], row[2], v.Qty, method, v.UnitCost, v.Value}
+	}
+
+	return nil
+}
+
+const valuationSql = `
+SELECT
+    t4.material_code,
+    t4.name AS material_name,
+    t5.name AS category_name,
+    COALESCE(t2.qty, 0) AS qty,
+    t4.price AS standard_cost,
+    COALESCE(t3.cost, t4.price) AS average_cost,
+    COALESCE(t6.qty, 0) AS layer_qty,
+    COALESCE(t6.value, 0) AS layer_value
+FROM
+    material AS t4
+LEFT JOIN
+    (SELECT material_id, SUM(qty) AS qty FROM stock GROUP BY material_id) AS t2
+ON
+    t2.material_id = t4.id
+LEFT JOIN
+    material_average_cost AS t3
+ON
+    t3.material_id = t4.id
+LEFT JOIN
+    rel_material_category AS t5
+ON
+    t5.id = t4.category_id
+LEFT JOIN
+    (SELECT material_id, SUM(remaining) AS qty, SUM(remaining * cost) AS value FROM cost_layer WHERE remaining > 0 GROUP BY material_id) AS t6
+ON
+    t6.material_id = t4.id
+WHERE
+    COALESCE(t2.qty, 0) > 0
+AND
+`
+
+func toInt(v interface{}) int {
+	switch t := v.(type) {
+	case int64:
+		return int(t)
+	case float64:
+		return int(t)
+	case string:
+		i, _ := strconv.Atoi(t)
+		return i
+	}
+
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	switch t := v.(type) {
+	case int64:
+		return float64(t)
+	case float64:
+		return t
+	case string:
+		f, _ := strconv.ParseFloat(t, 64)
+		return f
+	}
+
+	return 0
+}
@@ -0,0 +1,111 @@
+package rfid
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+// 标签出入记录
+type Record struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 开关门
+	SessionId int `orm:"column(session_id)" json:"sessionId"`
+	// 订单
+	OrderId int `orm:"column(order_id)" json:"orderId"`
+	// 用户
+	AccountId int `orm:"column(account_id)" json:"accountId"`
+	// 格子
+	GridId int `orm:"column(grid_id)" json:"gridId"`
+	// 物料
+	MaterialId int `orm:"column(material_id)" json:"materialId"`
+	// 标签
+	Rfid string `orm:"column(rfid)" json:"rfid"`
+	// 类型1上料2领料3回收
+	Type int `orm:"column(type)" json:"type"`
+
+	// other
+	AccountName  string `json:"accountName"`
+	MaterialName string `json:"materialName"`
+}
+
+func (t *Record) TableName() string {
+	return "rfid_record"
+}
+
+// 添加
+func InsertRecord(obj *Record) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 查询所有
+func RecordList(where map[string]interface{}, page, pageSize int) (int64, []*Record, error) {
+	list := []*Record{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.session_id", where["sessionId"]).
+		Id("t1.account_id", where["accountId"]).
+		Id("t1.grid_id", where["gridId"]).
+		Id("t1.material_id", where["materialId"]).
+		Search(where["name"], "t1.rfid").
+		Sort(where["sort"], recordSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(recordListCountSql, recordListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var recordSorts = map[string]string{
+	"id":         "t1.id",
+	"created":    "t1.created",
+	"materialId": "t1.material_id",
+	"gridId":     "t1.grid_id",
+	"accountId":  "t1.account_id",
+}
+
+const recordListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    rfid_record AS t1
+WHERE
+`
+
+const recordListSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.session_id,
+    t1.order_id,
+    t1.account_id,
+    t1.grid_id,
+    t1.material_id,
+    t1.rfid,
+    t1.type,
+    t2.username AS account_name,
+    t3.name AS material_name
+FROM
+    rfid_record AS t1
+LEFT JOIN
+    account AS t2
+ON
+    t1.account_id = t2.id
+LEFT JOIN
+    material AS t3
+ON
+    t1.material_id = t3.id
+WHERE
+`
@@ -0,0 +1,82 @@
+package rfid
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+)
+
+var (
+	ErrSessionNotFound = errors.New("rfid session not found")
+	ErrSessionClosed   = errors.New("rfid session closed")
+)
+
+const (
+	// 已开门
+	SESSION_OPEN = iota
+	// 已关门对账
+	SESSION_CLOSED
+)
+
+// 一次开关门
+type Session struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 开门用户
+	AccountId int `orm:"column(account_id)" json:"accountId"`
+	// 格子
+	GridId int `orm:"column(grid_id)" json:"gridId"`
+	// 状态0已开门1已关门
+	Status int `orm:"column(status);default(0)" json:"status"`
+	// 开门前标签JSON
+	BeforeTags string `orm:"column(before_tags);type(text)" json:"beforeTags"`
+	// 关门后标签JSON
+	AfterTags string `orm:"column(after_tags);type(text)" json:"afterTags"`
+	// 更新时间
+	Updated string `orm:"column(updated)" json:"updated"`
+}
+
+func (t *Session) TableName() string {
+	return "rfid_session"
+}
+
+// 添加
+func InsertSession(obj *Session) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateSession(obj *Session) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func SessionById(id int) (*Session, error) {
+	o := orm.NewOrm()
+
+	obj := &Session{
+		Id: id,
+	}
+
+	if err := o.Read(obj, "Id"); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrSessionNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,183 @@
+package rfid
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/ledger"
+	"github.com/beego/ms304w-client/models/material"
+	"github.com/beego/ms304w-client/models/order"
+)
+
+// 对账的一个物料和类型,Tags已改为关门后的位置
+type SettleItem struct {
+	Order *order.Order
+	Tags  []*material.MaterialRfid
+}
+
+// 对账后变化的库存,Before为nil是新增
+type StockChange struct {
+	Before *order.Stock
+	After  *order.Stock
+}
+
+// 关门对账,在一个事务中关闭开门记录、生成订单、更新标签和记录并按标签重算库存
+// 开门记录已关闭时返回ErrSessionClosed,重复回调不会重复生成
+// affected为受影响的格子和物料
+func Settle(session *Session, items []*SettleItem, affected [][2]int, src *ledger.Movement) ([]*StockChange, error) {
+	o := orm.NewOrm()
+
+	if err := o.Begin(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	res, err := o.Raw(closeSessionSql, SESSION_CLOSED, session.AfterTags, session.Updated, session.Id, SESSION_OPEN).Exec()
+	if err != nil {
+		o.Rollback()
+		return nil, errors.As(err, session.Id)
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		o.Rollback()
+		return nil, errors.As(ErrSessionClosed, session.Id)
+	}
+
+	for _, v := range items {
+		if _, err := o.Insert(v.Order); err != nil {
+			o.Rollback()
+			return nil, errors.As(err, v.Order.MaterialId)
+		}
+
+		for _, tag := range v.Tags {
+			if _, err := o.Update(tag, "State", "GridId", "AccountId", "Updated", "UpdatedBy"); err != nil {
+				o.Rollback()
+				return nil, errors.As(err, tag.Rfid)
+			}
+
+			if _, err := o.Insert(&Record{
+				Created:    session.Updated,
+				SessionId:  session.Id,
+				OrderId:    v.Order.Id,
+				AccountId:  session.AccountId,
+				GridId:     session.GridId,
+				MaterialId: tag.MaterialId,
+				Rfid:       tag.Rfid,
+				Type:       v.Order.Type,
+			}); err != nil {
+				o.Rollback()
+				return nil, errors.As(err, tag.Rfid)
+			}
+		}
+	}
+
+	changes := make([]*StockChange, 0, len(affected))
+	for _, k := range affected {
+		change, err := syncStock(o, k[0], k[1], session.Updated, src)
+		if err != nil {
+			o.Rollback()
+			return nil, errors.As(err, k[0], k[1])
+		}
+
+		if change != nil {
+			changes = append(changes, change)
+		}
+	}
+
+	if err := o.Commit(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return changes, nil
+}
+
+// 在事务中按在柜标签数量更新格子库存,没有变化时返回nil
+func syncStock(o orm.Ormer, gridId, materialId int, updated string, src *ledger.Movement) (*StockChange, error) {
+	var qty int
+	if err := o.Raw(tagQtySql, gridId, materialId, material.RFID_IN).QueryRow(&qty); err != nil {
+		return nil, errors.As(err)
+	}
+
+	stock := &order.Stock{}
+	if err := o.Raw(stockSql, gridId, materialId).QueryRow(stock); err != nil {
+		if err != orm.ErrNoRows {
+			return nil, errors.As(err)
+		}
+
+		if qty == 0 {
+			return nil, nil
+		}
+
+		after := &order.Stock{
+			Created:    updated,
+			GridId:     gridId,
+			MaterialId: materialId,
+			Qty:        qty,
+			Updated:    updated,
+		}
+		if _, err := o.Insert(after); err != nil {
+			return nil, errors.As(err)
+		}
+
+		if err := ledger.Record(o, src, nil, after); err != nil {
+			return nil, errors.As(err)
+		}
+
+		return &StockChange{After: after}, nil
+	}
+
+	if stock.Qty == qty {
+		return nil, nil
+	}
+
+	before := *stock
+	stock.Qty = qty
+	stock.Updated = updated
+	if _, err := o.Raw(updateStockSql, stock.Qty, stock.Updated, stock.Id).Exec(); err != nil {
+		return nil, errors.As(err)
+	}
+
+	if err := ledger.Record(o, src, &before, stock); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return &StockChange{Before: &before, After: stock}, nil
+}
+
+const closeSessionSql = `
+UPDATE rfid_session SET status = ?, after_tags = ?, updated = ? WHERE id = ? AND status = ?
+`
+
+const tagQtySql = `
+SELECT
+    COUNT(*)
+FROM
+    rel_material_rfid AS t1
+WHERE
+    t1.grid_id = ?
+AND
+    t1.material_id = ?
+AND
+    t1.state = ?
+`
+
+const stockSql = `
+SELECT
+    t1.id,
+    t1.created,
+    t1.grid_id,
+    t1.sensor_id,
+    t1.material_id,
+    t1.qty,
+    t1.updated
+FROM
+    stock AS t1
+WHERE
+    t1.grid_id = ?
+AND
+    t1.material_id = ?
+ORDER BY t1.id
+LIMIT 1
+`
+
+const updateStockSql = `
+UPDATE stock SET qty = ?, updated = ? WHERE id = ?
+`
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+const (
+	// 待发送
+	DELIVERY_PENDING = 0
+	// 成功
+	DELIVERY_SUCCESS = 1
+	// 超过重试次数
+	DELIVERY_FAILED = 2
+)
+
+// 待推送队列,重启后继续发送
+type Delivery struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// webhook
+	WebhookId int `orm:"column(webhook_id);index" json:"webhookId"`
+	// 事件类型
+	Topic string `orm:"column(topic)" json:"topic"`
+	// 推送内容JSON
+	Payload string `orm:"column(payload);type(text)" json:"payload"`
+	// 状态0待发送1成功2失败
+	Status int `orm:"column(status);default(0);index" json:"status"`
+	// 已发送次数
+	Attempts int `orm:"column(attempts);default(0)" json:"attempts"`
+	// 下次发送时间
+	NextAttempt string `orm:"column(next_attempt);index" json:"nextAttempt"`
+	// 更新时间
+	Updated string `orm:"column(updated)" json:"updated"`
+}
+
+func (t *Delivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// 每次发送记录
+type Attempt struct {
+	Id      int    `orm:"column(id);auto;pk" json:"id"`
+	Created string `orm:"column(created)" json:"created"`
+	// 推送
+	DeliveryId int `orm:"column(delivery_id);index" json:"deliveryId"`
+	WebhookId  int `orm:"column(webhook_id)" json:"webhookId"`
+	// 第几次
+	Attempt int `orm:"column(attempt)" json:"attempt"`
+	// HTTP状态码,请求失败为0
+	StatusCode int `orm:"column(status_code)" json:"statusCode"`
+	// 响应内容
+	Response string `orm:"column(response);type(text)" json:"response"`
+	// 请求错误
+	Err string `orm:"column(err)" json:"err"`
+	// 耗时毫秒
+	Duration int `orm:"column(duration)" json:"duration"`
+}
+
+func (t *Attempt) TableName() string {
+	return "webhook_attempt"
+}
+
+// 添加
+func InsertDelivery(obj *Delivery) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateDelivery(obj *Delivery) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func DeliveryById(id int) (*Delivery, error) {
+	o := orm.NewOrm()
+
+	obj := &Delivery{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrDeliveryNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 到期待发送
+func DueDeliveries(now string, limit int) ([]*Delivery, error) {
+	o := orm.NewOrm()
+
+	list := []*Delivery{}
+
+	if _, err := o.Raw(dueDeliveriesSql, DELIVERY_PENDING, now, limit).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const dueDeliveriesSql = `
+SELECT
+    *
+FROM
+    webhook_delivery AS t1
+WHERE
+    t1.status = ?
+AND
+    t1.next_attempt <= ?
+ORDER BY t1.id
+LIMIT ?
+`
+
+// 查询所有
+func DeliveryList(where map[string]interface{}, page, pageSize int) (int64, []*Delivery, error) {
+	list := []*Delivery{}
+
+	f := query.New().
+		DateRange("t1.created", where["startDate"], where["endDate"]).
+		Id("t1.webhook_id", where["webhookId"]).
+		Equal("t1.topic", where["topic"]).
+		Status("t1.status", where["status"]).
+		Sort(where["sort"], deliverySorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(deliveryListCountSql, deliveryListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var deliverySorts = map[string]string{
+	"id":       "t1.id",
+	"created":  "t1.created",
+	"topic":    "t1.topic",
+	"status":   "t1.status",
+	"attempts": "t1.attempts",
+	"updated":  "t1.updated",
+}
+
+const deliveryListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    webhook_delivery AS t1
+WHERE
+`
+
+const deliveryListSql = `
+SELECT
+    *
+FROM
+    webhook_delivery AS t1
+WHERE
+`
+
+// 添加发送记录
+func InsertAttempt(obj *Attempt) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 推送的发送记录
+func AttemptList(deliveryId int) ([]*Attempt, error) {
+	o := orm.NewOrm()
+
+	list := []*Attempt{}
+
+	if _, err := o.Raw(attemptListSql, deliveryId).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const attemptListSql = `
+SELECT
+    *
+FROM
+    webhook_attempt AS t1
+WHERE
+    t1.delivery_id = ?
+ORDER BY t1.id
+`
@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"strings"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/beego/ms304w-client/basis/errors"
+	"github.com/beego/ms304w-client/models/query"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+const (
+	// 停用
+	WEBHOOK_DISABLE = 0
+	// 启用
+	WEBHOOK_ENABLE = 1
+)
+
+// 订阅所有事件
+const ALL = "*"
+
+// webhook订阅
+type Webhook struct {
+	Id        int    `orm:"column(id);auto;pk" json:"id"`
+	Created   string `orm:"column(created)" json:"created"`
+	CreatedBy string `orm:"column(created_by)" json:"createdBy"`
+	// 名称
+	Name string `orm:"column(name)" json:"name"`
+	// 推送地址
+	Url string `orm:"column(url)" json:"url"`
+	// 事件类型,逗号分隔,*为所有
+	Events string `orm:"column(events)" json:"events"`
+	// 签名密钥
+	Secret string `orm:"column(secret)" json:"secret"`
+	// 状态0停用1启用
+	Status int `orm:"column(status);default(1)" json:"status"`
+	// 更新时间
+	Updated   string `orm:"column(updated)" json:"updated"`
+	UpdatedBy string `orm:"column(updated_by)" json:"updatedBy"`
+}
+
+func (t *Webhook) TableName() string {
+	return "webhook"
+}
+
+// 是否订阅事件
+func (t *Webhook) Match(topic string) bool {
+	for _, v := range strings.Split(t.Events, ",") {
+		v = strings.TrimSpace(v)
+		if v == ALL || v == topic {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 添加
+func InsertWebhook(obj *Webhook) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Insert(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 修改
+func UpdateWebhook(obj *Webhook) error {
+	o := orm.NewOrm()
+
+	if _, err := o.Update(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 删除
+func DelWebhook(id int) error {
+	o := orm.NewOrm()
+
+	obj := &Webhook{
+		Id: id,
+	}
+
+	if _, err := o.Delete(obj); err != nil {
+		return errors.As(err)
+	}
+
+	return nil
+}
+
+// 根据ID查询
+func WebhookById(id int) (*Webhook, error) {
+	o := orm.NewOrm()
+
+	obj := &Webhook{
+		Id: id,
+	}
+
+	if err := o.Read(obj); err != nil {
+		if err == orm.ErrNoRows {
+			return nil, errors.As(ErrWebhookNotFound)
+		}
+
+		return nil, errors.As(err)
+	}
+
+	return obj, nil
+}
+
+// 启用的webhook
+func EnableWebhooks() ([]*Webhook, error) {
+	o := orm.NewOrm()
+
+	list := []*Webhook{}
+
+	if _, err := o.Raw(enableWebhooksSql, WEBHOOK_ENABLE).QueryRows(&list); err != nil {
+		return nil, errors.As(err)
+	}
+
+	return list, nil
+}
+
+const enableWebhooksSql = `
+SELECT
+    *
+FROM
+    webhook AS t1
+WHERE
+    t1.status = ?
+`
+
+// 查询所有
+func WebhookList(where map[string]interface{}, page, pageSize int) (int64, []*Webhook, error) {
+	list := []*Webhook{}
+
+	f := query.New().
+		Search(where["name"], "t1.name").
+		Status("t1.status", where["status"]).
+		Sort(where["sort"], webhookSorts, "id:desc").
+		Cursor(where["cursor"])
+
+	total, err := f.Page(webhookListCountSql, webhookListSql, "", page, pageSize, &list)
+	if err != nil {
+		return -1, nil, errors.As(err)
+	}
+
+	return total, list, nil
+}
+
+// 可排序字段
+var webhookSorts = map[string]string{
+	"id":      "t1.id",
+	"created": "t1.created",
+	"name":    "t1.name",
+	"status":  "t1.status",
+	"updated": "t1.updated",
+}
+
+const webhookListCountSql = `
+SELECT
+    COUNT(*)
+FROM
+    webhook AS t1
+WHERE
+`
+
+const webhookListSql = `
+SELECT
+    *
+FROM
+    webhook AS t1
+WHERE
+`
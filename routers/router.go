@@ -30,6 +30,16 @@ func init() {
 			return true
 		}),
 
+		// 恢复备份时维护中
+		beego.NSBefore(func(ctx *context.Context) {
+			if controllers.Maintenance() && !strings.HasPrefix(ctx.Request.URL.Path, "/v1/backup") {
+				ctx.ResponseWriter.WriteHeader(503)
+				data := controllers.NewHttpResponse(503, nil, errors.New("Maintenance"))
+				ctx.WriteString(data.String())
+				return
+			}
+		}),
+
 		// 权限验证
 		beego.NSBefore(func(ctx *context.Context) {
 			oauth, err := beego.AppConfig.Bool("oauth")
@@ -37,8 +47,18 @@ func init() {
 				panic(err)
 			}
 
+			token := ctx.Request.Header.Get("Token")
+			// WebSocket和EventSource不能设置请求头
+			if len(token) == 0 && strings.HasPrefix(ctx.Request.URL.Path, "/v1/stream/") {
+				token = ctx.Input.Query("token")
+			}
+
+			// 登录身份,用于审计和操作人
+			if identity := controllers.OAuth.Identity(token); identity != nil {
+				ctx.Input.SetData(controllers.IdentityKey, identity)
+			}
+
 			if oauth {
-				token := ctx.Request.Header.Get("Token")
 				uri := ctx.Request.RequestURI
 				log.Info("uri: %s, token: %s", uri, token)
 
@@ -88,6 +108,11 @@ func init() {
 			beego.NSRouter("/login/card", &controllers.AccountController{}, "POST:LoginByCard"),
 			beego.NSRouter("/login/username", &controllers.AccountController{}, "POST:LoginByUsername"),
 			beego.NSRouter("/login/finger/:id:int", &controllers.AccountController{}, "GET:AccountByFinger"),
+			// finger
+			beego.NSRouter("/finger/enroll", &controllers.FingerController{}, "POST:StartEnroll"),
+			beego.NSRouter("/finger/enroll/:id:int", &controllers.FingerController{}, "GET:EnrollById"),
+			beego.NSRouter("/finger/enroll/confirm", &controllers.FingerController{}, "POST:ConfirmEnroll"),
+			beego.NSRouter("/finger/:accountId:int", &controllers.FingerController{}, "DELETE:DelFinger"),
 			beego.NSRouter("/user", &controllers.AccountController{}, "GET:AccountList"),
 			beego.NSRouter("/user/password", &controllers.AccountController{}, "PUT:EditPassword"),
 			// group
@@ -145,14 +170,26 @@ func init() {
 			beego.NSRouter("/group/:groupId:int/:materialId:int", &controllers.GroupMaterialController{}, "DELETE:DelGroupMaterial"),
 			beego.NSRouter("/group", &controllers.GroupMaterialController{}, "GET:MaterialByGroupId"),
 
-			/*
-				// rel_material_rfid
-				beego.NSRouter("/rfid", &controllers.MaterialRfidController{}, "POST:AddMaterialRfid"),
-				beego.NSRouter("/rfid", &controllers.MaterialRfidController{}, "PUT:EditMaterialRfid"),
-				beego.NSRouter("/rfid/:id:int", &controllers.MaterialRfidController{}, "DELETE:DelMaterialRfid"),
-				beego.NSRouter("/rfid/:rfid:string", &controllers.MaterialRfidController{}, "GET:MaterialByRfid"),
-				beego.NSRouter("/rfid", &controllers.MaterialRfidController{}, "GET:MaterialRfidList"),
-			*/
+			// rel_material_rfid
+			beego.NSRouter("/rfid", &controllers.MaterialRfidController{}, "POST:AddMaterialRfid"),
+			beego.NSRouter("/rfid", &controllers.MaterialRfidController{}, "PUT:EditMaterialRfid"),
+			beego.NSRouter("/rfid/:id:int", &controllers.MaterialRfidController{}, "DELETE:DelMaterialRfid"),
+			beego.NSRouter("/rfid/:rfid:string", &controllers.MaterialRfidController{}, "GET:MaterialByRfid"),
+			beego.NSRouter("/rfid", &controllers.MaterialRfidController{}, "GET:MaterialRfidList"),
+
+			// rel_material_fusion
+			beego.NSRouter("/fusion", &controllers.FusionController{}, "POST:AddFusion"),
+			beego.NSRouter("/fusion/:materialId:int", &controllers.FusionController{}, "GET:FusionByMaterialId"),
+			beego.NSRouter("/fusion/:materialId:int", &controllers.FusionController{}, "DELETE:DelFusion"),
+
+			// rel_material_substitute
+			beego.NSRouter("/substitute", &controllers.SubstituteController{}, "POST:AddSubstitute"),
+			beego.NSRouter("/substitute", &controllers.SubstituteController{}, "PUT:EditSubstitute"),
+			beego.NSRouter("/substitute/:id:int", &controllers.SubstituteController{}, "DELETE:DelSubstitute"),
+			beego.NSRouter("/substitute", &controllers.SubstituteController{}, "GET:SubstituteList"),
+			// 领料订单的替代记录
+			beego.NSRouter("/substitution", &controllers.SubstituteController{}, "GET:SubstitutionList"),
+			beego.NSRouter("/substitution/:orderId:int", &controllers.SubstituteController{}, "GET:SubstitutionByOrderId"),
 		),
 
 		// --------------------------
@@ -169,7 +206,6 @@ func init() {
 			// beego.NSRouter("/material/:materialId:int/:sensorId:int", &controllers.SensorController{}, "GET:SensorByMaterialId"),
 		),
 
-
 		// --------------------------
 		// Stock
 		beego.NSNamespace("/stock",
@@ -191,6 +227,8 @@ func init() {
 			beego.NSRouter("/material", &controllers.StockController{}, "GET:MaterialStockList"),
 			// 组物料库存
 			beego.NSRouter("/material/group", &controllers.StockController{}, "GET:GroupStockList"),
+			// 物料和替代物料的合计可用数量
+			beego.NSRouter("/availability/:materialId:int", &controllers.SubstituteController{}, "GET:Availability"),
 			// 根据物料ID查询格子
 			// 优先已存在相同物料格子
 			beego.NSRouter("/grid/:materialId:int", &controllers.StockController{}, "GET:GridByMaterialId"),
@@ -198,32 +236,31 @@ func init() {
 			beego.NSRouter("/auto", &controllers.StockController{}, "POST:Auto"),
 			// 查询
 			beego.NSRouter("/auto", &controllers.StockController{}, "GET:AutoList"),
+			// 多传感器结算
+			beego.NSRouter("/settle", &controllers.FusionController{}, "GET:SettleList"),
+			beego.NSRouter("/settle/:orderId:int", &controllers.FusionController{}, "GET:SettleByOrderId"),
+			// 手工调整
+			beego.NSRouter("/adjust", &controllers.AdjustController{}, "POST:AddAdjustment"),
+			beego.NSRouter("/adjust", &controllers.AdjustController{}, "GET:AdjustmentList"),
+			beego.NSRouter("/adjust/:id:int", &controllers.AdjustController{}, "GET:AdjustmentById"),
+			// 格子间调拨
+			beego.NSRouter("/transfer", &controllers.AdjustController{}, "POST:AddTransfer"),
+			beego.NSRouter("/transfer", &controllers.AdjustController{}, "GET:TransferList"),
+			beego.NSRouter("/transfer/:id:int", &controllers.AdjustController{}, "GET:TransferById"),
 		),
 
-		/*
-			// --------------------------
-			// RFID
-			beego.NSNamespace("/rfid",
-				// 入库单
-				beego.NSRouter("/in", &controllers.StockRfidController{}, "POST:StockIn"),
-				// 入库单确认
-				beego.NSRouter("/in/confirm", &controllers.StockRfidController{}, "POST:StockInConfirm"),
-				// 出库单
-				beego.NSRouter("/out", &controllers.StockRfidController{}, "POST:StockOut"),
-				// 出库单确认
-				beego.NSRouter("/out/confirm", &controllers.StockRfidController{}, "POST:StockOutConfirm"),
-				// 回收单
-				beego.NSRouter("/recycle", &controllers.StockRfidController{}, "POST:StockRecycle"),
-				// 回收单确认
-				beego.NSRouter("/recycle/confirm", &controllers.StockRfidController{}, "POST:StockRecycleConfirm"),
-				// 库存
-				beego.NSRouter("/stock", &controllers.StockRfidController{}, "GET:StockList"),
-				// 根据用户查询订单
-				beego.NSRouter("/order", &controllers.StockRfidController{}, "GET:OrderList"),
-				// 待回收列表
-				// beego.NSRouter("/recycle", &controllers.StockRfidController{}, "GET:RecycleList"),
-			),
-		*/
+		// --------------------------
+		// RFID
+		beego.NSNamespace("/rfid",
+			// 开门,关门后按标签对账
+			beego.NSRouter("/open", &controllers.StockRfidController{}, "POST:Open"),
+			// 开关门记录
+			beego.NSRouter("/session/:id:int", &controllers.StockRfidController{}, "GET:SessionById"),
+			// 标签库存
+			beego.NSRouter("/stock", &controllers.StockRfidController{}, "GET:StockList"),
+			// 标签出入记录
+			beego.NSRouter("/record", &controllers.StockRfidController{}, "GET:RecordList"),
+		),
 
 		// --------------------------
 		// Code
@@ -309,6 +346,175 @@ func init() {
 			beego.NSRouter("/qrcode", &controllers.CallbackController{}, "POST:Qrcode"),
 			// 指纹
 			beego.NSRouter("/finger", &controllers.CallbackController{}, "POST:Finger"),
+			// 关门标签
+			beego.NSRouter("/rfid", &controllers.CallbackController{}, "POST:Rfid"),
+			// 关门多传感器
+			beego.NSRouter("/sensor", &controllers.CallbackController{}, "POST:Sensor"),
+		),
+
+		// --------------------------
+		// Socket
+		beego.NSNamespace("/socket",
+			// 事件定义
+			beego.NSRouter("/schema", &controllers.SocketController{}, "GET:Schema"),
+		),
+
+		// --------------------------
+		// Stream
+		beego.NSNamespace("/stream",
+			beego.NSRouter("/ws", &controllers.StreamController{}, "GET:WebSocket"),
+			beego.NSRouter("/sse", &controllers.StreamController{}, "GET:Sse"),
+		),
+
+		// --------------------------
+		// Webhook
+		beego.NSNamespace("/webhook",
+			beego.NSRouter("/", &controllers.WebhookController{}, "POST:AddWebhook"),
+			beego.NSRouter("/", &controllers.WebhookController{}, "PUT:EditWebhook"),
+			beego.NSRouter("/:id:int", &controllers.WebhookController{}, "DELETE:DelWebhook"),
+			beego.NSRouter("/:id:int", &controllers.WebhookController{}, "GET:WebhookById"),
+			beego.NSRouter("/", &controllers.WebhookController{}, "GET:WebhookList"),
+			// 推送记录
+			beego.NSRouter("/delivery", &controllers.WebhookController{}, "GET:DeliveryList"),
+			beego.NSRouter("/delivery/:id:int", &controllers.WebhookController{}, "GET:DeliveryById"),
+			beego.NSRouter("/delivery/:id:int/retry", &controllers.WebhookController{}, "POST:RetryDelivery"),
+		),
+
+		// --------------------------
+		// Box
+		beego.NSNamespace("/box",
+			beego.NSRouter("/", &controllers.BoxController{}, "POST:AddBox"),
+			beego.NSRouter("/", &controllers.BoxController{}, "PUT:EditBox"),
+			beego.NSRouter("/:id:int", &controllers.BoxController{}, "DELETE:DelBox"),
+			beego.NSRouter("/:id:int", &controllers.BoxController{}, "GET:BoxById"),
+			beego.NSRouter("/", &controllers.BoxController{}, "GET:BoxList"),
+			// 健康状态
+			beego.NSRouter("/health", &controllers.BoxController{}, "GET:Health"),
+			beego.NSRouter("/health/:addr:int", &controllers.BoxController{}, "GET:HealthByAddr"),
+		),
+
+		// --------------------------
+		// Cost
+		beego.NSNamespace("/cost",
+			// 供应商价格
+			beego.NSRouter("/supplier", &controllers.CostController{}, "POST:AddSupplierCost"),
+			beego.NSRouter("/supplier", &controllers.CostController{}, "PUT:EditSupplierCost"),
+			beego.NSRouter("/supplier/:id:int", &controllers.CostController{}, "DELETE:DelSupplierCost"),
+			beego.NSRouter("/supplier", &controllers.CostController{}, "GET:SupplierCostList"),
+			// 成本层
+			beego.NSRouter("/layer", &controllers.CostController{}, "GET:LayerList"),
+			beego.NSRouter("/layer", &controllers.CostController{}, "PUT:EditLayer"),
+			// 订单成本
+			beego.NSRouter("/order", &controllers.CostController{}, "GET:OrderCostList"),
+			// 库存金额
+			beego.NSRouter("/valuation", &controllers.CostController{}, "GET:Valuation"),
+		),
+
+		// --------------------------
+		// CostCenter
+		beego.NSNamespace("/costcenter",
+			beego.NSRouter("/", &controllers.CostCenterController{}, "POST:AddCostCenter"),
+			beego.NSRouter("/", &controllers.CostCenterController{}, "PUT:EditCostCenter"),
+			beego.NSRouter("/:id:int", &controllers.CostCenterController{}, "DELETE:DelCostCenter"),
+			beego.NSRouter("/", &controllers.CostCenterController{}, "GET:CostCenterList"),
+			// 组或用户的默认成本中心
+			beego.NSRouter("/assign", &controllers.CostCenterController{}, "POST:AddAssign"),
+			beego.NSRouter("/assign/:id:int", &controllers.CostCenterController{}, "DELETE:DelAssign"),
+			beego.NSRouter("/assign", &controllers.CostCenterController{}, "GET:AssignList"),
+			// 工单
+			beego.NSRouter("/workorder", &controllers.CostCenterController{}, "POST:AddWorkOrder"),
+			beego.NSRouter("/workorder", &controllers.CostCenterController{}, "PUT:EditWorkOrder"),
+			beego.NSRouter("/workorder/:id:int", &controllers.CostCenterController{}, "DELETE:DelWorkOrder"),
+			beego.NSRouter("/workorder", &controllers.CostCenterController{}, "GET:WorkOrderList"),
+			// 领料记账
+			beego.NSRouter("/charge", &controllers.CostCenterController{}, "GET:ChargeList"),
+		),
+
+		// --------------------------
+		// Forecast
+		beego.NSNamespace("/forecast",
+			// 预览安全库存和订货点建议
+			beego.NSRouter("/", &controllers.ForecastController{}, "GET:Preview"),
+			beego.NSRouter("/apply", &controllers.ForecastController{}, "POST:Apply"),
+		),
+
+		// --------------------------
+		// Report
+		beego.NSNamespace("/report",
+			beego.NSRouter("/", &controllers.ReportController{}, "GET:ReportList"),
+			// 导出csv/xlsx
+			beego.NSRouter("/:name", &controllers.ReportController{}, "GET:Export"),
+		),
+
+		// --------------------------
+		// Sync
+		beego.NSNamespace("/sync",
+			beego.NSRouter("/status", &controllers.SyncController{}, "GET:Status"),
+			beego.NSRouter("/run", &controllers.SyncController{}, "POST:Run"),
+			beego.NSRouter("/outbox", &controllers.SyncController{}, "GET:OutboxList"),
+			beego.NSRouter("/conflict", &controllers.SyncController{}, "GET:ConflictList"),
+		),
+
+		// --------------------------
+		// Metrics
+		beego.NSNamespace("/metrics",
+			beego.NSRouter("/events", &controllers.MetricsController{}, "GET:Events"),
+		),
+
+		// --------------------------
+		// Inspection
+		beego.NSNamespace("/inspection",
+			beego.NSRouter("/", &controllers.InspectController{}, "GET:InspectionList"),
+			beego.NSRouter("/:id:int", &controllers.InspectController{}, "GET:InspectionById"),
+			// 检验回收,入库或报废
+			beego.NSRouter("/:id:int", &controllers.InspectController{}, "POST:Inspect"),
+		),
+
+		// --------------------------
+		// Kit
+		beego.NSNamespace("/kit",
+			beego.NSRouter("/", &controllers.KitController{}, "POST:AddKit"),
+			beego.NSRouter("/", &controllers.KitController{}, "PUT:EditKit"),
+			beego.NSRouter("/:id:int", &controllers.KitController{}, "DELETE:DelKit"),
+			beego.NSRouter("/:id:int", &controllers.KitController{}, "GET:KitById"),
+			beego.NSRouter("/", &controllers.KitController{}, "GET:KitList"),
+			// 预览领取计划和缺料
+			beego.NSRouter("/:id:int/plan", &controllers.KitController{}, "POST:Plan"),
+			// 领取套件
+			beego.NSRouter("/:id:int/pick", &controllers.KitController{}, "POST:PickKit"),
+			beego.NSRouter("/pick", &controllers.KitController{}, "GET:PickList"),
+			beego.NSRouter("/pick/:id:int", &controllers.KitController{}, "GET:PickById"),
+		),
+
+		// --------------------------
+		// Ledger
+		beego.NSNamespace("/ledger",
+			beego.NSRouter("/", &controllers.LedgerController{}, "GET:MovementList"),
+			beego.NSRouter("/:id:int", &controllers.LedgerController{}, "GET:MovementById"),
+			// 某一时刻的库存
+			beego.NSRouter("/balance", &controllers.LedgerController{}, "GET:Balance"),
+			// 用台账校验库存
+			beego.NSRouter("/verify", &controllers.LedgerController{}, "GET:Verify"),
+		),
+
+		// --------------------------
+		// Backup
+		beego.NSNamespace("/backup",
+			beego.NSRouter("/", &controllers.BackupController{}, "GET:BackupList"),
+			beego.NSRouter("/", &controllers.BackupController{}, "POST:AddBackup"),
+			// 恢复时进入维护模式
+			beego.NSRouter("/restore", &controllers.BackupController{}, "POST:RestoreBackup"),
+			// 检查数据库完整性
+			beego.NSRouter("/check", &controllers.BackupController{}, "GET:CheckBackup"),
+		),
+
+		// --------------------------
+		// Audit
+		beego.NSNamespace("/audit",
+			beego.NSRouter("/", &controllers.AuditController{}, "GET:AuditList"),
+			beego.NSRouter("/:id:int", &controllers.AuditController{}, "GET:AuditById"),
+			// 校验哈希链
+			beego.NSRouter("/verify", &controllers.AuditController{}, "GET:AuditVerify"),
 		),
 
 		// --------------------------